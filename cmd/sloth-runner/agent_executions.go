@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultDrainGracePeriod is how long a stopping agent lets in-flight tasks
+// finish before it cancels them.
+const defaultDrainGracePeriod = 30 * time.Second
+
+// drainCancelWait bounds how long a draining agent waits for cancelled tasks
+// to report before it stops serving.
+const drainCancelWait = 10 * time.Second
+
+// errAgentDraining rejects work submitted to an agent that is shutting down.
+var errAgentDraining = status.Error(codes.Unavailable, "agent is shutting down")
+
+// executionTracker keeps the tasks and commands running on an agent, so they
+// can be cancelled by execution ID and drained when the agent stops.
+type executionTracker struct {
+	mu       sync.Mutex
+	cancels  map[string]context.CancelFunc
+	draining bool
+	wg       sync.WaitGroup
+}
+
+// newExecutionTracker creates a new executionTracker.
+func newExecutionTracker() *executionTracker {
+	return &executionTracker{cancels: make(map[string]context.CancelFunc)}
+}
+
+// start registers an execution. The returned context is cancelled by cancel,
+// by drain or when parent is done; done must be called when the execution finishes.
+// An empty id gets a random one.
+func (e *executionTracker) start(parent context.Context, id string) (context.Context, func(), error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.draining {
+		return nil, nil, errAgentDraining
+	}
+	if id == "" {
+		id = uuid.New().String()
+	}
+	if _, ok := e.cancels[id]; ok {
+		return nil, nil, status.Errorf(codes.AlreadyExists, "execution %s is already running", id)
+	}
+	// A caller that goes away or times out cancels the execution, which is
+	// then reported as Cancelled rather than as timed out on the agent.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	stop := context.AfterFunc(parent, cancel)
+	e.cancels[id] = cancel
+	e.wg.Add(1)
+	done := func() {
+		e.mu.Lock()
+		delete(e.cancels, id)
+		e.mu.Unlock()
+		stop()
+		cancel()
+		e.wg.Done()
+	}
+	return ctx, done, nil
+}
+
+// cancel cancels execution id and reports whether it was running.
+func (e *executionTracker) cancel(id string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	cancel, ok := e.cancels[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// count returns the number of running executions.
+func (e *executionTracker) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.cancels)
+}
+
+// isDraining reports whether drain was called.
+func (e *executionTracker) isDraining() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.draining
+}
+
+// drain stops accepting executions and waits up to grace for the running
+// ones to finish. Those still running afterwards are cancelled. It returns
+// the number of cancelled executions.
+func (e *executionTracker) drain(grace time.Duration) int {
+	e.mu.Lock()
+	e.draining = true
+	e.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return 0
+	case <-time.After(grace):
+	}
+
+	e.mu.Lock()
+	cancelled := len(e.cancels)
+	for _, cancel := range e.cancels {
+		cancel()
+	}
+	e.mu.Unlock()
+	select {
+	case <-finished:
+	case <-time.After(drainCancelWait):
+	}
+	return cancelled
+}
+
+func (s *agentServer) CancelTask(ctx context.Context, in *pb.CancelTaskRequest) (*pb.CancelTaskResponse, error) {
+	cancelled := s.executions.cancel(in.GetExecutionId())
+	if cancelled {
+		slog.Warn(fmt.Sprintf("Cancelling execution %s at the caller's request", in.GetExecutionId()))
+	}
+	return &pb.CancelTaskResponse{Cancelled: cancelled}, nil
+}
+
+// shutdown drains the agent and stops its gRPC server.
+func (s *agentServer) shutdown(grace time.Duration) {
+	slog.Info(fmt.Sprintf("Draining agent: waiting up to %s for %d running task(s)", grace, s.executions.count()))
+	if n := s.executions.drain(grace); n > 0 {
+		slog.Warn(fmt.Sprintf("Cancelled %d task(s) still running after the grace period", n))
+	}
+	s.grpcServer.GracefulStop()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutionTrackerCancel(t *testing.T) {
+	e := newExecutionTracker()
+	ctx, done, err := e.start(context.Background(), "exec-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, e.count())
+
+	_, _, err = e.start(context.Background(), "exec-1")
+	assert.Error(t, err, "execution IDs must be unique")
+
+	assert.False(t, e.cancel("unknown"))
+	assert.True(t, e.cancel("exec-1"))
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	done()
+	assert.Equal(t, 0, e.count())
+}
+
+func TestExecutionTrackerDrain(t *testing.T) {
+	e := newExecutionTracker()
+
+	// Finishes within the grace period
+	_, quick, err := e.start(context.Background(), "")
+	assert.NoError(t, err)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		quick()
+	}()
+	assert.Equal(t, 0, e.drain(time.Second))
+
+	_, _, err = e.start(context.Background(), "")
+	assert.ErrorIs(t, err, errAgentDraining)
+
+	// Outlives the grace period and is cancelled
+	e = newExecutionTracker()
+	ctx, done, err := e.start(context.Background(), "")
+	assert.NoError(t, err)
+	go func() {
+		<-ctx.Done()
+		done()
+	}()
+	assert.Equal(t, 1, e.drain(20*time.Millisecond))
+}
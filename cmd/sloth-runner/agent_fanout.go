@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/pterm/pterm"
+)
+
+// formatLabels renders labels as a stable, comma-separated key=value list.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// matchesSelector reports whether the labels contain every key=value pair in selector.
+func matchesSelector(labels, selector map[string]string) bool {
+	for key, value := range selector {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// selectAgents returns the names of the active agents that match the
+// selector (or all active agents when selector is nil), sorted by name.
+// Matching agents that are not active are returned separately.
+func selectAgents(agents []*pb.AgentInfo, selector map[string]string) (active, inactive []string) {
+	for _, agent := range agents {
+		if selector != nil && !matchesSelector(agent.GetLabels(), selector) {
+			continue
+		}
+		if agent.GetStatus() == agentStatusActive {
+			active = append(active, agent.GetAgentName())
+		} else {
+			inactive = append(inactive, agent.GetAgentName())
+		}
+	}
+	sort.Strings(active)
+	sort.Strings(inactive)
+	return active, inactive
+}
+
+// fanOutOptions controls how a command is rolled out across agents.
+type fanOutOptions struct {
+	Parallelism int  // Maximum number of agents running the command at once
+	BatchSize   int  // Agents per rolling batch; 0 runs everything as one batch
+	FailFast    bool // Stop starting new agents after the first failure
+}
+
+// fanOutResult is the outcome of a command on a single agent.
+type fanOutResult struct {
+	Agent    string        `json:"agent"`
+	Status   string        `json:"status"` // Success, Failed or Skipped
+	ExitCode int32         `json:"exit_code"`
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// runFanOut runs execute for every agent according to opts and returns the
+// results in the same order as agents. Agents that were never started
+// because of fail-fast are reported as Skipped.
+func runFanOut(ctx context.Context, agents []string, opts fanOutOptions, execute func(ctx context.Context, agent string) fanOutResult) []fanOutResult {
+	results := make([]fanOutResult, len(agents))
+	for i, agent := range agents {
+		results[i] = fanOutResult{Agent: agent, Status: "Skipped", ExitCode: -1}
+	}
+
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(agents)
+	}
+
+	var mu sync.Mutex
+	failed := false
+
+	for start := 0; start < len(agents); start += batchSize {
+		end := start + batchSize
+		if end > len(agents) {
+			end = len(agents)
+		}
+
+		sem := make(chan struct{}, parallelism)
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			sem <- struct{}{}
+			mu.Lock()
+			stop := opts.FailFast && failed
+			mu.Unlock()
+			if stop || ctx.Err() != nil {
+				<-sem
+				break
+			}
+
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				startTime := time.Now()
+				result := execute(ctx, agents[i])
+				result.Agent = agents[i]
+				result.Duration = time.Since(startTime)
+				mu.Lock()
+				results[i] = result
+				if result.Status != "Success" {
+					failed = true
+				}
+				mu.Unlock()
+			}(i)
+		}
+		wg.Wait()
+
+		if opts.FailFast && failed {
+			break
+		}
+	}
+	return results
+}
+
+// executeOnAgent runs a command on one agent through the master.
+func executeOnAgent(ctx context.Context, client pb.AgentRegistryClient, agent, command string) fanOutResult {
+	resp, err := client.ExecuteCommand(ctx, &pb.ExecuteCommandRequest{AgentName: agent, Command: command})
+	if err != nil {
+		return fanOutResult{Status: "Failed", ExitCode: -1, Error: err.Error()}
+	}
+	result := fanOutResult{
+		Status:   "Success",
+		ExitCode: resp.GetExitCode(),
+		Stdout:   resp.GetStdout(),
+		Stderr:   resp.GetStderr(),
+	}
+	if !resp.GetSuccess() {
+		result.Status = "Failed"
+		result.Error = resp.GetError()
+	}
+	return result
+}
+
+// renderFanOutResults prints the aggregated results as a table or as JSON.
+func renderFanOutResults(w io.Writer, results []fanOutResult, output string) error {
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "AGENT\tSTATUS\tEXIT CODE\tDURATION\tSTDOUT\tSTDERR")
+	fmt.Fprintln(tw, "-----\t------\t---------\t--------\t------\t------")
+	for _, r := range results {
+		status := pterm.Green(r.Status)
+		switch r.Status {
+		case "Failed":
+			status = pterm.Red(r.Status)
+		case "Skipped":
+			status = pterm.Yellow(r.Status)
+		}
+		stderr := summarizeOutput(r.Stderr)
+		if r.Error != "" && r.Stderr == "" {
+			stderr = summarizeOutput(r.Error)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", r.Agent, status, r.ExitCode, r.Duration.Round(time.Millisecond), summarizeOutput(r.Stdout), stderr)
+	}
+	return tw.Flush()
+}
+
+// summarizeOutput keeps the last non-empty line of a command output so it fits in a table cell.
+func summarizeOutput(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if len(lines) > 1 {
+		last = fmt.Sprintf("%s (+%d lines)", last, len(lines)-1)
+	}
+	if len(last) > 60 {
+		last = last[:57] + "..."
+	}
+	return last
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/labels"
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectAgents(t *testing.T) {
+	agents := []*pb.AgentInfo{
+		{AgentName: "web2", Status: "Active", Labels: map[string]string{"role": "web", "env": "prod"}},
+		{AgentName: "web1", Status: "Active", Labels: map[string]string{"role": "web", "env": "prod"}},
+		{AgentName: "web3", Status: "Inactive", Labels: map[string]string{"role": "web", "env": "prod"}},
+		{AgentName: "db1", Status: "Active", Labels: map[string]string{"role": "db", "env": "prod"}},
+	}
+
+	selector, err := labels.ParseSelector("role=web, env=prod")
+	assert.NoError(t, err)
+	active, inactive := selectAgents(agents, selector)
+	assert.Equal(t, []string{"web1", "web2"}, active)
+	assert.Equal(t, []string{"web3"}, inactive)
+
+	active, _ = selectAgents(agents, nil)
+	assert.Equal(t, []string{"db1", "web1", "web2"}, active)
+
+	_, err = labels.ParseSelector("role")
+	assert.Error(t, err)
+}
+
+func TestRunFanOutRollingBatchesRespectParallelism(t *testing.T) {
+	agents := []string{"a1", "a2", "a3", "a4", "a5"}
+	var running, maxRunning int32
+	results := runFanOut(context.Background(), agents, fanOutOptions{Parallelism: 2, BatchSize: 3}, func(ctx context.Context, agent string) fanOutResult {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return fanOutResult{Status: "Success", Stdout: agent}
+	})
+
+	assert.Len(t, results, 5)
+	assert.LessOrEqual(t, maxRunning, int32(2))
+	for i, r := range results {
+		assert.Equal(t, agents[i], r.Agent)
+		assert.Equal(t, "Success", r.Status)
+	}
+}
+
+func TestRunFanOutFailFastSkipsLaterBatches(t *testing.T) {
+	agents := []string{"a1", "a2", "a3", "a4"}
+	results := runFanOut(context.Background(), agents, fanOutOptions{Parallelism: 1, BatchSize: 2, FailFast: true}, func(ctx context.Context, agent string) fanOutResult {
+		if agent == "a1" {
+			return fanOutResult{Status: "Failed", ExitCode: 3}
+		}
+		return fanOutResult{Status: "Success"}
+	})
+
+	assert.Equal(t, "Failed", results[0].Status)
+	assert.Equal(t, int32(3), results[0].ExitCode)
+	for _, r := range results[1:] {
+		assert.Equal(t, "Skipped", r.Status)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chalkan3/sloth-runner/internal/workspace"
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// agentPath resolves a path received from a client. Relative paths are
+// relative to the agent's home directory, like scp, or to the policy's
+// workdir, outside of which nothing may be copied.
+func (s *agentServer) agentPath(path string) (string, error) {
+	if path == "" {
+		return "", status.Error(codes.InvalidArgument, "path is required")
+	}
+	if !filepath.IsAbs(path) {
+		base := ""
+		if s.policy != nil && s.policy.Workdir != "" {
+			base = s.policy.Workdir
+		} else {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("failed to get user home directory: %w", err)
+			}
+			base = home
+		}
+		path = filepath.Join(base, path)
+	}
+	path = filepath.Clean(path)
+	if err := s.policy.checkPath(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// receiveFile writes the chunks returned by recv to path, or to name inside
+// path when path is a directory. The file is written to a temporary file
+// first and renamed into place, so readers never see a partial file.
+func receiveFile(path, name string, mode os.FileMode, first []byte, recv func() ([]byte, error)) (string, int64, error) {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		if name == "" {
+			return "", 0, fmt.Errorf("%s is a directory", path)
+		}
+		path = filepath.Join(path, filepath.Base(name))
+	}
+	if mode == 0 {
+		mode = 0644
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written := int64(0)
+	data := first
+	for {
+		if len(data) > 0 {
+			n, err := tmp.Write(data)
+			written += int64(n)
+			if err != nil {
+				tmp.Close()
+				return "", written, fmt.Errorf("failed to write %s: %w", path, err)
+			}
+		}
+		data, err = recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			tmp.Close()
+			return "", written, err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return "", written, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), mode.Perm()); err != nil {
+		return "", written, fmt.Errorf("failed to set mode of %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", written, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, written, nil
+}
+
+// sendFile streams the file at path in chunks; the first chunk carries its mode.
+func sendFile(path string, send func(*pb.FileChunk) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+
+	chunk := &pb.FileChunk{Path: path, Mode: uint32(fi.Mode().Perm())}
+	buf := make([]byte, workspace.ChunkSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			chunk.Data = buf[:n]
+			if err := send(chunk); err != nil {
+				return err
+			}
+			chunk = &pb.FileChunk{}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if chunk.GetPath() != "" {
+		return send(chunk) // Empty file
+	}
+	return nil
+}
+
+func (s *agentServer) PutFile(stream pb.Agent_PutFileServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	path, err := s.agentPath(first.GetPath())
+	if err != nil {
+		return err
+	}
+	written, n, err := receiveFile(path, first.GetName(), os.FileMode(first.GetMode()), first.GetData(), func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.GetData(), nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.policy.chownToRunAs(written); err != nil {
+		os.Remove(written)
+		return fmt.Errorf("failed to give %s to the run_as user: %w", written, err)
+	}
+	slog.Info(fmt.Sprintf("Received file %s (%d bytes)", written, n))
+	return stream.SendAndClose(&pb.PutFileResponse{Path: written, BytesWritten: n})
+}
+
+func (s *agentServer) GetFile(in *pb.GetFileRequest, stream pb.Agent_GetFileServer) error {
+	path, err := s.agentPath(in.GetPath())
+	if err != nil {
+		return err
+	}
+	slog.Info(fmt.Sprintf("Sending file %s", path))
+	return sendFile(path, stream.Send)
+}
+
+// PutAgentFile relays an upload to the agent named in its first chunk.
+func (s *agentRegistryServer) PutAgentFile(stream pb.AgentRegistry_PutAgentFileServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	client, conn, err := s.dialAgent(first.GetAgentName())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	pterm.Info.Printf("Copying file to agent %s:%s\n", first.GetAgentName(), first.GetPath())
+	agentStream, err := client.PutFile(stream.Context())
+	if err != nil {
+		return fmt.Errorf("failed to copy file to agent: %v", err)
+	}
+	for chunk := first; ; {
+		if err := agentStream.Send(chunk); err != nil {
+			break // The agent's error is returned by CloseAndRecv
+		}
+		chunk, err = stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	resp, err := agentStream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(resp)
+}
+
+// GetAgentFile relays a download from an agent.
+func (s *agentRegistryServer) GetAgentFile(in *pb.GetFileRequest, stream pb.AgentRegistry_GetAgentFileServer) error {
+	client, conn, err := s.dialAgent(in.GetAgentName())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	pterm.Info.Printf("Copying file from agent %s:%s\n", in.GetAgentName(), in.GetPath())
+	agentStream, err := client.GetFile(stream.Context(), in)
+	if err != nil {
+		return fmt.Errorf("failed to copy file from agent: %v", err)
+	}
+	for {
+		chunk, err := agentStream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+	}
+}
+
+// parseCopyTarget splits an `agent cp` argument of the form <agent>:<path>.
+// Arguments without an agent name, or whose colon comes after a slash, are
+// local paths.
+func parseCopyTarget(arg string) (agentName, path string) {
+	i := strings.Index(arg, ":")
+	if i <= 0 || strings.Contains(arg[:i], "/") {
+		return "", arg
+	}
+	return arg[:i], arg[i+1:]
+}
+
+// runAgentCopy copies a file between this host and an agent, in the direction
+// given by which argument names an agent.
+func runAgentCopy(cmd *cobra.Command, src, dst string) error {
+	srcAgent, srcPath := parseCopyTarget(src)
+	dstAgent, dstPath := parseCopyTarget(dst)
+	if (srcAgent == "") == (dstAgent == "") {
+		return fmt.Errorf("exactly one of the source and destination must be <agent>:<path>")
+	}
+
+	conn, err := dialMaster(cmd)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	registryClient := pb.NewAgentRegistryClient(conn)
+
+	if dstAgent != "" {
+		stream, err := registryClient.PutAgentFile(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to copy to agent %s: %v", dstAgent, err)
+		}
+		err = sendFile(srcPath, func(chunk *pb.FileChunk) error {
+			if chunk.GetPath() != "" {
+				chunk.AgentName, chunk.Path, chunk.Name = dstAgent, dstPath, filepath.Base(srcPath)
+				if chunk.Path == "" {
+					chunk.Path = "." // Agent's home directory
+				}
+			}
+			return stream.Send(chunk)
+		})
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to copy %s: %v", srcPath, err)
+		}
+		resp, err := stream.CloseAndRecv()
+		if err != nil {
+			return fmt.Errorf("failed to copy to agent %s: %v", dstAgent, err)
+		}
+		fmt.Printf("Copied %s to %s:%s (%d bytes)\n", srcPath, dstAgent, resp.GetPath(), resp.GetBytesWritten())
+		return nil
+	}
+
+	stream, err := registryClient.GetAgentFile(context.Background(), &pb.GetFileRequest{AgentName: srcAgent, Path: srcPath})
+	if err != nil {
+		return fmt.Errorf("failed to copy from agent %s: %v", srcAgent, err)
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("failed to copy from agent %s: %v", srcAgent, err)
+	}
+	written, n, err := receiveFile(dstPath, filepath.Base(srcPath), os.FileMode(first.GetMode()), first.GetData(), func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.GetData(), nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy from agent %s: %v", srcAgent, err)
+	}
+	fmt.Printf("Copied %s:%s to %s (%d bytes)\n", srcAgent, srcPath, written, n)
+	return nil
+}
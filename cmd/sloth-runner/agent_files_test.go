@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCopyTarget(t *testing.T) {
+	for arg, want := range map[string][2]string{
+		"web1:/etc/hosts": {"web1", "/etc/hosts"},
+		"web1:":           {"web1", ""},
+		"./build/app":     {"", "./build/app"},
+		"dir/file:v2":     {"", "dir/file:v2"},
+		":weird":          {"", ":weird"},
+		"/abs/path":       {"", "/abs/path"},
+	} {
+		agentName, path := parseCopyTarget(arg)
+		assert.Equal(t, want, [2]string{agentName, path}, arg)
+	}
+}
+
+func TestSendReceiveFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "app.sh")
+	content := bytes.Repeat([]byte("x"), 3<<20+17) // Spans several chunks
+	assert.NoError(t, ioutil.WriteFile(src, content, 0755))
+
+	var chunks []*pb.FileChunk
+	assert.NoError(t, sendFile(src, func(c *pb.FileChunk) error {
+		chunks = append(chunks, &pb.FileChunk{Path: c.Path, Mode: c.Mode, Data: append([]byte(nil), c.Data...)})
+		return nil
+	}))
+	assert.Greater(t, len(chunks), 1)
+	assert.Equal(t, uint32(0755), chunks[0].Mode)
+
+	// Copying into a directory keeps the file name
+	dest := filepath.Join(dir, "dest")
+	assert.NoError(t, os.Mkdir(dest, 0755))
+	i := 1
+	written, n, err := receiveFile(dest, "app.sh", os.FileMode(chunks[0].Mode), chunks[0].Data, func() ([]byte, error) {
+		if i == len(chunks) {
+			return nil, io.EOF
+		}
+		i++
+		return chunks[i-1].Data, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dest, "app.sh"), written)
+	assert.Equal(t, int64(len(content)), n)
+
+	got, err := ioutil.ReadFile(written)
+	assert.NoError(t, err)
+	assert.Equal(t, content, got)
+	fi, err := os.Stat(written)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), fi.Mode().Perm())
+
+	entries, _ := ioutil.ReadDir(dest)
+	assert.Len(t, entries, 1, "no temporary files are left behind")
+}
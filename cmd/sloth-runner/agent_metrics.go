@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/pterm/pterm"
+)
+
+// collectAgentMetrics takes the health snapshot an agent sends with its
+// heartbeats. Values the platform cannot provide are left at zero.
+func collectAgentMetrics(s *agentServer, diskPath string) *pb.AgentMetrics {
+	metrics := &pb.AgentMetrics{RunningTasks: int32(s.executions.count())}
+	metrics.Load1, metrics.Load5, metrics.Load15 = loadAverage()
+	metrics.MemoryTotalBytes, metrics.MemoryAvailableBytes = memoryUsage()
+	metrics.DiskTotalBytes, metrics.DiskFreeBytes = diskUsage(diskPath)
+	return metrics
+}
+
+// sendHeartbeat sends a heartbeat to the master and returns the jobs it
+// cancelled. A master that does not know the agent, because it restarted or
+// evicted it, rejects the heartbeat, and the agent registers again.
+func sendHeartbeat(client pb.AgentRegistryClient, req *pb.HeartbeatRequest, register func() error) ([]string, error) {
+	resp, err := client.Heartbeat(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.GetSuccess() {
+		slog.Warn(fmt.Sprintf("Master rejected the heartbeat (%s), registering again", resp.GetMessage()))
+		if err := register(); err != nil {
+			return nil, fmt.Errorf("failed to register with master again: %v", err)
+		}
+		slog.Info("Agent registered with master again")
+	}
+	return resp.GetCancelledJobIds(), nil
+}
+
+// renderAgentList prints agents with their health metrics as a table.
+func renderAgentList(w io.Writer, agents []*pb.AgentInfo, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "AGENT NAME\tADDRESS\tSTATUS\tLAST HEARTBEAT\tLOAD (1m)\tMEMORY FREE\tDISK FREE\tTASKS\tVERSION\tLABELS")
+	fmt.Fprintln(tw, "------------\t----------\t------\t--------------\t---------\t-----------\t---------\t-----\t-------\t------")
+	for _, agent := range agents {
+		status := agent.GetStatus()
+		coloredStatus := pterm.Red(status)
+		switch status {
+		case agentStatusActive:
+			coloredStatus = pterm.Green(status)
+		case agentStatusDegraded:
+			coloredStatus = pterm.Yellow(status)
+		}
+
+		lastHeartbeat := "never"
+		if agent.GetLastHeartbeat() > 0 {
+			lastHeartbeat = fmt.Sprintf("%s ago", now.Sub(time.Unix(agent.GetLastHeartbeat(), 0)).Round(time.Second))
+		}
+
+		load, memory, disk, tasks := "-", "-", "-", "-"
+		if m := agent.GetMetrics(); m != nil {
+			load = fmt.Sprintf("%.2f", m.GetLoad1())
+			if m.GetMemoryTotalBytes() > 0 {
+				memory = fmt.Sprintf("%s / %s", formatBytes(m.GetMemoryAvailableBytes()), formatBytes(m.GetMemoryTotalBytes()))
+			}
+			if m.GetDiskTotalBytes() > 0 {
+				disk = fmt.Sprintf("%s / %s", formatBytes(m.GetDiskFreeBytes()), formatBytes(m.GetDiskTotalBytes()))
+			}
+			tasks = fmt.Sprintf("%d", m.GetRunningTasks())
+		}
+		version := agent.GetVersion()
+		if version == "" {
+			version = "-"
+		} else if agent.GetVersionSkew() {
+			version = pterm.Yellow(version + " (skew)")
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", agent.GetAgentName(), agent.GetAgentAddress(), coloredStatus, lastHeartbeat, load, memory, disk, tasks, version, formatLabels(agent.GetLabels()))
+	}
+	return tw.Flush()
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. "1.5 GiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
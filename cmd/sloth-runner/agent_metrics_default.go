@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+func loadAverage() (load1, load5, load15 float64) {
+	// Not implemented on non-linux systems
+	return 0, 0, 0
+}
+
+func memoryUsage() (total, available uint64) {
+	// Not implemented on non-linux systems
+	return 0, 0
+}
+
+func diskUsage(path string) (total, free uint64) {
+	// Not implemented on non-linux systems
+	return 0, 0
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/luainterface"
+	lua "github.com/yuin/gopher-lua"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+)
+
+// agentPolicy restricts what an agent runs. It is loaded from the file given
+// to `agent start --policy`; settings left out do not restrict anything.
+type agentPolicy struct {
+	AllowedCommands   []string      `yaml:"allowed_commands"`    // Patterns; * matches anything
+	AllowedLuaModules []string      `yaml:"allowed_lua_modules"` // Modules tasks may use
+	RunAs             string        `yaml:"run_as"`              // User commands run as
+	Workdir           string        `yaml:"workdir"`             // Commands and file transfers stay below it
+	AllowedEnv        []string      `yaml:"allowed_env"`         // Patterns of environment variables passed to commands
+	MaxRuntime        time.Duration `yaml:"max_runtime"`
+	MaxOutput         string        `yaml:"max_output"`    // e.g. "10MB"; applies to stdout and stderr each
+	AllowUpgrade      bool          `yaml:"allow_upgrade"` // Accept agent upgrades despite allowed_commands
+
+	maxOutputBytes int64
+	uid, gid       uint32
+}
+
+// loadAgentPolicy reads and validates a policy file.
+func loadAgentPolicy(path string) (*agentPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	var p agentPolicy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	known := make(map[string]bool)
+	for _, name := range luainterface.ModuleNames {
+		known[name] = true
+	}
+	for _, name := range p.AllowedLuaModules {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown Lua module %q in allowed_lua_modules", name)
+		}
+	}
+	if p.Workdir != "" {
+		if !filepath.IsAbs(p.Workdir) {
+			return nil, fmt.Errorf("workdir must be an absolute path")
+		}
+		p.Workdir = filepath.Clean(p.Workdir)
+		if err := os.MkdirAll(p.Workdir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create workdir: %w", err)
+		}
+	}
+	if p.RunAs != "" {
+		u, err := user.Lookup(p.RunAs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up run_as user: %w", err)
+		}
+		uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+		gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+		p.uid, p.gid = uint32(uid), uint32(gid)
+		if err := checkRunAs(p.uid); err != nil {
+			return nil, err
+		}
+	}
+	if p.MaxRuntime < 0 {
+		return nil, fmt.Errorf("max_runtime must not be negative")
+	}
+	if p.MaxOutput != "" {
+		if p.maxOutputBytes, err = parseByteSize(p.MaxOutput); err != nil {
+			return nil, fmt.Errorf("invalid max_output: %w", err)
+		}
+	}
+	return &p, nil
+}
+
+// parseByteSize parses sizes such as "512", "64KB" or "10MB".
+func parseByteSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, multiplier = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("expected a positive size such as 10MB")
+	}
+	return n * multiplier, nil
+}
+
+// matchPattern reports whether s matches pattern as a whole, where * matches
+// any sequence of characters, spaces and slashes included.
+func matchPattern(pattern, s string) bool {
+	expr := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	matched, _ := regexp.MatchString("^"+expr+"$", s)
+	return matched
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyViolation is the error returned for anything a policy forbids.
+func policyViolation(format string, args ...interface{}) error {
+	return status.Errorf(codes.PermissionDenied, "denied by agent policy: "+format, args...)
+}
+
+// restrictsCommands reports whether only allowed_commands may run.
+func (p *agentPolicy) restrictsCommands() bool {
+	return p != nil && p.AllowedCommands != nil
+}
+
+// shellMetacharacters are the characters that make a shell do more than run
+// one program with arguments: chain, pipe, redirect, substitute or quote.
+const shellMetacharacters = ";&|<>$`\\\"'()\n\r"
+
+// checkCommand rejects commands that match none of the allowed patterns. A
+// restricted command may not use the shell: it is split into words, matched
+// as the words joined by single spaces, and the words are returned to run
+// it with.
+func (p *agentPolicy) checkCommand(command string) ([]string, error) {
+	if !p.restrictsCommands() {
+		return nil, nil
+	}
+	if strings.ContainsAny(command, shellMetacharacters) {
+		return nil, policyViolation("command %q uses shell syntax, which is not allowed", command)
+	}
+	args := strings.Fields(command)
+	if len(args) == 0 || !matchAny(p.AllowedCommands, strings.Join(args, " ")) {
+		return nil, policyViolation("command %q is not allowed", command)
+	}
+	return args, nil
+}
+
+// checkPath rejects paths outside the workdir jail, following symlinks, so
+// a link inside the jail does not lead out of it.
+func (p *agentPolicy) checkPath(path string) error {
+	if p == nil || p.Workdir == "" {
+		return nil
+	}
+	workdir, err := filepath.EvalSymlinks(p.Workdir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve workdir: %w", err)
+	}
+	resolved, err := resolvePath(filepath.Clean(path))
+	if err != nil {
+		return policyViolation("%s cannot be resolved: %v", path, err)
+	}
+	rel, err := filepath.Rel(workdir, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return policyViolation("%s is outside of %s", path, p.Workdir)
+	}
+	return nil
+}
+
+// resolvePath resolves the symlinks of path. For a path that does not exist
+// yet, those of its deepest existing parent are resolved. A dangling symlink
+// is an error, as writing to it would create its target.
+func resolvePath(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		if _, lerr := os.Lstat(path); lerr == nil {
+			return "", fmt.Errorf("%s is a dangling symlink", path)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// chownToRunAs gives a file the agent created to the run_as user, so it is
+// owned as if that user had written it.
+func (p *agentPolicy) chownToRunAs(path string) error {
+	if p == nil || p.RunAs == "" {
+		return nil
+	}
+	return os.Lchown(path, int(p.uid), int(p.gid))
+}
+
+// allowsEnv reports whether the environment variable name may reach tasks.
+func (p *agentPolicy) allowsEnv(name string) bool {
+	return p == nil || p.AllowedEnv == nil || matchAny(p.AllowedEnv, name)
+}
+
+// prepareCommand checks a command against the policy and applies its working
+// directory, environment and user to cmd. When commands are restricted, cmd
+// is changed to run the command's words directly, without a shell.
+func (p *agentPolicy) prepareCommand(cmd *exec.Cmd, command string) error {
+	if p == nil {
+		return nil
+	}
+	args, err := p.checkCommand(command)
+	if err != nil {
+		return err
+	}
+	if args != nil {
+		path, err := exec.LookPath(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to find %s: %w", args[0], err)
+		}
+		cmd.Path, cmd.Args, cmd.Err = path, args, nil
+	}
+	if p.Workdir != "" {
+		if cmd.Dir == "" {
+			cmd.Dir = p.Workdir
+		} else if err := p.checkPath(cmd.Dir); err != nil {
+			return err
+		}
+	}
+	if p.AllowedEnv != nil {
+		env := cmd.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		cmd.Env = []string{}
+		for _, e := range env {
+			if p.allowsEnv(strings.SplitN(e, "=", 2)[0]) {
+				cmd.Env = append(cmd.Env, e)
+			}
+		}
+	}
+	if p.RunAs != "" {
+		setRunAs(cmd, p.uid, p.gid)
+	}
+	return nil
+}
+
+// limitOutput caps what w receives at the policy's max_output. exceeded is
+// called once when output is dropped.
+func (p *agentPolicy) limitOutput(w io.Writer, exceeded func()) io.Writer {
+	if p == nil || p.maxOutputBytes == 0 || w == nil {
+		return w
+	}
+	return &limitedWriter{w: w, remaining: p.maxOutputBytes, exceeded: exceeded}
+}
+
+// outputLimitExceeded is the error for commands that wrote more than max_output.
+func (p *agentPolicy) outputLimitExceeded() error {
+	return status.Errorf(codes.ResourceExhausted, "output exceeded the agent policy's max_output of %s", p.MaxOutput)
+}
+
+// limitedWriter discards writes beyond its limit, while reporting them as
+// written so the command is not interrupted by a short write.
+type limitedWriter struct {
+	w         io.Writer
+	remaining int64
+	exceeded  func()
+	once      sync.Once
+}
+
+func (l *limitedWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	if int64(n) > l.remaining {
+		b = b[:l.remaining]
+		l.once.Do(l.exceeded)
+	}
+	l.remaining -= int64(len(b))
+	if _, err := l.w.Write(b); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// policyGuard applies a policy to one task execution and keeps the first
+// violation, which fails the execution once the task returns.
+type policyGuard struct {
+	policy *agentPolicy
+
+	mu        sync.Mutex
+	violation error
+}
+
+func (g *policyGuard) record(err error) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.violation == nil {
+		g.violation = err
+	}
+	return err
+}
+
+// err returns the first violation of the execution, if any.
+func (g *policyGuard) err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.violation
+}
+
+// guardCommand is the luainterface.CommandGuard of the execution.
+func (g *policyGuard) guardCommand(cmd *exec.Cmd, command string) error {
+	if err := g.policy.prepareCommand(cmd, command); err != nil {
+		return g.record(err)
+	}
+	exceeded := func() { g.record(g.policy.outputLimitExceeded()) }
+	cmd.Stdout = g.policy.limitOutput(cmd.Stdout, exceeded)
+	cmd.Stderr = g.policy.limitOutput(cmd.Stderr, exceeded)
+	return nil
+}
+
+// prepareState restricts the modules of a Lua state. When commands are
+// restricted, os.execute and io.popen are disabled too, since they would
+// bypass the allowlist.
+func (g *policyGuard) prepareState(L *lua.LState) {
+	if g.policy.AllowedLuaModules != nil {
+		luainterface.RestrictModules(L, g.policy.AllowedLuaModules, func(module string) {
+			g.record(policyViolation("Lua module %q is not allowed", module))
+		})
+	}
+	if !g.policy.restrictsCommands() {
+		return
+	}
+	for lib, fn := range map[string]string{"os": "execute", "io": "popen"} {
+		name := lib + "." + fn
+		if tbl, ok := L.GetGlobal(lib).(*lua.LTable); ok {
+			tbl.RawSetString(fn, L.NewFunction(func(L *lua.LState) int {
+				L.RaiseError("%v", g.record(policyViolation("%s is not allowed, use exec.run", name)))
+				return 0
+			}))
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func checkRunAs(uid uint32) error {
+	return fmt.Errorf("run_as is only supported on linux agents")
+}
+
+func setRunAs(cmd *exec.Cmd, uid, gid uint32) {
+	// Not supported on non-linux systems; checkRunAs rejects such policies
+}
@@ -0,0 +1,26 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// checkRunAs verifies the agent can start processes as uid.
+func checkRunAs(uid uint32) error {
+	if euid := os.Geteuid(); euid != 0 && uint32(euid) != uid {
+		return fmt.Errorf("run_as requires the agent to run as root")
+	}
+	return nil
+}
+
+func setRunAs(cmd *exec.Cmd, uid, gid uint32) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uid, Gid: gid}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/luainterface"
+	"github.com/stretchr/testify/assert"
+	lua "github.com/yuin/gopher-lua"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func writePolicy(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadAgentPolicy(t *testing.T) {
+	jail := t.TempDir()
+	p, err := loadAgentPolicy(writePolicy(t, `
+allowed_commands: ["uptime", "systemctl status *"]
+allowed_lua_modules: [exec, log]
+workdir: `+jail+`
+allowed_env: [PATH, "LC_*"]
+max_runtime: 5m
+max_output: 2MB
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, p.MaxRuntime)
+	assert.Equal(t, int64(2<<20), p.maxOutputBytes)
+
+	_, err = loadAgentPolicy(writePolicy(t, "allowed_lua_modules: [nope]"))
+	assert.Error(t, err)
+	_, err = loadAgentPolicy(writePolicy(t, "allowed_comands: [uptime]"))
+	assert.Error(t, err, "unknown settings are rejected")
+	_, err = loadAgentPolicy(writePolicy(t, "workdir: relative"))
+	assert.Error(t, err)
+
+	// An empty allowlist still restricts
+	p, err = loadAgentPolicy(writePolicy(t, "allowed_commands: []"))
+	assert.NoError(t, err)
+	_, err = p.checkCommand("uptime")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestAgentPolicyPrepareCommand(t *testing.T) {
+	jail := t.TempDir()
+	p := &agentPolicy{
+		AllowedCommands: []string{"uptime", "systemctl status *"},
+		Workdir:         jail,
+		AllowedEnv:      []string{"PATH", "LC_*"},
+	}
+
+	args, err := p.checkCommand("systemctl  status nginx")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"systemctl", "status", "nginx"}, args)
+	_, err = p.checkCommand("systemctl stop nginx")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// The shell could run anything after an allowed prefix, so its syntax
+	// is denied.
+	for _, command := range []string{
+		"systemctl status nginx; id",
+		"systemctl status $(id)",
+		"systemctl status `id`",
+		"systemctl status nginx && id",
+		"systemctl status nginx || id",
+		"systemctl status nginx | sh",
+		"systemctl status nginx > /etc/passwd",
+		"systemctl status nginx\nid",
+		"systemctl status 'nginx'",
+	} {
+		_, err := p.checkCommand(command)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err), command)
+		assert.Equal(t, codes.PermissionDenied, status.Code(p.prepareCommand(exec.Command("bash", "-c", command), command)), command)
+	}
+
+	// Allowed commands run without a shell.
+	cmd := exec.Command("bash", "-c", "uptime")
+	cmd.Env = []string{"PATH=/bin", "LC_ALL=C", "SECRET=x"}
+	assert.NoError(t, p.prepareCommand(cmd, "uptime"))
+	assert.Equal(t, []string{"uptime"}, cmd.Args)
+	assert.Equal(t, "uptime", filepath.Base(cmd.Path))
+	assert.Equal(t, jail, cmd.Dir)
+	assert.Equal(t, []string{"PATH=/bin", "LC_ALL=C"}, cmd.Env)
+
+	cmd = exec.Command("bash", "-c", "uptime")
+	cmd.Dir = "/etc"
+	assert.Equal(t, codes.PermissionDenied, status.Code(p.prepareCommand(cmd, "uptime")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(p.checkPath(filepath.Join(jail, "../x"))))
+	assert.NoError(t, p.checkPath(filepath.Join(jail, "a/b")))
+
+	// Symlinks are followed: one pointing out of the jail is outside of it,
+	// for existing files and new ones below it alike.
+	outside := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0600))
+	assert.NoError(t, os.Symlink(outside, filepath.Join(jail, "escape")))
+	assert.NoError(t, os.Symlink(filepath.Join(outside, "missing"), filepath.Join(jail, "dangling")))
+	for _, path := range []string{"escape", "escape/secret", "escape/new/file", "dangling"} {
+		assert.Equal(t, codes.PermissionDenied, status.Code(p.checkPath(filepath.Join(jail, path))), path)
+	}
+	assert.NoError(t, os.Mkdir(filepath.Join(jail, "a"), 0755))
+	assert.NoError(t, os.Symlink(filepath.Join(jail, "a"), filepath.Join(jail, "inside")))
+	assert.NoError(t, p.checkPath(filepath.Join(jail, "inside/b")))
+
+	// No policy allows everything
+	var none *agentPolicy
+	assert.NoError(t, none.prepareCommand(exec.Command("rm"), "rm -rf /tmp/x"))
+}
+
+func TestAgentPolicyChownToRunAs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upload")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("x"), 0644))
+
+	var none *agentPolicy
+	assert.NoError(t, none.chownToRunAs(path))
+	p := &agentPolicy{RunAs: "me", uid: uint32(os.Getuid()), gid: uint32(os.Getgid())}
+	assert.NoError(t, p.chownToRunAs(path))
+	assert.Error(t, p.chownToRunAs(filepath.Join(t.TempDir(), "missing")))
+}
+
+func TestAgentPolicyLimitOutput(t *testing.T) {
+	p := &agentPolicy{MaxOutput: "4B", maxOutputBytes: 4}
+	var buf bytes.Buffer
+	exceeded := 0
+	w := p.limitOutput(&buf, func() { exceeded++ })
+	n, err := w.Write([]byte("abc"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	n, err = w.Write([]byte("defgh"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	w.Write([]byte("ij"))
+	assert.Equal(t, "abcd", buf.String())
+	assert.Equal(t, 1, exceeded)
+}
+
+func TestPolicyGuardRestrictsLua(t *testing.T) {
+	g := &policyGuard{policy: &agentPolicy{AllowedLuaModules: []string{"log"}, AllowedCommands: []string{"true"}}}
+	L := lua.NewState()
+	defer L.Close()
+	luainterface.OpenAll(L)
+	g.prepareState(L)
+
+	assert.NoError(t, L.DoString(`log.info("allowed")`))
+	assert.Error(t, L.DoString(`fs.read("/etc/hosts")`))
+	assert.Equal(t, codes.PermissionDenied, status.Code(g.err()))
+
+	g = &policyGuard{policy: g.policy}
+	g.prepareState(L)
+	assert.Error(t, L.DoString(`local n = require("net")`))
+	assert.Error(t, L.DoString(`os.execute("id")`))
+	assert.Equal(t, codes.PermissionDenied, status.Code(g.err()))
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+)
+
+// jobPuller runs on a pull-mode agent. It long-polls the master's job queue,
+// runs the leased jobs with at most slots of them in flight, and reports the
+// results back. This lets agents behind NAT or firewalls receive work.
+type jobPuller struct {
+	client    pb.AgentRegistryClient
+	agentName string
+	slots     int
+	server    *agentServer
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+	freed   chan struct{}
+}
+
+// newJobPuller creates a new jobPuller.
+func newJobPuller(client pb.AgentRegistryClient, agentName string, slots int, server *agentServer) *jobPuller {
+	if slots <= 0 {
+		slots = 1
+	}
+	return &jobPuller{
+		client:    client,
+		agentName: agentName,
+		slots:     slots,
+		server:    server,
+		running:   make(map[string]context.CancelFunc),
+		freed:     make(chan struct{}, 1),
+	}
+}
+
+// Run polls for jobs until ctx is cancelled.
+func (p *jobPuller) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if p.server.executions.isDraining() {
+			return
+		}
+		free := p.freeSlots()
+		if free <= 0 {
+			select {
+			case <-p.freed:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		resp, err := p.client.PullJobs(ctx, &pb.PullJobsRequest{
+			AgentName:   p.agentName,
+			FreeSlots:   int32(free),
+			WaitSeconds: int32(maxJobPullWait / time.Second),
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error(fmt.Sprintf("Failed to pull jobs from master: %v", err))
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for _, job := range resp.GetJobs() {
+			jobCtx, cancel := context.WithCancel(ctx)
+			p.mu.Lock()
+			p.running[job.GetJobId()] = cancel
+			p.mu.Unlock()
+			go p.execute(jobCtx, job)
+		}
+	}
+}
+
+// Cancel aborts the given jobs if they are running on this agent.
+func (p *jobPuller) Cancel(jobIDs []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, id := range jobIDs {
+		if cancel, ok := p.running[id]; ok {
+			slog.Warn(fmt.Sprintf("Cancelling job %s at the master's request", id))
+			cancel()
+		}
+	}
+}
+
+func (p *jobPuller) freeSlots() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.slots - len(p.running)
+}
+
+func (p *jobPuller) execute(ctx context.Context, job *pb.Job) {
+	defer func() {
+		p.mu.Lock()
+		if cancel, ok := p.running[job.GetJobId()]; ok {
+			cancel()
+			delete(p.running, job.GetJobId())
+		}
+		p.mu.Unlock()
+		select {
+		case p.freed <- struct{}{}:
+		default:
+		}
+	}()
+
+	if p.server.executions.isDraining() {
+		// Leave the job unreported; its lease expires and the master requeues it.
+		slog.Warn(fmt.Sprintf("Not running job %s: agent is shutting down", job.GetJobId()))
+		return
+	}
+	slog.Info(fmt.Sprintf("Running job %s (attempt %d)", job.GetJobId(), job.GetAttempts()))
+	result := &pb.CompleteJobRequest{AgentName: p.agentName, JobId: job.GetJobId()}
+
+	if job.GetTask() != nil {
+		resp, err := p.server.ExecuteTask(ctx, job.GetTask())
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			completeTaskJob(result, resp)
+		}
+	} else {
+		resp, err := p.server.runCommand(ctx, job.GetCommand())
+		if err != nil {
+			result.Error = err.Error()
+			result.ExitCode = -1
+		} else {
+			result.Success = resp.GetSuccess()
+			result.Stdout = resp.GetStdout()
+			result.Stderr = resp.GetStderr()
+			result.Error = resp.GetError()
+			result.ExitCode = resp.GetExitCode()
+		}
+	}
+
+	// Report with a fresh context: the job context may have been cancelled.
+	reportCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := p.client.CompleteJob(reportCtx, result); err != nil {
+		slog.Error(fmt.Sprintf("Failed to report result of job %s: %v", job.GetJobId(), err))
+	}
+}
@@ -4,26 +4,78 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/chalkan3/sloth-runner/internal/audit"
 	"github.com/pterm/pterm"
 	pb "github.com/chalkan3/sloth-runner/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
+const (
+	agentStatusActive   = "Active"
+	agentStatusDegraded = "Degraded"
+	agentStatusInactive = "Inactive"
+)
+
+// agentHealthThresholds decide an agent's status from the age of its last
+// heartbeat. Agents heartbeat every 5 seconds.
+type agentHealthThresholds struct {
+	DegradedAfter time.Duration // Missed a few heartbeats
+	InactiveAfter time.Duration // Considered down
+	EvictAfter    time.Duration // Removed from the registry; 0 never evicts
+}
+
+var defaultAgentHealthThresholds = agentHealthThresholds{
+	DegradedAfter: 15 * time.Second,
+	InactiveAfter: 60 * time.Second,
+	EvictAfter:    10 * time.Minute,
+}
+
+// status returns the status of an agent whose last heartbeat is lastHeartbeat.
+func (t agentHealthThresholds) status(lastHeartbeat, now time.Time) string {
+	age := now.Sub(lastHeartbeat)
+	switch {
+	case age >= t.InactiveAfter:
+		return agentStatusInactive
+	case age >= t.DegradedAfter:
+		return agentStatusDegraded
+	default:
+		return agentStatusActive
+	}
+}
+
 // agentRegistryServer implements the AgentRegistry service.
  type agentRegistryServer struct {
 	pb.UnimplementedAgentRegistryServer
 	mu      sync.Mutex
 	agents  map[string]*pb.AgentInfo
+	jobs    *jobQueue
+	runs    *workflowRunStore
+	health  agentHealthThresholds
+	audit   *audit.Recorder // nil when auditing is disabled
+	token   string          // Shared token callers must present; empty disables authentication
+	// dispatched holds the cancel functions of jobs the master is running on push-mode agents.
+	dispatched map[string]context.CancelFunc
+	// upgrades are told when an agent being upgraded registers again.
+	upgrades   map[string]chan *pb.RegisterAgentRequest
 	grpcServer *grpc.Server
 }
 
 // newAgentRegistryServer creates a new agentRegistryServer.
 func newAgentRegistryServer() *agentRegistryServer {
 	return &agentRegistryServer{
-		agents: make(map[string]*pb.AgentInfo),
+		agents:     make(map[string]*pb.AgentInfo),
+		jobs:       newJobQueue(),
+		runs:       newWorkflowRunStore(defaultArtifactDir(), maxWorkflowRuns),
+		health:     defaultAgentHealthThresholds,
+		dispatched: make(map[string]context.CancelFunc),
+		upgrades:   make(map[string]chan *pb.RegisterAgentRequest),
 	}
 }
 
@@ -33,9 +85,33 @@ func (s *agentRegistryServer) RegisterAgent(ctx context.Context, req *pb.Registe
 	defer s.mu.Unlock()
 
 	pterm.Success.Printf("Agent registered: %s at %s\n", req.AgentName, req.AgentAddress)
-	s.agents[req.AgentName] = &pb.AgentInfo{
+	slots := req.Slots
+	if slots <= 0 {
+		slots = 1
+	}
+	if req.Version != "" && req.Version != version {
+		pterm.Warning.Printf("Agent %s runs sloth-runner %s, but the master runs %s\n", req.AgentName, req.Version, version)
+	}
+	agent := &pb.AgentInfo{
 		AgentName:    req.AgentName,
 		AgentAddress: req.AgentAddress,
+		PullMode:     req.PullMode,
+		Slots:        slots,
+		Labels:       req.Labels,
+		Version:      req.Version,
+		// Registration counts as a heartbeat, so the agent is not evicted right away.
+		LastHeartbeat: time.Now().Unix(),
+	}
+	s.agents[req.AgentName] = agent
+	if registered, ok := s.upgrades[req.AgentName]; ok {
+		select {
+		case registered <- proto.Clone(req).(*pb.RegisterAgentRequest):
+		default:
+		}
+	}
+	// A (re)registering agent has no jobs running, so anything it held is lost.
+	if n := s.jobs.RequeueAgent(req.AgentName); n > 0 {
+		pterm.Warning.Printf("Requeued %d job(s) previously leased by agent %s\n", n, req.AgentName)
 	}
 
 	return &pb.RegisterAgentResponse{Success: true, Message: "Agent registered successfully"}, nil
@@ -47,23 +123,20 @@ func (s *agentRegistryServer) ListAgents(ctx context.Context, req *pb.ListAgents
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	now := time.Now()
 	var agents []*pb.AgentInfo
 	for _, agent := range s.agents {
 		// Determine agent status based on last heartbeat
-		status := "Inactive"
-		pterm.Debug.Printf("Agent %s: LastHeartbeat=%d, CurrentTime=%d, Diff=%d\n", agent.AgentName, agent.LastHeartbeat, time.Now().Unix(), time.Now().Unix()-agent.LastHeartbeat)
-		if time.Now().Unix()-agent.LastHeartbeat < 60 { // Agent considered active if heartbeat within last 60 seconds
-			status = "Active"
-		}
-		agents = append(agents, &pb.AgentInfo{
-			AgentName:     agent.AgentName,
-			AgentAddress:  agent.AgentAddress,
-			LastHeartbeat: agent.LastHeartbeat,
-			Status:        status,
-		})
+		status := s.health.status(time.Unix(agent.LastHeartbeat, 0), now)
+		pterm.Debug.Printf("Agent %s: LastHeartbeat=%d, CurrentTime=%d, Status=%s\n", agent.AgentName, agent.LastHeartbeat, now.Unix(), status)
+		info := proto.Clone(agent).(*pb.AgentInfo)
+		info.Status = status
+		info.VersionSkew = info.Version != "" && info.Version != version
+		agents = append(agents, info)
 	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].AgentName < agents[j].AgentName })
 
-	return &pb.ListAgentsResponse{Agents: agents}, nil
+	return &pb.ListAgentsResponse{Agents: agents, MasterVersion: version}, nil
 }
 
 // Heartbeat updates the last heartbeat timestamp for an agent.
@@ -73,8 +146,11 @@ func (s *agentRegistryServer) Heartbeat(ctx context.Context, req *pb.HeartbeatRe
 
 	if agent, ok := s.agents[req.AgentName]; ok {
 		agent.LastHeartbeat = time.Now().Unix()
+		agent.Metrics = req.Metrics
+		agent.Version = req.Version
 		pterm.Debug.Printf("Heartbeat received from agent: %s\n", req.AgentName)
-		return &pb.HeartbeatResponse{Success: true, Message: "Heartbeat received"}, nil
+		cancelled := s.jobs.RenewLeases(req.AgentName)
+		return &pb.HeartbeatResponse{Success: true, Message: "Heartbeat received", CancelledJobIds: cancelled}, nil
 	}
 	return &pb.HeartbeatResponse{Success: false, Message: "Agent not found"}, nil
 }
@@ -86,10 +162,15 @@ func (s *agentRegistryServer) ExecuteCommand(ctx context.Context, req *pb.Execut
 	s.mu.Unlock()
 
 	if !ok {
-		return nil, fmt.Errorf("agent not found: %s", req.AgentName)
+		return nil, status.Errorf(codes.NotFound, "agent not found: %s", req.AgentName)
 	}
 
-	conn, err := grpc.Dial(agent.AgentAddress, grpc.WithInsecure())
+	if agent.PullMode {
+		// The agent may not be reachable, so hand the command over through the queue.
+		return s.executeCommandViaQueue(ctx, req)
+	}
+
+	conn, err := s.dial(agent.AgentAddress)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to agent: %v", err)
 	}
@@ -98,17 +179,214 @@ func (s *agentRegistryServer) ExecuteCommand(ctx context.Context, req *pb.Execut
 	client := pb.NewAgentClient(conn)
 	resp, err := client.RunCommand(ctx, &pb.RunCommandRequest{Command: req.Command})
 	if err != nil {
-		return nil, fmt.Errorf("failed to run command on agent: %v", err)
+		// Keep the agent's status code, so callers can tell policy rejections apart.
+		st := status.Convert(err)
+		return nil, status.Errorf(st.Code(), "failed to run command on agent: %s", st.Message())
+	}
+
+	return &pb.ExecuteCommandResponse{
+		Success:  resp.Success,
+		Stdout:   resp.Stdout,
+		Stderr:   resp.Stderr,
+		Error:    resp.Error,
+		ExitCode: resp.ExitCode,
+	}, nil
+}
+
+// dial connects to an agent at address, presenting the master's token.
+func (s *agentRegistryServer) dial(address string) (*grpc.ClientConn, error) {
+	options := append(audit.DialOptions(), tokenDialOptions(s.token)...)
+	return grpc.Dial(address, append(options, grpc.WithInsecure())...)
+}
+
+// dialAgent connects to a registered agent. The caller must close conn.
+func (s *agentRegistryServer) dialAgent(agentName string) (pb.AgentClient, *grpc.ClientConn, error) {
+	s.mu.Lock()
+	agent, ok := s.agents[agentName]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, nil, status.Errorf(codes.NotFound, "agent not found: %s", agentName)
+	}
+	if agent.PullMode {
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "agent %s runs in pull mode and cannot be reached by the master", agentName)
+	}
+	conn, err := s.dial(agent.AgentAddress)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to agent: %v", err)
 	}
+	return pb.NewAgentClient(conn), conn, nil
+}
 
+// executeCommandViaQueue submits the command as a job for a pull-mode agent
+// and waits for the agent to report back.
+func (s *agentRegistryServer) executeCommandViaQueue(ctx context.Context, req *pb.ExecuteCommandRequest) (*pb.ExecuteCommandResponse, error) {
+	job, err := s.jobs.Submit(&pb.SubmitJobRequest{AgentName: req.AgentName, Command: req.Command})
+	if err != nil {
+		return nil, err
+	}
+	jobID := job.JobId
+	job, err = s.jobs.Wait(ctx, job.JobId)
+	if err != nil {
+		if ctx.Err() != nil {
+			s.jobs.Cancel(jobID)
+		}
+		return nil, fmt.Errorf("failed waiting for job on agent %s: %v", req.AgentName, err)
+	}
 	return &pb.ExecuteCommandResponse{
-		Success: resp.Success,
-		Stdout:  resp.Stdout,
-		Stderr:  resp.Stderr,
-		Error:   resp.Error,
+		Success:  job.Status == jobStatusSucceeded,
+		Stdout:   job.Stdout,
+		Stderr:   job.Stderr,
+		Error:    job.Error,
+		ExitCode: job.ExitCode,
 	}, nil
 }
 
+// SubmitJob adds a job to the master's queue.
+func (s *agentRegistryServer) SubmitJob(ctx context.Context, req *pb.SubmitJobRequest) (*pb.SubmitJobResponse, error) {
+	var agent *pb.AgentInfo
+	if req.AgentName != "" {
+		s.mu.Lock()
+		agent = s.agents[req.AgentName]
+		s.mu.Unlock()
+		if agent == nil {
+			return nil, status.Errorf(codes.NotFound, "agent not found: %s", req.AgentName)
+		}
+	}
+	job, err := s.jobs.Submit(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	pterm.Info.Printf("Job %s queued for agent %q\n", job.JobId, job.AgentName)
+	if agent != nil && !agent.PullMode {
+		go s.dispatchJob(job.JobId, agent.AgentName)
+	}
+	return &pb.SubmitJobResponse{JobId: job.JobId}, nil
+}
+
+// PullJobs leases queued jobs to a pull-mode agent, holding the call open
+// until work is available or the requested wait elapses.
+func (s *agentRegistryServer) PullJobs(ctx context.Context, req *pb.PullJobsRequest) (*pb.PullJobsResponse, error) {
+	s.mu.Lock()
+	agent, ok := s.agents[req.AgentName]
+	var slots int
+	if ok {
+		slots = int(agent.Slots)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "agent not found: %s", req.AgentName)
+	}
+
+	free := slots - s.jobs.LeasedCount(req.AgentName)
+	if req.FreeSlots < int32(free) {
+		free = int(req.FreeSlots)
+	}
+	wait := time.Duration(req.WaitSeconds) * time.Second
+	if wait <= 0 || wait > maxJobPullWait {
+		wait = maxJobPullWait
+	}
+
+	jobs := s.jobs.Pull(ctx, req.AgentName, free, wait)
+	for _, job := range jobs {
+		pterm.Debug.Printf("Job %s leased to agent %s (attempt %d)\n", job.JobId, req.AgentName, job.Attempts)
+	}
+	return &pb.PullJobsResponse{Jobs: jobs}, nil
+}
+
+// CompleteJob records the result of a job reported by an agent.
+func (s *agentRegistryServer) CompleteJob(ctx context.Context, req *pb.CompleteJobRequest) (*pb.CompleteJobResponse, error) {
+	accepted := s.jobs.Complete(req)
+	if !accepted {
+		pterm.Warning.Printf("Ignoring result for job %s from agent %s: job is no longer leased to it\n", req.JobId, req.AgentName)
+	}
+	return &pb.CompleteJobResponse{Accepted: accepted}, nil
+}
+
+// ListJobs lists the jobs known to the master.
+func (s *agentRegistryServer) ListJobs(ctx context.Context, req *pb.ListJobsRequest) (*pb.ListJobsResponse, error) {
+	return &pb.ListJobsResponse{Jobs: s.jobs.List(req.AgentName, req.Status)}, nil
+}
+
+// GetJob returns a single job.
+func (s *agentRegistryServer) GetJob(ctx context.Context, req *pb.GetJobRequest) (*pb.Job, error) {
+	job, ok := s.jobs.Get(req.JobId)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "job not found: %s", req.JobId)
+	}
+	return job, nil
+}
+
+// CancelJob cancels a queued or running job.
+func (s *agentRegistryServer) CancelJob(ctx context.Context, req *pb.CancelJobRequest) (*pb.CancelJobResponse, error) {
+	job, err := s.jobs.Cancel(req.JobId)
+	if err != nil {
+		return &pb.CancelJobResponse{Success: false, Message: err.Error()}, nil
+	}
+	s.abortDispatchedJob(job.JobId)
+	return &pb.CancelJobResponse{Success: true, Message: fmt.Sprintf("Job %s cancelled", job.JobId)}, nil
+}
+
+// reapJobLeases periodically requeues jobs whose agents stopped renewing
+// their leases, and forgets jobs past their retention.
+func (s *agentRegistryServer) reapJobLeases(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if n := s.jobs.ExpireLeases(); n > 0 {
+				pterm.Warning.Printf("Requeued %d job(s) with expired leases\n", n)
+			}
+			if n := s.jobs.PruneFinished(); n > 0 {
+				pterm.Debug.Printf("Removed %d finished job(s) past their retention\n", n)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// evictStaleAgents periodically removes agents that have not sent a
+// heartbeat within the eviction threshold, requeueing the jobs they held.
+func (s *agentRegistryServer) evictStaleAgents(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, name := range s.evict(time.Now()) {
+				pterm.Warning.Printf("Evicted agent %s: no heartbeat for more than %s\n", name, s.health.EvictAfter)
+				if n := s.jobs.RequeueAgent(name); n > 0 {
+					pterm.Warning.Printf("Requeued %d job(s) previously leased by agent %s\n", n, name)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// evict removes the agents whose last heartbeat is older than the eviction
+// threshold and returns their names.
+func (s *agentRegistryServer) evict(now time.Time) []string {
+	if s.health.EvictAfter <= 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var evicted []string
+	for name, agent := range s.agents {
+		if now.Sub(time.Unix(agent.LastHeartbeat, 0)) >= s.health.EvictAfter {
+			delete(s.agents, name)
+			evicted = append(evicted, name)
+		}
+	}
+	sort.Strings(evicted)
+	return evicted
+}
+
 // StopAgent stops a remote agent.
 func (s *agentRegistryServer) StopAgent(ctx context.Context, req *pb.StopAgentRequest) (*pb.StopAgentResponse, error) {
 	s.mu.Lock()
@@ -116,17 +394,17 @@ func (s *agentRegistryServer) StopAgent(ctx context.Context, req *pb.StopAgentRe
 	s.mu.Unlock()
 
 	if !ok {
-		return nil, fmt.Errorf("agent not found: %s", req.AgentName)
+		return nil, status.Errorf(codes.NotFound, "agent not found: %s", req.AgentName)
 	}
 
-	conn, err := grpc.Dial(agent.AgentAddress, grpc.WithInsecure())
+	conn, err := s.dial(agent.AgentAddress)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to agent: %v", err)
 	}
 	defer conn.Close()
 
 	client := pb.NewAgentClient(conn)
-	_, err = client.Shutdown(ctx, &pb.ShutdownRequest{})
+	_, err = client.Shutdown(ctx, &pb.ShutdownRequest{GracePeriodSeconds: req.GracePeriodSeconds})
 	if err != nil {
 		return nil, fmt.Errorf("failed to stop agent: %v", err)
 	}
@@ -141,9 +419,23 @@ func (s *agentRegistryServer) Start(port int) error {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
 
-	s.grpcServer = grpc.NewServer()
+	// Audit first, so rejected calls are recorded too.
+	var options []grpc.ServerOption
+	if s.audit != nil {
+		options = s.audit.ServerOptions()
+	}
+	if s.token != "" {
+		options = append(options, tokenAuthServerOptions(s.token)...)
+	}
+	s.grpcServer = grpc.NewServer(options...)
 	pb.RegisterAgentRegistryServer(s.grpcServer, s)
 	pterm.Info.Printf("Agent registry listening at %v\n", lis.Addr())
+
+	stopReaper := make(chan struct{})
+	defer close(stopReaper)
+	go s.reapJobLeases(5*time.Second, stopReaper)
+	go s.evictStaleAgents(5*time.Second, stopReaper)
+
 	return s.grpcServer.Serve(lis)
 }
 
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAgentHealthThresholds(t *testing.T) {
+	thresholds := agentHealthThresholds{DegradedAfter: 10 * time.Second, InactiveAfter: 30 * time.Second}
+	now := time.Now()
+
+	assert.Equal(t, agentStatusActive, thresholds.status(now.Add(-5*time.Second), now))
+	assert.Equal(t, agentStatusDegraded, thresholds.status(now.Add(-10*time.Second), now))
+	assert.Equal(t, agentStatusInactive, thresholds.status(now.Add(-45*time.Second), now))
+}
+
+func TestEvictStaleAgents(t *testing.T) {
+	s := newAgentRegistryServer()
+	s.health = agentHealthThresholds{DegradedAfter: time.Second, InactiveAfter: time.Minute, EvictAfter: 5 * time.Minute}
+
+	for _, name := range []string{"fresh", "stale"} {
+		_, err := s.RegisterAgent(context.Background(), &pb.RegisterAgentRequest{AgentName: name, AgentAddress: name + ":50051"})
+		assert.NoError(t, err)
+	}
+	_, err := s.Heartbeat(context.Background(), &pb.HeartbeatRequest{
+		AgentName: "fresh",
+		Version:   "v1.2.3",
+		Metrics:   &pb.AgentMetrics{Load1: 0.5, RunningTasks: 2},
+	})
+	assert.NoError(t, err)
+	s.agents["stale"].LastHeartbeat = time.Now().Add(-10 * time.Minute).Unix()
+
+	resp, err := s.ListAgents(context.Background(), &pb.ListAgentsRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Agents, 2)
+	assert.Equal(t, agentStatusActive, resp.Agents[0].Status)
+	assert.Equal(t, "v1.2.3", resp.Agents[0].Version)
+	assert.Equal(t, int32(2), resp.Agents[0].Metrics.RunningTasks)
+	assert.Equal(t, agentStatusInactive, resp.Agents[1].Status)
+
+	assert.Equal(t, []string{"stale"}, s.evict(time.Now()))
+	assert.Contains(t, s.agents, "fresh")
+	assert.NotContains(t, s.agents, "stale")
+
+	s.health.EvictAfter = 0
+	s.agents["fresh"].LastHeartbeat = 0
+	assert.Empty(t, s.evict(time.Now()))
+}
+
+func TestHeartbeatRegistersEvictedAgent(t *testing.T) {
+	s := newAgentRegistryServer()
+	s.health = agentHealthThresholds{DegradedAfter: time.Second, InactiveAfter: time.Minute, EvictAfter: 5 * time.Minute}
+	conn, err := grpc.Dial(serveGRPC(t, func(server *grpc.Server) { pb.RegisterAgentRegistryServer(server, s) }), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewAgentRegistryClient(conn)
+
+	registrations := 0
+	register := func() error {
+		registrations++
+		_, err := client.RegisterAgent(context.Background(), &pb.RegisterAgentRequest{AgentName: "edge1", AgentAddress: "edge1:50051"})
+		return err
+	}
+	assert.NoError(t, register())
+	heartbeat := &pb.HeartbeatRequest{AgentName: "edge1"}
+	_, err = sendHeartbeat(client, heartbeat, register)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, registrations)
+
+	s.agents["edge1"].LastHeartbeat = time.Now().Add(-10 * time.Minute).Unix()
+	assert.Equal(t, []string{"edge1"}, s.evict(time.Now()))
+
+	// The evicted agent's next heartbeat is rejected, and it registers again.
+	_, err = sendHeartbeat(client, heartbeat, register)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, registrations)
+	resp, err := s.ListAgents(context.Background(), &pb.ListAgentsRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Agents, 1)
+	assert.Equal(t, agentStatusActive, resp.Agents[0].Status)
+
+	_, err = sendHeartbeat(client, heartbeat, func() error { return io.EOF })
+	assert.NoError(t, err, "registered agents are not registered again")
+	delete(s.agents, "edge1")
+	_, err = sendHeartbeat(client, heartbeat, func() error { return io.EOF })
+	assert.Error(t, err)
+	_, err = client.PullJobs(context.Background(), &pb.PullJobsRequest{AgentName: "edge1"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestAgentRequiresToken(t *testing.T) {
+	const token = "s3cret"
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	agent := grpc.NewServer(tokenAuthServerOptions(token)...)
+	pb.RegisterAgentServer(agent, &agentServer{executions: newExecutionTracker()})
+	go agent.Serve(lis)
+	defer agent.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = pb.NewAgentClient(conn).RunCommand(context.Background(), &pb.RunCommandRequest{Command: "true"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// The master presents its own token to the agent.
+	for _, masterToken := range []string{"wrong", token} {
+		s := newAgentRegistryServer()
+		s.token = masterToken
+		_, err = s.RegisterAgent(context.Background(), &pb.RegisterAgentRequest{AgentName: "web1", AgentAddress: lis.Addr().String()})
+		assert.NoError(t, err)
+		resp, err := s.ExecuteCommand(context.Background(), &pb.ExecuteCommandRequest{AgentName: "web1", Command: "echo ok"})
+		if masterToken != token {
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, "ok\n", resp.GetStdout())
+	}
+}
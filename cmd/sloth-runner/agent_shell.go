@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// shellCommand returns the command an interactive session runs.
+func shellCommand(start *pb.ShellStart) *exec.Cmd {
+	var cmd *exec.Cmd
+	if start.GetCommand() != "" {
+		cmd = exec.Command("bash", "-c", start.GetCommand())
+	} else {
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "/bin/bash"
+		}
+		cmd = exec.Command(shell, "-l")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		cmd.Dir = home
+	}
+	termName := start.GetTerm()
+	if termName == "" {
+		termName = "xterm"
+	}
+	cmd.Env = append(os.Environ(), "TERM="+termName)
+	return cmd
+}
+
+// Shell runs an interactive session on a pseudo-terminal. The first message
+// must carry a ShellStart; the last one sent back carries the exit code.
+func (s *agentServer) Shell(stream pb.Agent_ShellServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	start := first.GetStart()
+	if start == nil {
+		return status.Error(codes.InvalidArgument, "shell session must begin with a start message")
+	}
+
+	ctx, done, err := s.executions.start(stream.Context(), "")
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	cmd := shellCommand(start)
+	if s.policy.restrictsCommands() && start.GetCommand() == "" {
+		return policyViolation("interactive shells are not allowed")
+	}
+	if s.policy != nil && s.policy.Workdir != "" {
+		cmd.Dir = s.policy.Workdir
+	}
+	if err := s.policy.prepareCommand(cmd, start.GetCommand()); err != nil {
+		return err
+	}
+	ptmx, err := startPTY(cmd, uint16(start.GetRows()), uint16(start.GetCols()))
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "failed to start shell: %v", err)
+	}
+	defer ptmx.Close()
+	slog.Info(fmt.Sprintf("Started shell session (pid %d)", cmd.Process.Pid))
+
+	// Hang up when the client goes away, or the agent cancels the session.
+	go func() {
+		<-ctx.Done()
+		hangupShell(cmd)
+	}()
+	go func() {
+		for {
+			in, err := stream.Recv()
+			if err == io.EOF {
+				// The client's input ended: send end-of-file, as a terminal would.
+				ptmx.Write([]byte{4})
+				return
+			}
+			if err != nil {
+				hangupShell(cmd)
+				return
+			}
+			if size := in.GetResize(); size != nil {
+				resizePTY(ptmx, uint16(size.GetRows()), uint16(size.GetCols()))
+			}
+			if len(in.GetData()) > 0 {
+				ptmx.Write(in.GetData())
+			}
+		}
+	}()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := ptmx.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&pb.ShellOutput{Data: buf[:n]}); err != nil {
+				hangupShell(cmd)
+				break
+			}
+		}
+		if err != nil {
+			break // EIO once the shell exits
+		}
+	}
+
+	exitCode := 0
+	if err := cmd.Wait(); err != nil {
+		exitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	slog.Info(fmt.Sprintf("Shell session (pid %d) exited with code %d", cmd.Process.Pid, exitCode))
+	return stream.Send(&pb.ShellOutput{Exited: true, ExitCode: int32(exitCode)})
+}
+
+// AgentShell relays an interactive session to the agent named in its start message.
+func (s *agentRegistryServer) AgentShell(stream pb.AgentRegistry_AgentShellServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if first.GetStart() == nil {
+		return status.Error(codes.InvalidArgument, "shell session must begin with a start message")
+	}
+	client, conn, err := s.dialAgent(first.GetStart().GetAgentName())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	agentStream, err := client.Shell(stream.Context())
+	if err != nil {
+		return fmt.Errorf("failed to open shell on agent: %v", err)
+	}
+	pterm.Info.Printf("Shell session opened on agent %s\n", first.GetStart().GetAgentName())
+	if err := agentStream.Send(first); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			in, err := stream.Recv()
+			if err != nil {
+				agentStream.CloseSend()
+				return
+			}
+			if err := agentStream.Send(in); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		out, err := agentStream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(out); err != nil {
+			return err
+		}
+	}
+}
+
+// runAgentShell attaches the terminal to a shell session on an agent and
+// returns the exit code of the remote shell.
+func runAgentShell(cmd *cobra.Command, agentName, command string) (int, error) {
+	conn, err := dialMaster(cmd)
+	if err != nil {
+		return -1, err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := pb.NewAgentRegistryClient(conn).AgentShell(ctx)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open shell on agent %s: %v", agentName, err)
+	}
+
+	var sendMu sync.Mutex
+	send := func(in *pb.ShellInput) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return stream.Send(in)
+	}
+
+	stdinFd := int(os.Stdin.Fd())
+	start := &pb.ShellStart{AgentName: agentName, Command: command, Term: os.Getenv("TERM")}
+	if term.IsTerminal(stdinFd) {
+		if cols, rows, err := term.GetSize(stdinFd); err == nil {
+			start.Rows, start.Cols = uint32(rows), uint32(cols)
+		}
+		state, err := term.MakeRaw(stdinFd)
+		if err != nil {
+			return -1, fmt.Errorf("failed to put terminal in raw mode: %v", err)
+		}
+		defer term.Restore(stdinFd, state)
+
+		resized := make(chan os.Signal, 1)
+		notifyWindowSize(resized)
+		go func() {
+			for range resized {
+				if cols, rows, err := term.GetSize(stdinFd); err == nil {
+					send(&pb.ShellInput{Resize: &pb.WindowSize{Rows: uint32(rows), Cols: uint32(cols)}})
+				}
+			}
+		}()
+	}
+	if err := send(&pb.ShellInput{Start: start}); err != nil {
+		return -1, fmt.Errorf("failed to start shell on agent %s: %v", agentName, err)
+	}
+
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				if send(&pb.ShellInput{Data: append([]byte(nil), buf[:n]...)}) != nil {
+					return
+				}
+			}
+			if err != nil {
+				sendMu.Lock()
+				stream.CloseSend()
+				sendMu.Unlock()
+				return
+			}
+		}
+	}()
+
+	for {
+		out, err := stream.Recv()
+		if err == io.EOF {
+			return -1, fmt.Errorf("shell on agent %s closed without an exit code", agentName)
+		}
+		if err != nil {
+			return -1, fmt.Errorf("shell on agent %s failed: %v", agentName, err)
+		}
+		if len(out.GetData()) > 0 {
+			os.Stdout.Write(out.GetData())
+		}
+		if out.GetExited() {
+			return int(out.GetExitCode()), nil
+		}
+	}
+}
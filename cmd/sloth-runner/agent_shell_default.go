@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+func startPTY(cmd *exec.Cmd, rows, cols uint16) (*os.File, error) {
+	return nil, fmt.Errorf("interactive shells are only supported on linux agents")
+}
+
+func resizePTY(ptmx *os.File, rows, cols uint16) {
+	// No-op on non-linux systems
+}
+
+func hangupShell(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+func notifyWindowSize(ch chan<- os.Signal) {
+	// No-op on non-linux systems
+}
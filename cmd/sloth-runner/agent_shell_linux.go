@@ -0,0 +1,69 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// startPTY starts cmd with a new pseudo-terminal as its controlling
+// terminal and returns the master side.
+func startPTY(cmd *exec.Cmd, rows, cols uint16) (*os.File, error) {
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pty: %w", err)
+	}
+	if err := unix.IoctlSetPointerInt(int(ptmx.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		ptmx.Close()
+		return nil, fmt.Errorf("failed to unlock pty: %w", err)
+	}
+	n, err := unix.IoctlGetInt(int(ptmx.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		ptmx.Close()
+		return nil, fmt.Errorf("failed to get pty number: %w", err)
+	}
+	tty, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		ptmx.Close()
+		return nil, fmt.Errorf("failed to open pty slave: %w", err)
+	}
+	defer tty.Close()
+	resizePTY(ptmx, rows, cols)
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid, cmd.SysProcAttr.Setctty = true, true
+	if err := cmd.Start(); err != nil {
+		ptmx.Close()
+		return nil, err
+	}
+	return ptmx, nil
+}
+
+// resizePTY sets the window size of a pty.
+func resizePTY(ptmx *os.File, rows, cols uint16) {
+	if rows == 0 || cols == 0 {
+		return
+	}
+	unix.IoctlSetWinsize(int(ptmx.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Row: rows, Col: cols})
+}
+
+// hangupShell ends a shell session and everything started from it.
+func hangupShell(cmd *exec.Cmd) {
+	// The shell leads its own session and process group.
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// notifyWindowSize relays terminal resizes to ch.
+func notifyWindowSize(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGWINCH)
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// upgradeBackupEnvVar tells an agent restarted by an upgrade where its
+	// previous binary is, so it can roll back if it fails to register.
+	upgradeBackupEnvVar = "SLOTH_RUNNER_UPGRADE_BACKUP"
+
+	// upgradeRegisterTimeout is how long an upgraded agent keeps trying to
+	// register with the master before rolling back.
+	upgradeRegisterTimeout = 30 * time.Second
+
+	// upgradeWatchdogTimeout is how long the watchdog of an upgrade waits
+	// for the upgraded agent to register before rolling back.
+	upgradeWatchdogTimeout = upgradeRegisterTimeout + 30*time.Second
+
+	// upgradeBackupSuffix is appended to the agent binary to name the
+	// previous binary during an upgrade.
+	upgradeBackupSuffix = ".old"
+
+	// upgradeRolledBackSuffix is appended to the agent binary to name the
+	// file left by a rollback, so the restored agent reports it when it
+	// registers, however it was restarted.
+	upgradeRolledBackSuffix = ".rolled-back"
+
+	// defaultUpgradeTimeout is how long the master waits for an upgraded
+	// agent to register again.
+	defaultUpgradeTimeout = 2 * time.Minute
+)
+
+// agentExecutable returns the path of the running binary.
+func agentExecutable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// upgradeTarget returns the path of the agent binary whose previous version
+// is backup. The running binary cannot be used: once renamed, it resolves to
+// the backup.
+func upgradeTarget(backup string) string {
+	return strings.TrimSuffix(backup, upgradeBackupSuffix)
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkSHA256 fails unless the file at path has the hex SHA-256 want.
+func checkSHA256(path, want string) error {
+	if want == "" {
+		return status.Errorf(codes.InvalidArgument, "the binary was sent without its SHA-256")
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return fmt.Errorf("failed to checksum the binary: %w", err)
+	}
+	if !strings.EqualFold(sum, want) {
+		return status.Errorf(codes.InvalidArgument, "the binary has SHA-256 %s, expected %s", sum, want)
+	}
+	return nil
+}
+
+// binaryVersion runs "<path> version", which also checks that the binary
+// runs on this host.
+func binaryVersion(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "version").Output()
+	if err != nil {
+		return "", err
+	}
+	v := strings.TrimSpace(string(out))
+	if v == "" {
+		return "", fmt.Errorf("no version reported")
+	}
+	return v, nil
+}
+
+// Upgrade replaces the agent's binary with the one streamed by the master.
+// Only agents that require the token accept upgrades. The new binary must
+// match the SHA-256 sent with it before it is run at all, and must run
+// before it is installed; the agent then drains and restarts in place,
+// keeping the previous binary until it registers.
+func (s *agentServer) Upgrade(stream pb.Agent_UpgradeServer) error {
+	if !s.authenticated {
+		return status.Errorf(codes.FailedPrecondition, "upgrades require the agent to be started with a token")
+	}
+	if s.policy.restrictsCommands() && !s.policy.AllowUpgrade {
+		return policyViolation("upgrades are not allowed")
+	}
+	s.upgradeMu.Lock()
+	defer s.upgradeMu.Unlock()
+	if s.upgradeBackup != "" {
+		return status.Errorf(codes.FailedPrecondition, "the agent is already restarting for an upgrade")
+	}
+
+	exe, err := agentExecutable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the agent binary: %w", err)
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	staged := exe + ".new"
+	if _, _, err := receiveFile(staged, "", 0755, first.GetData(), func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.GetData(), nil
+	}); err != nil {
+		return err
+	}
+	if err := checkSHA256(staged, first.GetSha256()); err != nil {
+		os.Remove(staged)
+		return err
+	}
+	newVersion, err := binaryVersion(staged)
+	if err != nil {
+		os.Remove(staged)
+		return status.Errorf(codes.FailedPrecondition, "the new binary does not run on this agent: %v", err)
+	}
+
+	backup := exe + upgradeBackupSuffix
+	if err := os.Rename(exe, backup); err != nil {
+		os.Remove(staged)
+		return fmt.Errorf("failed to back up the agent binary: %w", err)
+	}
+	if err := os.Rename(staged, exe); err != nil {
+		os.Rename(backup, exe)
+		return fmt.Errorf("failed to install the new binary: %w", err)
+	}
+	s.upgradeBackup = backup
+	slog.Info(fmt.Sprintf("Installed sloth-runner %s, restarting the agent", newVersion))
+
+	go s.shutdown(defaultDrainGracePeriod)
+	return stream.SendAndClose(&pb.UpgradeResponse{PreviousVersion: version, Version: newVersion})
+}
+
+// pendingUpgrade returns the previous binary once an upgrade is installed.
+func (s *agentServer) pendingUpgrade() string {
+	s.upgradeMu.Lock()
+	defer s.upgradeMu.Unlock()
+	return s.upgradeBackup
+}
+
+// takeUpgradeBackup returns the previous binary when this agent was started
+// by an upgrade, and clears it from the environment of child processes.
+func takeUpgradeBackup() string {
+	backup := os.Getenv(upgradeBackupEnvVar)
+	os.Unsetenv(upgradeBackupEnvVar)
+	return backup
+}
+
+// takeUpgradeRollback reports whether this agent was restarted from its
+// previous binary after a failed upgrade, and clears the rollback marker.
+func takeUpgradeRollback() bool {
+	exe, err := agentExecutable()
+	if err != nil {
+		return false
+	}
+	return os.Remove(exe+upgradeRolledBackSuffix) == nil
+}
+
+// restoreUpgradeBackup puts the previous binary back in place and marks the
+// rollback.
+func restoreUpgradeBackup(backup string) error {
+	target := upgradeTarget(backup)
+	if err := os.Rename(backup, target); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(target+upgradeRolledBackSuffix, nil, 0644); err != nil {
+		slog.Warn(fmt.Sprintf("Failed to mark the rollback, the master will not be told about it: %v", err))
+	}
+	return nil
+}
+
+// restartUpgradedAgent replaces the process with the upgraded binary, with
+// the same arguments and PID. It only returns if that fails.
+func restartUpgradedAgent(backup string) error {
+	if err := startUpgradeWatchdog(backup); err != nil {
+		slog.Warn(fmt.Sprintf("Failed to start the upgrade watchdog, the upgrade cannot be rolled back if the new binary crashes: %v", err))
+	}
+	env := append(os.Environ(), upgradeBackupEnvVar+"="+backup)
+	return rollbackUpgrade(backup, execBinary(upgradeTarget(backup), os.Args, env))
+}
+
+// startUpgradeWatchdog starts a process from the previous binary that rolls
+// the upgrade back if the upgraded agent exits, or does not register in
+// time, without doing it itself. The upgraded agent tells the watchdog it
+// registered by removing the backup.
+func startUpgradeWatchdog(backup string) error {
+	args := []string{"agent", "upgrade-watchdog", "--pid", strconv.Itoa(os.Getpid()), "--backup", backup, "--timeout", upgradeWatchdogTimeout.String(), "--"}
+	cmd := exec.Command(backup, append(args, os.Args[1:]...)...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	// The watchdog detaches itself, so the agent does not have to reap it.
+	return cmd.Run()
+}
+
+// detachUpgradeWatchdog starts the watchdog again with --detached and
+// returns, so it is not a child of the agent.
+func detachUpgradeWatchdog(args []string) error {
+	exe, err := agentExecutable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, append([]string{"agent", "upgrade-watchdog", "--detached"}, args...)...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	setSysProcAttr(cmd)
+	return cmd.Start()
+}
+
+// runUpgradeWatchdog waits for the agent with the given PID to register,
+// which removes backup, and otherwise kills it, restores backup and starts
+// the agent again with agentArgs. Under systemd, the unit restarts the
+// agent instead, so two agents never run at once.
+func runUpgradeWatchdog(pid int, backup string, timeout time.Duration, agentArgs []string) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			return nil
+		}
+		if processSignal(process, syscall.Signal(0)) != nil {
+			slog.Error("Upgraded agent exited before registering with the master")
+			break
+		}
+		if time.Now().After(deadline) {
+			slog.Error(fmt.Sprintf("Upgraded agent did not register with the master within %s", timeout))
+			processSignal(process, syscall.SIGKILL)
+			break
+		}
+		time.Sleep(time.Second)
+	}
+
+	if err := restoreUpgradeBackup(backup); err != nil {
+		if os.IsNotExist(err) {
+			return nil // The agent registered at the last moment
+		}
+		return fmt.Errorf("failed to roll back the upgrade: %w", err)
+	}
+	if os.Getenv("INVOCATION_ID") != "" {
+		slog.Warn("Rolled back the upgrade; systemd restarts the agent")
+		return nil
+	}
+	cmd := exec.Command(upgradeTarget(backup), agentArgs...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	setSysProcAttr(cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to restart the previous binary: %w", err)
+	}
+	slog.Warn(fmt.Sprintf("Rolled back the upgrade; agent restarted with PID %d", cmd.Process.Pid))
+	return nil
+}
+
+// rollbackUpgrade puts the previous binary back and restarts it. It only
+// returns if that fails.
+func rollbackUpgrade(backup string, cause error) error {
+	slog.Error(fmt.Sprintf("Upgrade failed, rolling back to the previous binary: %v", cause))
+	if err := restoreUpgradeBackup(backup); err != nil {
+		return fmt.Errorf("failed to roll back the upgrade: %w", err)
+	}
+	if err := execBinary(upgradeTarget(backup), os.Args, os.Environ()); err != nil {
+		return fmt.Errorf("failed to restart the previous binary: %w", err)
+	}
+	return nil
+}
+
+// UpgradeAgent pushes the binary streamed by the caller to the selected
+// agents, one at a time, and reports how each upgrade went.
+func (s *agentRegistryServer) UpgradeAgent(stream pb.AgentRegistry_UpgradeAgentServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	targets, err := s.upgradeTargets(first.GetAgentNames(), first.GetAll())
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(first.GetTimeoutSeconds()) * time.Second
+	if timeout <= 0 {
+		timeout = defaultUpgradeTimeout
+	}
+
+	tmp, err := ioutil.TempFile("", "sloth-runner-upgrade-")
+	if err != nil {
+		return fmt.Errorf("failed to stage the binary: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	_, size, err := receiveFile(tmp.Name(), "", 0755, first.GetData(), func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.GetData(), nil
+	})
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		return status.Errorf(codes.InvalidArgument, "no binary was sent")
+	}
+	checksum := first.GetSha256()
+	if err := checkSHA256(tmp.Name(), checksum); err != nil {
+		return err
+	}
+
+	for _, name := range targets {
+		pterm.Info.Printf("Upgrading agent %s\n", name)
+		if err := stream.Send(s.upgradeAgent(stream.Context(), name, tmp.Name(), checksum, timeout)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upgradeTargets returns the agents to upgrade, sorted by name.
+func (s *agentRegistryServer) upgradeTargets(names []string, all bool) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if all {
+		names = nil
+		for name := range s.agents {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, status.Errorf(codes.FailedPrecondition, "no agents are registered")
+		}
+		return names, nil
+	}
+	if len(names) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "no agents selected")
+	}
+	for _, name := range names {
+		if _, ok := s.agents[name]; !ok {
+			return nil, status.Errorf(codes.NotFound, "agent not found: %s", name)
+		}
+	}
+	return names, nil
+}
+
+// upgradeAgent sends the binary at path, with its SHA-256, to an agent and
+// waits for it to register again, with the new binary or, if it rolled
+// back, the old one.
+func (s *agentRegistryServer) upgradeAgent(ctx context.Context, name, path, checksum string, timeout time.Duration) *pb.UpgradeAgentResult {
+	result := &pb.UpgradeAgentResult{AgentName: name}
+	client, conn, err := s.dialAgent(name)
+	if err != nil {
+		result.Message = status.Convert(err).Message()
+		return result
+	}
+	defer conn.Close()
+
+	registered := make(chan *pb.RegisterAgentRequest, 1)
+	s.mu.Lock()
+	s.upgrades[name] = registered
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.upgrades, name)
+		s.mu.Unlock()
+	}()
+
+	resp, err := pushUpgrade(ctx, client, path, checksum)
+	if err != nil {
+		result.Message = fmt.Sprintf("failed to upgrade: %s", status.Convert(err).Message())
+		return result
+	}
+	result.PreviousVersion = resp.GetPreviousVersion()
+
+	select {
+	case req := <-registered:
+		result.Version = req.GetVersion()
+		// Agents that predate the rollback flag come back with the old version.
+		if req.GetRolledBack() || result.Version != resp.GetVersion() {
+			result.RolledBack = true
+			result.Message = fmt.Sprintf("the agent failed to start version %s and rolled back", resp.GetVersion())
+		} else {
+			result.Success = true
+			result.Message = "upgraded"
+		}
+	case <-time.After(timeout):
+		result.Message = fmt.Sprintf("the agent did not register again within %s", timeout)
+	case <-ctx.Done():
+		result.Message = ctx.Err().Error()
+	}
+	return result
+}
+
+// pushUpgrade streams the binary at path, with its SHA-256, to an agent.
+func pushUpgrade(ctx context.Context, client pb.AgentClient, path, checksum string) (*pb.UpgradeResponse, error) {
+	stream, err := client.Upgrade(ctx)
+	if err != nil {
+		return nil, err
+	}
+	first := true
+	if err := sendFile(path, func(chunk *pb.FileChunk) error {
+		msg := &pb.FileChunk{Data: chunk.GetData()}
+		if first {
+			msg.Sha256 = checksum
+			first = false
+		}
+		return stream.Send(msg)
+	}); err != nil {
+		stream.CloseSend()
+		return nil, err
+	}
+	return stream.CloseAndRecv()
+}
+
+// runAgentUpgrade sends binary to the master to upgrade the selected agents
+// and prints the outcome for each. When checksum is set, binary must have
+// that SHA-256.
+func runAgentUpgrade(cmd *cobra.Command, names []string, all bool, binary, checksum string, timeout time.Duration) error {
+	if binary == "" {
+		exe, err := agentExecutable()
+		if err != nil {
+			return fmt.Errorf("failed to locate the sloth-runner binary: %w", err)
+		}
+		binary = exe
+	}
+	sum, err := fileSHA256(binary)
+	if err != nil {
+		return fmt.Errorf("failed to checksum %s: %w", binary, err)
+	}
+	if checksum != "" && !strings.EqualFold(sum, checksum) {
+		return fmt.Errorf("%s has SHA-256 %s, expected %s", binary, sum, checksum)
+	}
+	conn, err := dialMaster(cmd)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stream, err := pb.NewAgentRegistryClient(conn).UpgradeAgent(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to upgrade agents: %v", err)
+	}
+	first := true
+	err = sendFile(binary, func(chunk *pb.FileChunk) error {
+		msg := &pb.UpgradeAgentChunk{Data: chunk.GetData()}
+		if first {
+			msg.AgentNames = names
+			msg.All = all
+			msg.TimeoutSeconds = int32(timeout.Seconds())
+			msg.Sha256 = sum
+			first = false
+		}
+		return stream.Send(msg)
+	})
+	if err == nil && first {
+		err = fmt.Errorf("%s is empty", binary)
+	}
+	if err == io.EOF {
+		// The master rejected the upgrade; its error comes with Recv.
+		if _, err := stream.Recv(); err != nil && err != io.EOF {
+			return fmt.Errorf("failed to upgrade agents: %v", err)
+		}
+	}
+	if err != nil {
+		stream.CloseSend()
+		return fmt.Errorf("failed to send %s: %v", binary, err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	failed := 0
+	for {
+		result, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to upgrade agents: %v", err)
+		}
+		switch {
+		case result.GetSuccess():
+			pterm.Success.Printf("Agent %s upgraded from %s to %s\n", result.GetAgentName(), result.GetPreviousVersion(), result.GetVersion())
+		case result.GetRolledBack():
+			failed++
+			pterm.Warning.Printf("Agent %s rolled back to %s: %s\n", result.GetAgentName(), result.GetVersion(), result.GetMessage())
+		default:
+			failed++
+			pterm.Error.Printf("Agent %s was not upgraded: %s\n", result.GetAgentName(), result.GetMessage())
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d agent(s) were not upgraded", failed)
+	}
+	return nil
+}
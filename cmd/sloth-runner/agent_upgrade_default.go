@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "fmt"
+
+var execBinary = func(path string, args, env []string) error {
+	return fmt.Errorf("restarting in place is only supported on linux agents")
+}
@@ -0,0 +1,12 @@
+//go:build linux
+// +build linux
+
+package main
+
+import "syscall"
+
+// execBinary replaces the running process with path, keeping its PID. It
+// is a variable so tests can stub it.
+var execBinary = func(path string, args, env []string) error {
+	return syscall.Exec(path, args, env)
+}
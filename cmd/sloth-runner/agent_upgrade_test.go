@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRegisterAgentVersionSkew(t *testing.T) {
+	registry := newAgentRegistryServer()
+	ctx := context.Background()
+	_, err := registry.RegisterAgent(ctx, &pb.RegisterAgentRequest{AgentName: "current", Version: version})
+	assert.NoError(t, err)
+	_, err = registry.RegisterAgent(ctx, &pb.RegisterAgentRequest{AgentName: "old", Version: "v0.1.0"})
+	assert.NoError(t, err)
+	_, err = registry.RegisterAgent(ctx, &pb.RegisterAgentRequest{AgentName: "unknown"})
+	assert.NoError(t, err)
+
+	resp, err := registry.ListAgents(ctx, &pb.ListAgentsRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, version, resp.MasterVersion)
+	skew := make(map[string]bool)
+	for _, agent := range resp.Agents {
+		skew[agent.AgentName] = agent.VersionSkew
+	}
+	assert.Equal(t, map[string]bool{"current": false, "old": true, "unknown": false}, skew)
+}
+
+func TestUpgradeTargets(t *testing.T) {
+	registry := newAgentRegistryServer()
+	_, err := registry.upgradeTargets(nil, true)
+	assert.Error(t, err, "no agents to upgrade")
+
+	for _, name := range []string{"web2", "web1"} {
+		registry.RegisterAgent(context.Background(), &pb.RegisterAgentRequest{AgentName: name})
+	}
+	targets, err := registry.upgradeTargets(nil, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web1", "web2"}, targets)
+
+	_, err = registry.upgradeTargets([]string{"web1", "db1"}, false)
+	assert.Error(t, err)
+	_, err = registry.upgradeTargets(nil, false)
+	assert.Error(t, err)
+}
+
+// upgradingAgent accepts an upgrade and registers again with comeBackAs.
+type upgradingAgent struct {
+	pb.UnimplementedAgentServer
+	registry   *agentRegistryServer
+	address    string
+	comeBackAs string // Empty to never register again
+	rolledBack bool
+	received   []byte
+	checksum   string
+}
+
+func (a *upgradingAgent) Upgrade(stream pb.Agent_UpgradeServer) error {
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if a.received == nil {
+			a.checksum = chunk.GetSha256()
+		}
+		a.received = append(a.received, chunk.GetData()...)
+	}
+	if a.comeBackAs != "" {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			a.registry.RegisterAgent(context.Background(), &pb.RegisterAgentRequest{
+				AgentName: "edge1", AgentAddress: a.address, Version: a.comeBackAs, RolledBack: a.rolledBack,
+			})
+		}()
+	}
+	return stream.SendAndClose(&pb.UpgradeResponse{PreviousVersion: "v1.0.0", Version: "v2.0.0"})
+}
+
+func TestUpgradeAgent(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "sloth-runner")
+	assert.NoError(t, ioutil.WriteFile(binary, []byte("new binary"), 0755))
+	checksum, err := fileSHA256(binary)
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		comeBackAs string
+		rolledBack bool // Reported by the agent
+		success    bool
+		message    string
+	}{
+		{comeBackAs: "v2.0.0", success: true, message: "upgraded"},
+		{comeBackAs: "v1.0.0", message: "rolled back"},
+		// Both binaries may report the same version, e.g. development builds.
+		{comeBackAs: "v2.0.0", rolledBack: true, message: "rolled back"},
+		{comeBackAs: "", message: "did not register again"},
+	} {
+		registry := newAgentRegistryServer()
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		agent := &upgradingAgent{registry: registry, address: lis.Addr().String(), comeBackAs: tc.comeBackAs, rolledBack: tc.rolledBack}
+		server := grpc.NewServer()
+		pb.RegisterAgentServer(server, agent)
+		go server.Serve(lis)
+
+		registry.RegisterAgent(context.Background(), &pb.RegisterAgentRequest{AgentName: "edge1", AgentAddress: agent.address, Version: "v1.0.0"})
+		result := registry.upgradeAgent(context.Background(), "edge1", binary, checksum, 500*time.Millisecond)
+		server.Stop()
+
+		assert.Equal(t, "new binary", string(agent.received))
+		assert.Equal(t, checksum, agent.checksum)
+		assert.Equal(t, tc.success, result.Success, tc.comeBackAs)
+		assert.Equal(t, !tc.success && tc.comeBackAs != "", result.RolledBack, tc.comeBackAs)
+		assert.Contains(t, result.Message, tc.message)
+		assert.Equal(t, "v1.0.0", result.PreviousVersion)
+		assert.Equal(t, tc.comeBackAs, result.Version)
+	}
+}
+
+func TestUpgradeTarget(t *testing.T) {
+	assert.Equal(t, "/usr/local/bin/sloth-runner", upgradeTarget("/usr/local/bin/sloth-runner.old"))
+}
+
+func TestAgentUpgradeChecks(t *testing.T) {
+	upgrade := func(server *agentServer, data, checksum string) error {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		s := grpc.NewServer()
+		pb.RegisterAgentServer(s, server)
+		go s.Serve(lis)
+		defer s.Stop()
+		conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		stream, err := pb.NewAgentClient(conn).Upgrade(context.Background())
+		assert.NoError(t, err)
+		stream.Send(&pb.FileChunk{Data: []byte(data), Sha256: checksum})
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+
+	err := upgrade(&agentServer{}, "new binary", "")
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "agents without a token refuse upgrades")
+
+	// A binary that does not match its checksum is removed without being run.
+	exe, err := agentExecutable()
+	assert.NoError(t, err)
+	err = upgrade(&agentServer{authenticated: true}, "#!/bin/sh\ntouch "+exe+".ran\n", "0123")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), "expected 0123")
+	assert.NoFileExists(t, exe+".new")
+	assert.NoFileExists(t, exe+".ran")
+}
+
+func TestRollbackUpgrade(t *testing.T) {
+	defer func(f func(string, []string, []string) error) { execBinary = f }(execBinary)
+	var execPath string
+	execBinary = func(path string, args, env []string) error {
+		execPath = path
+		return nil
+	}
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "sloth-runner")
+	backup := target + upgradeBackupSuffix
+	assert.NoError(t, ioutil.WriteFile(target, []byte("new"), 0755))
+	assert.NoError(t, ioutil.WriteFile(backup, []byte("old"), 0755))
+
+	assert.NoError(t, rollbackUpgrade(backup, io.EOF))
+	data, err := ioutil.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+	assert.NoFileExists(t, backup)
+	assert.Equal(t, target, execPath)
+	assert.FileExists(t, target+upgradeRolledBackSuffix)
+
+	assert.Error(t, rollbackUpgrade(backup, io.EOF), "nothing to roll back to")
+}
+
+func TestRunUpgradeWatchdog(t *testing.T) {
+	defer func(f func(*os.Process, os.Signal) error) { processSignal = f }(processSignal)
+
+	// setup installs an upgrade whose previous binary records its arguments
+	// in out when it is restarted.
+	setup := func() (target, backup, out string) {
+		dir := t.TempDir()
+		target = filepath.Join(dir, "sloth-runner")
+		backup = target + upgradeBackupSuffix
+		out = filepath.Join(dir, "restarted")
+		assert.NoError(t, ioutil.WriteFile(target, []byte("#!/bin/sh\nexit 1\n"), 0755))
+		assert.NoError(t, ioutil.WriteFile(backup, []byte("#!/bin/sh\necho \"$*\" > "+out+"\n"), 0755))
+		return target, backup, out
+	}
+	restarted := func(out string) string {
+		var data []byte
+		assert.Eventually(t, func() bool {
+			var err error
+			data, err = ioutil.ReadFile(out)
+			return err == nil && len(data) > 0
+		}, 3*time.Second, 20*time.Millisecond)
+		return string(data)
+	}
+
+	// The upgraded agent registered, which removed the backup.
+	target, backup, out := setup()
+	assert.NoError(t, os.Remove(backup))
+	assert.NoError(t, runUpgradeWatchdog(os.Getpid(), backup, time.Minute, []string{"agent", "start"}))
+	assert.NoFileExists(t, out)
+
+	// The upgraded agent exited before registering.
+	processSignal = func(p *os.Process, sig os.Signal) error { return os.ErrProcessDone }
+	target, backup, out = setup()
+	assert.NoError(t, runUpgradeWatchdog(os.Getpid(), backup, time.Minute, []string{"agent", "start"}))
+	assert.Equal(t, "agent start\n", restarted(out))
+	assert.NoFileExists(t, backup)
+	assert.FileExists(t, target+upgradeRolledBackSuffix)
+	data, err := ioutil.ReadFile(target)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "exit 1")
+
+	// The upgraded agent hangs: it is killed once the timeout expires.
+	var signals []os.Signal
+	processSignal = func(p *os.Process, sig os.Signal) error {
+		signals = append(signals, sig)
+		return nil
+	}
+	_, backup, out = setup()
+	assert.NoError(t, runUpgradeWatchdog(os.Getpid(), backup, 0, []string{"agent", "start"}))
+	assert.Contains(t, signals, os.Signal(syscall.SIGKILL))
+	assert.Equal(t, "agent start\n", restarted(out))
+
+	// Under systemd, the unit restarts the agent.
+	t.Setenv("INVOCATION_ID", "0123")
+	target, backup, out = setup()
+	assert.NoError(t, runUpgradeWatchdog(os.Getpid(), backup, 0, []string{"agent", "start"}))
+	assert.NoFileExists(t, backup)
+	assert.FileExists(t, target+upgradeRolledBackSuffix)
+	time.Sleep(100 * time.Millisecond)
+	assert.NoFileExists(t, out)
+}
+
+func TestTakeUpgradeRollback(t *testing.T) {
+	exe, err := agentExecutable()
+	assert.NoError(t, err)
+	assert.False(t, takeUpgradeRollback())
+	assert.NoError(t, ioutil.WriteFile(exe+upgradeRolledBackSuffix, nil, 0644))
+	assert.True(t, takeUpgradeRollback())
+	assert.False(t, takeUpgradeRollback(), "the marker is cleared")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/workspace"
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/google/uuid"
+)
+
+// defaultWorkspaceTTL is how long an agent keeps a synced workspace around
+// after it was last used. Runners sync into the same workspace for every
+// delegated task of a group run, so only the first sync sends everything.
+const defaultWorkspaceTTL = time.Hour
+
+// workspaceStore keeps the workspaces synced to this agent, one directory per ID.
+type workspaceStore struct {
+	root string
+	ttl  time.Duration
+
+	mu       sync.Mutex
+	lastUsed map[string]time.Time
+}
+
+// newWorkspaceStore creates a workspaceStore rooted at root.
+func newWorkspaceStore(root string, ttl time.Duration) *workspaceStore {
+	return &workspaceStore{root: root, ttl: ttl, lastUsed: make(map[string]time.Time)}
+}
+
+// dir returns the directory of workspace id, creating it if needed.
+func (w *workspaceStore) dir(id string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", fmt.Errorf("invalid workspace id %q", id)
+	}
+	dir := filepath.Join(w.root, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create workspace %s: %w", id, err)
+	}
+	w.mu.Lock()
+	w.lastUsed[id] = time.Now()
+	w.mu.Unlock()
+	return dir, nil
+}
+
+// collect removes the workspaces that were not used within the TTL.
+func (w *workspaceStore) collect() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, used := range w.lastUsed {
+		if time.Since(used) > w.ttl {
+			slog.Info(fmt.Sprintf("Removing idle workspace %s", id))
+			os.RemoveAll(filepath.Join(w.root, id))
+			delete(w.lastUsed, id)
+		}
+	}
+}
+
+// run garbage-collects idle workspaces until ctx is cancelled.
+func (w *workspaceStore) run(ctx context.Context) {
+	ticker := time.NewTicker(w.ttl / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.collect()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *agentServer) GetWorkspaceManifest(ctx context.Context, in *pb.WorkspaceManifestRequest) (*pb.WorkspaceManifest, error) {
+	dir, err := s.workspaces.dir(in.GetWorkspaceId())
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := workspace.Scan(dir, workspace.Filter{})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.WorkspaceManifest{WorkspaceId: in.GetWorkspaceId(), Files: manifest.Proto()}, nil
+}
+
+func (s *agentServer) SyncWorkspace(stream pb.Agent_SyncWorkspaceServer) error {
+	header, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("failed to receive workspace header: %w", err)
+	}
+	dir, err := s.workspaces.dir(header.GetWorkspaceId())
+	if err != nil {
+		return err
+	}
+	if err := workspace.Remove(dir, header.GetDeleted()); err != nil {
+		return fmt.Errorf("failed to delete workspace files: %w", err)
+	}
+
+	cr := workspace.NewChunkReader(func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.GetData(), nil
+	})
+	written, err := workspace.Unpack(cr, dir)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to unpack workspace: %w", err)
+	}
+	slog.Info(fmt.Sprintf("Synced workspace %s: %d files written, %d deleted, %d bytes received", header.GetWorkspaceId(), written, len(header.GetDeleted()), cr.BytesRead))
+	return stream.SendAndClose(&pb.SyncWorkspaceResponse{
+		FilesWritten:  int32(written),
+		FilesDeleted:  int32(len(header.GetDeleted())),
+		BytesReceived: cr.BytesRead,
+	})
+}
+
+func (s *agentServer) FetchWorkspace(in *pb.FetchWorkspaceRequest, stream pb.Agent_FetchWorkspaceServer) error {
+	dir, err := s.workspaces.dir(in.GetWorkspaceId())
+	if err != nil {
+		return err
+	}
+	filter := workspace.Filter{Include: in.GetInclude(), Exclude: in.GetExclude()}
+	current, err := workspace.Scan(dir, filter)
+	if err != nil {
+		return err
+	}
+	changed, deleted := workspace.Diff(current, workspace.ManifestFromProto(in.GetKnown()))
+
+	if err := stream.Send(&pb.WorkspaceChunk{WorkspaceId: in.GetWorkspaceId(), Deleted: deleted}); err != nil {
+		return err
+	}
+	cw := workspace.NewChunkWriter(workspace.ChunkSize, func(data []byte) error {
+		return stream.Send(&pb.WorkspaceChunk{Data: data})
+	})
+	if err := workspace.Pack(dir, changed, cw); err != nil {
+		return fmt.Errorf("failed to pack workspace: %w", err)
+	}
+	return cw.Flush()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/audit"
+	"github.com/spf13/cobra"
+)
+
+// defaultAuditLogPath returns where a component keeps its audit log by default.
+func defaultAuditLogPath(name string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".sloth-runner", "audit", name+".jsonl")
+}
+
+// newAuditRecorder opens the audit log at path. It returns nil, auditing
+// nothing, when path is empty. Calls presenting token are recorded as
+// authenticated.
+func newAuditRecorder(path, component, node, token string, skip ...string) (*audit.Recorder, error) {
+	if path == "" {
+		return nil, nil
+	}
+	logger, err := audit.Open(path, audit.DefaultMaxSize, audit.DefaultMaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	r := &audit.Recorder{Logger: logger, Component: component, Node: node, Skip: make(map[string]bool)}
+	if token != "" {
+		r.Authenticated = func(ctx context.Context) bool { return authenticate(ctx, token) == nil }
+	}
+	for _, method := range skip {
+		r.Skip[method] = true
+	}
+	return r, nil
+}
+
+// renderAuditEvents prints audit events as a table.
+func renderAuditEvents(w io.Writer, events []audit.Event) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tCALLER\tRPC\tAGENT\tOPERATION\tSTATUS\tEXIT\tDURATION\tBYTES IN/OUT")
+	fmt.Fprintln(tw, "----\t------\t---\t-----\t---------\t------\t----\t--------\t------------")
+	for _, e := range events {
+		operation := e.Command
+		if e.Task != "" {
+			operation = "task " + e.Task
+		} else if e.Path != "" {
+			operation = "file " + e.Path
+		}
+		if len(operation) > 60 {
+			operation = operation[:57] + "..."
+		}
+		exit := "-"
+		if e.ExitCode != nil {
+			exit = fmt.Sprintf("%d", *e.ExitCode)
+		} else if e.Success != nil && !*e.Success {
+			exit = "failed"
+		}
+		caller := e.Caller
+		if e.ClaimedCaller != "" {
+			caller += " (claims " + e.ClaimedCaller + ")"
+		}
+		rpc := e.RPC[strings.LastIndex(e.RPC, "/")+1:]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d/%d\n",
+			e.Time.Local().Format("2006-01-02 15:04:05"), caller, rpc, e.Agent, operation, e.Code, exit,
+			(time.Duration(e.DurationMs) * time.Millisecond).String(), e.BytesIn, e.BytesOut)
+	}
+	return tw.Flush()
+}
+
+// runAuditQuery prints the events of an audit log that match the command's flags.
+func runAuditQuery(cmd *cobra.Command) error {
+	file, _ := cmd.Flags().GetString("file")
+	agentName, _ := cmd.Flags().GetString("agent")
+	caller, _ := cmd.Flags().GetString("caller")
+	rpc, _ := cmd.Flags().GetString("rpc")
+	since, _ := cmd.Flags().GetDuration("since")
+	output, _ := cmd.Flags().GetString("output")
+	if output != "table" && output != "json" {
+		return fmt.Errorf("invalid output format %q. Use table or json", output)
+	}
+
+	filter := audit.Filter{Agent: agentName, Caller: caller, RPC: rpc}
+	if since > 0 {
+		filter.Since = time.Now().Add(-since)
+	}
+	events, err := audit.Query(file, filter)
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		for _, e := range events {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(events) == 0 {
+		fmt.Fprintln(cmd.OutOrStdout(), "No matching audit events.")
+		return nil
+	}
+	return renderAuditEvents(cmd.OutOrStdout(), events)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/chalkan3/sloth-runner/internal/audit"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultMasterAddress = "localhost:50053"
+	masterEnvVar         = "SLOTH_RUNNER_MASTER"
+	clientConfigEnvVar   = "SLOTH_RUNNER_CONFIG"
+)
+
+// clientContext is a named master that CLI commands can talk to.
+type clientContext struct {
+	Name   string `yaml:"name"`
+	Master string `yaml:"master"`
+	Token  string `yaml:"token,omitempty"` // Shared token of a master that requires one
+}
+
+// clientConfig is the persistent CLI configuration stored in
+// ~/.sloth-runner/config.yaml, similar to a kubeconfig.
+type clientConfig struct {
+	CurrentContext string          `yaml:"current-context"`
+	Contexts       []clientContext `yaml:"contexts"`
+}
+
+// clientConfigPath returns the path of the client configuration file.
+func clientConfigPath() (string, error) {
+	if path := os.Getenv(clientConfigEnvVar); path != "" {
+		return path, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".sloth-runner", "config.yaml"), nil
+}
+
+// loadClientConfig reads the client configuration. A missing file yields an
+// empty configuration.
+func loadClientConfig(path string) (*clientConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &clientConfig{}, nil
+		}
+		return nil, fmt.Errorf("failed to read client config %s: %w", path, err)
+	}
+	var config clientConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse client config %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// save writes the client configuration, creating its directory if needed.
+func (c *clientConfig) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal client config: %w", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write client config %s: %w", path, err)
+	}
+	return nil
+}
+
+// context returns the context with the given name.
+func (c *clientConfig) context(name string) (*clientContext, bool) {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			return &c.Contexts[i], true
+		}
+	}
+	return nil, false
+}
+
+// setContext adds a context or updates the master of an existing one.
+func (c *clientConfig) setContext(name, master string) {
+	if ctx, ok := c.context(name); ok {
+		ctx.Master = master
+		return
+	}
+	c.Contexts = append(c.Contexts, clientContext{Name: name, Master: master})
+}
+
+// deleteContext removes a context, clearing it as current if needed.
+func (c *clientConfig) deleteContext(name string) bool {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			c.Contexts = append(c.Contexts[:i], c.Contexts[i+1:]...)
+			if c.CurrentContext == name {
+				c.CurrentContext = ""
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// resolveMasterAddress picks the master address for a CLI command. In order
+// of precedence: the --master flag, the SLOTH_RUNNER_MASTER environment
+// variable, the context selected with --context, the current context from
+// the client config, and finally localhost.
+func resolveMasterAddress(cmd *cobra.Command) (string, error) {
+	addr, _, err := resolveMaster(cmd)
+	return addr, err
+}
+
+// resolveMaster returns the master address for a CLI command, as
+// resolveMasterAddress does, and the token to present to it. The
+// SLOTH_RUNNER_TOKEN environment variable takes precedence over the token
+// of the selected context.
+func resolveMaster(cmd *cobra.Command) (string, string, error) {
+	token := os.Getenv(authTokenEnvVar)
+	if flag := cmd.Flags().Lookup("master"); flag != nil && flag.Changed {
+		return flag.Value.String(), token, nil
+	}
+	if addr := os.Getenv(masterEnvVar); addr != "" {
+		return addr, token, nil
+	}
+
+	path, err := clientConfigPath()
+	if err != nil {
+		return "", "", err
+	}
+	config, err := loadClientConfig(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	contextName := config.CurrentContext
+	if flag := cmd.Flags().Lookup("context"); flag != nil && flag.Changed {
+		contextName = flag.Value.String()
+	}
+	if contextName != "" {
+		ctx, ok := config.context(contextName)
+		if !ok {
+			return "", "", fmt.Errorf("context '%s' not found in %s", contextName, path)
+		}
+		if token == "" {
+			token = ctx.Token
+		}
+		return ctx.Master, token, nil
+	}
+	return defaultMasterAddress, token, nil
+}
+
+// dialMaster connects to the master selected for cmd.
+func dialMaster(cmd *cobra.Command) (*grpc.ClientConn, error) {
+	addr, token, err := resolveMaster(cmd)
+	if err != nil {
+		return nil, err
+	}
+	options := append(audit.DialOptions(), tokenDialOptions(token)...)
+	conn, err := grpc.Dial(addr, append(options, grpc.WithInsecure())...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to master at %s: %v", addr, err)
+	}
+	return conn, nil
+}
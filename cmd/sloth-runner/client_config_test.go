@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMasterFlagsCmd() *cobra.Command {
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().String("master", "", "")
+	cmd.Flags().String("context", "", "")
+	return cmd
+}
+
+func TestResolveMasterAddressPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv(clientConfigEnvVar, path)
+	t.Setenv(masterEnvVar, "")
+
+	// Nothing configured: fall back to localhost.
+	addr, err := resolveMasterAddress(newMasterFlagsCmd())
+	assert.NoError(t, err)
+	assert.Equal(t, defaultMasterAddress, addr)
+
+	config := &clientConfig{}
+	config.setContext("prod", "prod-master:50053")
+	config.setContext("staging", "staging-master:50053")
+	config.CurrentContext = "prod"
+	assert.NoError(t, config.save(path))
+
+	addr, err = resolveMasterAddress(newMasterFlagsCmd())
+	assert.NoError(t, err)
+	assert.Equal(t, "prod-master:50053", addr)
+
+	cmd := newMasterFlagsCmd()
+	cmd.Flags().Set("context", "staging")
+	addr, err = resolveMasterAddress(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, "staging-master:50053", addr)
+
+	t.Setenv(masterEnvVar, "env-master:50053")
+	addr, err = resolveMasterAddress(newMasterFlagsCmd())
+	assert.NoError(t, err)
+	assert.Equal(t, "env-master:50053", addr)
+
+	cmd = newMasterFlagsCmd()
+	cmd.Flags().Set("master", "flag-master:50053")
+	addr, err = resolveMasterAddress(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, "flag-master:50053", addr)
+
+	t.Setenv(masterEnvVar, "")
+	cmd = newMasterFlagsCmd()
+	cmd.Flags().Set("context", "missing")
+	_, err = resolveMasterAddress(cmd)
+	assert.Error(t, err)
+}
+
+func TestClientConfigDeleteContext(t *testing.T) {
+	config := &clientConfig{CurrentContext: "prod"}
+	config.setContext("prod", "a:1")
+	config.setContext("prod", "b:2")
+	assert.Len(t, config.Contexts, 1)
+	assert.Equal(t, "b:2", config.Contexts[0].Master)
+
+	assert.True(t, config.deleteContext("prod"))
+	assert.Empty(t, config.CurrentContext)
+	assert.False(t, config.deleteContext("prod"))
+}
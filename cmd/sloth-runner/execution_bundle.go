@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chalkan3/sloth-runner/internal/luainterface"
+	"github.com/chalkan3/sloth-runner/internal/types"
+	pb "github.com/chalkan3/sloth-runner/proto"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// pluginsDir returns the directory plugins are installed in.
+func pluginsDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".sloth-runner", "plugins"), nil
+}
+
+// forwardEnvVar lists, comma separated, more variables of the caller's
+// environment to ship to agents, besides those the tasks declare.
+const forwardEnvVar = "SLOTH_RUNNER_FORWARD_ENV"
+
+// forwardedEnv returns the variables of the caller's environment that are
+// shipped to agents: those the task groups and tasks name in forward_env,
+// and those listed in SLOTH_RUNNER_FORWARD_ENV. The shared token is never
+// shipped.
+func forwardedEnv(taskGroups map[string]types.TaskGroup) map[string]string {
+	var names []string
+	for _, group := range taskGroups {
+		names = append(names, group.ForwardEnv...)
+		for _, task := range group.Tasks {
+			names = append(names, task.ForwardEnv...)
+		}
+	}
+	names = append(names, strings.Split(os.Getenv(forwardEnvVar), ",")...)
+	env := make(map[string]string)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || name == authTokenEnvVar {
+			continue
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// buildExecutionBundle captures the Lua environment that L was prepared with
+// by loadAndRenderLuaConfig, so agents can rebuild it for delegated tasks.
+func buildExecutionBundle(L *lua.LState, taskGroups map[string]types.TaskGroup, configFilePath, renderedScript string) (*pb.ExecutionBundle, error) {
+	bundle := &pb.ExecutionBundle{
+		Script:     renderedScript,
+		ScriptPath: filepath.Base(configFilePath),
+		Imports:    luainterface.ImportedFiles(L),
+		Plugins:    make(map[string][]byte),
+		Env:        forwardedEnv(taskGroups),
+	}
+
+	if values := L.GetGlobal("values"); values != lua.LNil {
+		data, err := json.Marshal(luainterface.LuaValueToGo(values))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode values: %w", err)
+		}
+		bundle.ValuesJson = string(data)
+	}
+
+	dir, err := pluginsDir()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() && strings.HasPrefix(fi.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if fi.IsDir() || filepath.Ext(path) != ".lua" {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			bundle.Plugins[filepath.ToSlash(rel)] = content
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read plugins: %w", err)
+		}
+	}
+	return bundle, nil
+}
+
+// loadExecutionBundle prepares L the same way loadAndRenderLuaConfig did on
+// the caller, with workDir standing in for the directory of the config file.
+// os.getenv only sees the variables policy allows. prepare, if not nil, is
+// called once the built-in modules are loaded. The returned cleanup function
+// removes the unpacked plugins.
+func loadExecutionBundle(L *lua.LState, bundle *pb.ExecutionBundle, workDir string, policy *agentPolicy, prepare func(*lua.LState)) (map[string]types.TaskGroup, func(), error) {
+	pluginRoot, err := ioutil.TempDir("", "sloth-runner-plugins-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create plugin directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(pluginRoot) }
+
+	plugins := make(map[string]bool)
+	for rel, content := range bundle.GetPlugins() {
+		target := filepath.Join(pluginRoot, filepath.FromSlash(rel))
+		if !strings.HasPrefix(target, pluginRoot+string(os.PathSeparator)) {
+			cleanup()
+			return nil, nil, fmt.Errorf("invalid plugin path %q", rel)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to unpack plugin %s: %w", rel, err)
+		}
+		if err := ioutil.WriteFile(target, content, 0644); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to unpack plugin %s: %w", rel, err)
+		}
+		plugins[strings.SplitN(rel, "/", 2)[0]] = true
+	}
+	packagePath := L.GetGlobal("package").(*lua.LTable).RawGetString("path").String()
+	for name := range plugins {
+		packagePath = filepath.Join(pluginRoot, name, "?.lua") + ";" + packagePath
+	}
+	L.GetGlobal("package").(*lua.LTable).RawSetString("path", lua.LString(packagePath))
+
+	configFilePath := filepath.Join(workDir, bundle.GetScriptPath())
+	luainterface.OpenAll(L)
+	if prepare != nil {
+		prepare(L)
+	}
+	luainterface.OpenBundledImport(L, configFilePath, bundle.GetImports())
+
+	if bundle.GetValuesJson() != "" {
+		var values interface{}
+		if err := json.Unmarshal([]byte(bundle.GetValuesJson()), &values); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to decode values: %w", err)
+		}
+		L.SetGlobal("values", luainterface.GoValueToLua(L, values))
+	}
+
+	// os.getenv sees the forwarded variables of the caller first, then the
+	// agent's environment, both filtered by the policy's allowed_env.
+	env := bundle.GetEnv()
+	L.GetGlobal("os").(*lua.LTable).RawSetString("getenv", L.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		if !policy.allowsEnv(name) {
+			L.Push(lua.LNil)
+		} else if value, ok := env[name]; ok {
+			L.Push(lua.LString(value))
+		} else if value, ok := os.LookupEnv(name); ok {
+			L.Push(lua.LString(value))
+		} else {
+			L.Push(lua.LNil)
+		}
+		return 1
+	}))
+
+	taskGroups, err := luainterface.LoadTaskDefinitions(L, bundle.GetScript(), configFilePath)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to load task definitions: %w", err)
+	}
+	return taskGroups, cleanup, nil
+}
+
+// applyTaskParams merges params into the named task of group.
+func applyTaskParams(taskGroups map[string]types.TaskGroup, group, task string, params map[string]string) {
+	if len(params) == 0 {
+		return
+	}
+	for i := range taskGroups[group].Tasks {
+		t := &taskGroups[group].Tasks[i]
+		if t.Name != task {
+			continue
+		}
+		if t.Params == nil {
+			t.Params = make(map[string]string)
+		}
+		for key, value := range params {
+			t.Params[key] = value
+		}
+	}
+}
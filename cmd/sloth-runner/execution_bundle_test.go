@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chalkan3/sloth-runner/internal/luainterface"
+	"github.com/stretchr/testify/assert"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestExecutionBundleRoundTrip(t *testing.T) {
+	callerDir, _ := ioutil.TempDir("", "bundle-caller-")
+	defer os.RemoveAll(callerDir)
+	agentDir, _ := ioutil.TempDir("", "bundle-agent-")
+	defer os.RemoveAll(agentDir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(callerDir, "lib.lua"), []byte(`greeting = "hello"`), 0644))
+	script := `
+import("lib.lua")
+TaskDefinitions = { g = { description = "d", forward_env = { "BUNDLE_TEST_VAR", "SLOTH_RUNNER_TOKEN" },
+  tasks = { { name = "t", command = "true", forward_env = "BUNDLE_TASK_VAR" } } } }
+`
+	for name, value := range map[string]string{
+		"BUNDLE_TEST_VAR":          "from-caller",
+		"BUNDLE_TASK_VAR":          "from-task",
+		"BUNDLE_LISTED_VAR":        "listed",
+		"BUNDLE_SECRET_VAR":        "secret",
+		"SLOTH_RUNNER_TOKEN":       "token",
+		"SLOTH_RUNNER_FORWARD_ENV": "BUNDLE_LISTED_VAR, BUNDLE_MISSING_VAR",
+	} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	caller := lua.NewState()
+	defer caller.Close()
+	luainterface.OpenAll(caller)
+	luainterface.OpenImport(caller, filepath.Join(callerDir, "main.lua"))
+	caller.SetGlobal("values", luainterface.GoValueToLua(caller, map[string]interface{}{"name": "world"}))
+	callerGroups, err := luainterface.LoadTaskDefinitions(caller, script, filepath.Join(callerDir, "main.lua"))
+	assert.NoError(t, err)
+
+	bundle, err := buildExecutionBundle(caller, callerGroups, filepath.Join(callerDir, "main.lua"), script)
+	assert.NoError(t, err)
+	assert.Contains(t, bundle.GetImports(), "lib.lua")
+	// Only declared and listed variables are shipped, never the token.
+	assert.Equal(t, map[string]string{
+		"BUNDLE_TEST_VAR":   "from-caller",
+		"BUNDLE_TASK_VAR":   "from-task",
+		"BUNDLE_LISTED_VAR": "listed",
+	}, bundle.GetEnv())
+	bundle.Params = map[string]string{"p": "v"}
+
+	// The agent has none of the caller's files on disk.
+	agent := lua.NewState()
+	defer agent.Close()
+	groups, cleanup, err := loadExecutionBundle(agent, bundle, agentDir, nil, nil)
+	assert.NoError(t, err)
+	defer cleanup()
+
+	assert.Equal(t, "hello", agent.GetGlobal("greeting").String())
+	assert.Equal(t, "world", agent.GetGlobal("values").(*lua.LTable).RawGetString("name").String())
+	assert.NoError(t, agent.DoString(`env_value = os.getenv("BUNDLE_TEST_VAR")`))
+	assert.Equal(t, "from-caller", agent.GetGlobal("env_value").String())
+
+	// An agent policy's allowed_env hides the other variables, forwarded or
+	// not.
+	restricted := lua.NewState()
+	defer restricted.Close()
+	_, restrictedCleanup, err := loadExecutionBundle(restricted, bundle, agentDir, &agentPolicy{AllowedEnv: []string{"BUNDLE_TASK_*"}}, nil)
+	assert.NoError(t, err)
+	defer restrictedCleanup()
+	assert.NoError(t, restricted.DoString(`hidden, shown, home = os.getenv("BUNDLE_TEST_VAR"), os.getenv("BUNDLE_TASK_VAR"), os.getenv("HOME")`))
+	assert.Equal(t, lua.LNil, restricted.GetGlobal("hidden"))
+	assert.Equal(t, "from-task", restricted.GetGlobal("shown").String())
+	assert.Equal(t, lua.LNil, restricted.GetGlobal("home"))
+
+	applyTaskParams(groups, "g", "t", bundle.GetParams())
+	assert.Equal(t, "v", groups["g"].Tasks[0].Params["p"])
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/audit"
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/pterm/pterm"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// httpCallerHeader lets HTTP clients name the user they act for, like the
+// CLI does over gRPC. The audit log keeps it as the claimed caller, next to
+// the authenticated one. Without it the client's address is claimed.
+const httpCallerHeader = "X-Sloth-Runner-Caller"
+
+// maxHTTPRequestBody bounds the JSON bodies the gateway accepts.
+const maxHTTPRequestBody = 16 << 20
+
+// httpGateway serves the AgentRegistry service as JSON over HTTP. Every
+// request is relayed to the master's gRPC server with the client's
+// Authorization header, so both protocols share authentication and auditing.
+type httpGateway struct {
+	registry pb.AgentRegistryClient
+	mux      *http.ServeMux
+}
+
+// newHTTPGateway creates a gateway relaying to the master behind conn. With
+// ui, it also serves the dashboard at /.
+func newHTTPGateway(conn *grpc.ClientConn, ui bool) *httpGateway {
+	g := &httpGateway{registry: pb.NewAgentRegistryClient(conn), mux: http.NewServeMux()}
+	g.mux.HandleFunc("GET /v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPIDocument)
+	})
+	g.mux.HandleFunc("GET /v1/agents", g.listAgents)
+	g.mux.HandleFunc("GET /v1/agents/{name}", g.getAgent)
+	g.mux.HandleFunc("POST /v1/agents/{name}/commands", g.executeCommand)
+	g.mux.HandleFunc("POST /v1/agents/{name}/stop", g.stopAgent)
+	g.mux.HandleFunc("GET /v1/runs", g.listRuns)
+	g.mux.HandleFunc("POST /v1/runs", g.submitRun)
+	g.mux.HandleFunc("GET /v1/runs/{id}", g.getRun)
+	g.mux.HandleFunc("GET /v1/runs/{id}/logs", g.getRunLogs)
+	g.mux.HandleFunc("POST /v1/runs/{id}/cancel", g.cancelRun)
+	g.mux.HandleFunc("GET /v1/workflow-runs", g.listWorkflowRuns)
+	g.mux.HandleFunc("GET /v1/workflow-runs/{id}", g.getWorkflowRun)
+	g.mux.HandleFunc("GET /v1/workflow-runs/{id}/artifacts/{name}", g.getArtifact)
+	if ui {
+		// The page holds no data; it reads everything from the API with the user's token.
+		g.mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(dashboardPage)
+		})
+	}
+	return g
+}
+
+func (g *httpGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// startHTTPGateway serves the gateway on httpPort in the background,
+// relaying to the master's gRPC server at grpcAddr.
+func startHTTPGateway(httpPort int, grpcAddr string, ui bool) error {
+	conn, err := grpc.Dial(grpcAddr, append(audit.DialOptions(), grpc.WithInsecure())...)
+	if err != nil {
+		return fmt.Errorf("failed to connect the HTTP gateway to the master: %v", err)
+	}
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", httpPort))
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to listen on HTTP port: %v", err)
+	}
+	server := &http.Server{Handler: newHTTPGateway(conn, ui), ReadHeaderTimeout: 10 * time.Second}
+	pterm.Info.Printf("HTTP API listening at %v\n", lis.Addr())
+	if ui {
+		pterm.Info.Printf("Dashboard available at http://localhost:%d/\n", httpPort)
+	}
+	go func() {
+		if err := server.Serve(lis); err != nil && err != http.ErrServerClosed {
+			pterm.Error.Printf("HTTP API stopped: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// outgoing relays the credentials and identity of an HTTP request to gRPC.
+func outgoing(r *http.Request) *http.Request {
+	ctx := r.Context()
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", authorization)
+	}
+	caller := r.Header.Get(httpCallerHeader)
+	if caller == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		caller = "http@" + host
+	}
+	return r.WithContext(audit.WithCaller(ctx, caller))
+}
+
+// decodeBody reads a JSON request body into msg. An empty body leaves msg unchanged.
+func decodeBody(r *http.Request, msg proto.Message) error {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxHTTPRequestBody))
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to read request body: %v", err)
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil
+	}
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid request body: %v", err)
+	}
+	return nil
+}
+
+// writeMessage writes msg as JSON, using the field names of the proto file.
+func writeMessage(w http.ResponseWriter, code int, msg proto.Message) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(msg)
+	if err != nil {
+		writeError(w, status.Errorf(codes.Internal, "failed to encode response: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+// writeError writes a gRPC error as {"code": ..., "message": ...} with the
+// matching HTTP status.
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatusFromCode(st.Code()))
+	json.NewEncoder(w).Encode(map[string]string{"code": st.Code().String(), "message": st.Message()})
+}
+
+// httpStatusFromCode maps gRPC status codes to HTTP status codes.
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted, codes.FailedPrecondition:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled:
+		return 499 // Client closed request
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (g *httpGateway) listAgents(w http.ResponseWriter, r *http.Request) {
+	r = outgoing(r)
+	resp, err := g.registry.ListAgents(r.Context(), &pb.ListAgentsRequest{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, http.StatusOK, resp)
+}
+
+func (g *httpGateway) getAgent(w http.ResponseWriter, r *http.Request) {
+	r = outgoing(r)
+	resp, err := g.registry.ListAgents(r.Context(), &pb.ListAgentsRequest{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for _, agent := range resp.GetAgents() {
+		if agent.GetAgentName() == r.PathValue("name") {
+			writeMessage(w, http.StatusOK, agent)
+			return
+		}
+	}
+	writeError(w, status.Errorf(codes.NotFound, "agent not found: %s", r.PathValue("name")))
+}
+
+func (g *httpGateway) executeCommand(w http.ResponseWriter, r *http.Request) {
+	r = outgoing(r)
+	req := &pb.ExecuteCommandRequest{}
+	if err := decodeBody(r, req); err != nil {
+		writeError(w, err)
+		return
+	}
+	req.AgentName = r.PathValue("name")
+	if req.Command == "" {
+		writeError(w, status.Error(codes.InvalidArgument, "command is required"))
+		return
+	}
+	resp, err := g.registry.ExecuteCommand(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, http.StatusOK, resp)
+}
+
+func (g *httpGateway) stopAgent(w http.ResponseWriter, r *http.Request) {
+	r = outgoing(r)
+	req := &pb.StopAgentRequest{}
+	if err := decodeBody(r, req); err != nil {
+		writeError(w, err)
+		return
+	}
+	req.AgentName = r.PathValue("name")
+	resp, err := g.registry.StopAgent(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, http.StatusOK, resp)
+}
+
+func (g *httpGateway) listRuns(w http.ResponseWriter, r *http.Request) {
+	r = outgoing(r)
+	query := r.URL.Query()
+	resp, err := g.registry.ListJobs(r.Context(), &pb.ListJobsRequest{AgentName: query.Get("agent"), Status: query.Get("status")})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, http.StatusOK, resp)
+}
+
+func (g *httpGateway) submitRun(w http.ResponseWriter, r *http.Request) {
+	r = outgoing(r)
+	req := &pb.SubmitJobRequest{}
+	if err := decodeBody(r, req); err != nil {
+		writeError(w, err)
+		return
+	}
+	resp, err := g.registry.SubmitJob(r.Context(), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	job, err := g.registry.GetJob(r.Context(), &pb.GetJobRequest{JobId: resp.GetJobId()})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/v1/runs/"+job.GetJobId())
+	writeMessage(w, http.StatusCreated, job)
+}
+
+func (g *httpGateway) getRun(w http.ResponseWriter, r *http.Request) {
+	r = outgoing(r)
+	job, err := g.registry.GetJob(r.Context(), &pb.GetJobRequest{JobId: r.PathValue("id")})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, http.StatusOK, job)
+}
+
+// getRunLogs returns the standard output of a run as plain text, or its
+// standard error with ?stream=stderr.
+func (g *httpGateway) getRunLogs(w http.ResponseWriter, r *http.Request) {
+	r = outgoing(r)
+	stream := r.URL.Query().Get("stream")
+	if stream != "" && stream != "stdout" && stream != "stderr" {
+		writeError(w, status.Errorf(codes.InvalidArgument, "invalid stream %q. Use stdout or stderr", stream))
+		return
+	}
+	job, err := g.registry.GetJob(r.Context(), &pb.GetJobRequest{JobId: r.PathValue("id")})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	logs := job.GetStdout()
+	if stream == "stderr" {
+		logs = job.GetStderr()
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Sloth-Runner-Run-Status", job.GetStatus())
+	io.WriteString(w, logs)
+}
+
+func (g *httpGateway) cancelRun(w http.ResponseWriter, r *http.Request) {
+	r = outgoing(r)
+	jobID := r.PathValue("id")
+	if _, err := g.registry.GetJob(r.Context(), &pb.GetJobRequest{JobId: jobID}); err != nil {
+		writeError(w, err)
+		return
+	}
+	resp, err := g.registry.CancelJob(r.Context(), &pb.CancelJobRequest{JobId: jobID})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !resp.GetSuccess() {
+		writeError(w, status.Error(codes.FailedPrecondition, resp.GetMessage()))
+		return
+	}
+	writeMessage(w, http.StatusOK, resp)
+}
+
+func (g *httpGateway) listWorkflowRuns(w http.ResponseWriter, r *http.Request) {
+	r = outgoing(r)
+	resp, err := g.registry.ListWorkflowRuns(r.Context(), &pb.ListWorkflowRunsRequest{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, http.StatusOK, resp)
+}
+
+func (g *httpGateway) getWorkflowRun(w http.ResponseWriter, r *http.Request) {
+	r = outgoing(r)
+	run, err := g.registry.GetWorkflowRun(r.Context(), &pb.GetWorkflowRunRequest{RunId: r.PathValue("id")})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, http.StatusOK, run)
+}
+
+// getArtifact downloads an artifact of a workflow run.
+func (g *httpGateway) getArtifact(w http.ResponseWriter, r *http.Request) {
+	r = outgoing(r)
+	name := r.PathValue("name")
+	stream, err := g.registry.GetArtifact(r.Context(), &pb.GetArtifactRequest{RunId: r.PathValue("id"), Name: name})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// Errors arrive with the first message, so only then is the status known.
+	chunk, err := stream.Recv()
+	if err != nil && err != io.EOF {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	for err == nil {
+		if _, err := w.Write(chunk.GetData()); err != nil {
+			return
+		}
+		chunk, err = stream.Recv()
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+// newTestGateway serves a registry that requires token over gRPC and
+// returns an HTTP gateway relaying to it.
+func newTestGateway(t *testing.T, token string) (*agentRegistryServer, *httptest.Server) {
+	registry := newAgentRegistryServer()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer(tokenAuthServerOptions(token)...)
+	pb.RegisterAgentRegistryServer(server, registry)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	gateway := httptest.NewServer(newHTTPGateway(conn, true))
+	t.Cleanup(gateway.Close)
+	return registry, gateway
+}
+
+func doRequest(t *testing.T, method, url, token, body string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp, string(data)
+}
+
+func TestHTTPGatewayRequiresToken(t *testing.T) {
+	_, gateway := newTestGateway(t, "s3cret")
+
+	resp, body := doRequest(t, "GET", gateway.URL+"/v1/agents", "", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, body, `"code":"Unauthenticated"`)
+
+	resp, _ = doRequest(t, "GET", gateway.URL+"/v1/agents", "wrong", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, body = doRequest(t, "GET", gateway.URL+"/v1/openapi.json", "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(body), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+}
+
+func TestHTTPGatewayAgentsAndRuns(t *testing.T) {
+	const token = "s3cret"
+	registry, gateway := newTestGateway(t, token)
+	_, err := registry.RegisterAgent(context.Background(), &pb.RegisterAgentRequest{AgentName: "edge1", PullMode: true})
+	assert.NoError(t, err)
+
+	resp, body := doRequest(t, "GET", gateway.URL+"/v1/agents", token, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `"agent_name":"edge1"`)
+
+	resp, _ = doRequest(t, "GET", gateway.URL+"/v1/agents/edge1", token, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = doRequest(t, "GET", gateway.URL+"/v1/agents/missing", token, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = doRequest(t, "POST", gateway.URL+"/v1/runs", token, `{"agent_name": "missing", "command": "uptime"}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = doRequest(t, "POST", gateway.URL+"/v1/runs", token, `{"agent_name": "edge1"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = doRequest(t, "POST", gateway.URL+"/v1/runs", token, `{"bogus": true}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, body = doRequest(t, "POST", gateway.URL+"/v1/runs", token, `{"agent_name": "edge1", "command": "uptime"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	var run struct {
+		JobID  string `json:"job_id"`
+		Status string `json:"status"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(body), &run))
+	assert.Equal(t, jobStatusQueued, run.Status)
+	assert.Equal(t, "/v1/runs/"+run.JobID, resp.Header.Get("Location"))
+
+	// The agent reports its result; the run's status and logs reflect it.
+	leased := registry.jobs.Lease("edge1", 1)
+	assert.Len(t, leased, 1)
+	registry.jobs.Complete(&pb.CompleteJobRequest{AgentName: "edge1", JobId: run.JobID, Success: true, Stdout: "up 3 days\n", Stderr: "warning\n"})
+
+	resp, body = doRequest(t, "GET", gateway.URL+"/v1/runs/"+run.JobID, token, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `"status":"Succeeded"`)
+
+	resp, body = doRequest(t, "GET", gateway.URL+"/v1/runs/"+run.JobID+"/logs", token, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "up 3 days\n", body)
+	assert.Equal(t, jobStatusSucceeded, resp.Header.Get("X-Sloth-Runner-Run-Status"))
+	_, body = doRequest(t, "GET", gateway.URL+"/v1/runs/"+run.JobID+"/logs?stream=stderr", token, "")
+	assert.Equal(t, "warning\n", body)
+
+	resp, _ = doRequest(t, "POST", gateway.URL+"/v1/runs/"+run.JobID+"/cancel", token, "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode, "finished runs cannot be cancelled")
+	resp, _ = doRequest(t, "POST", gateway.URL+"/v1/runs/missing/cancel", token, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, body = doRequest(t, "GET", gateway.URL+"/v1/runs?agent=edge1&status=Succeeded", token, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, run.JobID)
+}
+
+func TestValidBearerToken(t *testing.T) {
+	assert.True(t, validBearerToken("Bearer abc", "abc"))
+	assert.False(t, validBearerToken("Bearer abd", "abc"))
+	assert.False(t, validBearerToken("abc", "abc"))
+	assert.False(t, validBearerToken("", "abc"))
+}
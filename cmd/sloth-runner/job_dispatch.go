@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/pterm/pterm"
+)
+
+// dispatchJob runs a job submitted for a push-mode agent. Such agents do
+// not poll the queue, so the master leases the job on the agent's behalf,
+// calls the agent and records the result like a pull-mode agent would.
+// The lease is renewed by the agent's heartbeats.
+func (s *agentRegistryServer) dispatchJob(jobID, agentName string) {
+	job, ok := s.jobs.LeaseJob(jobID, agentName)
+	if !ok {
+		return // Cancelled before it started
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.mu.Lock()
+	s.dispatched[jobID] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.dispatched, jobID)
+		s.mu.Unlock()
+	}()
+
+	result := &pb.CompleteJobRequest{AgentName: agentName, JobId: jobID}
+	client, conn, err := s.dialAgent(agentName)
+	if err != nil {
+		result.Error = err.Error()
+		result.ExitCode = -1
+		s.jobs.Complete(result)
+		return
+	}
+	defer conn.Close()
+
+	if job.GetTask() != nil {
+		resp, err := client.ExecuteTask(ctx, job.GetTask())
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			completeTaskJob(result, resp)
+		}
+	} else {
+		resp, err := client.RunCommand(ctx, &pb.RunCommandRequest{Command: job.GetCommand()})
+		if err != nil {
+			result.Error = err.Error()
+			result.ExitCode = -1
+		} else {
+			result.Success = resp.GetSuccess()
+			result.Stdout = resp.GetStdout()
+			result.Stderr = resp.GetStderr()
+			result.Error = resp.GetError()
+			result.ExitCode = resp.GetExitCode()
+		}
+	}
+	if !s.jobs.Complete(result) {
+		pterm.Warning.Printf("Discarding result of job %s on agent %s: the job was cancelled\n", jobID, agentName)
+	}
+}
+
+// abortDispatchedJob stops the call running a cancelled job on a push-mode agent.
+func (s *agentRegistryServer) abortDispatchedJob(jobID string) {
+	s.mu.Lock()
+	cancel, ok := s.dispatched[jobID]
+	s.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// completeTaskJob fills in the result of a task job from the agent's
+// response. The logs of the task's attempts go to stdout, so whoever
+// submitted the job gets them back; the runner's message goes to error
+// when the task failed.
+func completeTaskJob(result *pb.CompleteJobRequest, resp *pb.ExecuteTaskResponse) {
+	result.Success = resp.GetSuccess()
+	var logs strings.Builder
+	for _, r := range resp.GetResults() {
+		if len(resp.GetResults()) > 1 {
+			fmt.Fprintf(&logs, "--- attempt %d: %s ---\n", r.GetAttempt(), r.GetStatus())
+		}
+		logs.WriteString(r.GetLogs())
+	}
+	result.Stdout = logs.String()
+	if result.Stdout == "" {
+		result.Stdout = resp.GetOutput()
+	}
+	if !resp.GetSuccess() {
+		result.Error = resp.GetOutput()
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	jobStatusQueued    = "Queued"
+	jobStatusLeased    = "Leased"
+	jobStatusSucceeded = "Succeeded"
+	jobStatusFailed    = "Failed"
+	jobStatusCancelled = "Cancelled"
+
+	defaultJobLeaseTimeout = 60 * time.Second
+	defaultJobMaxAttempts  = 3
+	maxJobPullWait         = 30 * time.Second
+	defaultJobRetention    = 24 * time.Hour
+)
+
+// jobQueue is the master-side queue that pull-mode agents lease jobs from.
+// Leases are renewed by agent heartbeats; a lease that is not renewed in time
+// (the agent died or lost connectivity) puts the job back in the queue.
+type jobQueue struct {
+	mu      sync.Mutex
+	jobs    map[string]*pb.Job
+	order   []string // Submission order, used to hand out jobs FIFO
+	changed chan struct{}
+	// cancelled holds, per agent, the leased jobs that were cancelled and
+	// that the agent has not been told about yet.
+	cancelled map[string][]string
+	// retention is how long finished jobs are kept; zero keeps them forever.
+	retention time.Duration
+	now       func() time.Time
+}
+
+// newJobQueue creates an empty jobQueue.
+func newJobQueue() *jobQueue {
+	return &jobQueue{
+		jobs:      make(map[string]*pb.Job),
+		changed:   make(chan struct{}),
+		cancelled: make(map[string][]string),
+		retention: defaultJobRetention,
+		now:       time.Now,
+	}
+}
+
+// notifyLocked wakes up everyone waiting on the queue. Callers must hold q.mu.
+func (q *jobQueue) notifyLocked() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// Submit adds a new job to the queue and returns a copy of it.
+func (q *jobQueue) Submit(req *pb.SubmitJobRequest) (*pb.Job, error) {
+	if req.GetCommand() == "" && req.GetTask() == nil {
+		return nil, fmt.Errorf("job must have either a command or a task")
+	}
+
+	leaseTimeout := req.GetLeaseTimeoutSeconds()
+	if leaseTimeout <= 0 {
+		leaseTimeout = int32(defaultJobLeaseTimeout / time.Second)
+	}
+	maxAttempts := req.GetMaxAttempts()
+	if maxAttempts <= 0 {
+		maxAttempts = defaultJobMaxAttempts
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := &pb.Job{
+		JobId:               uuid.New().String(),
+		AgentName:           req.GetAgentName(),
+		Command:             req.GetCommand(),
+		Task:                req.GetTask(),
+		Status:              jobStatusQueued,
+		MaxAttempts:         maxAttempts,
+		LeaseTimeoutSeconds: leaseTimeout,
+		CreatedAt:           q.now().Unix(),
+	}
+	q.jobs[job.JobId] = job
+	q.order = append(q.order, job.JobId)
+	q.notifyLocked()
+	return cloneJob(job), nil
+}
+
+// Lease hands out up to n queued jobs that agentName is allowed to run.
+func (q *jobQueue) Lease(agentName string, n int) []*pb.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.leaseLocked(agentName, n)
+}
+
+func (q *jobQueue) leaseLocked(agentName string, n int) []*pb.Job {
+	var leased []*pb.Job
+	now := q.now()
+	for _, id := range q.order {
+		if len(leased) >= n {
+			break
+		}
+		job := q.jobs[id]
+		if job.Status != jobStatusQueued {
+			continue
+		}
+		if job.AgentName != "" && job.AgentName != agentName {
+			continue
+		}
+		job.Status = jobStatusLeased
+		job.LeasedBy = agentName
+		job.Attempts++
+		job.LeasedAt = now.Unix()
+		job.LeaseExpiresAt = now.Add(time.Duration(job.LeaseTimeoutSeconds) * time.Second).Unix()
+		leased = append(leased, cloneJob(job))
+	}
+	if len(leased) > 0 {
+		q.notifyLocked()
+	}
+	return leased
+}
+
+// LeaseJob leases one queued job to agentName. The master uses it to run
+// jobs on agents it can reach itself.
+func (q *jobQueue) LeaseJob(jobID, agentName string) (*pb.Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[jobID]
+	if !ok || job.Status != jobStatusQueued {
+		return nil, false
+	}
+	now := q.now()
+	job.Status = jobStatusLeased
+	job.LeasedBy = agentName
+	job.Attempts++
+	job.LeasedAt = now.Unix()
+	job.LeaseExpiresAt = now.Add(time.Duration(job.LeaseTimeoutSeconds) * time.Second).Unix()
+	q.notifyLocked()
+	return cloneJob(job), true
+}
+
+// Pull is the long-poll variant of Lease: when nothing is available for the
+// agent it blocks until a job shows up, the wait expires or ctx is done.
+// With no room for jobs (n <= 0) it blocks until the queue changes instead,
+// e.g. one of the agent's leases ends, so the agent does not poll in a loop.
+func (q *jobQueue) Pull(ctx context.Context, agentName string, n int, wait time.Duration) []*pb.Job {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		q.mu.Lock()
+		var jobs []*pb.Job
+		if n > 0 {
+			jobs = q.leaseLocked(agentName, n)
+		}
+		changed := q.changed
+		q.mu.Unlock()
+		if len(jobs) > 0 {
+			return jobs
+		}
+		if n <= 0 {
+			select {
+			case <-changed:
+			case <-timer.C:
+			case <-ctx.Done():
+			}
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Complete records the result reported by the agent that holds the lease.
+// Results for jobs that were cancelled or re-leased in the meantime are
+// ignored and reported as not accepted.
+func (q *jobQueue) Complete(req *pb.CompleteJobRequest) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[req.GetJobId()]
+	if !ok || job.Status != jobStatusLeased || job.LeasedBy != req.GetAgentName() {
+		return false
+	}
+	job.Status = jobStatusFailed
+	if req.GetSuccess() {
+		job.Status = jobStatusSucceeded
+	}
+	job.Stdout = req.GetStdout()
+	job.Stderr = req.GetStderr()
+	job.Error = req.GetError()
+	job.ExitCode = req.GetExitCode()
+	job.FinishedAt = q.now().Unix()
+	q.notifyLocked()
+	return true
+}
+
+// Cancel cancels a queued or leased job. For leased jobs the owning agent is
+// told to abort on its next heartbeat.
+func (q *jobQueue) Cancel(jobID string) (*pb.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return nil, fmt.Errorf("job not found: %s", jobID)
+	}
+	switch job.Status {
+	case jobStatusQueued:
+	case jobStatusLeased:
+		q.cancelled[job.LeasedBy] = append(q.cancelled[job.LeasedBy], job.JobId)
+	default:
+		return nil, fmt.Errorf("job %s already finished with status %s", jobID, job.Status)
+	}
+	job.Status = jobStatusCancelled
+	job.FinishedAt = q.now().Unix()
+	q.notifyLocked()
+	return cloneJob(job), nil
+}
+
+// RenewLeases extends the leases of every job held by agentName and returns
+// the IDs of its jobs that were cancelled since the last renewal.
+func (q *jobQueue) RenewLeases(agentName string) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	for _, job := range q.jobs {
+		if job.Status == jobStatusLeased && job.LeasedBy == agentName {
+			job.LeaseExpiresAt = now.Add(time.Duration(job.LeaseTimeoutSeconds) * time.Second).Unix()
+		}
+	}
+	cancelled := q.cancelled[agentName]
+	delete(q.cancelled, agentName)
+	return cancelled
+}
+
+// RequeueAgent puts every job leased by agentName back in the queue. It is
+// used when an agent re-registers, since a restarted agent has lost its jobs.
+func (q *jobQueue) RequeueAgent(agentName string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	requeued := 0
+	for _, job := range q.jobs {
+		if job.Status == jobStatusLeased && job.LeasedBy == agentName {
+			q.requeueLocked(job, fmt.Sprintf("agent %s restarted", agentName))
+			requeued++
+		}
+	}
+	delete(q.cancelled, agentName)
+	if requeued > 0 {
+		q.notifyLocked()
+	}
+	return requeued
+}
+
+// ExpireLeases requeues jobs whose lease ran out and returns how many it touched.
+func (q *jobQueue) ExpireLeases() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now().Unix()
+	expired := 0
+	for _, job := range q.jobs {
+		if job.Status == jobStatusLeased && job.LeaseExpiresAt <= now {
+			q.requeueLocked(job, fmt.Sprintf("lease held by agent %s expired", job.LeasedBy))
+			expired++
+		}
+	}
+	if expired > 0 {
+		q.notifyLocked()
+	}
+	return expired
+}
+
+// PruneFinished forgets the jobs that finished longer than the retention
+// ago and returns how many it removed.
+func (q *jobQueue) PruneFinished() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.retention <= 0 {
+		return 0
+	}
+
+	cutoff := q.now().Add(-q.retention).Unix()
+	order := q.order[:0]
+	pruned := 0
+	for _, id := range q.order {
+		job := q.jobs[id]
+		if isJobFinished(job) && job.FinishedAt <= cutoff {
+			delete(q.jobs, id)
+			pruned++
+			continue
+		}
+		order = append(order, id)
+	}
+	q.order = order
+	return pruned
+}
+
+// requeueLocked returns a leased job to the queue, or fails it once it has
+// used up its attempts. Callers must hold q.mu.
+func (q *jobQueue) requeueLocked(job *pb.Job, reason string) {
+	job.LeasedBy = ""
+	job.LeasedAt = 0
+	job.LeaseExpiresAt = 0
+	if job.Attempts >= job.MaxAttempts {
+		job.Status = jobStatusFailed
+		job.Error = fmt.Sprintf("%s after %d attempts", reason, job.Attempts)
+		job.FinishedAt = q.now().Unix()
+		return
+	}
+	job.Status = jobStatusQueued
+	job.Error = reason
+}
+
+// Get returns a copy of the job with the given ID.
+func (q *jobQueue) Get(jobID string) (*pb.Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return nil, false
+	}
+	return cloneJob(job), true
+}
+
+// Wait blocks until the job reaches a final status or ctx is done.
+func (q *jobQueue) Wait(ctx context.Context, jobID string) (*pb.Job, error) {
+	for {
+		q.mu.Lock()
+		job, ok := q.jobs[jobID]
+		if !ok {
+			q.mu.Unlock()
+			return nil, fmt.Errorf("job not found: %s", jobID)
+		}
+		if isJobFinished(job) {
+			q.mu.Unlock()
+			return cloneJob(job), nil
+		}
+		changed := q.changed
+		q.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// List returns copies of the jobs matching the optional agent and status
+// filters, oldest first.
+func (q *jobQueue) List(agentName, status string) []*pb.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var jobs []*pb.Job
+	for _, id := range q.order {
+		job := q.jobs[id]
+		if agentName != "" && job.AgentName != agentName && job.LeasedBy != agentName {
+			continue
+		}
+		if status != "" && job.Status != status {
+			continue
+		}
+		jobs = append(jobs, cloneJob(job))
+	}
+	return jobs
+}
+
+// LeasedCount returns how many jobs agentName currently holds.
+func (q *jobQueue) LeasedCount(agentName string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	count := 0
+	for _, job := range q.jobs {
+		if job.Status == jobStatusLeased && job.LeasedBy == agentName {
+			count++
+		}
+	}
+	return count
+}
+
+func isJobFinished(job *pb.Job) bool {
+	switch job.Status {
+	case jobStatusSucceeded, jobStatusFailed, jobStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func cloneJob(job *pb.Job) *pb.Job {
+	return proto.Clone(job).(*pb.Job)
+}
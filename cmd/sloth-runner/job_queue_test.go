@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobQueueLeaseAndComplete(t *testing.T) {
+	q := newJobQueue()
+	job, err := q.Submit(&pb.SubmitJobRequest{AgentName: "agent1", Command: "echo hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, jobStatusQueued, job.Status)
+
+	// Jobs targeted at another agent are not handed out.
+	assert.Empty(t, q.Lease("agent2", 1))
+
+	leased := q.Lease("agent1", 5)
+	assert.Len(t, leased, 1)
+	assert.Equal(t, jobStatusLeased, leased[0].Status)
+	assert.Equal(t, int32(1), leased[0].Attempts)
+
+	// Only the lease holder may complete the job.
+	assert.False(t, q.Complete(&pb.CompleteJobRequest{AgentName: "agent2", JobId: job.JobId, Success: true}))
+	assert.True(t, q.Complete(&pb.CompleteJobRequest{AgentName: "agent1", JobId: job.JobId, Success: true, Stdout: "hi"}))
+
+	done, err := q.Wait(context.Background(), job.JobId)
+	assert.NoError(t, err)
+	assert.Equal(t, jobStatusSucceeded, done.Status)
+	assert.Equal(t, "hi", done.Stdout)
+}
+
+func TestJobQueueExpiredLeaseIsRequeued(t *testing.T) {
+	now := time.Unix(1000, 0)
+	q := newJobQueue()
+	q.now = func() time.Time { return now }
+
+	job, _ := q.Submit(&pb.SubmitJobRequest{Command: "true", LeaseTimeoutSeconds: 10, MaxAttempts: 2})
+	assert.Len(t, q.Lease("agent1", 1), 1)
+
+	// A heartbeat keeps the lease alive.
+	now = now.Add(8 * time.Second)
+	q.RenewLeases("agent1")
+	now = now.Add(8 * time.Second)
+	assert.Equal(t, 0, q.ExpireLeases())
+
+	// The agent goes silent and the job goes back to the queue.
+	now = now.Add(20 * time.Second)
+	assert.Equal(t, 1, q.ExpireLeases())
+	requeued, _ := q.Get(job.JobId)
+	assert.Equal(t, jobStatusQueued, requeued.Status)
+
+	// Another agent picks it up; losing this lease as well exhausts the attempts.
+	assert.Len(t, q.Lease("agent2", 1), 1)
+	assert.Equal(t, 1, q.RequeueAgent("agent2"))
+	failed, _ := q.Get(job.JobId)
+	assert.Equal(t, jobStatusFailed, failed.Status)
+}
+
+func TestJobQueueCancelLeasedJobNotifiesAgent(t *testing.T) {
+	q := newJobQueue()
+	job, _ := q.Submit(&pb.SubmitJobRequest{Command: "sleep 100"})
+	q.Lease("agent1", 1)
+
+	_, err := q.Cancel(job.JobId)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{job.JobId}, q.RenewLeases("agent1"))
+	assert.Empty(t, q.RenewLeases("agent1"))
+
+	// A late result from the agent is ignored.
+	assert.False(t, q.Complete(&pb.CompleteJobRequest{AgentName: "agent1", JobId: job.JobId, Success: true}))
+
+	_, err = q.Cancel(job.JobId)
+	assert.Error(t, err)
+}
+
+func TestJobQueuePullWaitsForWork(t *testing.T) {
+	q := newJobQueue()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		q.Submit(&pb.SubmitJobRequest{Command: "true"})
+	}()
+	jobs := q.Pull(context.Background(), "agent1", 1, 2*time.Second)
+	assert.Len(t, jobs, 1)
+
+	assert.Empty(t, q.Pull(context.Background(), "agent1", 1, 10*time.Millisecond))
+}
+
+func TestJobQueuePullWithoutRoomWaitsForChange(t *testing.T) {
+	q := newJobQueue()
+	q.Submit(&pb.SubmitJobRequest{Command: "true"})
+
+	// With no free slot nothing is leased, and the call blocks instead of
+	// returning at once.
+	start := time.Now()
+	assert.Empty(t, q.Pull(context.Background(), "agent1", 0, 50*time.Millisecond))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// A change to the queue ends the wait, so the agent can ask again.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		q.Submit(&pb.SubmitJobRequest{Command: "true"})
+	}()
+	start = time.Now()
+	assert.Empty(t, q.Pull(context.Background(), "agent1", 0, 2*time.Second))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Len(t, q.List("", jobStatusQueued), 2)
+}
+
+func TestJobQueuePrunesFinishedJobs(t *testing.T) {
+	now := time.Unix(1000, 0)
+	q := newJobQueue()
+	q.now = func() time.Time { return now }
+	q.retention = time.Hour
+
+	done, _ := q.Submit(&pb.SubmitJobRequest{Command: "true"})
+	q.Lease("agent1", 1)
+	q.Complete(&pb.CompleteJobRequest{AgentName: "agent1", JobId: done.JobId, Success: true})
+	queued, _ := q.Submit(&pb.SubmitJobRequest{Command: "true"})
+
+	now = now.Add(30 * time.Minute)
+	assert.Equal(t, 0, q.PruneFinished())
+	now = now.Add(time.Hour)
+	assert.Equal(t, 1, q.PruneFinished())
+	_, ok := q.Get(done.JobId)
+	assert.False(t, ok)
+	// Unfinished jobs are kept however old they are.
+	jobs := q.List("", "")
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, queued.JobId, jobs[0].JobId)
+	}
+
+	q.retention = 0
+	q.Cancel(queued.JobId)
+	now = now.Add(48 * time.Hour)
+	assert.Equal(t, 0, q.PruneFinished(), "a zero retention keeps finished jobs")
+}
@@ -4,7 +4,8 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
-	// "encoding/json" // Removed
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,6 +16,9 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"text/tabwriter"
 	"text/template"
@@ -25,6 +29,8 @@ import (
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 
+	"github.com/chalkan3/sloth-runner/internal/audit"
+	"github.com/chalkan3/sloth-runner/internal/labels"
 	"github.com/chalkan3/sloth-runner/internal/luainterface"
 	"github.com/chalkan3/sloth-runner/internal/repl"
 	"github.com/chalkan3/sloth-runner/internal/scheduler"
@@ -32,6 +38,9 @@ import (
 	"github.com/chalkan3/sloth-runner/internal/types"
 	pb "github.com/chalkan3/sloth-runner/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 	lua "github.com/yuin/gopher-lua"
 )
 
@@ -367,7 +376,6 @@ var (
 	outputFile     string
 	templateName   string
 	schedulerConfigPath string
-	runAsScheduler bool
 	setFlags       []string // New: To store key-value pairs for template data
 	interactive    bool     // New: To enable interactive mode for task execution
 	version        = "dev" // será substituído em tempo de compilação
@@ -436,11 +444,10 @@ func loadAndRenderLuaConfig(L *lua.LState, configFilePath, env, shardsStr string
 	}
 
 	// Add plugins to Lua path
-	homeDir, err := os.UserHomeDir()
+	pluginsDir, err := pluginsDir()
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to get user home directory: %w", err)
+		return nil, "", err
 	}
-	pluginsDir := filepath.Join(homeDir, ".sloth-runner", "plugins")
 
 	if _, err := os.Stat(pluginsDir); !os.IsNotExist(err) {
 		pluginDirs, err := ioutil.ReadDir(pluginsDir)
@@ -640,7 +647,14 @@ It will monitor and execute tasks defined in the scheduler configuration file.`,
 		cmd.Println("Starting sloth-runner scheduler in background...")
 
 		// Re-execute the current binary in background with a special flag
-		command := execCommand(os.Args[0], "--run-as-scheduler", "--scheduler-config", schedulerConfigPath)
+		runArgs := []string{"scheduler", "run", "--scheduler-config", schedulerConfigPath}
+		// Jobs targeting agents go through the master selected here.
+		for _, name := range []string{"master", "context"} {
+			if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+				runArgs = append(runArgs, "--"+name, flag.Value.String())
+			}
+		}
+		command := execCommand(os.Args[0], runArgs...)
 		setSysProcAttr(command)
 		command.Stdout = os.Stdout // For debugging, redirect to /dev/null in production
 		command.Stderr = os.Stderr // For debugging, redirect to /dev/null in production
@@ -706,6 +720,151 @@ var disableCmd = &cobra.Command{
 
 
 
+var schedulerRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Runs the sloth-runner scheduler in the foreground",
+	Long: `The run command runs the scheduler in the foreground until it is interrupted.
+Scheduled tasks run inside the scheduler process, or on agents through the master (--master,
+$SLOTH_RUNNER_MASTER or the current context) when they target agents. The enable command starts it in the background.
+Changes to the configuration file are applied without a restart, and SIGHUP reloads it at once.
+The status command queries it over a unix socket next to the configuration file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sched := scheduler.NewScheduler(schedulerConfigPath)
+		sched.Runner = scheduledRunner(cmd)
+		if err := sched.LoadConfig(); err != nil {
+			return fmt.Errorf("failed to load scheduler config: %w", err)
+		}
+		sched.History = scheduler.NewHistory(sched.Config().History)
+		if err := sched.Start(); err != nil {
+			return fmt.Errorf("failed to start scheduler: %w", err)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := sched.ServeStatus(ctx, schedulerSocketPath()); err != nil {
+			fmt.Printf("Not serving the scheduler status: %v\n", err)
+		}
+		go sched.WatchConfig(ctx, schedulerReloadInterval)
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-hup:
+				fmt.Println("Received SIGHUP, reloading scheduler config...")
+				if err := sched.Reload(); err != nil {
+					fmt.Printf("Failed to reload scheduler config: %v\n", err)
+				}
+			case <-ctx.Done():
+				sched.Stop()
+				return nil
+			}
+		}
+	},
+}
+
+var schedulerHistoryCmd = &cobra.Command{
+	Use:   "history [job]",
+	Short: "Lists the recorded runs of scheduled tasks",
+	Long:  `The history command lists the latest runs of a scheduled task, or of every scheduled task, newest first.`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var job string
+		if len(args) == 1 {
+			job = args[0]
+		}
+		limit, _ := cmd.Flags().GetInt("limit")
+		return runSchedulerHistory(cmd, job, limit)
+	},
+}
+
+var schedulerLogsCmd = &cobra.Command{
+	Use:   "logs <run>",
+	Short: "Shows the outcome and logs of a scheduled run",
+	Long:  `The logs command shows the outcome of a recorded scheduled run and the logs of its tasks. A unique prefix of the run ID is enough.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSchedulerLogs(cmd, args[0])
+	},
+}
+
+var schedulerAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Adds a scheduled task to the configuration",
+	Long: `The add command validates a new scheduled task, including its cron expression, and adds it to the
+scheduler configuration file. A running scheduler picks it up without a restart.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		task := scheduler.ScheduledTask{}
+		task.Name, _ = cmd.Flags().GetString("name")
+		task.Schedule, _ = cmd.Flags().GetString("schedule")
+		task.TaskFile, _ = cmd.Flags().GetString("file")
+		task.TaskGroup, _ = cmd.Flags().GetString("group")
+		task.Tasks, _ = cmd.Flags().GetStringSlice("task")
+		task.Values, _ = cmd.Flags().GetString("values")
+		task.Timezone, _ = cmd.Flags().GetString("timezone")
+		return runSchedulerAdd(cmd, task)
+	},
+}
+
+var schedulerPauseCmd = &cobra.Command{
+	Use:   "pause <job>",
+	Short: "Pauses a scheduled task",
+	Long:  `The pause command stops scheduling a task, without removing it from the configuration.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setScheduledTaskPaused(cmd, args[0], true)
+	},
+}
+
+var schedulerResumeCmd = &cobra.Command{
+	Use:   "resume <job>",
+	Short: "Resumes a paused scheduled task",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setScheduledTaskPaused(cmd, args[0], false)
+	},
+}
+
+var schedulerRunNowCmd = &cobra.Command{
+	Use:   "run-now <job>",
+	Short: "Runs a scheduled task now",
+	Long: `The run-now command has the running scheduler run a scheduled task once, with its concurrency policy,
+timeout and retries, waits for it and records the run in the scheduler history. When no scheduler is
+running, the task runs in the foreground instead. Paused tasks can be run too.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSchedulerRunNow(cmd, args[0])
+	},
+}
+
+var schedulerStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows the state of the running scheduler and its jobs",
+	Long: `The status command asks the running scheduler, over a unix socket next to its configuration file,
+for its uptime, the hash of the configuration it applied, and for every job its next and previous
+fire time, whether it is running and for how long, and its last run. Use --output json for monitoring.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+		return runSchedulerStatus(cmd, output)
+	},
+}
+
+var schedulerSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Imports the schedules declared in a workflow file",
+	Long: `The sync command imports the schedules and triggers that the task groups and tasks of a workflow
+file declare into the scheduler configuration file. The imported tasks are owned by the workflow file:
+syncing it again updates them, and removes those it no longer declares. A running scheduler picks up
+the changes without a restart.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		workflow, _ := cmd.Flags().GetString("file")
+		values, _ := cmd.Flags().GetString("values")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		return runSchedulerSync(cmd, workflow, values, dryRun)
+	},
+}
+
 var listScheduledCmd = &cobra.Command{
 	Use:   "list",
 	Short: "Lists all configured scheduled tasks",
@@ -729,10 +888,33 @@ var listScheduledCmd = &cobra.Command{
 
 		pterm.DefaultSection.Println("Configured Scheduled Tasks")
 		tableData := pterm.TableData{
-			{"NAME", "SCHEDULE", "FILE", "GROUP", "TASK"},
+			{"NAME", "SCHEDULE", "FILE", "GROUP", "TASK", "STATE"},
+		}
+		chainedBy := make(map[string][]string)
+		for _, task := range sched.Config().ScheduledTasks {
+			for _, name := range append(append([]string{}, task.OnSuccess.Jobs...), task.OnFailure.Jobs...) {
+				chainedBy[name] = append(chainedBy[name], task.Name)
+			}
 		}
 		for _, task := range sched.Config().ScheduledTasks {
-			tableData = append(tableData, []string{task.Name, task.Schedule, task.TaskFile, task.TaskGroup, task.TaskName})
+			state := pterm.Green("active")
+			if task.Paused {
+				state = pterm.Yellow("paused")
+			}
+			schedule := task.Schedule
+			if triggers := task.Triggers(); len(triggers) > 0 {
+				if schedule != "" {
+					schedule += ", "
+				}
+				schedule += "on " + strings.Join(triggers, ", ")
+			}
+			if upstream := chainedBy[task.Name]; len(upstream) > 0 {
+				if schedule != "" {
+					schedule += ", "
+				}
+				schedule += "after " + strings.Join(upstream, ", ")
+			}
+			tableData = append(tableData, []string{task.Name, schedule, task.TaskFile, task.TaskGroup, strings.Join(task.Targets(), ", "), state})
 		}
 		pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
 		return nil
@@ -780,7 +962,7 @@ var deleteScheduledCmd = &cobra.Command{
 			return fmt.Errorf("failed to save updated scheduler config: %w", err)
 		}
 
-		cmd.Printf("Scheduled task '%s' deleted successfully. Please restart the scheduler for changes to take effect.\n", taskName)
+		cmd.Printf("Scheduled task '%s' deleted successfully. A running scheduler picks up the change automatically.\n", taskName)
 		return nil
 	},
 }
@@ -938,8 +1120,29 @@ var runCmd = &cobra.Command{
 			return nil
 		}
 		tr := taskrunner.NewTaskRunner(L, taskGroups, targetGroup, targetTasks, dryRun, interactive, surveyAsker, luaScript)
+		tr.Version = version
+		tr.DialOptions = tokenDialOptions(os.Getenv(authTokenEnvVar))
 		luainterface.OpenParallel(L, tr)
 		luainterface.OpenSession(L, tr)
+		bundle, err := buildExecutionBundle(L, taskGroups, configFilePath, luaScript)
+		if err != nil {
+			return err
+		}
+		tr.Bundle = bundle
+		// Ctrl-C cancels running tasks, including those delegated to agents.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		tr.Context = ctx
+		if report, _ := cmd.Flags().GetBool("report"); report {
+			reporter, err := newWorkflowReporter(cmd, configFilePath)
+			if err != nil {
+				return err
+			}
+			tr.Observer = reporter
+			runErr := tr.Run()
+			reporter.finish(ctx, runErr)
+			return runErr
+		}
 		if err := tr.Run(); err != nil {
 			return err // Directly return the error
 		}
@@ -1125,6 +1328,40 @@ var agentStartCmd = &cobra.Command{
 		agentName, _ := cmd.Flags().GetString("name")
 		daemon, _ := cmd.Flags().GetBool("daemon")
 		bindAddress, _ := cmd.Flags().GetString("bind-address")
+		pullMode, _ := cmd.Flags().GetBool("pull")
+		slots, _ := cmd.Flags().GetInt("slots")
+		labelFlags, _ := cmd.Flags().GetStringArray("label")
+		policyFile, _ := cmd.Flags().GetString("policy")
+		tokenFile, _ := cmd.Flags().GetString("token-file")
+		auditLog, _ := cmd.Flags().GetString("audit-log")
+		if !cmd.Flags().Changed("audit-log") {
+			auditLog = defaultAuditLogPath("agent-" + agentName)
+		}
+
+		agentLabels, err := labels.Parse(labelFlags)
+		if err != nil {
+			return err
+		}
+
+		token, err := loadAuthToken(tokenFile)
+		if err != nil {
+			return err
+		}
+		if tokenFile != "" {
+			if tokenFile, err = filepath.Abs(tokenFile); err != nil {
+				return err
+			}
+		}
+
+		var policy *agentPolicy
+		if policyFile != "" {
+			if policy, err = loadAgentPolicy(policyFile); err != nil {
+				return err
+			}
+			if policyFile, err = filepath.Abs(policyFile); err != nil {
+				return err
+			}
+		}
 
 		if daemon {
 			pidFile := filepath.Join("/tmp", fmt.Sprintf("sloth-runner-agent-%s.pid", agentName))
@@ -1148,7 +1385,18 @@ var agentStartCmd = &cobra.Command{
 			}
 			logFilePath := filepath.Join(logDir, fmt.Sprintf("agent-%s.log", agentName))
 
-			command := execCommand(os.Args[0], "agent", "start", "--port", strconv.Itoa(port), "--name", agentName, "--master", masterAddr, "--bind-address", bindAddress)
+			daemonArgs := []string{"agent", "start", "--port", strconv.Itoa(port), "--name", agentName, "--master", masterAddr, "--bind-address", bindAddress, "--pull=" + strconv.FormatBool(pullMode), "--slots", strconv.Itoa(slots)}
+			for _, label := range labelFlags {
+				daemonArgs = append(daemonArgs, "--label", label)
+			}
+			if policyFile != "" {
+				daemonArgs = append(daemonArgs, "--policy", policyFile)
+			}
+			if tokenFile != "" {
+				daemonArgs = append(daemonArgs, "--token-file", tokenFile)
+			}
+			daemonArgs = append(daemonArgs, "--audit-log", auditLog)
+			command := execCommand(os.Args[0], daemonArgs...)
 			setSysProcAttr(command)
 			stdoutFile, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 			if err != nil {
@@ -1176,6 +1424,11 @@ var agentStartCmd = &cobra.Command{
 			return nil
 		}
 
+		// Set when this process was started by an upgrade, which is rolled
+		// back if the agent cannot listen or register.
+		upgradeBackup := takeUpgradeBackup()
+		rolledBack := takeUpgradeRollback()
+
 		listenAddr := fmt.Sprintf(":%d", port)
 		if bindAddress != "" {
 			listenAddr = fmt.Sprintf("%s:%d", bindAddress, port)
@@ -1183,6 +1436,9 @@ var agentStartCmd = &cobra.Command{
 
 		lis, err := net.Listen("tcp", listenAddr)
 		if err != nil {
+			if upgradeBackup != "" {
+				return rollbackUpgrade(upgradeBackup, err)
+			}
 			return fmt.Errorf("failed to listen: %v", err)
 		}
 
@@ -1192,57 +1448,160 @@ var agentStartCmd = &cobra.Command{
 			reportAddress = fmt.Sprintf("%s:%d", bindAddress, port)
 		}
 
+		if pullMode && masterAddr == "" {
+			return fmt.Errorf("--pull requires --master")
+		}
+
+		// Workspaces live inside the policy's workdir, so tasks can run commands in them.
+		workspaceRoot := filepath.Join(os.TempDir(), "sloth-runner-workspaces")
+		if policy != nil {
+			slog.Info(fmt.Sprintf("Enforcing execution policy from %s", policyFile))
+			if policy.Workdir != "" {
+				workspaceRoot = filepath.Join(policy.Workdir, ".sloth-runner-workspaces")
+			}
+		}
+
+		recorder, err := newAuditRecorder(auditLog, "agent", agentName, token)
+		if err != nil {
+			return err
+		}
+		var serverOptions []grpc.ServerOption
+		if recorder != nil {
+			serverOptions = recorder.ServerOptions()
+		}
+		// The agent requires the token it presents to the master from
+		// the master and the runners delegating to it.
+		if token != "" {
+			serverOptions = append(serverOptions, tokenAuthServerOptions(token)...)
+		}
+		s := grpc.NewServer(serverOptions...)
+		server := &agentServer{
+			grpcServer: s,
+			workspaces: newWorkspaceStore(workspaceRoot, defaultWorkspaceTTL),
+			executions: newExecutionTracker(),
+			policy:     policy,
+
+			authenticated: token != "",
+		}
+		go server.workspaces.run(context.Background())
+
 		if masterAddr != "" {
-			conn, err := grpc.Dial(masterAddr, grpc.WithInsecure())
+			options := append(audit.DialOptions(), tokenDialOptions(token)...)
+			conn, err := grpc.Dial(masterAddr, append(options, grpc.WithInsecure())...)
 			if err != nil {
 				return fmt.Errorf("failed to connect to master: %v", err)
 			}
 			defer conn.Close()
 
 			registryClient := pb.NewAgentRegistryClient(conn)
-			_, err = registryClient.RegisterAgent(context.Background(), &pb.RegisterAgentRequest{
-				AgentName:    agentName,
-				AgentAddress: reportAddress,
-			})
+			register := func() error {
+				_, err := registryClient.RegisterAgent(context.Background(), &pb.RegisterAgentRequest{
+					AgentName:    agentName,
+					AgentAddress: reportAddress,
+					PullMode:     pullMode,
+					Slots:        int32(slots),
+					Labels:       agentLabels,
+					Version:      version,
+					RolledBack:   rolledBack,
+				})
+				if err == nil {
+					rolledBack = false // Reported once
+				}
+				return err
+			}
+			err = register()
+			if upgradeBackup != "" {
+				for deadline := time.Now().Add(upgradeRegisterTimeout); err != nil && time.Now().Before(deadline); {
+					time.Sleep(2 * time.Second)
+					err = register()
+				}
+				if err != nil {
+					lis.Close()
+					return rollbackUpgrade(upgradeBackup, fmt.Errorf("failed to register with master: %v", err))
+				}
+				os.Remove(upgradeBackup)
+				slog.Info(fmt.Sprintf("Agent upgraded to sloth-runner %s", version))
+			}
 			if err != nil {
 				return fmt.Errorf("failed to register with master: %v", err)
 			}
 			slog.Info(fmt.Sprintf("Agent registered with master at %s, reporting address %s", masterAddr, reportAddress))
 
+			var puller *jobPuller
+			if pullMode {
+				puller = newJobPuller(registryClient, agentName, slots, server)
+				go puller.Run(context.Background())
+				slog.Info(fmt.Sprintf("Pulling jobs from master with %d slot(s)", slots))
+			}
+
 			// Start heartbeat sender
 			go func() {
 				for {
-					_, err := registryClient.Heartbeat(context.Background(), &pb.HeartbeatRequest{AgentName: agentName})
+					cancelled, err := sendHeartbeat(registryClient, &pb.HeartbeatRequest{
+						AgentName: agentName,
+						Metrics:   collectAgentMetrics(server, os.TempDir()),
+						Version:   version,
+					}, register)
 					if err != nil {
 						slog.Error(fmt.Sprintf("Failed to send heartbeat to master: %v", err))
+					} else if puller != nil {
+						puller.Cancel(cancelled)
 					}
 					time.Sleep(5 * time.Second)
 				}
 			}()
 		}
 
-		s := grpc.NewServer()
-		server := &agentServer{grpcServer: s}
+		// Drain in-flight tasks when asked to terminate
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			sig := <-signals
+			slog.Info(fmt.Sprintf("Received %s", sig))
+			server.shutdown(defaultDrainGracePeriod)
+		}()
+
 		pb.RegisterAgentServer(s, server)
 		slog.Info(fmt.Sprintf("Agent listening at %v", lis.Addr()))
 		if err := s.Serve(lis); err != nil {
 			return fmt.Errorf("failed to serve: %v", err)
 		}
+		if backup := server.pendingUpgrade(); backup != "" {
+			return restartUpgradedAgent(backup)
+		}
 		return nil
 	},
 }
 var agentRunCmd = &cobra.Command{
-	Use:   "run <agent_name> <command>",
-	Short: "Executes a command on a remote agent",
-	Long:  `Executes an arbitrary shell command on a specified remote agent.`, 
-	Args:  cobra.ExactArgs(2),
+	Use:   "run <agent_name> <command> | run --selector <key=value,...> <command> | run --all <command>",
+	Short: "Executes a command on one or more remote agents",
+	Long: `Executes an arbitrary shell command on a specified remote agent.
+	With --selector or --all the command is fanned out to every matching agent,
+	optionally in rolling batches, and the per-agent results are aggregated.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		selector, _ := cmd.Flags().GetString("selector")
+		all, _ := cmd.Flags().GetBool("all")
+		if selector != "" && all {
+			return fmt.Errorf("--selector and --all are mutually exclusive")
+		}
+		if selector != "" || all {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		selector, _ := cmd.Flags().GetString("selector")
+		all, _ := cmd.Flags().GetBool("all")
+		if selector != "" || all {
+			return runAgentFanOut(cmd, selector, args[0])
+		}
+
 		agentName := args[0]
 		command := args[1]
 
-		conn, err := grpc.Dial("localhost:50053", grpc.WithInsecure()) // Master's AgentRegistry address
+		conn, err := dialMaster(cmd)
 		if err != nil {
-			return fmt.Errorf("failed to connect to master: %v", err)
+			return err
 		}
 		defer conn.Close()
 
@@ -1289,6 +1648,72 @@ var agentRunCmd = &cobra.Command{
 	},
 }
 
+// runAgentFanOut runs a command on every agent matching the selector (or on
+// all agents when the selector is empty) and prints the aggregated results.
+func runAgentFanOut(cmd *cobra.Command, selectorStr, command string) error {
+	parallelism, _ := cmd.Flags().GetInt("parallel")
+	batchSize, _ := cmd.Flags().GetInt("batch-size")
+	failFast, _ := cmd.Flags().GetBool("fail-fast")
+	output, _ := cmd.Flags().GetString("output")
+	if output != "table" && output != "json" {
+		return fmt.Errorf("invalid --output %q. Expected table or json", output)
+	}
+
+	var selector map[string]string
+	if selectorStr != "" {
+		var err error
+		if selector, err = labels.ParseSelector(selectorStr); err != nil {
+			return err
+		}
+	}
+
+	conn, err := dialMaster(cmd)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	registryClient := pb.NewAgentRegistryClient(conn)
+	listResp, err := registryClient.ListAgents(context.Background(), &pb.ListAgentsRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to list agents: %v", err)
+	}
+
+	agents, inactive := selectAgents(listResp.GetAgents(), selector)
+	if len(inactive) > 0 {
+		pterm.Warning.Printf("Ignoring inactive agents: %s\n", strings.Join(inactive, ", "))
+	}
+	if len(agents) == 0 {
+		return fmt.Errorf("no active agents match the selection")
+	}
+	if output == "table" {
+		pterm.Info.Printf("Running on %d agent(s): %s\n", len(agents), command)
+	}
+
+	results := runFanOut(context.Background(), agents, fanOutOptions{
+		Parallelism: parallelism,
+		BatchSize:   batchSize,
+		FailFast:    failFast,
+	}, func(ctx context.Context, agent string) fanOutResult {
+		return executeOnAgent(ctx, registryClient, agent, command)
+	})
+
+	if err := renderFanOutResults(cmd.OutOrStdout(), results, output); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Status != "Success" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("command did not succeed on %d of %d agent(s)", failed, len(results))
+	}
+	return nil
+}
+
 var agentListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "Lists all registered agents",
@@ -1300,60 +1725,73 @@ var agentListCmd = &cobra.Command{
 			slog.SetDefault(slog.New(pterm.NewSlogHandler(&pterm.DefaultLogger)))
 			fmt.Println("Debug mode enabled for agent list command.")
 		}
-		conn, err := grpc.Dial("localhost:50053", grpc.WithInsecure()) // Master's AgentRegistry address
+		output, _ := cmd.Flags().GetString("output")
+		if output != "table" && output != "json" {
+			return fmt.Errorf("invalid output format %q. Use table or json", output)
+		}
+		conn, err := dialMaster(cmd)
 		if err != nil {
 			fmt.Printf("Error connecting to master: %v\n", err)
-			return fmt.Errorf("failed to connect to master: %v", err)
+			return err
 		}
 		defer conn.Close()
-		fmt.Printf("Connected to master: %v\n", conn)
+		if debug {
+			fmt.Printf("Connected to master: %v\n", conn)
+		}
 
 		registryClient := pb.NewAgentRegistryClient(conn)
-		fmt.Printf("Registry client created: %v\n", registryClient)
 
 		resp, err := registryClient.ListAgents(context.Background(), &pb.ListAgentsRequest{})
 		if err != nil {
 			return fmt.Errorf("failed to list agents: %v", err)
 		}
 
+		if output == "json" {
+			data, err := protojson.MarshalOptions{Multiline: true, Indent: "  ", UseProtoNames: true, EmitUnpopulated: true}.Marshal(resp)
+			if err != nil {
+				return fmt.Errorf("failed to encode agents: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
 		if len(resp.GetAgents()) == 0 {
 			fmt.Println("No agents registered.")
 			return nil
 		}
 
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-		fmt.Fprintln(w, "AGENT NAME\tADDRESS\tSTATUS\tLAST HEARTBEAT")
-		fmt.Fprintln(w, "------------\t----------\t------\t--------------")
+		if err := renderAgentList(os.Stdout, resp.GetAgents(), time.Now()); err != nil {
+			return err
+		}
 		for _, agent := range resp.GetAgents() {
-			status := agent.GetStatus()
-			coloredStatus := status
-			if status == "Active" {
-				coloredStatus = pterm.Green(status)
-			} else {
-				coloredStatus = pterm.Red(status)
+			if agent.GetVersionSkew() {
+				pterm.Warning.Printf("Some agents do not run the master's version (%s); upgrade them with 'sloth-runner agent upgrade'.\n", resp.GetMasterVersion())
+				break
 			}
-			fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", agent.GetAgentName(), agent.GetAgentAddress(), coloredStatus, agent.GetLastHeartbeat())
 		}
-		return w.Flush()
+		return nil
 	},
 }
 var agentStopCmd = &cobra.Command{
 	Use:   "stop <agent_name>",
 	Short: "Stops a remote agent",
-	Long:  `Stops a specified remote agent gracefully.`, 
+	Long:  `Stops a specified remote agent gracefully. The agent stops accepting work and
+	lets in-flight tasks finish for up to --grace-period before cancelling them.`,
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		agentName := args[0]
 
-		conn, err := grpc.Dial("localhost:50053", grpc.WithInsecure()) // Master's AgentRegistry address
+		conn, err := dialMaster(cmd)
 		if err != nil {
-			return fmt.Errorf("failed to connect to master: %v", err)
+			return err
 		}
 		defer conn.Close()
 
+		gracePeriod, _ := cmd.Flags().GetDuration("grace-period")
 		registryClient := pb.NewAgentRegistryClient(conn)
 		_, err = registryClient.StopAgent(context.Background(), &pb.StopAgentRequest{
-			AgentName: agentName,
+			AgentName:          agentName,
+			GracePeriodSeconds: int32(gracePeriod / time.Second),
 		})
 		if err != nil {
 			return fmt.Errorf("failed to stop agent %s: %v", agentName, err)
@@ -1364,72 +1802,611 @@ var agentStopCmd = &cobra.Command{
 	},
 }
 
+var agentUpgradeCmd = &cobra.Command{
+	Use:   "upgrade <agent_name>... | upgrade --all",
+	Short: "Upgrades remote agents to a new sloth-runner binary",
+	Long: `Pushes a sloth-runner binary to agents through the master, by default the
+	binary running this command, with its SHA-256. Only agents started with a
+	token accept upgrades. Each agent checks the SHA-256 and that the binary runs,
+	drains, and restarts in place with it. An agent that fails to register with the master
+	again rolls back to its previous binary. Agents are upgraded one at a time.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		if all {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		binary, _ := cmd.Flags().GetString("binary")
+		checksum, _ := cmd.Flags().GetString("sha256")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		return runAgentUpgrade(cmd, args, all, binary, checksum, timeout)
+	},
+}
+
+var agentInstallServiceCmd = &cobra.Command{
+	Use:   "install-service --name <agent_name> [agent start flags]",
+	Short: "Installs the agent as a systemd service",
+	Long: `Generates a systemd unit running "agent start" with the given flags, as
+	root by default, with logs in the journal and restarts on failure. The unit is
+	enabled and started. Use --print to only print the unit.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		agentName, _ := cmd.Flags().GetString("name")
+		if agentName == "" {
+			return fmt.Errorf("--name is required")
+		}
+		serviceUser, _ := cmd.Flags().GetString("user")
+		unitDir, _ := cmd.Flags().GetString("unit-dir")
+		print, _ := cmd.Flags().GetBool("print")
+		exe, err := agentExecutable()
+		if err != nil {
+			return err
+		}
+		startArgs, err := serviceArgs(cmd.Flags(), "user", "unit-dir", "print")
+		if err != nil {
+			return err
+		}
+		return installService(cmd.OutOrStdout(), serviceUnit{
+			Name:        agentServiceUnit(agentName),
+			Description: "sloth-runner agent " + agentName,
+			User:        serviceUser,
+			ExecStart:   append([]string{exe, "agent", "start"}, startArgs...),
+			// The watchdog of an upgrade must outlive the agent it rolls back.
+			KillMode: "process",
+		}, unitDir, print)
+	},
+}
+
+var agentStatusCmd = &cobra.Command{
+	Use:   "status <agent_name>",
+	Short: "Shows the status of a local agent service",
+	Long: `Shows the status of the agent's systemd service on this host, or of an
+	agent started with --daemon if no service is installed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pidFile := filepath.Join("/tmp", fmt.Sprintf("sloth-runner-agent-%s.pid", args[0]))
+		return runServiceStatus(cmd, agentServiceUnit(args[0]), pidFile)
+	},
+}
+
+var agentUpgradeWatchdogCmd = &cobra.Command{
+	Use:    "upgrade-watchdog --pid <pid> --backup <path> -- <agent args>...",
+	Short:  "Rolls back an agent upgrade if the upgraded agent fails to register",
+	Hidden: true, // Started by upgrading agents
+	RunE: func(cmd *cobra.Command, args []string) error {
+		detached, _ := cmd.Flags().GetBool("detached")
+		if !detached {
+			return detachUpgradeWatchdog(os.Args[3:])
+		}
+		pid, _ := cmd.Flags().GetInt("pid")
+		backup, _ := cmd.Flags().GetString("backup")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		return runUpgradeWatchdog(pid, backup, timeout, args)
+	},
+}
+
+var agentShellCmd = &cobra.Command{
+	Use:   "shell <agent_name>",
+	Short: "Opens an interactive shell on a remote agent",
+	Long: `Opens an interactive shell on a remote agent through the master, on a
+	pseudo-terminal, without a separate SSH connection. Use --command to run a
+	single interactive program instead of the login shell.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		command, _ := cmd.Flags().GetString("command")
+		exitCode, err := runAgentShell(cmd, args[0], command)
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			return fmt.Errorf("remote shell exited with code %d", exitCode)
+		}
+		return nil
+	},
+}
+
+var agentCpCmd = &cobra.Command{
+	Use:   "cp <local_path> <agent_name>:<path> | cp <agent_name>:<path> <local_path>",
+	Short: "Copies a file to or from a remote agent",
+	Long: `Copies a single file between this host and a remote agent through the master.
+	Relative paths on the agent are relative to its home directory, and copying
+	into a directory keeps the file name.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAgentCopy(cmd, args[0], args[1])
+	},
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspects the audit log",
+	Long:  `The audit command reads the audit events recorded by the master and the agents.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var auditQueryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Lists audit events",
+	Long: `Lists the audit events of an audit log, rotated files included, oldest first.
+	By default the master's log on this host is read; use --file for an agent's log.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAuditQuery(cmd)
+	},
+}
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Manages jobs in the master's queue",
+	Long:  `The jobs command provides subcommands to submit, list, and cancel jobs queued on the master. Pull-mode agents lease their jobs; jobs for other agents are run by the master right away.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var jobsSubmitCmd = &cobra.Command{
+	Use:   "submit <command>",
+	Short: "Queues a command on the master",
+	Long:  `Queues a shell command on the master. Pull-mode agents lease it from the queue; without --agent any of them may take it.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		agentName, _ := cmd.Flags().GetString("agent")
+		leaseTimeout, _ := cmd.Flags().GetDuration("lease-timeout")
+		maxAttempts, _ := cmd.Flags().GetInt("max-attempts")
+
+		conn, err := dialMaster(cmd)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		registryClient := pb.NewAgentRegistryClient(conn)
+		resp, err := registryClient.SubmitJob(context.Background(), &pb.SubmitJobRequest{
+			AgentName:           agentName,
+			Command:             args[0],
+			LeaseTimeoutSeconds: int32(leaseTimeout / time.Second),
+			MaxAttempts:         int32(maxAttempts),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to submit job: %v", err)
+		}
+
+		cmd.Printf("Job %s queued.\n", resp.GetJobId())
+		return nil
+	},
+}
+
+var jobsListCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "Lists jobs known to the master",
+	Long:    `Lists queued, running, and finished jobs known to the master.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		agentName, _ := cmd.Flags().GetString("agent")
+		status, _ := cmd.Flags().GetString("status")
+
+		conn, err := dialMaster(cmd)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		registryClient := pb.NewAgentRegistryClient(conn)
+		resp, err := registryClient.ListJobs(context.Background(), &pb.ListJobsRequest{AgentName: agentName, Status: status})
+		if err != nil {
+			return fmt.Errorf("failed to list jobs: %v", err)
+		}
+
+		if len(resp.GetJobs()) == 0 {
+			fmt.Println("No jobs found.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "JOB ID\tAGENT\tSTATUS\tATTEMPTS\tCREATED\tCOMMAND")
+		fmt.Fprintln(w, "------\t-----\t------\t--------\t-------\t-------")
+		for _, job := range resp.GetJobs() {
+			agent := job.GetAgentName()
+			if job.GetLeasedBy() != "" {
+				agent = job.GetLeasedBy()
+			} else if agent == "" {
+				agent = "*"
+			}
+			what := job.GetCommand()
+			if job.GetTask() != nil {
+				what = fmt.Sprintf("task %s/%s", job.GetTask().GetTaskGroup(), job.GetTask().GetTaskName())
+			}
+			created := time.Unix(job.GetCreatedAt(), 0).Format(time.RFC3339)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\t%s\n", job.GetJobId(), agent, colorJobStatus(job.GetStatus()), job.GetAttempts(), job.GetMaxAttempts(), created, what)
+		}
+		return w.Flush()
+	},
+}
+
+var jobsCancelCmd = &cobra.Command{
+	Use:   "cancel <job_id>",
+	Short: "Cancels a queued or running job",
+	Long:  `Cancels a job. Queued jobs are dropped; running jobs are aborted by their agent on its next heartbeat.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conn, err := dialMaster(cmd)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		registryClient := pb.NewAgentRegistryClient(conn)
+		resp, err := registryClient.CancelJob(context.Background(), &pb.CancelJobRequest{JobId: args[0]})
+		if err != nil {
+			return fmt.Errorf("failed to cancel job %s: %v", args[0], err)
+		}
+		if !resp.GetSuccess() {
+			return fmt.Errorf("failed to cancel job %s: %s", args[0], resp.GetMessage())
+		}
+
+		cmd.Println(resp.GetMessage())
+		return nil
+	},
+}
+
+func colorJobStatus(status string) string {
+	switch status {
+	case jobStatusSucceeded:
+		return pterm.Green(status)
+	case jobStatusFailed, jobStatusCancelled:
+		return pterm.Red(status)
+	case jobStatusLeased:
+		return pterm.Cyan(status)
+	default:
+		return pterm.Yellow(status)
+	}
+}
+
+var contextCmd = &cobra.Command{
+	Use:   "context",
+	Short: "Manages named master contexts",
+	Long: `The context command manages named masters stored in the client config file
+	(~/.sloth-runner/config.yaml), so agent and job commands can target several fleets.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var contextSetCmd = &cobra.Command{
+	Use:   "set <name> --master <address> [--token <token>]",
+	Short: "Creates or updates a context",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		master, _ := cmd.Flags().GetString("master")
+		if master == "" {
+			return fmt.Errorf("--master is required")
+		}
+		path, err := clientConfigPath()
+		if err != nil {
+			return err
+		}
+		config, err := loadClientConfig(path)
+		if err != nil {
+			return err
+		}
+		config.setContext(args[0], master)
+		if cmd.Flags().Changed("token") {
+			token, _ := cmd.Flags().GetString("token")
+			ctx, _ := config.context(args[0])
+			ctx.Token = token
+		}
+		if config.CurrentContext == "" {
+			config.CurrentContext = args[0]
+		}
+		if err := config.save(path); err != nil {
+			return err
+		}
+		cmd.Printf("Context '%s' set to master %s.\n", args[0], master)
+		return nil
+	},
+}
+
+var contextUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Switches the current context",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := clientConfigPath()
+		if err != nil {
+			return err
+		}
+		config, err := loadClientConfig(path)
+		if err != nil {
+			return err
+		}
+		if _, ok := config.context(args[0]); !ok {
+			return fmt.Errorf("context '%s' not found. Create it with 'sloth-runner context set %s --master <address>'", args[0], args[0])
+		}
+		config.CurrentContext = args[0]
+		if err := config.save(path); err != nil {
+			return err
+		}
+		cmd.Printf("Switched to context '%s'.\n", args[0])
+		return nil
+	},
+}
+
+var contextListCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "Lists the configured contexts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := clientConfigPath()
+		if err != nil {
+			return err
+		}
+		config, err := loadClientConfig(path)
+		if err != nil {
+			return err
+		}
+		if len(config.Contexts) == 0 {
+			cmd.Println("No contexts configured.")
+			return nil
+		}
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "CURRENT\tNAME\tMASTER")
+		for _, c := range config.Contexts {
+			current := ""
+			if c.Name == config.CurrentContext {
+				current = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", current, c.Name, c.Master)
+		}
+		return w.Flush()
+	},
+}
+
+var contextCurrentCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Shows the master address CLI commands will use",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		addr, err := resolveMasterAddress(cmd)
+		if err != nil {
+			return err
+		}
+		path, err := clientConfigPath()
+		if err != nil {
+			return err
+		}
+		config, err := loadClientConfig(path)
+		if err != nil {
+			return err
+		}
+		name := config.CurrentContext
+		if override, _ := cmd.Flags().GetString("context"); override != "" {
+			name = override
+		}
+		if name == "" {
+			name = "(none)"
+		}
+		cmd.Printf("Current context: %s\nMaster: %s\n", name, addr)
+		return nil
+	},
+}
+
+var contextDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Deletes a context",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := clientConfigPath()
+		if err != nil {
+			return err
+		}
+		config, err := loadClientConfig(path)
+		if err != nil {
+			return err
+		}
+		if !config.deleteContext(args[0]) {
+			return fmt.Errorf("context '%s' not found", args[0])
+		}
+		if err := config.save(path); err != nil {
+			return err
+		}
+		cmd.Printf("Context '%s' deleted.\n", args[0])
+		return nil
+	},
+}
+
 type agentServer struct {
 	pb.UnimplementedAgentServer
 	grpcServer *grpc.Server
+	workspaces *workspaceStore
+	executions *executionTracker
+	policy     *agentPolicy // nil when the agent runs anything
+	// authenticated is set when callers must present the token, which
+	// upgrades require.
+	authenticated bool
+
+	upgradeMu     sync.Mutex
+	upgradeBackup string // Previous binary, once an upgrade is installed
 }
 
 
 func (s *agentServer) RunCommand(ctx context.Context, in *pb.RunCommandRequest) (*pb.RunCommandResponse, error) {
-	slog.Info(fmt.Sprintf("Executing command on agent: %s", in.GetCommand()))
+	return s.runCommand(ctx, in.GetCommand())
+}
+
+// runCommand runs a shell command on the agent host under the agent's
+// policy. It is shared by the RunCommand RPC and by jobs pulled from the
+// master's queue. Policy violations are returned as errors.
+func (s *agentServer) runCommand(ctx context.Context, command string) (*pb.RunCommandResponse, error) {
+	slog.Info(fmt.Sprintf("Executing command on agent: %s", command))
+	ctx, done, err := s.executions.start(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
 
-	cmd := exec.Command("bash", "-c", in.GetCommand())
+	cmd := exec.Command("bash", "-c", command)
+	if err := s.policy.prepareCommand(cmd, command); err != nil {
+		slog.Warn(fmt.Sprintf("Rejected command %q: %v", command, err))
+		return nil, err
+	}
+	if s.policy != nil && s.policy.MaxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.policy.MaxRuntime)
+		defer cancel()
+	}
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	var exceeded atomic.Bool
+	cmd.Stdout = s.policy.limitOutput(&stdout, func() { exceeded.Store(true) })
+	cmd.Stderr = s.policy.limitOutput(&stderr, func() { exceeded.Store(true) })
 
-	err := cmd.Run()
+	err = luainterface.RunCommandContext(ctx, cmd)
+	if exceeded.Load() {
+		return nil, s.policy.outputLimitExceeded()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, status.Errorf(codes.DeadlineExceeded, "command exceeded the agent policy's max_runtime of %s", s.policy.MaxRuntime)
+	}
+
+	exitCode := 0
+	if err != nil {
+		exitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+	}
 
 	return &pb.RunCommandResponse{
-		Success: err == nil,
-		Stdout:  stdout.String(),
-		Stderr:  stderr.String(),
-		Error:   fmt.Sprintf("%v", err),
+		Success:  err == nil,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Error:    fmt.Sprintf("%v", err),
+		ExitCode: int32(exitCode),
 	}, nil
 }
 
 func (s *agentServer) Shutdown(ctx context.Context, in *pb.ShutdownRequest) (*pb.ShutdownResponse, error) {
 	slog.Info("Shutting down agent server")
-	go func() {
-		time.Sleep(1 * time.Second)
-		s.grpcServer.GracefulStop()
-	}()
+	grace := time.Duration(in.GetGracePeriodSeconds()) * time.Second
+	if grace <= 0 {
+		grace = defaultDrainGracePeriod
+	}
+	go s.shutdown(grace)
 	return &pb.ShutdownResponse{}, nil
 }
 
 func (s *agentServer) ExecuteTask(ctx context.Context, in *pb.ExecuteTaskRequest) (*pb.ExecuteTaskResponse, error) {
 	slog.Info(fmt.Sprintf("Received task: %s", in.GetTaskName()))
-
-	// Create a temporary directory for the workspace
-	workDir, err := ioutil.TempDir("", "sloth-runner-agent-")
+	if v := in.GetRunnerVersion(); v != "" && v != version {
+		slog.Warn(fmt.Sprintf("Task %s comes from sloth-runner %s, but this agent runs %s", in.GetTaskName(), v, version))
+	}
+	startTime := time.Now()
+	ctx, done, err := s.executions.start(ctx, in.GetExecutionId())
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+		return nil, err
+	}
+	defer done()
+
+	// Enforce the policy on the task's commands and Lua states
+	var guard *policyGuard
+	var prepare func(*lua.LState)
+	if s.policy != nil {
+		guard = &policyGuard{policy: s.policy}
+		prepare = guard.prepareState
+		ctx = luainterface.WithCommandGuard(ctx, guard.guardCommand)
+		if s.policy.MaxRuntime > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.policy.MaxRuntime)
+			defer cancel()
+		}
 	}
-	defer os.RemoveAll(workDir)
 
-	// Unpack the workspace
-	if err := extractTar(bytes.NewReader(in.GetWorkspace()), workDir); err != nil {
-		return nil, fmt.Errorf("failed to untar workspace: %w", err)
+	// Run in the workspace synced with SyncWorkspace, or unpack the legacy
+	// tarball into a temporary directory.
+	var workDir string
+	if in.GetWorkspaceId() != "" {
+		dir, err := s.workspaces.dir(in.GetWorkspaceId())
+		if err != nil {
+			return nil, err
+		}
+		workDir = dir
+	} else {
+		dir, err := ioutil.TempDir("", "sloth-runner-agent-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp dir: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		if err := extractTar(bytes.NewReader(in.GetWorkspace()), dir); err != nil {
+			return nil, fmt.Errorf("failed to untar workspace: %w", err)
+		}
+		workDir = dir
 	}
 
 	// Create a new Lua state
 	L := lua.NewState()
 	defer L.Close()
 
-	// Load the Lua script
-	if err := L.DoString(in.GetLuaScript()); err != nil {
-		return nil, fmt.Errorf("failed to load lua script: %w", err)
+	var taskGroups map[string]types.TaskGroup
+	if bundle := in.GetBundle(); bundle != nil {
+		// Rebuild the caller's Lua environment
+		groups, cleanup, err := loadExecutionBundle(L, bundle, workDir, s.policy, prepare)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		applyTaskParams(groups, in.GetTaskGroup(), in.GetTaskName(), bundle.GetParams())
+		taskGroups = groups
+	} else {
+		// Load the Lua script
+		if prepare != nil {
+			prepare(L)
+		}
+		if err := L.DoString(in.GetLuaScript()); err != nil {
+			return nil, fmt.Errorf("failed to load lua script: %w", err)
+		}
+
+		groups, err := luainterface.LoadTaskDefinitions(L, in.GetLuaScript(), "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load task definitions: %w", err)
+		}
+		taskGroups = groups
 	}
 
 	// Create a new task runner
-	taskGroups, err := luainterface.LoadTaskDefinitions(L, in.GetLuaScript(), "")
-	if err != nil {
-		return nil, fmt.Errorf("failed to load task definitions: %w", err)
-	}
-				tr := taskrunner.NewTaskRunner(L, taskGroups, in.GetTaskGroup(), []string{in.GetTaskName()}, false, false, nil, in.GetLuaScript())
+	tr := taskrunner.NewTaskRunner(L, taskGroups, in.GetTaskGroup(), []string{in.GetTaskName()}, false, false, nil, in.GetLuaScript())
+	tr.WorkdirOverride = workDir
+	tr.Local = true
+	tr.Context = ctx
+	tr.PrepareState = prepare
+	luainterface.OpenParallel(L, tr)
+	luainterface.OpenSession(L, tr)
 	// Run the task
-	if err := tr.Run(); err != nil {
-		return &pb.ExecuteTaskResponse{Success: false, Output: err.Error()}, nil
+	runErr := tr.Run()
+	if guard != nil {
+		if err := guard.err(); err != nil {
+			slog.Warn(fmt.Sprintf("Task %s violated the agent policy: %v", in.GetTaskName(), err))
+			return nil, err
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, status.Errorf(codes.DeadlineExceeded, "task exceeded the agent policy's max_runtime of %s", s.policy.MaxRuntime)
+		}
+	}
+	if err := runErr; err != nil {
+		resp := taskResponse(tr, in.GetTaskName(), startTime)
+		resp.Output = err.Error()
+		return resp, nil
+	}
+
+	resp := taskResponse(tr, in.GetTaskName(), startTime)
+	resp.Success = true
+	resp.Output = "Task executed successfully"
+
+	// The runner fetches synced workspaces with FetchWorkspace.
+	if in.GetWorkspaceId() != "" {
+		return resp, nil
 	}
 
 	// Pack the workspace
@@ -1437,8 +2414,39 @@ func (s *agentServer) ExecuteTask(ctx context.Context, in *pb.ExecuteTaskRequest
 	if err := createTar(workDir, &buf); err != nil {
 		return nil, fmt.Errorf("failed to tar workspace: %w", err)
 	}
+	resp.Workspace = buf.Bytes()
+	return resp, nil
+}
+
+// taskResponse reports the output table, exports and per-attempt results of
+// a task run by tr, so the runner can treat it like a local task.
+func taskResponse(tr *taskrunner.TaskRunner, taskName string, startTime time.Time) *pb.ExecuteTaskResponse {
+	resp := &pb.ExecuteTaskResponse{DurationMs: time.Since(startTime).Milliseconds(), AgentVersion: version}
 
-	return &pb.ExecuteTaskResponse{Success: true, Output: "Task executed successfully", Workspace: buf.Bytes()}, nil
+	var results []types.TaskResult
+	for _, result := range tr.Results {
+		if result.Name == taskName {
+			results = append(results, result)
+		}
+	}
+	resp.Results = taskrunner.TaskResultsToProto(results)
+	resp.Attempts = int32(len(results))
+
+	if output, ok := tr.Outputs[taskName]; ok {
+		if data, err := json.Marshal(output); err == nil {
+			resp.OutputJson = string(data)
+		} else {
+			slog.Warn(fmt.Sprintf("Failed to encode output of task %s: %v", taskName, err))
+		}
+	}
+	if len(tr.Exports) > 0 {
+		if data, err := json.Marshal(tr.Exports); err == nil {
+			resp.ExportsJson = string(data)
+		} else {
+			slog.Warn(fmt.Sprintf("Failed to encode exports of task %s: %v", taskName, err))
+		}
+	}
+	return resp
 }
 
 // tar function to create a tarball of a directory
@@ -1513,6 +2521,17 @@ var masterCmd = &cobra.Command{
 		port, _ := cmd.Flags().GetInt("port")
 		daemon, _ := cmd.Flags().GetBool("daemon")
 		debug, _ := cmd.Flags().GetBool("debug")
+		degradedAfter, _ := cmd.Flags().GetDuration("degraded-after")
+		inactiveAfter, _ := cmd.Flags().GetDuration("inactive-after")
+		evictAfter, _ := cmd.Flags().GetDuration("evict-after")
+		jobRetention, _ := cmd.Flags().GetDuration("job-retention")
+		auditLog, _ := cmd.Flags().GetString("audit-log")
+		httpPort, _ := cmd.Flags().GetInt("http-port")
+		ui, _ := cmd.Flags().GetBool("ui")
+		if ui && httpPort == 0 {
+			httpPort = defaultDashboardPort
+		}
+		tokenFile, _ := cmd.Flags().GetString("token-file")
 
 		if debug {
 			pterm.DefaultLogger.Level = pterm.LogLevelDebug
@@ -1520,6 +2539,17 @@ var masterCmd = &cobra.Command{
 			pterm.Debug.Println("Debug mode enabled for master server.")
 		}
 
+		if degradedAfter <= 0 || inactiveAfter < degradedAfter {
+			return fmt.Errorf("--inactive-after must be greater than or equal to --degraded-after, and both must be positive")
+		}
+		if evictAfter != 0 && evictAfter < inactiveAfter {
+			return fmt.Errorf("--evict-after must be 0 (never evict) or at least --inactive-after")
+		}
+		token, err := loadAuthToken(tokenFile)
+		if err != nil {
+			return err
+		}
+
 		if daemon {
 			pidFile := filepath.Join(".", "sloth-runner-master.pid")
 			if _, err := os.Stat(pidFile); err == nil {
@@ -1536,7 +2566,22 @@ var masterCmd = &cobra.Command{
 				os.Remove(pidFile)
 			}
 
-			command := execCommand(os.Args[0], "master", "--port", strconv.Itoa(port))
+			masterArgs := []string{"master", "--port", strconv.Itoa(port),
+				"--degraded-after", degradedAfter.String(),
+				"--inactive-after", inactiveAfter.String(),
+				"--evict-after", evictAfter.String(),
+				"--job-retention", jobRetention.String(),
+				"--audit-log", auditLog,
+				"--http-port", strconv.Itoa(httpPort),
+				"--ui=" + strconv.FormatBool(ui)}
+			if tokenFile != "" {
+				absTokenFile, err := filepath.Abs(tokenFile)
+				if err != nil {
+					return fmt.Errorf("failed to resolve token file path: %w", err)
+				}
+				masterArgs = append(masterArgs, "--token-file", absTokenFile)
+			}
+			command := execCommand(os.Args[0], masterArgs...)
 			setSysProcAttr(command)
 			stdoutFile, err := os.OpenFile("master.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 			if err != nil {
@@ -1564,10 +2609,67 @@ var masterCmd = &cobra.Command{
 			return nil
 		}
 
+		globalAgentRegistry.health = agentHealthThresholds{
+			DegradedAfter: degradedAfter,
+			InactiveAfter: inactiveAfter,
+			EvictAfter:    evictAfter,
+		}
+		globalAgentRegistry.jobs.retention = jobRetention
+		// Heartbeats and job polling are housekeeping, not operations.
+		recorder, err := newAuditRecorder(auditLog, "master", "", token, "Heartbeat", "PullJobs")
+		if err != nil {
+			return err
+		}
+		globalAgentRegistry.audit = recorder
+		globalAgentRegistry.token = token
+		if httpPort > 0 {
+			if err := startHTTPGateway(httpPort, fmt.Sprintf("localhost:%d", port), ui); err != nil {
+				return err
+			}
+		}
 		return globalAgentRegistry.Start(port)
 	},
 }
 
+var masterInstallServiceCmd = &cobra.Command{
+	Use:   "install-service [master flags]",
+	Short: "Installs the master as a systemd service",
+	Long: `Generates a systemd unit running the master with the given flags, as a
+	dedicated user, with logs in the journal and restarts on failure. The unit is
+	enabled and started. Use --print to only print the unit.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		serviceUser, _ := cmd.Flags().GetString("user")
+		unitDir, _ := cmd.Flags().GetString("unit-dir")
+		print, _ := cmd.Flags().GetBool("print")
+		exe, err := agentExecutable()
+		if err != nil {
+			return err
+		}
+		masterArgs, err := serviceArgs(cmd.Flags(), "user", "unit-dir", "print")
+		if err != nil {
+			return err
+		}
+		return installService(cmd.OutOrStdout(), serviceUnit{
+			Name:        masterServiceUnit,
+			Description: "sloth-runner master",
+			User:        serviceUser,
+			ExecStart:   append([]string{exe, "master"}, masterArgs...),
+		}, unitDir, print)
+	},
+}
+
+var masterStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows the status of the local master service",
+	Long: `Shows the status of the master's systemd service on this host, or of a
+	master started with --daemon from this directory if no service is installed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runServiceStatus(cmd, masterServiceUnit, filepath.Join(".", "sloth-runner-master.pid"))
+	},
+}
+
 var globalAgentRegistry *agentRegistryServer
 
 func init() {
@@ -1582,12 +2684,32 @@ func init() {
 	masterCmd.Flags().IntP("port", "p", 50053, "The port for the master to listen on")
 	masterCmd.Flags().Bool("daemon", false, "Run the master server as a daemon")
 	masterCmd.Flags().Bool("debug", false, "Enable debug logging for the master server")
+	masterCmd.Flags().Duration("degraded-after", defaultAgentHealthThresholds.DegradedAfter, "Mark agents as Degraded when their last heartbeat is older than this")
+	masterCmd.Flags().Duration("inactive-after", defaultAgentHealthThresholds.InactiveAfter, "Mark agents as Inactive when their last heartbeat is older than this")
+	masterCmd.Flags().Duration("evict-after", defaultAgentHealthThresholds.EvictAfter, "Remove agents whose last heartbeat is older than this (0 never evicts)")
+	masterCmd.Flags().Duration("job-retention", defaultJobRetention, "Forget finished jobs after this long (0 keeps them)")
+	masterCmd.Flags().String("audit-log", defaultAuditLogPath("master"), "Append audit events to this file (empty disables auditing)")
+	masterCmd.Flags().Int("http-port", 0, "Also serve the HTTP/JSON API on this port (0 disables it)")
+	masterCmd.Flags().Bool("ui", false, fmt.Sprintf("Serve the web dashboard on the HTTP port (%d unless --http-port is set)", defaultDashboardPort))
+	masterCmd.Flags().String("token-file", "", "Require clients and agents to present the token in this file (default $SLOTH_RUNNER_TOKEN; unset disables authentication)")
+	masterCmd.AddCommand(masterInstallServiceCmd)
+	masterCmd.AddCommand(masterStatusCmd)
+	addServiceFlags(masterInstallServiceCmd, masterCmd)
+	masterInstallServiceCmd.Flags().String("user", defaultServiceUser, "User the service runs as; created if missing")
+	masterInstallServiceCmd.Flags().String("unit-dir", defaultUnitDir, "Directory the unit file is written to")
+	masterInstallServiceCmd.Flags().Bool("print", false, "Print the unit instead of installing it")
 
 	agentStartCmd.Flags().IntP("port", "p", 50051, "The port for the agent to listen on")
 	agentStartCmd.Flags().String("master", "", "The address of the master server to register with")
 	agentStartCmd.Flags().String("name", "", "The name of the agent")
 	agentStartCmd.Flags().Bool("daemon", false, "Run the agent as a daemon")
 	agentStartCmd.Flags().String("bind-address", "", "The IP address for the agent to bind to and report to the master")
+	agentStartCmd.Flags().Bool("pull", false, "Pull jobs from the master's queue instead of waiting for the master to connect")
+	agentStartCmd.Flags().Int("slots", 1, "Number of jobs the agent runs concurrently in pull mode")
+	agentStartCmd.Flags().StringArray("label", []string{}, "Label the agent for selection by fan-out commands (e.g., --label role=web --label env=prod)")
+	agentStartCmd.Flags().String("policy", "", "Path to a YAML execution policy restricting what the agent runs")
+	agentStartCmd.Flags().String("token-file", "", "File with the token to present to the master and to require from callers (default $SLOTH_RUNNER_TOKEN)")
+	agentStartCmd.Flags().String("audit-log", "", "Append audit events to this file (default ~/.sloth-runner/audit/agent-<name>.jsonl; empty disables auditing)")
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(templateCmd)
 	rootCmd.AddCommand(newCmd)
@@ -1603,11 +2725,81 @@ func init() {
 	agentCmd.AddCommand(agentRunCmd)
 	agentCmd.AddCommand(agentListCmd)
 	agentCmd.AddCommand(agentStopCmd)
+	agentCmd.AddCommand(agentUpgradeCmd)
+	agentCmd.AddCommand(agentInstallServiceCmd)
+	agentCmd.AddCommand(agentStatusCmd)
+	addServiceFlags(agentInstallServiceCmd, agentStartCmd)
+	agentInstallServiceCmd.Flags().String("user", defaultAgentServiceUser, "User the service runs as; created if missing. Upgrades and run_as need root")
+	agentInstallServiceCmd.Flags().String("unit-dir", defaultUnitDir, "Directory the unit file is written to")
+	agentInstallServiceCmd.Flags().Bool("print", false, "Print the unit instead of installing it")
+	agentCmd.AddCommand(agentUpgradeWatchdogCmd)
+	agentUpgradeWatchdogCmd.Flags().Int("pid", 0, "PID of the upgraded agent")
+	agentUpgradeWatchdogCmd.Flags().String("backup", "", "The agent's previous binary")
+	agentUpgradeWatchdogCmd.Flags().Duration("timeout", upgradeWatchdogTimeout, "How long the agent has to register")
+	agentUpgradeWatchdogCmd.Flags().Bool("detached", false, "Run the watchdog instead of detaching it")
+	agentUpgradeCmd.Flags().Bool("all", false, "Upgrade every registered agent")
+	agentUpgradeCmd.Flags().String("binary", "", "sloth-runner binary to install (default: the binary running this command)")
+	agentUpgradeCmd.Flags().String("sha256", "", "Expected SHA-256 of the binary; the upgrade is refused if it differs")
+	agentUpgradeCmd.Flags().Duration("timeout", defaultUpgradeTimeout, "How long each agent has to register again after restarting")
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditQueryCmd)
+	auditQueryCmd.Flags().String("file", defaultAuditLogPath("master"), "Audit log to read")
+	auditQueryCmd.Flags().String("agent", "", "Only show operations on this agent")
+	auditQueryCmd.Flags().String("caller", "", "Only show operations whose caller or claimed caller contains this text (e.g., a user name)")
+	auditQueryCmd.Flags().String("rpc", "", "Only show calls whose method contains this text (e.g., ExecuteCommand)")
+	auditQueryCmd.Flags().Duration("since", 0, "Only show events from this long ago onwards (e.g., 24h)")
+	auditQueryCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	agentCmd.AddCommand(agentShellCmd)
+	agentCmd.AddCommand(agentCpCmd)
+	agentShellCmd.Flags().String("command", "", "Run this command on the pseudo-terminal instead of the login shell")
 	agentListCmd.Flags().Bool("debug", false, "Enable debug logging for this command")
+	agentListCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	agentStopCmd.Flags().Duration("grace-period", defaultDrainGracePeriod, "How long in-flight tasks may run before the agent cancels them")
+	agentRunCmd.Flags().String("selector", "", "Run on every agent whose labels match (e.g., role=web,env=prod)")
+	agentRunCmd.Flags().Bool("all", false, "Run on every active agent")
+	agentRunCmd.Flags().Int("parallel", 10, "Maximum number of agents running the command at the same time")
+	agentRunCmd.Flags().Int("batch-size", 0, "Roll the command out in batches of this many agents (0 runs them all as one batch)")
+	agentRunCmd.Flags().Bool("fail-fast", false, "Stop starting new agents after the first failure")
+	agentRunCmd.Flags().StringP("output", "o", "table", "Output format for fan-out results: table or json")
+
+	rootCmd.AddCommand(jobsCmd)
+	jobsCmd.AddCommand(jobsSubmitCmd)
+	jobsCmd.AddCommand(jobsListCmd)
+	jobsCmd.AddCommand(jobsCancelCmd)
+	jobsSubmitCmd.Flags().String("agent", "", "Only let this agent run the job (default: any pull-mode agent)")
+	jobsSubmitCmd.Flags().Duration("lease-timeout", defaultJobLeaseTimeout, "How long an agent may hold the job without heartbeating before it is requeued")
+	jobsSubmitCmd.Flags().Int("max-attempts", defaultJobMaxAttempts, "How many times the job is leased before it is marked as failed")
+	jobsListCmd.Flags().String("agent", "", "Only show jobs for this agent")
+	jobsListCmd.Flags().String("status", "", "Only show jobs with this status (Queued, Leased, Succeeded, Failed, Cancelled)")
 	checkCmd.AddCommand(dependenciesCmd)
 
 	schedulerCmd.AddCommand(enableCmd)
 	schedulerCmd.AddCommand(disableCmd)
+	schedulerCmd.AddCommand(schedulerRunCmd)
+	schedulerCmd.AddCommand(schedulerHistoryCmd)
+	schedulerHistoryCmd.Flags().Int("limit", 20, "Maximum number of runs to list (0 lists all)")
+	schedulerCmd.AddCommand(schedulerLogsCmd)
+	schedulerCmd.AddCommand(schedulerAddCmd)
+	schedulerAddCmd.Flags().String("name", "", "Unique name of the scheduled task (required)")
+	schedulerAddCmd.Flags().String("schedule", "", "Cron expression or descriptor, such as \"0 2 * * *\" or \"@every 1h\" (required)")
+	schedulerAddCmd.Flags().StringP("file", "f", "", "Path to the Lua task definition file (required)")
+	schedulerAddCmd.Flags().StringP("group", "g", "", "Task group to run tasks from")
+	schedulerAddCmd.Flags().StringSliceP("task", "t", nil, "Task to run; repeat or separate with commas (default: every task of the group)")
+	schedulerAddCmd.Flags().StringP("values", "v", "", "Path to a YAML file with values to be passed to Lua tasks")
+	schedulerAddCmd.Flags().String("timezone", "", "IANA time zone of the schedule (default: the local time zone)")
+	schedulerAddCmd.MarkFlagRequired("name")
+	schedulerAddCmd.MarkFlagRequired("schedule")
+	schedulerAddCmd.MarkFlagRequired("file")
+	schedulerCmd.AddCommand(schedulerPauseCmd)
+	schedulerCmd.AddCommand(schedulerResumeCmd)
+	schedulerCmd.AddCommand(schedulerRunNowCmd)
+	schedulerCmd.AddCommand(schedulerStatusCmd)
+	schedulerCmd.AddCommand(schedulerSyncCmd)
+	schedulerSyncCmd.Flags().StringP("file", "f", "", "Path to the Lua workflow file declaring the schedules (required)")
+	schedulerSyncCmd.Flags().StringP("values", "v", "", "Path to a YAML file with values to be passed to Lua tasks")
+	schedulerSyncCmd.Flags().Bool("dry-run", false, "Show the changes without saving them")
+	schedulerSyncCmd.MarkFlagRequired("file")
+	schedulerStatusCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
 	schedulerCmd.AddCommand(listScheduledCmd)
 	schedulerCmd.AddCommand(deleteScheduledCmd)
 
@@ -1625,6 +2817,7 @@ func init() {
 	runCmd.Flags().BoolVar(&returnOutput, "return", false, "Return the output of the target tasks as JSON")
 	runCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Bypass interactive task selection and run all tasks")
 	runCmd.Flags().BoolVar(&interactive, "interactive", false, "Enable interactive mode for task execution")
+	runCmd.Flags().Bool("report", false, "Report the run's progress, logs and artifacts to the master's dashboard")
 	listCmd.Flags().StringVarP(&configFilePath, "file", "f", "examples/basic_pipeline.lua", "Path to the Lua task configuration template file")
 	listCmd.Flags().StringVarP(&env, "env", "e", "Development", "Environment for the tasks (e.g., Development, Production)")
 	listCmd.Flags().BoolVarP(&isProduction, "prod", "p", false, "Set to true for production environment")
@@ -1647,8 +2840,17 @@ func init() {
 	pluginCmd.AddCommand(uninstallPluginCmd)
 
 	schedulerCmd.PersistentFlags().StringVarP(&schedulerConfigPath, "scheduler-config", "c", "scheduler.yaml", "Path to the scheduler configuration file")
-	rootCmd.PersistentFlags().BoolVar(&runAsScheduler, "run-as-scheduler", false, "(Internal) Do not use directly. Runs the process as a background scheduler.")
 	rootCmd.PersistentFlags().Bool("debug", false, "Enable debug logging")
+	rootCmd.PersistentFlags().String("master", "", "Address of the master server (overrides $SLOTH_RUNNER_MASTER and the current context)")
+	rootCmd.PersistentFlags().String("context", "", "Name of the context from the client config to use")
+
+	rootCmd.AddCommand(contextCmd)
+	contextCmd.AddCommand(contextSetCmd)
+	contextSetCmd.Flags().String("token", "", "Token to present to the master, if it requires one")
+	contextCmd.AddCommand(contextUseCmd)
+	contextCmd.AddCommand(contextListCmd)
+	contextCmd.AddCommand(contextCurrentCmd)
+	contextCmd.AddCommand(contextDeleteCmd)
 	schedulerPIDFile = filepath.Join(filepath.Dir(schedulerConfigPath), "sloth-runner-scheduler.pid")
 
 	if testOutputBuffer != nil {
@@ -1664,22 +2866,6 @@ func Execute() error {
 	// 	pterm.DefaultLogger.Level = pterm.LogLevelDebug
 	// }
 
-	if runAsScheduler {
-		// This is the background scheduler process
-		sched := scheduler.NewScheduler(schedulerConfigPath)
-		if err := sched.LoadConfig(); err != nil {
-			slog.Error("failed to load scheduler config", "err", err)
-			return err // Return error instead of os.Exit(1)
-		}
-		if err := sched.Start(); err != nil {
-			slog.Error("failed to start scheduler", "err", err)
-			return err // Return error instead of os.Exit(1)
-		}
-
-		// Keep the scheduler running until terminated
-		select {}
-	}
-
 	err := rootCmd.Execute()
 	if err != nil {
 		slog.Error("DEBUG: rootCmd.Execute() returned error", "err", err)
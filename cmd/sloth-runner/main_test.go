@@ -151,14 +151,8 @@ func TestHelperProcess(t *testing.T) {
 			writer = f
 		}
 
-		// Check for --run-as-scheduler flag
-		runAsSchedulerFlag := false
-		for _, arg := range commandArgs {
-			if arg == "--run-as-scheduler" {
-				runAsSchedulerFlag = true
-				break
-			}
-		}
+		// Check for the scheduler run command
+		runAsSchedulerFlag := len(commandArgs) > 2 && commandArgs[1] == "scheduler" && commandArgs[2] == "run"
 
 		if runAsSchedulerFlag {
 			fmt.Fprintln(writer, "Starting sloth-runner scheduler in background...")
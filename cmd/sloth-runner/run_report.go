@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/audit"
+	"github.com/chalkan3/sloth-runner/internal/types"
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/google/uuid"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// workflowReporter reports the progress of a run to the master, for its
+// dashboard. Reports are sent in the background, coalescing updates, and a
+// master that cannot be reached only produces a warning.
+type workflowReporter struct {
+	client pb.AgentRegistryClient
+	conn   *grpc.ClientConn
+
+	mu     sync.Mutex
+	run    *pb.WorkflowRun
+	tasks  map[string]*pb.WorkflowTask // By group/name
+	warned bool
+
+	changed chan struct{}
+	done    chan struct{}
+}
+
+// newWorkflowReporter connects to the master selected for cmd and starts
+// reporting a run of file.
+func newWorkflowReporter(cmd *cobra.Command, file string) (*workflowReporter, error) {
+	conn, err := dialMaster(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	r := &workflowReporter{
+		client: pb.NewAgentRegistryClient(conn),
+		conn:   conn,
+		run: &pb.WorkflowRun{
+			RunId:     uuid.New().String(),
+			File:      file,
+			Caller:    audit.LocalCaller(),
+			Status:    workflowRunRunning,
+			StartedAt: time.Now().Unix(),
+		},
+		tasks:   make(map[string]*pb.WorkflowTask),
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go r.loop()
+	r.notify()
+	return r, nil
+}
+
+// notify schedules a report of the current state.
+func (r *workflowReporter) notify() {
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (r *workflowReporter) loop() {
+	defer close(r.done)
+	for range r.changed {
+		r.send()
+	}
+}
+
+// send reports a snapshot of the run.
+func (r *workflowReporter) send() {
+	r.mu.Lock()
+	snapshot := proto.Clone(r.run).(*pb.WorkflowRun)
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := r.client.ReportWorkflowRun(ctx, snapshot); err != nil {
+		r.warn("Failed to report the run to the master: %v\n", err)
+	}
+}
+
+// warn prints a reporting problem once per run, so an unreachable master
+// does not flood the output.
+func (r *workflowReporter) warn(format string, args ...interface{}) {
+	r.mu.Lock()
+	warned := r.warned
+	r.warned = true
+	r.mu.Unlock()
+	if !warned {
+		pterm.Warning.Printf(format, args...)
+	}
+}
+
+// task returns the record of a task, adding it if needed. Callers must hold r.mu.
+func (r *workflowReporter) task(group, name string) *pb.WorkflowTask {
+	key := group + "/" + name
+	task, ok := r.tasks[key]
+	if !ok {
+		task = &pb.WorkflowTask{Group: group, Name: name, Status: "Pending"}
+		r.tasks[key] = task
+		r.run.Tasks = append(r.run.Tasks, task)
+	}
+	return task
+}
+
+func (r *workflowReporter) GroupStarted(group string, tasks []*types.Task) {
+	r.mu.Lock()
+	for _, t := range tasks {
+		r.task(group, t.Name).DependsOn = t.DependsOn
+	}
+	r.mu.Unlock()
+	r.notify()
+}
+
+func (r *workflowReporter) TaskStarted(group, name string, attempt int) {
+	r.mu.Lock()
+	task := r.task(group, name)
+	task.Status = "Running"
+	task.Attempts = int32(attempt)
+	if attempt <= 1 {
+		task.StartedAt = time.Now().Unix()
+	}
+	r.mu.Unlock()
+	r.notify()
+}
+
+func (r *workflowReporter) TaskFinished(group string, result types.TaskResult) {
+	r.mu.Lock()
+	task := r.task(group, result.Name)
+	task.Status = result.Status
+	task.DurationMs = result.Duration.Milliseconds()
+	task.Logs = result.Logs
+	task.Error = ""
+	if result.Error != nil {
+		task.Error = result.Error.Error()
+	}
+	if int32(result.Attempt) > task.Attempts {
+		task.Attempts = int32(result.Attempt)
+	}
+	r.mu.Unlock()
+	r.notify()
+}
+
+// ArtifactProduced uploads the artifact. It runs before the next task
+// starts, so artifacts are uploaded as soon as they exist.
+func (r *workflowReporter) ArtifactProduced(group, task, path string) {
+	// The run must be known to the master before its artifacts.
+	r.send()
+	if err := r.uploadArtifact(group, task, path); err != nil {
+		r.warn("Failed to upload artifact %s to the master: %v\n", filepath.Base(path), err)
+	}
+}
+
+func (r *workflowReporter) uploadArtifact(group, task, path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	stream, err := r.client.UploadArtifact(ctx)
+	if err != nil {
+		return err
+	}
+	info := &pb.ArtifactInfo{Group: group, Task: task, Name: filepath.Base(path)}
+	first := true
+	err = sendFile(path, func(chunk *pb.FileChunk) error {
+		msg := &pb.ArtifactChunk{Data: chunk.GetData()}
+		if first {
+			msg.RunId = r.run.RunId
+			msg.Info = info
+			first = false
+		}
+		return stream.Send(msg)
+	})
+	if err != nil {
+		stream.CloseSend()
+		return err
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// finish reports the outcome of the run and waits for the report to be sent.
+func (r *workflowReporter) finish(ctx context.Context, runErr error) {
+	r.mu.Lock()
+	r.run.FinishedAt = time.Now().Unix()
+	switch {
+	case runErr == nil:
+		r.run.Status = workflowRunSucceeded
+	case errors.Is(ctx.Err(), context.Canceled):
+		r.run.Status = workflowRunCancelled
+		r.run.Error = runErr.Error()
+	default:
+		r.run.Status = workflowRunFailed
+		r.run.Error = runErr.Error()
+	}
+	r.mu.Unlock()
+
+	close(r.changed)
+	<-r.done
+	r.send()
+	r.conn.Close()
+}
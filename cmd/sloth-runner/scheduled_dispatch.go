@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/labels"
+	"github.com/chalkan3/sloth-runner/internal/scheduler"
+	"github.com/chalkan3/sloth-runner/internal/types"
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	lua "github.com/yuin/gopher-lua"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scheduledJobPollInterval is how often the scheduler checks on the jobs it
+// submitted to the master.
+var scheduledJobPollInterval = time.Second
+
+// scheduledRunner runs scheduled tasks in this process, or on agents
+// through the master selected for cmd when they target agents.
+func scheduledRunner(cmd *cobra.Command) scheduler.RunFunc {
+	return func(ctx context.Context, task scheduler.ScheduledTask) *scheduler.RunResult {
+		if !task.Remote() {
+			return runScheduledTask(ctx, task)
+		}
+		conn, err := dialMaster(cmd)
+		if err != nil {
+			return &scheduler.RunResult{Error: err.Error()}
+		}
+		defer conn.Close()
+		return dispatchScheduledTask(ctx, pb.NewAgentRegistryClient(conn), task)
+	}
+}
+
+// dispatchScheduledTask runs the selected tasks of a scheduled task on the
+// agents it targets, as jobs queued on the master. Agents run in parallel,
+// each running the tasks in order and skipping the rest after a failure.
+// Each task is a job of its own, in which the agent runs its depends_on
+// first, so tasks that need the same task are rejected rather than have it
+// run once per job. Every task on every agent is reported as
+// "<agent>/<task>", with the logs the agent collected.
+func dispatchScheduledTask(ctx context.Context, client pb.AgentRegistryClient, task scheduler.ScheduledTask) *scheduler.RunResult {
+	result := &scheduler.RunResult{}
+	fail := func(err error) *scheduler.RunResult {
+		result.Error = err.Error()
+		return result
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+	taskGroups, luaScript, err := loadScheduledTaskFile(L, task)
+	if err != nil {
+		return fail(err)
+	}
+	targets := task.Targets()
+	for _, name := range targets {
+		if _, ok := findTask(taskGroups[task.TaskGroup].Tasks, name); !ok {
+			return fail(fmt.Errorf("task '%s' not found in group '%s'", name, task.TaskGroup))
+		}
+	}
+	if err := checkSeparateTargets(taskGroups[task.TaskGroup].Tasks, targets); err != nil {
+		return fail(err)
+	}
+	bundle, err := buildExecutionBundle(L, taskGroups, task.TaskFile, luaScript)
+	if err != nil {
+		return fail(err)
+	}
+	bundle.Params = task.Params
+
+	agents, inactive, err := scheduledAgents(ctx, client, task)
+	if err != nil {
+		return fail(err)
+	}
+	for _, agent := range inactive {
+		result.Tasks = append(result.Tasks, scheduler.TaskResult{Name: agent, Status: "Failed", Error: "the agent is not active"})
+	}
+	perAgent := make([][]scheduler.TaskResult, len(agents))
+	var wg sync.WaitGroup
+	for i, agent := range agents {
+		wg.Add(1)
+		go func(i int, agent string) {
+			defer wg.Done()
+			for _, name := range targets {
+				if len(perAgent[i]) > 0 && perAgent[i][len(perAgent[i])-1].Status != "Success" {
+					perAgent[i] = append(perAgent[i], scheduler.TaskResult{Name: agent + "/" + name, Status: "Skipped"})
+					continue
+				}
+				perAgent[i] = append(perAgent[i], runTaskOnAgent(ctx, client, agent, &pb.ExecuteTaskRequest{
+					TaskName:      name,
+					TaskGroup:     task.TaskGroup,
+					LuaScript:     luaScript,
+					Bundle:        bundle,
+					ExecutionId:   uuid.New().String(),
+					RunnerVersion: version,
+				}))
+			}
+		}(i, agent)
+	}
+	wg.Wait()
+	for _, results := range perAgent {
+		result.Tasks = append(result.Tasks, results...)
+	}
+	for _, r := range result.Tasks {
+		if r.Status != "Success" && r.Status != "Skipped" {
+			return fail(fmt.Errorf("%s: %s", r.Name, r.Error))
+		}
+	}
+	result.Success = true
+	return result
+}
+
+// findTask returns the task of the given name.
+func findTask(tasks []types.Task, name string) (types.Task, bool) {
+	for _, t := range tasks {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return types.Task{}, false
+}
+
+// checkSeparateTargets fails when a task is one of targets, or one of their
+// dependencies, for more than one of them.
+func checkSeparateTargets(tasks []types.Task, targets []string) error {
+	neededBy := make(map[string]string)
+	for _, target := range targets {
+		seen := make(map[string]bool)
+		queue := []string{target}
+		for len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if other, ok := neededBy[name]; ok {
+				return fmt.Errorf("tasks '%s' and '%s' both need task '%s', which would run once for each on agents; select only '%s' and let depends_on run the rest",
+					other, target, name, target)
+			}
+			neededBy[name] = target
+			if t, ok := findTask(tasks, name); ok {
+				queue = append(queue, t.DependsOn...)
+			}
+		}
+	}
+	return nil
+}
+
+// scheduledAgents returns the active agents a scheduled task targets, and
+// those it targets that are not active.
+func scheduledAgents(ctx context.Context, client pb.AgentRegistryClient, task scheduler.ScheduledTask) (active, inactive []string, err error) {
+	resp, err := client.ListAgents(ctx, &pb.ListAgentsRequest{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list agents: %v", err)
+	}
+	switch {
+	case task.Agent != "":
+		for _, agent := range resp.GetAgents() {
+			if agent.GetAgentName() == task.Agent {
+				if agent.GetStatus() != agentStatusActive {
+					return nil, []string{task.Agent}, nil
+				}
+				return []string{task.Agent}, nil, nil
+			}
+		}
+		return nil, nil, fmt.Errorf("agent not found: %s", task.Agent)
+	case task.Selector != "":
+		selector, err := labels.ParseSelector(task.Selector)
+		if err != nil {
+			return nil, nil, err
+		}
+		active, inactive = selectAgents(resp.GetAgents(), selector)
+		if len(active)+len(inactive) == 0 {
+			return nil, nil, fmt.Errorf("no agents match selector %s", task.Selector)
+		}
+	default:
+		active, inactive = selectAgents(resp.GetAgents(), nil)
+		if len(active)+len(inactive) == 0 {
+			return nil, nil, fmt.Errorf("no agents registered with the master")
+		}
+	}
+	return active, inactive, nil
+}
+
+// runTaskOnAgent queues a task for an agent on the master and waits for
+// it. The job is cancelled when ctx is.
+func runTaskOnAgent(ctx context.Context, client pb.AgentRegistryClient, agent string, req *pb.ExecuteTaskRequest) (result scheduler.TaskResult) {
+	result = scheduler.TaskResult{Name: agent + "/" + req.TaskName, Status: "Failed"}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	submitted, err := client.SubmitJob(ctx, &pb.SubmitJobRequest{AgentName: agent, Task: req})
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to submit job: %v", err)
+		return result
+	}
+	job, err := waitForJob(ctx, client, submitted.GetJobId())
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Logs = job.GetStdout() + job.GetStderr()
+	switch job.GetStatus() {
+	case jobStatusSucceeded:
+		result.Status = "Success"
+	case jobStatusCancelled:
+		result.Error = fmt.Sprintf("job %s was cancelled", job.GetJobId())
+	default:
+		result.Error = fmt.Sprintf("job %s failed: %s", job.GetJobId(), job.GetError())
+	}
+	return result
+}
+
+// waitForJob polls the master until a job finishes, retrying failed polls
+// unless the master no longer knows the job. When ctx is done first, the
+// job is cancelled.
+func waitForJob(ctx context.Context, client pb.AgentRegistryClient, jobID string) (*pb.Job, error) {
+	ticker := time.NewTicker(scheduledJobPollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := client.GetJob(ctx, &pb.GetJobRequest{JobId: jobID})
+		if err == nil {
+			switch job.GetStatus() {
+			case jobStatusSucceeded, jobStatusFailed, jobStatusCancelled:
+				return job, nil
+			}
+		} else if status.Code(err) == codes.NotFound {
+			return nil, fmt.Errorf("failed to get job %s: %v", jobID, err)
+		}
+		select {
+		case <-ctx.Done():
+			cancelCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			client.CancelJob(cancelCtx, &pb.CancelJobRequest{JobId: jobID})
+			return nil, fmt.Errorf("job %s cancelled: %v", jobID, context.Cause(ctx))
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/scheduler"
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// serveGRPC serves a gRPC service on a local port until the test ends.
+func serveGRPC(t *testing.T, register func(*grpc.Server)) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	register(server)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+func TestDispatchScheduledTask(t *testing.T) {
+	defer func(interval time.Duration) { scheduledJobPollInterval = interval }(scheduledJobPollInterval)
+	scheduledJobPollInterval = 10 * time.Millisecond
+
+	workflow := filepath.Join(t.TempDir(), "maintenance.lua")
+	require.NoError(t, ioutil.WriteFile(workflow, []byte(`
+TaskDefinitions = {
+  maintenance = {
+    description = "fleet maintenance",
+    tasks = {
+      { name = "clean", command = function(params)
+          log.info("cleaning " .. (params.path or "everything"))
+          return true, "ok"
+        end },
+      { name = "fail", command = function() return false, "disk full" end },
+      { name = "rotate", depends_on = "clean", command = function() return true, "ok" end },
+    }
+  }
+}
+`), 0644))
+
+	registry := newAgentRegistryServer()
+	master := serveGRPC(t, func(s *grpc.Server) { pb.RegisterAgentRegistryServer(s, registry) })
+	for _, agent := range []struct{ name, role string }{{"web1", "web"}, {"web2", "web"}, {"db1", "db"}} {
+		address := serveGRPC(t, func(s *grpc.Server) {
+			pb.RegisterAgentServer(s, &agentServer{executions: newExecutionTracker()})
+		})
+		_, err := registry.RegisterAgent(context.Background(), &pb.RegisterAgentRequest{
+			AgentName: agent.name, AgentAddress: address, Labels: map[string]string{"role": agent.role},
+		})
+		require.NoError(t, err)
+	}
+	conn, err := grpc.Dial(master, grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewAgentRegistryClient(conn)
+
+	task := scheduler.ScheduledTask{
+		Name:      "clean_tmp",
+		TaskFile:  workflow,
+		TaskGroup: "maintenance",
+		TaskName:  "clean",
+		Params:    map[string]string{"path": "/tmp"},
+		Selector:  "role=web",
+	}
+	result := dispatchScheduledTask(context.Background(), client, task)
+	require.True(t, result.Success, result.Error)
+	require.Len(t, result.Tasks, 2)
+	for i, agent := range []string{"web1", "web2"} {
+		assert.Equal(t, agent+"/clean", result.Tasks[i].Name)
+		assert.Equal(t, "Success", result.Tasks[i].Status)
+		assert.Contains(t, result.Tasks[i].Logs, "cleaning /tmp")
+	}
+
+	// A failed task skips the next ones on its agent and fails the run.
+	task.Selector, task.Agent, task.Tasks = "", "db1", []string{"fail", "clean"}
+	task.TaskName = ""
+	result = dispatchScheduledTask(context.Background(), client, task)
+	assert.False(t, result.Success)
+	require.Len(t, result.Tasks, 2)
+	assert.Equal(t, "Failed", result.Tasks[0].Status)
+	assert.Equal(t, "Skipped", result.Tasks[1].Status)
+	assert.Contains(t, result.Error, "db1/fail")
+
+	// Each task runs as its own job, with its dependencies, so tasks that
+	// need the same task are rejected; the last one alone runs them all.
+	task.Tasks = []string{"clean", "rotate"}
+	result = dispatchScheduledTask(context.Background(), client, task)
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Error, "both need task 'clean'")
+	assert.Empty(t, result.Tasks)
+	task.Tasks, task.Params = []string{"rotate"}, nil
+	result = dispatchScheduledTask(context.Background(), client, task)
+	require.True(t, result.Success, result.Error)
+	require.Len(t, result.Tasks, 1)
+	assert.Equal(t, "db1/rotate", result.Tasks[0].Name)
+
+	// Inactive agents fail the run.
+	registry.mu.Lock()
+	registry.agents["web2"].LastHeartbeat = 0
+	registry.mu.Unlock()
+	task.Agent, task.AllAgents, task.Tasks = "", true, []string{"clean"}
+	result = dispatchScheduledTask(context.Background(), client, task)
+	assert.False(t, result.Success)
+	require.Len(t, result.Tasks, 3)
+	assert.Equal(t, scheduler.TaskResult{Name: "web2", Status: "Failed", Error: "the agent is not active"}, result.Tasks[0])
+	assert.Contains(t, result.Error, "web2")
+
+	task.AllAgents, task.Selector = false, "role=cache"
+	result = dispatchScheduledTask(context.Background(), client, task)
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Error, "no agents match selector role=cache")
+}
+
+// flakyRegistry fails the first GetJob calls, as a master restarting or
+// briefly unreachable would.
+type flakyRegistry struct {
+	pb.UnimplementedAgentRegistryServer
+	failures int
+}
+
+func (r *flakyRegistry) GetJob(ctx context.Context, req *pb.GetJobRequest) (*pb.Job, error) {
+	if req.GetJobId() != "job" {
+		return nil, status.Errorf(codes.NotFound, "job not found: %s", req.GetJobId())
+	}
+	if r.failures > 0 {
+		r.failures--
+		return nil, status.Error(codes.Unavailable, "master unavailable")
+	}
+	return &pb.Job{JobId: "job", Status: jobStatusSucceeded}, nil
+}
+
+func TestWaitForJobRetries(t *testing.T) {
+	defer func(interval time.Duration) { scheduledJobPollInterval = interval }(scheduledJobPollInterval)
+	scheduledJobPollInterval = 10 * time.Millisecond
+
+	master := serveGRPC(t, func(s *grpc.Server) { pb.RegisterAgentRegistryServer(s, &flakyRegistry{failures: 2}) })
+	conn, err := grpc.Dial(master, grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewAgentRegistryClient(conn)
+
+	job, err := waitForJob(context.Background(), client, "job")
+	require.NoError(t, err)
+	assert.Equal(t, jobStatusSucceeded, job.GetStatus())
+
+	_, err = waitForJob(context.Background(), client, "gone")
+	assert.ErrorContains(t, err, "job not found")
+}
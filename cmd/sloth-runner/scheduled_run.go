@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/chalkan3/sloth-runner/internal/luainterface"
+	"github.com/chalkan3/sloth-runner/internal/scheduler"
+	"github.com/chalkan3/sloth-runner/internal/taskrunner"
+	"github.com/chalkan3/sloth-runner/internal/types"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Defaults of the run command flags, used when a scheduled task leaves
+// the corresponding field empty.
+const (
+	defaultRunEnv    = "Development"
+	defaultRunShards = "1,2,3"
+)
+
+// runScheduledTask runs a scheduled task in this process, like the run
+// command with --yes, and reports the outcome of every task.
+func runScheduledTask(ctx context.Context, task scheduler.ScheduledTask) *scheduler.RunResult {
+	result := &scheduler.RunResult{}
+	fail := func(err error) *scheduler.RunResult {
+		result.Error = err.Error()
+		return result
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+	taskGroups, luaScript, err := loadScheduledTaskFile(L, task)
+	if err != nil {
+		return fail(err)
+	}
+
+	targets := task.Targets()
+	selected := make(map[string]bool)
+	for _, name := range targets {
+		selected[name] = true
+	}
+	found := make(map[string]bool)
+	for groupName, group := range taskGroups {
+		if task.TaskGroup != "" && groupName != task.TaskGroup {
+			continue
+		}
+		for i, t := range group.Tasks {
+			if len(targets) == 0 {
+				targets = append(targets, t.Name)
+			} else if !selected[t.Name] {
+				continue
+			}
+			found[t.Name] = true
+			if len(task.Params) > 0 {
+				params := make(map[string]string, len(t.Params)+len(task.Params))
+				for k, v := range t.Params {
+					params[k] = v
+				}
+				for k, v := range task.Params {
+					params[k] = v
+				}
+				group.Tasks[i].Params = params
+			}
+		}
+	}
+	for _, name := range targets {
+		if !found[name] {
+			return fail(fmt.Errorf("task '%s' not found", name))
+		}
+	}
+	if len(targets) == 0 {
+		return fail(fmt.Errorf("no tasks found to run in %s", task.TaskFile))
+	}
+
+	tr := taskrunner.NewTaskRunner(L, taskGroups, task.TaskGroup, targets, false, false, surveyAsker, luaScript)
+	tr.Version = version
+	tr.Context = ctx
+	tr.DialOptions = tokenDialOptions(os.Getenv(authTokenEnvVar))
+	luainterface.OpenParallel(L, tr)
+	luainterface.OpenSession(L, tr)
+	bundle, err := buildExecutionBundle(L, taskGroups, task.TaskFile, luaScript)
+	if err != nil {
+		return fail(err)
+	}
+	tr.Bundle = bundle
+
+	runErr := tr.Run()
+	for _, r := range tr.Results {
+		taskResult := scheduler.TaskResult{Name: r.Name, Status: r.Status, Duration: r.Duration, Logs: r.Logs}
+		if r.Error != nil {
+			taskResult.Error = r.Error.Error()
+		}
+		result.Tasks = append(result.Tasks, taskResult)
+	}
+	result.Outputs = tr.Outputs
+	if runErr != nil {
+		// The error of the first failed task says more than the run's.
+		for _, r := range tr.Results {
+			if r.Error != nil {
+				return fail(r.Error)
+			}
+		}
+		return fail(runErr)
+	}
+	result.Success = true
+	return result
+}
+
+// loadScheduledTaskFile renders and loads the task file of a scheduled task
+// with its values, env, production and shards, and checks its task group.
+func loadScheduledTaskFile(L *lua.LState, task scheduler.ScheduledTask) (map[string]types.TaskGroup, string, error) {
+	taskEnv, shards := task.Env, task.Shards
+	if taskEnv == "" {
+		taskEnv = defaultRunEnv
+	}
+	if shards == "" {
+		shards = defaultRunShards
+	}
+	taskGroups, luaScript, err := loadAndRenderLuaConfig(L, task.TaskFile, taskEnv, shards, task.Production, task.Values, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if task.TaskGroup != "" {
+		if _, ok := taskGroups[task.TaskGroup]; !ok {
+			return nil, "", fmt.Errorf("task group '%s' not found", task.TaskGroup)
+		}
+	}
+	return taskGroups, luaScript, nil
+}
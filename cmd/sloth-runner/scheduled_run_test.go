@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunScheduledTask(t *testing.T) {
+	dir := t.TempDir()
+	workflow := filepath.Join(dir, "workflow.lua")
+	require.NoError(t, ioutil.WriteFile(workflow, []byte(`
+TaskDefinitions = {
+  jobs = {
+    description = "scheduled jobs",
+    tasks = {
+      { name = "greet", params = { region = "us", who = "world" }, command = function(params)
+          return true, "ok", { message = values.greeting .. " " .. params.who .. " in " .. params.region .. " ({{ .Env }})" }
+        end },
+      { name = "fail", command = function(params) return false, "boom" end },
+    }
+  }
+}
+`), 0644))
+	values := filepath.Join(dir, "values.yaml")
+	require.NoError(t, ioutil.WriteFile(values, []byte("greeting: hello\n"), 0644))
+
+	result := runScheduledTask(context.Background(), scheduler.ScheduledTask{
+		Name:      "greeting",
+		TaskFile:  workflow,
+		TaskGroup: "jobs",
+		TaskName:  "greet",
+		Values:    values,
+		Env:       "Staging",
+		Params:    map[string]string{"region": "eu"},
+	})
+	require.True(t, result.Success, result.Error)
+	require.Len(t, result.Tasks, 1)
+	assert.Equal(t, "greet", result.Tasks[0].Name)
+	assert.Equal(t, "Success", result.Tasks[0].Status)
+	assert.Contains(t, result.Outputs, "greet")
+	assert.Equal(t, map[string]interface{}{"message": "hello world in eu (Staging)"}, result.Outputs["greet"])
+
+	result = runScheduledTask(context.Background(), scheduler.ScheduledTask{TaskFile: workflow, TaskGroup: "jobs", Tasks: []string{"fail"}})
+	assert.False(t, result.Success)
+	require.Len(t, result.Tasks, 1)
+	assert.NotEmpty(t, result.Tasks[0].Error)
+
+	result = runScheduledTask(context.Background(), scheduler.ScheduledTask{TaskFile: workflow, TaskGroup: "jobs", TaskName: "missing"})
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Error, "task 'missing' not found")
+}
+
+func TestSchedulerHistoryAndLogsCommands(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "scheduler.yaml")
+	historyDir := filepath.Join(dir, "history")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte("scheduled_tasks: []\nhistory:\n  dir: "+historyDir+"\n"), 0644))
+
+	output, err := executeCommand(rootCmd, "scheduler", "history", "-c", configPath)
+	require.NoError(t, err)
+	assert.Contains(t, output, "No scheduled runs recorded.")
+
+	started := time.Now()
+	run := &scheduler.RunResult{
+		Task:       "nightly",
+		StartedAt:  started,
+		FinishedAt: started.Add(time.Second),
+		Error:      "task 'backup' failed: disk full",
+		Tasks:      []scheduler.TaskResult{{Name: "backup", Status: "Failed", Logs: "$ df -h\n100%\n"}},
+	}
+	require.NoError(t, scheduler.NewHistory(scheduler.HistoryConfig{Dir: historyDir}).Record(run))
+
+	output, err = executeCommand(rootCmd, "scheduler", "history", "nightly", "-c", configPath)
+	require.NoError(t, err)
+	assert.Contains(t, output, run.ID)
+	assert.Contains(t, output, "disk full")
+
+	// executeCommand reports the "Error:" line of the run as an error.
+	output, _ = executeCommand(rootCmd, "scheduler", "logs", run.ID, "-c", configPath)
+	assert.Contains(t, output, "Status:    failed")
+	assert.Contains(t, output, "Error:     task 'backup' failed: disk full")
+	assert.Contains(t, output, "$ df -h\n100%\n")
+
+	_, err = executeCommand(rootCmd, "scheduler", "logs", "unknown", "-c", configPath)
+	assert.Error(t, err)
+}
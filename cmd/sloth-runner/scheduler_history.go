@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/scheduler"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// openSchedulerHistory returns the run history configured in the scheduler
+// config, or the default one when there is no config.
+func openSchedulerHistory() (*scheduler.History, error) {
+	sched, err := loadSchedulerConfig(true)
+	if err != nil {
+		return nil, err
+	}
+	return scheduler.NewHistory(sched.Config().History), nil
+}
+
+// runSchedulerHistory prints the latest runs of a job, or of every job.
+func runSchedulerHistory(cmd *cobra.Command, job string, limit int) error {
+	history, err := openSchedulerHistory()
+	if err != nil {
+		return err
+	}
+	runs, err := history.List(job)
+	if err != nil {
+		return fmt.Errorf("failed to read scheduler history: %w", err)
+	}
+	out := cmd.OutOrStdout()
+	if len(runs) == 0 {
+		fmt.Fprintln(out, "No scheduled runs recorded.")
+		return nil
+	}
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	tableData := pterm.TableData{{"RUN", "JOB", "STARTED", "DURATION", "STATUS", "ERROR"}}
+	for _, run := range runs {
+		status := colorRunStatus(run.Status)
+		tableData = append(tableData, []string{
+			run.ID,
+			run.Task,
+			run.StartedAt.Local().Format("2006-01-02 15:04:05"),
+			run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond).String(),
+			status,
+			truncate(run.Error, 60),
+		})
+	}
+	return pterm.DefaultTable.WithHasHeader().WithData(tableData).WithWriter(out).Render()
+}
+
+// runSchedulerLogs prints the outcome of a run and the logs of its tasks.
+func runSchedulerLogs(cmd *cobra.Command, runID string) error {
+	history, err := openSchedulerHistory()
+	if err != nil {
+		return err
+	}
+	run, err := history.Get(runID)
+	if err != nil {
+		return err
+	}
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Run:       %s\n", run.ID)
+	fmt.Fprintf(out, "Job:       %s\n", run.Task)
+	fmt.Fprintf(out, "Started:   %s\n", run.StartedAt.Local().Format(time.RFC3339))
+	fmt.Fprintf(out, "Finished:  %s (%s)\n", run.FinishedAt.Local().Format(time.RFC3339), run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond))
+	status := run.Status
+	if run.Attempts > 1 {
+		status += fmt.Sprintf(" after %d attempts", run.Attempts)
+	}
+	fmt.Fprintf(out, "Status:    %s\n", status)
+	if run.Error != "" {
+		fmt.Fprintf(out, "Error:     %s\n", run.Error)
+	}
+	fmt.Fprintf(out, "Log file:  %s\n\n", run.LogFile)
+	logs, err := ioutil.ReadFile(run.LogFile)
+	if err != nil {
+		return fmt.Errorf("failed to read run log: %w", err)
+	}
+	fmt.Fprint(out, string(logs))
+	return nil
+}
+
+// colorRunStatus colors the status of a scheduled run.
+func colorRunStatus(status string) string {
+	switch status {
+	case scheduler.StatusSuccess:
+		return pterm.Green(status)
+	case scheduler.StatusSkipped, scheduler.StatusReplaced, scheduler.StatusCancelled:
+		return pterm.Yellow(status)
+	default:
+		return pterm.Red(status)
+	}
+}
+
+// truncate shortens s to n characters on a single line.
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
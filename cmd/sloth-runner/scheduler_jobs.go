@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/scheduler"
+	"github.com/spf13/cobra"
+)
+
+// schedulerReloadInterval is how often a running scheduler checks its
+// config file for changes.
+const schedulerReloadInterval = 2 * time.Second
+
+// loadSchedulerConfig loads the scheduler config for editing. A missing
+// file gives an empty config when allowMissing is set.
+func loadSchedulerConfig(allowMissing bool) (*scheduler.Scheduler, error) {
+	sched := scheduler.NewScheduler(schedulerConfigPath)
+	if err := sched.LoadConfig(); err != nil {
+		if _, statErr := os.Stat(schedulerConfigPath); allowMissing && os.IsNotExist(statErr) {
+			sched.SetConfig(&scheduler.SchedulerConfig{})
+			return sched, nil
+		}
+		return nil, fmt.Errorf("failed to load scheduler config: %w", err)
+	}
+	return sched, nil
+}
+
+// runSchedulerAdd validates a new scheduled task and adds it to the config.
+func runSchedulerAdd(cmd *cobra.Command, task scheduler.ScheduledTask) error {
+	if err := task.Validate(); err != nil {
+		return err
+	}
+	sched, err := loadSchedulerConfig(true)
+	if err != nil {
+		return err
+	}
+	config := sched.Config()
+	if _, exists := config.Task(task.Name); exists {
+		return fmt.Errorf("scheduled task '%s' already exists", task.Name)
+	}
+	config.ScheduledTasks = append(config.ScheduledTasks, task)
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if err := sched.SaveConfig(); err != nil {
+		return fmt.Errorf("failed to save scheduler config: %w", err)
+	}
+	cmd.Printf("Scheduled task '%s' added with schedule '%s'. A running scheduler picks it up automatically.\n", task.Name, task.Schedule)
+	return nil
+}
+
+// setScheduledTaskPaused pauses or resumes a scheduled task.
+func setScheduledTaskPaused(cmd *cobra.Command, name string, paused bool) error {
+	sched, err := loadSchedulerConfig(false)
+	if err != nil {
+		return err
+	}
+	config := sched.Config()
+	found := false
+	for i := range config.ScheduledTasks {
+		if config.ScheduledTasks[i].Name == name {
+			config.ScheduledTasks[i].Paused = paused
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("scheduled task '%s' not found", name)
+	}
+	if err := sched.SaveConfig(); err != nil {
+		return fmt.Errorf("failed to save scheduler config: %w", err)
+	}
+	if paused {
+		cmd.Printf("Scheduled task '%s' paused. Runs already started go on.\n", name)
+	} else {
+		cmd.Printf("Scheduled task '%s' resumed.\n", name)
+	}
+	return nil
+}
+
+// runSchedulerRunNow has the running scheduler run a scheduled task once,
+// under its concurrency policy, with its timeout and retries, and waits for
+// it. Without a running scheduler, the task runs in this process. Paused
+// tasks can be run too.
+func runSchedulerRunNow(cmd *cobra.Command, name string) error {
+	result, err := scheduler.RequestRun(context.Background(), schedulerSocketPath(), name)
+	if errors.Is(err, scheduler.ErrSchedulerUnreachable) {
+		// Without a running scheduler, there is no other run to mind.
+		sched, err := loadSchedulerConfig(false)
+		if err != nil {
+			return err
+		}
+		task, ok := sched.Config().Task(name)
+		if !ok {
+			return fmt.Errorf("scheduled task '%s' not found", name)
+		}
+		cmd.Printf("The scheduler is not running; running '%s' here.\n", name)
+		sched.Runner = scheduledRunner(cmd)
+		sched.History = scheduler.NewHistory(sched.Config().History)
+		result = sched.RunTask(task)
+	} else if err != nil {
+		return fmt.Errorf("failed to run scheduled task '%s': %w", name, err)
+	}
+	if !result.Success {
+		return fmt.Errorf("scheduled task '%s' %s: %s (run %s)", name, result.Status, result.Error, result.ID)
+	}
+	cmd.Printf("Scheduled task '%s' completed successfully (run %s).\n", name, result.ID)
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chalkan3/sloth-runner/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerAddPauseResume(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "scheduler.yaml")
+
+	output, err := executeCommand(rootCmd, "scheduler", "add", "-c", configPath,
+		"--name", "nightly", "--schedule", "0 2 * * *", "--file", "deploy.lua", "--group", "deploy", "--task", "build,release", "--timezone", "Europe/Berlin")
+	require.NoError(t, err, output)
+	assert.Contains(t, output, "Scheduled task 'nightly' added")
+
+	_, err = executeCommand(rootCmd, "scheduler", "add", "-c", configPath,
+		"--name", "nightly", "--schedule", "0 3 * * *", "--file", "deploy.lua")
+	assert.Error(t, err, "duplicate name")
+	_, err = executeCommand(rootCmd, "scheduler", "add", "-c", configPath,
+		"--name", "broken", "--schedule", "0 25 * * *", "--file", "deploy.lua")
+	assert.Error(t, err, "invalid cron expression")
+
+	sched := scheduler.NewScheduler(configPath)
+	require.NoError(t, sched.LoadConfig())
+	require.Len(t, sched.Config().ScheduledTasks, 1)
+	task := sched.Config().ScheduledTasks[0]
+	assert.Equal(t, "0 2 * * *", task.Schedule)
+	assert.Equal(t, []string{"build", "release"}, task.Tasks)
+	assert.Equal(t, "Europe/Berlin", task.Timezone)
+
+	output, err = executeCommand(rootCmd, "scheduler", "pause", "nightly", "-c", configPath)
+	require.NoError(t, err, output)
+	require.NoError(t, sched.LoadConfig())
+	assert.True(t, sched.Config().ScheduledTasks[0].Paused)
+
+	output, err = executeCommand(rootCmd, "scheduler", "resume", "nightly", "-c", configPath)
+	require.NoError(t, err, output)
+	require.NoError(t, sched.LoadConfig())
+	assert.False(t, sched.Config().ScheduledTasks[0].Paused)
+
+	_, err = executeCommand(rootCmd, "scheduler", "pause", "unknown", "-c", configPath)
+	assert.Error(t, err)
+}
+
+func TestSchedulerStatusCommand(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "scheduler.yaml")
+	_, err := executeCommand(rootCmd, "scheduler", "status", "-c", configPath, "-o", "table")
+	assert.Error(t, err, "no scheduler running")
+
+	output, err := executeCommand(rootCmd, "scheduler", "add", "-c", configPath,
+		"--name", "nightly", "--schedule", "0 2 * * *", "--file", "deploy.lua", "--timezone", "UTC")
+	require.NoError(t, err, output)
+	sched := scheduler.NewScheduler(configPath)
+	require.NoError(t, sched.LoadConfig())
+	require.NoError(t, sched.Start())
+	defer sched.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, sched.ServeStatus(ctx, filepath.Join(filepath.Dir(configPath), "sloth-runner-scheduler.sock")))
+
+	output, err = executeCommand(rootCmd, "scheduler", "status", "-c", configPath, "-o", "json")
+	require.NoError(t, err, output)
+	var status scheduler.DaemonStatus
+	require.NoError(t, json.Unmarshal([]byte(output[strings.Index(output, "{"):]), &status))
+	require.Len(t, status.Jobs, 1)
+	assert.Equal(t, "nightly", status.Jobs[0].Name)
+	require.NotNil(t, status.Jobs[0].Next)
+	assert.Equal(t, 2, status.Jobs[0].Next.UTC().Hour())
+
+	output, err = executeCommand(rootCmd, "scheduler", "status", "-c", configPath, "-o", "table")
+	require.NoError(t, err, output)
+	assert.Contains(t, output, "Config hash:")
+	assert.Contains(t, output, "nightly")
+	assert.Contains(t, output, "idle")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/scheduler"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// schedulerStatusTimeout caps how long the status command waits for the
+// scheduler.
+const schedulerStatusTimeout = 5 * time.Second
+
+// schedulerSocketPath returns the unix socket a scheduler running with the
+// configured scheduler config serves its status on, next to its PID file.
+func schedulerSocketPath() string {
+	return filepath.Join(filepath.Dir(schedulerConfigPath), "sloth-runner-scheduler.sock")
+}
+
+// runSchedulerStatus prints the status of the running scheduler.
+func runSchedulerStatus(cmd *cobra.Command, output string) error {
+	if output != "table" && output != "json" {
+		return fmt.Errorf("invalid --output %q. Expected table or json", output)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), schedulerStatusTimeout)
+	defer cancel()
+	status, err := scheduler.FetchStatus(ctx, schedulerSocketPath())
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if output == "json" {
+		data, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal scheduler status: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+
+	fmt.Fprintf(out, "PID:          %d\n", status.PID)
+	fmt.Fprintf(out, "Started:      %s (up %s)\n", status.StartedAt.Local().Format(time.RFC3339), status.Uptime)
+	fmt.Fprintf(out, "Config:       %s\n", status.ConfigFile)
+	fmt.Fprintf(out, "Config hash:  %s\n\n", status.ConfigHash)
+	if len(status.Jobs) == 0 {
+		fmt.Fprintln(out, "No scheduled tasks configured.")
+		return nil
+	}
+	tableData := pterm.TableData{{"JOB", "SCHEDULE", "STATE", "NEXT", "PREVIOUS", "LAST RUN", "LAST STATUS"}}
+	for _, job := range status.Jobs {
+		schedule := job.Schedule
+		if len(job.Triggers) > 0 {
+			if schedule != "" {
+				schedule += ", "
+			}
+			schedule += "on " + strings.Join(job.Triggers, ", ")
+		}
+		state := pterm.Green("idle")
+		switch {
+		case job.Running > 0:
+			state = pterm.Cyan(fmt.Sprintf("running for %s", job.RunningFor))
+			if job.Running > 1 {
+				state = pterm.Cyan(fmt.Sprintf("%d running, oldest for %s", job.Running, job.RunningFor))
+			}
+		case job.Paused:
+			state = pterm.Yellow("paused")
+		}
+		lastRun, lastStatus := "-", "-"
+		if job.LastRun != nil {
+			lastRun = job.LastRun.StartedAt.Local().Format("2006-01-02 15:04:05")
+			lastStatus = colorRunStatus(job.LastRun.Status)
+		}
+		tableData = append(tableData, []string{job.Name, schedule, state, formatStatusTime(job.Next), formatStatusTime(job.Previous), lastRun, lastStatus})
+	}
+	return pterm.DefaultTable.WithHasHeader().WithData(tableData).WithWriter(out).Render()
+}
+
+// formatStatusTime formats an optional time of the scheduler status.
+func formatStatusTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
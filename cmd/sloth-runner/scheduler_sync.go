@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/chalkan3/sloth-runner/internal/scheduler"
+	"github.com/chalkan3/sloth-runner/internal/types"
+	"github.com/spf13/cobra"
+	lua "github.com/yuin/gopher-lua"
+	"gopkg.in/yaml.v2"
+)
+
+// runSchedulerSync imports the schedules declared in a workflow file into
+// the scheduler config.
+func runSchedulerSync(cmd *cobra.Command, workflow, values string, dryRun bool) error {
+	source, err := filepath.Abs(workflow)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", workflow, err)
+	}
+	if values != "" {
+		if values, err = filepath.Abs(values); err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", values, err)
+		}
+	}
+	L := lua.NewState()
+	defer L.Close()
+	taskGroups, _, err := loadAndRenderLuaConfig(L, source, defaultRunEnv, defaultRunShards, false, values, nil)
+	if err != nil {
+		return err
+	}
+	declared, err := workflowSchedules(source, values, taskGroups)
+	if err != nil {
+		return err
+	}
+
+	sched, err := loadSchedulerConfig(true)
+	if err != nil {
+		return err
+	}
+	config := sched.Config()
+	added, updated, removed, err := syncWorkflowSchedules(config, source, declared)
+	if err != nil {
+		return err
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	for _, name := range added {
+		cmd.Printf("+ %s\n", name)
+	}
+	for _, name := range updated {
+		cmd.Printf("~ %s\n", name)
+	}
+	for _, name := range removed {
+		cmd.Printf("- %s\n", name)
+	}
+	if dryRun {
+		cmd.Printf("Dry run: %d scheduled task(s) would be added, %d updated and %d removed.\n", len(added), len(updated), len(removed))
+		return nil
+	}
+	if len(added)+len(updated)+len(removed) > 0 {
+		if err := sched.SaveConfig(); err != nil {
+			return fmt.Errorf("failed to save scheduler config: %w", err)
+		}
+	}
+	cmd.Printf("Synced %s: %d scheduled task(s) added, %d updated, %d removed. A running scheduler picks them up automatically.\n",
+		workflow, len(added), len(updated), len(removed))
+	return nil
+}
+
+// workflowSchedules returns the scheduled tasks declared by the task groups
+// and tasks of a workflow file, owned by it. A group's schedule runs the
+// whole group and is named after it; a task's runs the task and is named
+// "<group>.<task>", unless the declaration sets a name.
+func workflowSchedules(source, values string, taskGroups map[string]types.TaskGroup) ([]scheduler.ScheduledTask, error) {
+	var groupNames []string
+	for name := range taskGroups {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+
+	var declared []scheduler.ScheduledTask
+	names := make(map[string]string)
+	add := func(spec map[string]interface{}, group, taskName, where string) error {
+		task, err := declaredSchedule(spec, where)
+		if err != nil {
+			return err
+		}
+		if task.Name == "" {
+			task.Name = group
+			if taskName != "" {
+				task.Name += "." + taskName
+			}
+		}
+		if other, ok := names[task.Name]; ok {
+			return fmt.Errorf("the schedules of %s and %s are both named %s", other, where, task.Name)
+		}
+		names[task.Name] = where
+		task.TaskFile, task.Source, task.TaskGroup, task.TaskName = source, source, group, taskName
+		if task.Values == "" {
+			task.Values = values
+		}
+		declared = append(declared, task)
+		return nil
+	}
+	for _, group := range groupNames {
+		if spec := taskGroups[group].Schedule; spec != nil {
+			if err := add(spec, group, "", "group "+group); err != nil {
+				return nil, err
+			}
+		}
+		for _, t := range taskGroups[group].Tasks {
+			if t.Schedule != nil {
+				if err := add(t.Schedule, group, t.Name, fmt.Sprintf("task %s of group %s", t.Name, group)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return declared, nil
+}
+
+// declaredSchedule turns the scheduler.yaml fields declared in a workflow
+// into a scheduled task, rejecting unknown fields and those sync sets.
+func declaredSchedule(spec map[string]interface{}, where string) (scheduler.ScheduledTask, error) {
+	var task scheduler.ScheduledTask
+	data, err := yaml.Marshal(spec)
+	if err != nil {
+		return task, fmt.Errorf("invalid schedule of %s: %w", where, err)
+	}
+	if err := yaml.UnmarshalStrict(data, &task); err != nil {
+		return task, fmt.Errorf("invalid schedule of %s: %w", where, err)
+	}
+	if task.TaskFile != "" || task.TaskGroup != "" || task.TaskName != "" || len(task.Tasks) > 0 || task.Source != "" {
+		return task, fmt.Errorf("the schedule of %s sets task_file, task_group, task_name, tasks or source, which come from where it is declared", where)
+	}
+	return task, nil
+}
+
+// syncWorkflowSchedules makes the scheduled tasks of config owned by source
+// those it declares: new ones are appended, changed ones replaced in place
+// and those no longer declared removed. Paused tasks stay paused. Tasks of
+// the same name that source does not own fail the sync.
+func syncWorkflowSchedules(config *scheduler.SchedulerConfig, source string, declared []scheduler.ScheduledTask) (added, updated, removed []string, err error) {
+	wanted := make(map[string]scheduler.ScheduledTask)
+	for _, task := range declared {
+		wanted[task.Name] = task
+	}
+	var tasks []scheduler.ScheduledTask
+	existing := make(map[string]bool)
+	for _, task := range config.ScheduledTasks {
+		next, ok := wanted[task.Name]
+		switch {
+		case ok && task.Source == "":
+			return nil, nil, nil, fmt.Errorf("scheduled task '%s' already exists in the scheduler config", task.Name)
+		case ok && task.Source != source:
+			return nil, nil, nil, fmt.Errorf("scheduled task '%s' is already declared by %s", task.Name, task.Source)
+		case ok:
+			existing[task.Name] = true
+			next.Paused = next.Paused || task.Paused
+			if !reflect.DeepEqual(next, task) {
+				updated = append(updated, task.Name)
+			}
+			tasks = append(tasks, next)
+		case task.Source == source:
+			removed = append(removed, task.Name)
+		default:
+			tasks = append(tasks, task)
+		}
+	}
+	for _, task := range declared {
+		if !existing[task.Name] {
+			added = append(added, task.Name)
+			tasks = append(tasks, task)
+		}
+	}
+	config.ScheduledTasks = tasks
+	return added, updated, removed, nil
+}
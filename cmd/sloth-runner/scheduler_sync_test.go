@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerSync(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "scheduler.yaml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`
+scheduled_tasks:
+  - name: "manual"
+    schedule: "@daily"
+    task_file: "other.lua"
+`), 0644))
+	workflow := filepath.Join(dir, "backup.lua")
+	writeWorkflow := func(content string) {
+		require.NoError(t, ioutil.WriteFile(workflow, []byte(content), 0644))
+	}
+	loadTasks := func() map[string]scheduler.ScheduledTask {
+		sched := scheduler.NewScheduler(configPath)
+		require.NoError(t, sched.LoadConfig())
+		tasks := make(map[string]scheduler.ScheduledTask)
+		for _, task := range sched.Config().ScheduledTasks {
+			tasks[task.Name] = task
+		}
+		return tasks
+	}
+
+	writeWorkflow(`
+TaskDefinitions = {
+  backup = {
+    schedule = "0 3 * * *",
+    tasks = {
+      { name = "dump", command = "echo dump" },
+      { name = "verify", command = "echo verify",
+        schedule = { cron = "*/15 * * * *", timezone = "UTC", timeout = "5m", params = { deep = "true" } } },
+    },
+  },
+  docs = {
+    triggers = { file_watch = { paths = { "docs" }, debounce = "5s" } },
+    tasks = { { name = "build", command = "echo build" } },
+  },
+}
+`)
+	output, err := executeCommand(rootCmd, "scheduler", "sync", "-c", configPath, "-f", workflow, "--dry-run")
+	require.NoError(t, err, output)
+	assert.Contains(t, output, "3 scheduled task(s) would be added")
+	assert.Len(t, loadTasks(), 1)
+
+	output, err = executeCommand(rootCmd, "scheduler", "sync", "-c", configPath, "-f", workflow, "--dry-run=false")
+	require.NoError(t, err, output)
+	tasks := loadTasks()
+	require.Len(t, tasks, 4)
+	assert.Equal(t, scheduler.ScheduledTask{
+		Name: "backup", Schedule: "0 3 * * *", TaskFile: workflow, TaskGroup: "backup", Source: workflow,
+	}, tasks["backup"])
+	verify := tasks["backup.verify"]
+	assert.Equal(t, "verify", verify.TaskName)
+	assert.Equal(t, "UTC", verify.Timezone)
+	assert.Equal(t, 5*time.Minute, verify.Timeout)
+	assert.Equal(t, map[string]string{"deep": "true"}, verify.Params)
+	require.NotNil(t, tasks["docs"].FileWatch)
+	assert.Equal(t, []string{"docs"}, tasks["docs"].FileWatch.Paths)
+	assert.Equal(t, 5*time.Second, tasks["docs"].FileWatch.Debounce)
+
+	// Pausing survives a sync, and schedules gone from the file are removed.
+	output, err = executeCommand(rootCmd, "scheduler", "pause", "backup", "-c", configPath)
+	require.NoError(t, err, output)
+	writeWorkflow(`
+TaskDefinitions = {
+  backup = {
+    schedule = "0 4 * * *",
+    tasks = { { name = "dump", command = "echo dump" } },
+  },
+}
+`)
+	output, err = executeCommand(rootCmd, "scheduler", "sync", "-c", configPath, "-f", workflow)
+	require.NoError(t, err, output)
+	assert.Contains(t, output, "0 scheduled task(s) added, 1 updated, 2 removed")
+	tasks = loadTasks()
+	require.Len(t, tasks, 2)
+	assert.Equal(t, "0 4 * * *", tasks["backup"].Schedule)
+	assert.True(t, tasks["backup"].Paused)
+	assert.Equal(t, "other.lua", tasks["manual"].TaskFile)
+
+	// Tasks the file does not own are left alone.
+	for _, declaration := range []string{
+		`{ cron = "@hourly", name = "manual" }`,
+		`{ cron = "@hourly", task_file = "other.lua" }`,
+		`{ cron = "@hourly", colour = "blue" }`,
+	} {
+		writeWorkflow(`TaskDefinitions = { backup = { schedule = ` + declaration + `, tasks = {} } }`)
+		_, err = executeCommand(rootCmd, "scheduler", "sync", "-c", configPath, "-f", workflow)
+		assert.Error(t, err, declaration)
+	}
+	for _, declaration := range []string{`"file_watch"`, `{ "file_watch" }`, `true`} {
+		writeWorkflow(`TaskDefinitions = { backup = { triggers = ` + declaration + `, tasks = {} } }`)
+		_, err = executeCommand(rootCmd, "scheduler", "sync", "-c", configPath, "-f", workflow)
+		assert.Error(t, err, declaration)
+	}
+	assert.Equal(t, tasks, loadTasks())
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	// defaultServiceUser is the dedicated user the master runs as.
+	defaultServiceUser = "sloth-runner"
+	// defaultAgentServiceUser is the user agents run as: upgrades replace
+	// the agent binary and policies may run commands as other users.
+	defaultAgentServiceUser = "root"
+	// serviceStateDir is the home of the service user, where services keep
+	// their state (audit logs, artifacts, workspaces).
+	serviceStateDir = "/var/lib/sloth-runner"
+	// serviceConfigDir holds configuration files such as tokens and policies,
+	// and an optional environment file per unit.
+	serviceConfigDir = "/etc/sloth-runner"
+	defaultUnitDir   = "/etc/systemd/system"
+)
+
+// serviceUnit describes the systemd unit of a master or agent.
+type serviceUnit struct {
+	Name        string // Unit name without the .service suffix
+	Description string
+	User        string
+	ExecStart   []string
+	// KillMode is how systemd stops the unit, "mixed" unless set.
+	KillMode string
+}
+
+// masterServiceUnit is the unit name of the master.
+const masterServiceUnit = "sloth-runner-master"
+
+// agentServiceUnit returns the unit name of an agent.
+func agentServiceUnit(agentName string) string {
+	return "sloth-runner-agent-" + agentName
+}
+
+// render returns the unit file. Services log to the journal, restart on
+// failure, and get SIGTERM alone when stopped so they drain their work
+// before the rest of their processes are killed.
+func (u serviceUnit) render() string {
+	killMode := u.KillMode
+	if killMode == "" {
+		killMode = "mixed"
+	}
+	var b strings.Builder
+	quoted := make([]string, len(u.ExecStart))
+	for i, arg := range u.ExecStart {
+		quoted[i] = systemdQuote(arg)
+	}
+	fmt.Fprintf(&b, `[Unit]
+Description=%s
+Documentation=https://github.com/chalkan3/sloth-runner
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+User=%s
+Group=%s
+Environment=HOME=%s
+EnvironmentFile=-%s
+WorkingDirectory=%s
+StateDirectory=sloth-runner
+ConfigurationDirectory=sloth-runner
+ExecStart=%s
+Restart=on-failure
+RestartSec=5s
+KillMode=%s
+TimeoutStopSec=%d
+StandardOutput=journal
+StandardError=journal
+SyslogIdentifier=%s
+
+[Install]
+WantedBy=multi-user.target
+`, u.Description, u.User, u.User, serviceStateDir, filepath.Join(serviceConfigDir, u.Name+".env"), serviceStateDir,
+		strings.Join(quoted, " "), killMode, int((defaultDrainGracePeriod+drainCancelWait).Seconds())+15, u.Name)
+	return b.String()
+}
+
+// systemdQuote quotes an ExecStart argument for systemd when needed.
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	return `"` + arg + `"`
+}
+
+// addServiceFlags gives an install-service command the flags of the
+// command its unit runs, except --daemon: systemd runs it in the background.
+func addServiceFlags(installCmd, serviceCmd *cobra.Command) {
+	serviceCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name != "daemon" {
+			installCmd.Flags().AddFlag(f)
+		}
+	})
+}
+
+// servicePathFlags are flags holding paths, made absolute for the unit.
+var servicePathFlags = map[string]bool{"policy": true, "token-file": true, "audit-log": true}
+
+// serviceArgs turns the flags set on the command line into arguments for
+// the service, skipping the ones in skip.
+func serviceArgs(flags *pflag.FlagSet, skip ...string) ([]string, error) {
+	skipped := make(map[string]bool)
+	for _, name := range skip {
+		skipped[name] = true
+	}
+	var args []string
+	var err error
+	flags.Visit(func(f *pflag.Flag) {
+		if skipped[f.Name] || err != nil {
+			return
+		}
+		values := []string{f.Value.String()}
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			values = slice.GetSlice()
+		}
+		for _, value := range values {
+			if servicePathFlags[f.Name] && value != "" {
+				if value, err = filepath.Abs(value); err != nil {
+					return
+				}
+			}
+			args = append(args, "--"+f.Name+"="+value)
+		}
+	})
+	return args, err
+}
+
+// installService writes unit to unitDir, creates its user and enables and
+// starts it. With print, the unit is only written to out.
+func installService(out io.Writer, unit serviceUnit, unitDir string, print bool) error {
+	if print {
+		fmt.Fprint(out, unit.render())
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("installing a service requires root; use --print to see the unit instead")
+	}
+	if err := ensureServiceUser(unit.User); err != nil {
+		return err
+	}
+	path := filepath.Join(unitDir, unit.Name+".service")
+	if err := ioutil.WriteFile(path, []byte(unit.render()), 0644); err != nil {
+		return fmt.Errorf("failed to write unit file: %w", err)
+	}
+	pterm.Success.Printf("Wrote %s\n", path)
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", "--now", unit.Name + ".service"}} {
+		if output, err := execCommand("systemctl", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("systemctl %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+		}
+	}
+	pterm.Success.Printf("Enabled and started %s. Follow its logs with: journalctl -u %s -f\n", unit.Name, unit.Name)
+	return nil
+}
+
+// ensureServiceUser creates the dedicated system user services run as.
+func ensureServiceUser(name string) error {
+	if _, err := user.Lookup(name); err == nil {
+		return nil
+	}
+	output, err := execCommand("useradd", "--system", "--home-dir", serviceStateDir, "--no-create-home", "--shell", "/usr/sbin/nologin", name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to create user %s: %v: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	pterm.Success.Printf("Created system user %s\n", name)
+	return nil
+}
+
+// serviceState is what systemd reports about a unit.
+type serviceState map[string]string
+
+// queryService asks systemd about a unit. found is false when the unit is
+// not installed or systemd is not available.
+func queryService(unitName string) (state serviceState, found bool) {
+	output, err := execCommand("systemctl", "show", unitName+".service",
+		"--property=LoadState,ActiveState,SubState,MainPID,ExecMainStartTimestamp,NRestarts,UnitFileState,Result").Output()
+	if err != nil {
+		return nil, false
+	}
+	state = parseSystemctlShow(output)
+	return state, state["LoadState"] == "loaded"
+}
+
+// parseSystemctlShow parses the key=value lines of systemctl show.
+func parseSystemctlShow(output []byte) serviceState {
+	state := make(serviceState)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if kv := strings.SplitN(scanner.Text(), "=", 2); len(kv) == 2 {
+			state[kv[0]] = kv[1]
+		}
+	}
+	return state
+}
+
+// runServiceStatus prints the status of a service, or of a daemon started
+// with --daemon when no unit is installed. It fails when nothing runs.
+func runServiceStatus(cmd *cobra.Command, unitName, pidFile string) error {
+	out := cmd.OutOrStdout()
+	if state, found := queryService(unitName); found {
+		fmt.Fprintf(out, "Service:   %s.service (%s)\n", unitName, state["UnitFileState"])
+		status := fmt.Sprintf("%s (%s)", state["ActiveState"], state["SubState"])
+		if state["ActiveState"] == "active" {
+			status = pterm.Green(status)
+			if since := state["ExecMainStartTimestamp"]; since != "" {
+				status += " since " + since
+			}
+		} else if state["ActiveState"] == "failed" {
+			status = pterm.Red(status) + " with result " + state["Result"]
+		}
+		fmt.Fprintf(out, "Status:    %s\n", status)
+		if pid := state["MainPID"]; pid != "" && pid != "0" {
+			fmt.Fprintf(out, "PID:       %s\n", pid)
+		}
+		fmt.Fprintf(out, "Restarts:  %s\n", state["NRestarts"])
+		fmt.Fprintf(out, "Logs:      journalctl -u %s\n", unitName)
+		if state["ActiveState"] != "active" {
+			return fmt.Errorf("%s is not running", unitName)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(out, "Service:   %s is not installed\n", unitName)
+	pidBytes, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return fmt.Errorf("%s is not running", unitName)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(pidBytes)))
+	if process, err := osFindProcess(pid); err == nil && processSignal(process, syscall.Signal(0)) == nil {
+		fmt.Fprintf(out, "Daemon:    running with PID %d (%s)\n", pid, pidFile)
+		return nil
+	}
+	return fmt.Errorf("%s is not running (stale PID file %s)", unitName, pidFile)
+}
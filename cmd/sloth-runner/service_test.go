@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceUnitRender(t *testing.T) {
+	unit := serviceUnit{
+		Name:        agentServiceUnit("web1"),
+		Description: "sloth-runner agent web1",
+		User:        "sloth-runner",
+		ExecStart:   []string{"/usr/local/bin/sloth-runner", "agent", "start", "--name=web1", "--label=env=prod east"},
+	}
+	out := unit.render()
+	assert.Contains(t, out, `ExecStart=/usr/local/bin/sloth-runner agent start --name=web1 "--label=env=prod east"`)
+	assert.Contains(t, out, "User=sloth-runner\n")
+	assert.Contains(t, out, "Restart=on-failure\n")
+	assert.Contains(t, out, "KillMode=mixed\n")
+
+	unit.KillMode = "process"
+	assert.Contains(t, unit.render(), "KillMode=process\n")
+	assert.Contains(t, out, "StandardOutput=journal\n")
+	assert.Contains(t, out, "SyslogIdentifier=sloth-runner-agent-web1\n")
+	assert.Contains(t, out, "EnvironmentFile=-/etc/sloth-runner/sloth-runner-agent-web1.env\n")
+	assert.Contains(t, out, "WantedBy=multi-user.target\n")
+}
+
+func TestSystemdQuote(t *testing.T) {
+	assert.Equal(t, "--port=50051", systemdQuote("--port=50051"))
+	assert.Equal(t, `"a b"`, systemdQuote("a b"))
+	assert.Equal(t, `"say \"hi\""`, systemdQuote(`say "hi"`))
+	assert.Equal(t, "100%%", systemdQuote("100%"))
+	assert.Equal(t, "$$HOME", systemdQuote("$HOME"))
+	assert.Equal(t, `""`, systemdQuote(""))
+}
+
+func TestServiceArgs(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Int("port", 50051, "")
+	flags.String("name", "", "")
+	flags.StringArray("label", nil, "")
+	flags.String("policy", "", "")
+	flags.Bool("print", false, "")
+	assert.NoError(t, flags.Parse([]string{"--name", "web1", "--label", "role=web", "--label", "env=prod", "--policy", "policy.yaml", "--print"}))
+
+	args, err := serviceArgs(flags, "print")
+	assert.NoError(t, err)
+	policy, _ := filepath.Abs("policy.yaml")
+	// Flags left at their defaults are not passed.
+	assert.Equal(t, []string{"--label=role=web", "--label=env=prod", "--name=web1", "--policy=" + policy}, args)
+}
+
+func TestRunServiceStatus(t *testing.T) {
+	oldExecCommand := execCommand
+	defer func() { execCommand = oldExecCommand }()
+	show := func(output string) {
+		execCommand = func(name string, arg ...string) *exec.Cmd {
+			return exec.Command("printf", "%s", output)
+		}
+	}
+	status := func() (string, error) {
+		var out bytes.Buffer
+		cmd := &cobra.Command{}
+		cmd.SetOut(&out)
+		err := runServiceStatus(cmd, masterServiceUnit, filepath.Join(t.TempDir(), "missing.pid"))
+		return out.String(), err
+	}
+
+	show("LoadState=loaded\nActiveState=active\nSubState=running\nMainPID=4242\nNRestarts=1\nUnitFileState=enabled\n")
+	out, err := status()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "sloth-runner-master.service (enabled)")
+	assert.Contains(t, out, "PID:       4242")
+	assert.Contains(t, out, "journalctl -u sloth-runner-master")
+
+	show("LoadState=loaded\nActiveState=failed\nSubState=failed\nMainPID=0\nResult=exit-code\n")
+	out, err = status()
+	assert.Error(t, err)
+	assert.Contains(t, out, "exit-code")
+
+	show("LoadState=not-found\n")
+	out, err = status()
+	assert.Error(t, err)
+	assert.Contains(t, out, "is not installed")
+}
+
+func TestAgentInstallServicePrint(t *testing.T) {
+	out, err := executeCommand(rootCmd, "agent", "install-service", "--name", "web1", "--master", "10.0.0.1:50053", "--print")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "User=root\n")
+	assert.Contains(t, out, "KillMode=process\n")
+	assert.Contains(t, out, "agent start --master=10.0.0.1:50053 --name=web1\n")
+
+	_, err = executeCommand(rootCmd, "agent", "install-service", "--name", "web1", "--daemon", "--print")
+	assert.Error(t, err, "systemd runs the agent in the background")
+	assert.NotNil(t, agentStartCmd.Flags().Lookup("daemon"))
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	workflowRunRunning   = "Running"
+	workflowRunSucceeded = "Succeeded"
+	workflowRunFailed    = "Failed"
+	workflowRunCancelled = "Cancelled"
+
+	// maxWorkflowRuns is how many workflow runs the master remembers.
+	maxWorkflowRuns = 100
+
+	// defaultDashboardPort is the HTTP port of master --ui without --http-port.
+	defaultDashboardPort = 8080
+)
+
+// defaultArtifactDir returns where the master keeps the artifacts of
+// reported workflow runs.
+func defaultArtifactDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "sloth-runner-artifacts")
+	}
+	return filepath.Join(home, ".sloth-runner", "master", "artifacts")
+}
+
+// workflowRunStore keeps the workflow runs reported to the master, newest
+// last, along with their artifacts. The oldest runs are forgotten, and their
+// artifacts deleted, once there are more than max.
+type workflowRunStore struct {
+	mu          sync.Mutex
+	runs        map[string]*pb.WorkflowRun
+	order       []string
+	max         int
+	artifactDir string
+	now         func() time.Time
+}
+
+// newWorkflowRunStore creates an empty store keeping artifacts under artifactDir.
+func newWorkflowRunStore(artifactDir string, max int) *workflowRunStore {
+	return &workflowRunStore{
+		runs:        make(map[string]*pb.WorkflowRun),
+		max:         max,
+		artifactDir: artifactDir,
+		now:         time.Now,
+	}
+}
+
+// Report records the latest state of a run. Artifacts are tracked by the
+// store, so the ones already uploaded are kept.
+func (s *workflowRunStore) Report(run *pb.WorkflowRun) error {
+	if run.GetRunId() == "" || filepath.Base(run.GetRunId()) != run.GetRunId() {
+		return status.Errorf(codes.InvalidArgument, "invalid run ID %q", run.GetRunId())
+	}
+	run = proto.Clone(run).(*pb.WorkflowRun)
+	run.UpdatedAt = s.now().Unix()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.runs[run.RunId]; ok {
+		run.Artifacts = existing.Artifacts
+	} else {
+		run.Artifacts = nil
+		s.order = append(s.order, run.RunId)
+	}
+	s.runs[run.RunId] = run
+	for len(s.order) > s.max {
+		oldest := s.order[0]
+		s.order = s.order[1:]
+		delete(s.runs, oldest)
+		os.RemoveAll(filepath.Join(s.artifactDir, oldest))
+	}
+	return nil
+}
+
+// List returns the runs, newest first, without their task logs.
+func (s *workflowRunStore) List() []*pb.WorkflowRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make([]*pb.WorkflowRun, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		run := proto.Clone(s.runs[s.order[i]]).(*pb.WorkflowRun)
+		for _, task := range run.Tasks {
+			task.Logs = ""
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// Get returns a copy of a run.
+func (s *workflowRunStore) Get(runID string) (*pb.WorkflowRun, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[runID]
+	if !ok {
+		return nil, false
+	}
+	return proto.Clone(run).(*pb.WorkflowRun), true
+}
+
+// artifactPath returns where the artifact name of a known run is stored.
+func (s *workflowRunStore) artifactPath(runID, name string) (string, error) {
+	if _, ok := s.Get(runID); !ok {
+		return "", status.Errorf(codes.NotFound, "workflow run not found: %s", runID)
+	}
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+		return "", status.Errorf(codes.InvalidArgument, "invalid artifact name %q", name)
+	}
+	return filepath.Join(s.artifactDir, runID, name), nil
+}
+
+// addArtifact records an uploaded artifact, replacing one with the same name.
+func (s *workflowRunStore) addArtifact(runID string, info *pb.ArtifactInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[runID]
+	if !ok {
+		return
+	}
+	for i, existing := range run.Artifacts {
+		if existing.GetName() == info.GetName() {
+			run.Artifacts[i] = info
+			return
+		}
+	}
+	run.Artifacts = append(run.Artifacts, info)
+}
+
+// ReportWorkflowRun records the progress of a workflow run.
+func (s *agentRegistryServer) ReportWorkflowRun(ctx context.Context, req *pb.WorkflowRun) (*pb.ReportWorkflowRunResponse, error) {
+	if err := s.runs.Report(req); err != nil {
+		return nil, err
+	}
+	return &pb.ReportWorkflowRunResponse{}, nil
+}
+
+// ListWorkflowRuns lists the workflow runs known to the master.
+func (s *agentRegistryServer) ListWorkflowRuns(ctx context.Context, req *pb.ListWorkflowRunsRequest) (*pb.ListWorkflowRunsResponse, error) {
+	return &pb.ListWorkflowRunsResponse{Runs: s.runs.List()}, nil
+}
+
+// GetWorkflowRun returns a workflow run, task logs included.
+func (s *agentRegistryServer) GetWorkflowRun(ctx context.Context, req *pb.GetWorkflowRunRequest) (*pb.WorkflowRun, error) {
+	run, ok := s.runs.Get(req.RunId)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "workflow run not found: %s", req.RunId)
+	}
+	return run, nil
+}
+
+// UploadArtifact stores an artifact of a workflow run. The first chunk names
+// the run and the artifact.
+func (s *agentRegistryServer) UploadArtifact(stream pb.AgentRegistry_UploadArtifactServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	info := first.GetInfo()
+	path, err := s.runs.artifactPath(first.GetRunId(), info.GetName())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	_, written, err := receiveFile(path, "", 0644, first.GetData(), func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.GetData(), nil
+	})
+	if err != nil {
+		return err
+	}
+	s.runs.addArtifact(first.GetRunId(), &pb.ArtifactInfo{Group: info.GetGroup(), Task: info.GetTask(), Name: info.GetName(), Size: written})
+	return stream.SendAndClose(&pb.UploadArtifactResponse{BytesWritten: written})
+}
+
+// GetArtifact streams an artifact of a workflow run.
+func (s *agentRegistryServer) GetArtifact(req *pb.GetArtifactRequest, stream pb.AgentRegistry_GetArtifactServer) error {
+	path, err := s.runs.artifactPath(req.RunId, req.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return status.Errorf(codes.NotFound, "artifact not found: %s", req.Name)
+	}
+	return sendFile(path, func(chunk *pb.FileChunk) error {
+		return stream.Send(&pb.ArtifactChunk{Data: chunk.GetData()})
+	})
+}
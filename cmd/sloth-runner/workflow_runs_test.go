@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func TestWorkflowRunStoreReportAndEvict(t *testing.T) {
+	dir := t.TempDir()
+	s := newWorkflowRunStore(dir, 2)
+
+	assert.Error(t, s.Report(&pb.WorkflowRun{}))
+	assert.Error(t, s.Report(&pb.WorkflowRun{RunId: "../escape"}))
+
+	assert.NoError(t, s.Report(&pb.WorkflowRun{RunId: "r1", Status: workflowRunRunning,
+		Tasks: []*pb.WorkflowTask{{Group: "g", Name: "build", Logs: "compiling\n"}}}))
+	s.addArtifact("r1", &pb.ArtifactInfo{Name: "app.tar.gz", Size: 3})
+
+	// Reports keep the artifacts already uploaded.
+	assert.NoError(t, s.Report(&pb.WorkflowRun{RunId: "r1", Status: workflowRunSucceeded}))
+	run, ok := s.Get("r1")
+	assert.True(t, ok)
+	assert.Equal(t, workflowRunSucceeded, run.Status)
+	assert.Len(t, run.Artifacts, 1)
+
+	_, err := s.artifactPath("r1", "../secret")
+	assert.Error(t, err)
+	_, err = s.artifactPath("missing", "app.tar.gz")
+	assert.Error(t, err)
+
+	path, err := s.artifactPath("r1", "app.tar.gz")
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, []byte("abc"), 0644))
+
+	// Listing is newest first; the oldest run and its artifacts are dropped.
+	assert.NoError(t, s.Report(&pb.WorkflowRun{RunId: "r2"}))
+	assert.NoError(t, s.Report(&pb.WorkflowRun{RunId: "r3"}))
+	runs := s.List()
+	assert.Len(t, runs, 2)
+	assert.Equal(t, "r3", runs[0].RunId)
+	assert.Equal(t, "r2", runs[1].RunId)
+	_, ok = s.Get("r1")
+	assert.False(t, ok)
+	_, err = os.Stat(filepath.Join(dir, "r1"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestHTTPGatewayWorkflowRuns(t *testing.T) {
+	const token = "s3cret"
+	registry, gateway := newTestGateway(t, token)
+	registry.runs = newWorkflowRunStore(t.TempDir(), maxWorkflowRuns)
+
+	_, err := registry.ReportWorkflowRun(context.Background(), &pb.WorkflowRun{
+		RunId:  "run1",
+		Status: workflowRunRunning,
+		Tasks:  []*pb.WorkflowTask{{Group: "g", Name: "build", Status: "Success", Logs: "compiling\n"}},
+	})
+	assert.NoError(t, err)
+
+	// Upload an artifact the way run --report does.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	pb.RegisterAgentRegistryServer(server, registry)
+	go server.Serve(lis)
+	defer server.Stop()
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	stream, err := pb.NewAgentRegistryClient(conn).UploadArtifact(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&pb.ArtifactChunk{RunId: "run1", Info: &pb.ArtifactInfo{Group: "g", Task: "build", Name: "app.txt"}, Data: []byte("hello ")}))
+	assert.NoError(t, stream.Send(&pb.ArtifactChunk{Data: []byte("world")}))
+	resp, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), resp.BytesWritten)
+
+	httpResp, body := doRequest(t, "GET", gateway.URL+"/v1/workflow-runs", token, "")
+	assert.Equal(t, http.StatusOK, httpResp.StatusCode)
+	assert.Contains(t, body, `"run_id":"run1"`)
+	assert.NotContains(t, body, "compiling", "listings leave out task logs")
+
+	httpResp, body = doRequest(t, "GET", gateway.URL+"/v1/workflow-runs/run1", token, "")
+	assert.Equal(t, http.StatusOK, httpResp.StatusCode)
+	assert.Contains(t, body, "compiling")
+	assert.Contains(t, body, `"name":"app.txt"`)
+
+	httpResp, body = doRequest(t, "GET", gateway.URL+"/v1/workflow-runs/run1/artifacts/app.txt", token, "")
+	assert.Equal(t, http.StatusOK, httpResp.StatusCode)
+	assert.Equal(t, "hello world", body)
+	assert.Contains(t, httpResp.Header.Get("Content-Disposition"), "app.txt")
+
+	httpResp, _ = doRequest(t, "GET", gateway.URL+"/v1/workflow-runs/run1/artifacts/other.txt", token, "")
+	assert.Equal(t, http.StatusNotFound, httpResp.StatusCode)
+	httpResp, _ = doRequest(t, "GET", gateway.URL+"/v1/workflow-runs/missing", token, "")
+	assert.Equal(t, http.StatusNotFound, httpResp.StatusCode)
+
+	httpResp, body = doRequest(t, "GET", gateway.URL+"/", "", "")
+	assert.Equal(t, http.StatusOK, httpResp.StatusCode)
+	assert.Contains(t, body, "<html")
+}
@@ -0,0 +1,189 @@
+// Package audit records the operations performed through the master and the
+// agents as JSON lines, one event per line, in a size-rotated file.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxSize is the size at which an audit file is rotated.
+	DefaultMaxSize = 100 << 20
+	// DefaultMaxBackups is the number of rotated files kept next to the current one.
+	DefaultMaxBackups = 10
+)
+
+// Event is one audited operation.
+type Event struct {
+	Time          time.Time `json:"time"`
+	Component     string    `json:"component"`                // "master" or "agent"
+	Node          string    `json:"node,omitempty"`           // Name of the agent that recorded the event
+	Caller        string    `json:"caller"`                   // Identity the server authenticated, at the client's host
+	ClaimedCaller string    `json:"claimed_caller,omitempty"` // user@host the client claims, unverified
+	Peer          string    `json:"peer,omitempty"`           // Network address of the client
+	RPC           string    `json:"rpc"`                      // Full gRPC method name
+	Agent         string    `json:"agent,omitempty"`          // Agent the operation targets
+	Command       string    `json:"command,omitempty"`        // Shell command, or command of a shell session
+	Task          string    `json:"task,omitempty"`           // group/task of a delegated task
+	Path          string    `json:"path,omitempty"`           // File of a file transfer
+	Code          string    `json:"code"`                     // gRPC status code
+	Error         string    `json:"error,omitempty"`
+	Success       *bool     `json:"success,omitempty"`
+	ExitCode      *int32    `json:"exit_code,omitempty"`
+	DurationMs    int64     `json:"duration_ms"`
+	BytesIn       int64     `json:"bytes_in"`
+	BytesOut      int64     `json:"bytes_out"`
+}
+
+// Logger appends events to a file, rotating it once it grows past maxSize.
+// Rotated files are named <path>.1 (the newest) to <path>.<maxBackups>.
+type Logger struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens or creates the audit file at path.
+func Open(path string, maxSize int64, maxBackups int) (*Logger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	l := &Logger{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Logger) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	l.file, l.size = f, fi.Size()
+	return nil
+}
+
+// Log appends an event.
+func (l *Logger) Log(e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotate shifts <path>.N to <path>.N+1, dropping the oldest, and starts a new file.
+func (l *Logger) rotate() error {
+	l.file.Close()
+	os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxBackups))
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if l.maxBackups > 0 {
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	} else {
+		os.Remove(l.path)
+	}
+	return l.open()
+}
+
+// Close closes the audit file.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Filter selects events in Query. Zero fields match everything.
+type Filter struct {
+	Agent  string
+	Caller string // Substring of the caller or of the claimed caller
+	RPC    string // Substring of the method name
+	Since  time.Time
+}
+
+func (f Filter) match(e Event) bool {
+	return (f.Agent == "" || e.Agent == f.Agent || e.Node == f.Agent) &&
+		(f.Caller == "" || strings.Contains(e.Caller, f.Caller) || strings.Contains(e.ClaimedCaller, f.Caller)) &&
+		(f.RPC == "" || strings.Contains(strings.ToLower(e.RPC), strings.ToLower(f.RPC))) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since))
+}
+
+// Query reads the events matching filter from the audit file at path and its
+// rotated files, oldest first.
+func Query(path string, filter Filter) ([]Event, error) {
+	rotated, _ := filepath.Glob(path + ".*")
+	files := make([]string, 0, len(rotated)+1)
+	for _, name := range rotated {
+		var n int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(name, path+"."), "%d", &n); err == nil && fmt.Sprintf("%s.%d", path, n) == name {
+			files = append(files, name)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return len(files[i]) > len(files[j]) || (len(files[i]) == len(files[j]) && files[i] > files[j])
+	})
+	files = append(files, path)
+
+	var events []Event
+	for _, name := range files {
+		f, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16<<20)
+		for scanner.Scan() {
+			var e Event
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				continue // Skip a line cut short by a crash
+			}
+			if filter.match(e) {
+				events = append(events, e)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log %s: %w", name, err)
+		}
+	}
+	return events, nil
+}
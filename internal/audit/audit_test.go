@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestLoggerRotatesAndQueryReadsOldestFirst(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	logger, err := Open(path, 200, 2)
+	assert.NoError(t, err)
+
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, logger.Log(Event{Time: base.Add(time.Duration(i) * time.Minute), RPC: "/agent.Agent/RunCommand", Agent: "a1", Command: "echo " + string(rune('a'+i))}))
+	}
+	assert.NoError(t, logger.Close())
+
+	_, err = os.Stat(path + ".1")
+	assert.NoError(t, err)
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err), "only maxBackups rotated files are kept")
+
+	events, err := Query(path, Filter{})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, events)
+	assert.Less(t, len(events), 6, "the oldest events were rotated away")
+	for i := 1; i < len(events); i++ {
+		assert.True(t, events[i-1].Time.Before(events[i].Time))
+	}
+	assert.Equal(t, "echo f", events[len(events)-1].Command)
+}
+
+func TestQueryFilters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	logger, err := Open(path, DefaultMaxSize, DefaultMaxBackups)
+	assert.NoError(t, err)
+	now := time.Now()
+	logger.Log(Event{Time: now.Add(-48 * time.Hour), Caller: "alice@ws", RPC: "/agent.AgentRegistry/ExecuteCommand", Agent: "a1"})
+	logger.Log(Event{Time: now.Add(-time.Hour), Caller: "bob@ws", RPC: "/agent.AgentRegistry/ExecuteCommand", Agent: "a2"})
+	logger.Log(Event{Time: now.Add(-time.Minute), Caller: "token@10.0.0.5", ClaimedCaller: "alice@ws", RPC: "/agent.Agent/ExecuteTask", Node: "a1"})
+	logger.Close()
+
+	events, err := Query(path, Filter{Agent: "a1", Since: now.Add(-24 * time.Hour)})
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "/agent.Agent/ExecuteTask", events[0].RPC)
+	}
+
+	events, _ = Query(path, Filter{Caller: "alice"})
+	assert.Len(t, events, 2)
+	events, _ = Query(path, Filter{RPC: "executecommand"})
+	assert.Len(t, events, 2)
+
+	events, err = Query(filepath.Join(t.TempDir(), "missing.jsonl"), Filter{})
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestDescribeRequestAndResponse(t *testing.T) {
+	e := &Event{}
+	describeRequest(e, &pb.ShellInput{Start: &pb.ShellStart{AgentName: "a1", Command: "bash"}})
+	describeRequest(e, &pb.ShellInput{Data: []byte("ls\n")})
+	assert.Equal(t, "a1", e.Agent)
+	assert.Equal(t, "bash", e.Command)
+
+	describeResponse(e, &pb.ShellOutput{Data: []byte("out")})
+	assert.Nil(t, e.ExitCode)
+	describeResponse(e, &pb.ShellOutput{Exited: true, ExitCode: 3})
+	if assert.NotNil(t, e.ExitCode) {
+		assert.Equal(t, int32(3), *e.ExitCode)
+	}
+
+	e = &Event{}
+	describeRequest(e, &pb.ExecuteTaskRequest{TaskGroup: "build", TaskName: "compile"})
+	assert.Equal(t, "build/compile", e.Task)
+	describeResponse(e, &pb.ExecuteTaskResponse{Success: true})
+	if assert.NotNil(t, e.Success) {
+		assert.True(t, *e.Success)
+	}
+}
+
+func TestNewEventRecordsAuthenticatedCaller(t *testing.T) {
+	r := &Recorder{Component: "master"}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 4242}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(callerKey, "root@prod", "authorization", "Bearer secret"))
+
+	e := r.newEvent(ctx, "/agent.AgentRegistry/ExecuteCommand")
+	assert.Equal(t, "anonymous@10.0.0.5", e.Caller)
+	assert.Equal(t, "root@prod", e.ClaimedCaller, "the claimed identity is kept apart")
+	assert.Equal(t, "10.0.0.5:4242", e.Peer)
+
+	r.Authenticated = func(ctx context.Context) bool {
+		md, _ := metadata.FromIncomingContext(ctx)
+		return len(md.Get("authorization")) > 0
+	}
+	assert.Equal(t, "token@10.0.0.5", r.newEvent(ctx, "/agent.AgentRegistry/ExecuteCommand").Caller)
+	assert.Equal(t, "anonymous@unknown", r.newEvent(context.Background(), "/agent.AgentRegistry/ExecuteCommand").Caller)
+}
@@ -0,0 +1,236 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// callerKey is the metadata key carrying the identity the caller claims.
+const callerKey = "x-sloth-runner-caller"
+
+// LocalCaller returns the identity of this process, as user@host.
+func LocalCaller() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return name + "@" + host
+}
+
+// withCaller attaches the caller identity to an outgoing call. Calls made
+// while serving another call forward the identity of that call's caller.
+func withCaller(ctx context.Context) context.Context {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(callerKey)) > 0 {
+		return ctx
+	}
+	caller := LocalCaller()
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(callerKey); len(v) > 0 {
+			caller = v[0]
+		}
+	}
+	return metadata.AppendToOutgoingContext(ctx, callerKey, caller)
+}
+
+// WithCaller makes calls made with ctx claim the given caller identity. It is
+// used by servers that relay requests received over other protocols.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, callerKey, caller)
+}
+
+// DialOptions makes a client identify its caller on every call, so servers
+// can audit who did what.
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(withCaller(ctx), method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(withCaller(ctx), desc, cc, method, opts...)
+		}),
+	}
+}
+
+// Recorder audits the calls served by a gRPC server.
+type Recorder struct {
+	Logger    *Logger
+	Component string          // "master" or "agent"
+	Node      string          // Name of the agent, for agents
+	Skip      map[string]bool // Method names, without service, that are not audited
+	// Authenticated reports whether a call presented valid credentials. It is
+	// nil when the server does not authenticate its callers.
+	Authenticated func(ctx context.Context) bool
+}
+
+// ServerOptions installs the recorder's interceptors on a server.
+func (r *Recorder) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(r.unary),
+		grpc.ChainStreamInterceptor(r.stream),
+	}
+}
+
+func (r *Recorder) skip(method string) bool {
+	return r.Skip[method[strings.LastIndex(method, "/")+1:]]
+}
+
+// newEvent starts the event of a call. Its caller is what the server can
+// vouch for: "token" when the call presented the token, "anonymous"
+// otherwise, at the host of the peer. The identity the client claims is
+// recorded apart, as anyone can send it.
+func (r *Recorder) newEvent(ctx context.Context, method string) *Event {
+	e := &Event{Time: time.Now(), Component: r.Component, Node: r.Node, RPC: method}
+	principal, host := "anonymous", "unknown"
+	if r.Authenticated != nil && r.Authenticated(ctx) {
+		principal = "token"
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		e.Peer = p.Addr.String()
+		host = e.Peer
+		if h, _, err := net.SplitHostPort(e.Peer); err == nil {
+			host = h
+		}
+	}
+	e.Caller = principal + "@" + host
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(callerKey); len(v) > 0 {
+			e.ClaimedCaller = v[0]
+		}
+	}
+	return e
+}
+
+func (r *Recorder) finish(e *Event, err error) {
+	e.DurationMs = time.Since(e.Time).Milliseconds()
+	e.Code = status.Code(err).String()
+	if err != nil {
+		e.Error = status.Convert(err).Message()
+	}
+	if e.Agent == "" {
+		e.Agent = r.Node
+	}
+	if logErr := r.Logger.Log(*e); logErr != nil {
+		fmt.Fprintf(os.Stderr, "failed to write audit event: %v\n", logErr)
+	}
+}
+
+func (r *Recorder) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if r.skip(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	e := r.newEvent(ctx, info.FullMethod)
+	describeRequest(e, req)
+	e.BytesIn = messageSize(req)
+	resp, err := handler(ctx, req)
+	if err == nil {
+		describeResponse(e, resp)
+		e.BytesOut = messageSize(resp)
+	}
+	r.finish(e, err)
+	return resp, err
+}
+
+func (r *Recorder) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if r.skip(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	e := r.newEvent(ss.Context(), info.FullMethod)
+	err := handler(srv, &auditedStream{ServerStream: ss, event: e})
+	r.finish(e, err)
+	return err
+}
+
+// auditedStream describes the event of a stream from the messages it carries.
+type auditedStream struct {
+	grpc.ServerStream
+	event *Event
+}
+
+func (s *auditedStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		describeRequest(s.event, m)
+		s.event.BytesIn += messageSize(m)
+	}
+	return err
+}
+
+func (s *auditedStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		describeResponse(s.event, m)
+		s.event.BytesOut += messageSize(m)
+	}
+	return err
+}
+
+func messageSize(m interface{}) int64 {
+	if msg, ok := m.(proto.Message); ok {
+		return int64(proto.Size(msg))
+	}
+	return 0
+}
+
+// describeRequest fills in the event from the fields a request has. Fields
+// already set are kept, so the first message of a stream describes it.
+func describeRequest(e *Event, req interface{}) {
+	setOnce := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	if r, ok := req.(interface{ GetAgentName() string }); ok {
+		setOnce(&e.Agent, r.GetAgentName())
+	}
+	if r, ok := req.(interface{ GetCommand() string }); ok {
+		setOnce(&e.Command, r.GetCommand())
+	}
+	if r, ok := req.(interface{ GetTaskName() string }); ok && r.GetTaskName() != "" {
+		task := r.GetTaskName()
+		if g, ok := req.(interface{ GetTaskGroup() string }); ok && g.GetTaskGroup() != "" {
+			task = g.GetTaskGroup() + "/" + task
+		}
+		setOnce(&e.Task, task)
+	}
+	if r, ok := req.(interface{ GetPath() string }); ok {
+		setOnce(&e.Path, r.GetPath())
+	}
+	if r, ok := req.(interface{ GetStart() *pb.ShellStart }); ok && r.GetStart() != nil {
+		describeRequest(e, r.GetStart())
+	}
+	if r, ok := req.(interface{ GetTask() *pb.ExecuteTaskRequest }); ok && r.GetTask() != nil {
+		describeRequest(e, r.GetTask())
+	}
+}
+
+// describeResponse records the outcome reported by a response.
+func describeResponse(e *Event, resp interface{}) {
+	if r, ok := resp.(interface{ GetExited() bool }); ok {
+		if r.GetExited() {
+			code := resp.(interface{ GetExitCode() int32 }).GetExitCode()
+			e.ExitCode = &code
+		}
+		return
+	}
+	if r, ok := resp.(interface{ GetExitCode() int32 }); ok {
+		code := r.GetExitCode()
+		e.ExitCode = &code
+	}
+	if r, ok := resp.(interface{ GetSuccess() bool }); ok {
+		success := r.GetSuccess()
+		e.Success = &success
+	}
+}
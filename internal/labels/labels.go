@@ -0,0 +1,29 @@
+// Package labels parses the key=value labels of agents and the selectors
+// that pick agents by them.
+package labels
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parse turns key=value pairs into a label map.
+func Parse(pairs []string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid label %q. Expected key=value", pair)
+		}
+		labels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return labels, nil
+}
+
+// ParseSelector parses a comma-separated selector such as "role=web,env=prod".
+func ParseSelector(selector string) (map[string]string, error) {
+	if strings.TrimSpace(selector) == "" {
+		return nil, fmt.Errorf("selector cannot be empty")
+	}
+	return Parse(strings.Split(selector, ","))
+}
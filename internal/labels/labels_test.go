@@ -0,0 +1,18 @@
+package labels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSelector(t *testing.T) {
+	selector, err := ParseSelector("role=web, env = prod")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"role": "web", "env": "prod"}, selector)
+
+	for _, invalid := range []string{"", " ", "role", "=web", "role=web,"} {
+		_, err := ParseSelector(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
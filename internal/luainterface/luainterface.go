@@ -13,6 +13,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/chalkan3/sloth-runner/internal/types"
 	lua "github.com/yuin/gopher-lua"
@@ -21,15 +23,36 @@ import (
 
 var ExecCommand = exec.Command
 
-func newLuaImportFunction(baseDir string) lua.LGFunction {
+// importRecord tracks the files loaded with import(), so they can be shipped
+// to agents along with the script.
+type importRecord struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// importRegistryKey is where OpenImport keeps its importRecord in the Lua registry.
+const importRegistryKey = "sloth_runner.imports"
+
+func importKey(relPath string) string {
+	return filepath.ToSlash(filepath.Clean(relPath))
+}
+
+func newLuaImportFunction(baseDir string, bundled map[string][]byte, record *importRecord) lua.LGFunction {
 	return func(L *lua.LState) int {
 		relPath := L.CheckString(1)
-		absPath := filepath.Join(baseDir, relPath)
-		content, err := ioutil.ReadFile(absPath)
-		if err != nil {
-			L.RaiseError("cannot read imported file: %s", err.Error())
-			return 0
+		content, ok := bundled[importKey(relPath)]
+		if !ok {
+			absPath := filepath.Join(baseDir, relPath)
+			data, err := ioutil.ReadFile(absPath)
+			if err != nil {
+				L.RaiseError("cannot read imported file: %s", err.Error())
+				return 0
+			}
+			content = data
 		}
+		record.mu.Lock()
+		record.files[importKey(relPath)] = content
+		record.mu.Unlock()
 		if err := L.DoString(string(content)); err != nil {
 			L.RaiseError("error executing imported file: %s", err.Error())
 			return 0
@@ -39,8 +62,35 @@ func newLuaImportFunction(baseDir string) lua.LGFunction {
 }
 
 func OpenImport(L *lua.LState, configFilePath string) {
+	OpenBundledImport(L, configFilePath, nil)
+}
+
+// OpenBundledImport registers an import() that serves files from bundled,
+// keyed by their path relative to the config file, before reading the disk.
+func OpenBundledImport(L *lua.LState, configFilePath string, bundled map[string][]byte) {
 	baseDir := filepath.Dir(configFilePath)
-	L.SetGlobal("import", L.NewFunction(newLuaImportFunction(baseDir)))
+	record := &importRecord{files: make(map[string][]byte)}
+	ud := L.NewUserData()
+	ud.Value = record
+	L.G.Registry.RawSetString(importRegistryKey, ud)
+	L.SetGlobal("import", L.NewFunction(newLuaImportFunction(baseDir, bundled, record)))
+}
+
+// ImportedFiles returns the files loaded with import() so far, keyed by
+// their path relative to the config file.
+func ImportedFiles(L *lua.LState) map[string][]byte {
+	files := make(map[string][]byte)
+	ud, ok := L.G.Registry.RawGetString(importRegistryKey).(*lua.LUserData)
+	if !ok {
+		return files
+	}
+	record := ud.Value.(*importRecord)
+	record.mu.Lock()
+	defer record.mu.Unlock()
+	for path, content := range record.files {
+		files[path] = content
+	}
+	return files
 }
 
 func GoValueToLua(L *lua.LState, value interface{}) lua.LValue {
@@ -529,7 +579,14 @@ func luaExecRun(L *lua.LState) int {
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	if guard, ok := ctx.Value(commandGuardKey{}).(CommandGuard); ok {
+		if err := guard(cmd, commandStr); err != nil {
+			L.RaiseError("%v", err)
+			return 0
+		}
+	}
+
+	err := RunCommandContext(ctx, cmd)
 
 	stdoutStr := stdout.String()
 	stderrStr := stderr.String()
@@ -540,6 +597,9 @@ func luaExecRun(L *lua.LState) int {
 	if stderrStr != "" {
 		slog.Warn(stderrStr, "source", "lua", "stream", "stderr")
 	}
+	if w := taskLog(L); w != nil {
+		fmt.Fprintf(w, "$ %s\n%s%s", commandStr, stdoutStr, stderrStr)
+	}
 
 	L.Push(lua.LString(stdoutStr))
 	L.Push(lua.LString(stderrStr))
@@ -547,6 +607,26 @@ func luaExecRun(L *lua.LState) int {
 	return 3
 }
 
+// RunCommandContext runs cmd in its own process group. When ctx is done
+// before cmd exits, the whole group is killed, not just cmd, so a cancelled
+// task leaves no processes behind.
+func RunCommandContext(ctx context.Context, cmd *exec.Cmd) error {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-done
+		return ctx.Err()
+	}
+}
+
 func ExecLoader(L *lua.LState) int {
 	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
 		"run": luaExecRun,
@@ -565,27 +645,54 @@ func OpenExec(L *lua.LState) {
 func luaLogInfo(L *lua.LState) int {
 	message := L.CheckString(1)
 	slog.Info(message, "source", "lua")
+	writeTaskLog(L, "INFO", message)
 	return 0
 }
 
 func luaLogWarn(L *lua.LState) int {
 	message := L.CheckString(1)
 	slog.Warn(message, "source", "lua")
+	writeTaskLog(L, "WARN", message)
 	return 0
 }
 
 func luaLogError(L *lua.LState) int {
 	message := L.CheckString(1)
 	slog.Error(message, "source", "lua")
+	writeTaskLog(L, "ERROR", message)
 	return 0
 }
 
 func luaLogDebug(L *lua.LState) int {
 	message := L.CheckString(1)
 	slog.Debug(message, "source", "lua")
+	writeTaskLog(L, "DEBUG", message)
 	return 0
 }
 
+type taskLogKey struct{}
+
+// WithTaskLog returns a context whose tasks also write their log.* messages
+// and the output of their exec.run commands to w.
+func WithTaskLog(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, taskLogKey{}, w)
+}
+
+func taskLog(L *lua.LState) io.Writer {
+	if ctx := L.Context(); ctx != nil {
+		if w, ok := ctx.Value(taskLogKey{}).(io.Writer); ok {
+			return w
+		}
+	}
+	return nil
+}
+
+func writeTaskLog(L *lua.LState, level, message string) {
+	if w := taskLog(L); w != nil {
+		fmt.Fprintf(w, "%s %-5s %s\n", time.Now().Format("15:04:05"), level, message)
+	}
+}
+
 func LogLoader(L *lua.LState) int {
 	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
 		"info":  luaLogInfo,
@@ -603,6 +710,55 @@ func OpenLog(L *lua.LState) {
 	}
 }
 
+// ModuleNames lists the modules loaded by OpenAll.
+var ModuleNames = []string{"exec", "fs", "net", "data", "log", "salt", "pulumi", "git", "gcp", "python", "aws", "pkg"}
+
+// RestrictModules makes the modules loaded by OpenAll that are not in allowed
+// unusable in L. Using one, through its global or require, raises an error
+// and calls denied with the module name.
+func RestrictModules(L *lua.LState, allowed []string, denied func(module string)) {
+	allow := make(map[string]bool)
+	for _, name := range allowed {
+		allow[name] = true
+	}
+	preload := L.GetField(L.GetGlobal("package"), "preload")
+	loaded := L.GetField(L.Get(lua.RegistryIndex), "_LOADED")
+	for _, name := range ModuleNames {
+		if allow[name] {
+			continue
+		}
+		module := name
+		deny := func(L *lua.LState) int {
+			denied(module)
+			L.RaiseError("module '%s' is not allowed on this agent", module)
+			return 0
+		}
+		guard := L.NewTable()
+		mt := L.NewTable()
+		mt.RawSetString("__index", L.NewFunction(deny))
+		L.SetMetatable(guard, mt)
+		L.SetGlobal(module, guard)
+		if tbl, ok := preload.(*lua.LTable); ok {
+			tbl.RawSetString(module, L.NewFunction(deny))
+		}
+		if tbl, ok := loaded.(*lua.LTable); ok {
+			tbl.RawSetString(module, lua.LNil)
+		}
+	}
+}
+
+type commandGuardKey struct{}
+
+// CommandGuard vets the commands a task starts with exec.run.
+type CommandGuard func(cmd *exec.Cmd, command string) error
+
+// WithCommandGuard returns a context whose tasks run every exec.run command
+// through guard before starting it. guard may adjust the command, and an
+// error from it fails the call instead.
+func WithCommandGuard(ctx context.Context, guard CommandGuard) context.Context {
+	return context.WithValue(ctx, commandGuardKey{}, guard)
+}
+
 // OpenAll preloads all available sloth-runner modules into the Lua state.
 func OpenAll(L *lua.LState) {
 	// Preload all modules, making them available to 'require'
@@ -795,6 +951,12 @@ func LoadTaskDefinitions(L *lua.LState, luaScriptContent string, configFilePath
 					if localOverrides.CommandStr != "" {
 						finalTask.CommandStr = localOverrides.CommandStr
 					}
+					if localOverrides.ForwardEnv != nil {
+						finalTask.ForwardEnv = localOverrides.ForwardEnv
+					}
+					if localOverrides.Schedule != nil {
+						finalTask.Schedule = localOverrides.Schedule
+					}
 					// ... (merge other fields)
 					finalTask.Name = taskKey.String()
 				} else {
@@ -819,6 +981,9 @@ func LoadTaskDefinitions(L *lua.LState, luaScriptContent string, configFilePath
 			CreateWorkdirBeforeRun:   createWorkdir,
 			CleanWorkdirAfterRunFunc: cleanWorkdirFunc,
 			DelegateTo:               delegateTo,
+			WorkspaceSync:            parseWorkspaceSync(groupTable.RawGetString("workspace_sync")),
+			ForwardEnv:               luaStringList(groupTable.RawGetString("forward_env")),
+			Schedule:                 parseScheduleDeclaration(groupTable),
 		}
 	})
 	return loadedTaskGroups, nil
@@ -946,7 +1111,75 @@ func parseLuaTask(L *lua.LState, taskTable *lua.LTable) types.Task {
 		PreExec:     preExec,
 		PostExec:    postExec,
 		DelegateTo:  delegateTo,
+		// Parse workspace_sync = { include = {...}, exclude = {...} }
+		WorkspaceSync: parseWorkspaceSync(taskTable.RawGetString("workspace_sync")),
+		ForwardEnv:    luaStringList(taskTable.RawGetString("forward_env")),
+		Schedule:      parseScheduleDeclaration(taskTable),
+	}
+}
+
+// parseWorkspaceSync reads a workspace_sync table. Each of include and
+// exclude may be a single pattern or a list of patterns.
+func parseWorkspaceSync(value lua.LValue) *types.WorkspaceSync {
+	table, ok := value.(*lua.LTable)
+	if !ok {
+		return nil
+	}
+	return &types.WorkspaceSync{
+		Include: luaStringList(table.RawGetString("include")),
+		Exclude: luaStringList(table.RawGetString("exclude")),
+	}
+}
+
+// parseScheduleDeclaration reads the schedule and triggers fields of a task
+// or group into the fields of a scheduled task of scheduler.yaml. schedule
+// is a cron expression, or a table of those fields with the expression in
+// cron; triggers holds file_watch, http_webhook and git_poll tables.
+func parseScheduleDeclaration(table *lua.LTable) map[string]interface{} {
+	spec := make(map[string]interface{})
+	switch schedule := table.RawGetString("schedule").(type) {
+	case *lua.LNilType:
+	case *lua.LTable:
+		fields, ok := LuaValueToGo(schedule).(map[string]interface{})
+		if !ok {
+			spec["schedule"] = LuaValueToGo(schedule) // Rejected by scheduler sync
+			break
+		}
+		for key, value := range fields {
+			if key == "cron" {
+				key = "schedule"
+			}
+			spec[key] = value
+		}
+	default:
+		spec["schedule"] = LuaValueToGo(schedule)
+	}
+	if triggers := table.RawGetString("triggers"); triggers != lua.LNil {
+		fields, ok := LuaValueToGo(triggers).(map[string]interface{})
+		if !ok {
+			spec["triggers"] = LuaValueToGo(triggers) // Rejected by scheduler sync
+		}
+		for key, value := range fields {
+			spec[key] = value
+		}
+	}
+	if len(spec) == 0 {
+		return nil
+	}
+	return spec
+}
+
+func luaStringList(value lua.LValue) []string {
+	var list []string
+	switch v := value.(type) {
+	case lua.LString:
+		list = append(list, string(v))
+	case *lua.LTable:
+		v.ForEach(func(_, item lua.LValue) {
+			list = append(list, item.String())
+		})
 	}
+	return list
 }
 
 func LuaTableToGoMap(L *lua.LState, table *lua.LTable) map[string]interface{} {
@@ -969,6 +1202,38 @@ func LuaTableToGoMap(L *lua.LState, table *lua.LTable) map[string]interface{} {
 	return result
 }
 
+// LuaValueToGo converts a Lua value into plain Go values that survive a JSON
+// round trip. Unlike LuaTableToGoMap, tables that are sequences become slices.
+func LuaValueToGo(value lua.LValue) interface{} {
+	switch v := value.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		count := 0
+		v.ForEach(func(_, _ lua.LValue) { count++ })
+		if n := v.MaxN(); n > 0 && n == count {
+			list := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				list = append(list, LuaValueToGo(v.RawGetInt(i)))
+			}
+			return list
+		}
+		result := make(map[string]interface{})
+		v.ForEach(func(key, item lua.LValue) {
+			result[key.String()] = LuaValueToGo(item)
+		})
+		return result
+	case *lua.LNilType:
+		return nil
+	default:
+		return value.String()
+	}
+}
+
 // CopyTable performs a deep copy of a table from one Lua state to another.
 func CopyTable(src *lua.LTable, destL *lua.LState) *lua.LTable {
 	destT := destL.NewTable()
@@ -1,10 +1,13 @@
 package luainterface
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	lua "github.com/yuin/gopher-lua"
@@ -142,3 +145,20 @@ func TestSaltTarget_Cmd_Basic(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+
+func TestRunCommandContext_KillsProcessTree(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The background sleep keeps stdout open, so Wait only returns once it is killed too.
+	cmd := exec.Command("bash", "-c", "sleep 30 & sleep 30")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	start := time.Now()
+	err := RunCommandContext(ctx, cmd)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
@@ -3,7 +3,6 @@ package luainterface
 import (
 	"fmt"
 	"os/exec"
-	"strings"
 
 	lua "github.com/yuin/gopher-lua"
 )
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package luainterface
+
+import (
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	// No-op on non-linux systems
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	// Only the command itself can be killed on non-linux systems
+	cmd.Process.Kill()
+}
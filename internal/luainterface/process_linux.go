@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package luainterface
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	// The command leads its own process group, so this also kills whatever it spawned.
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,266 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // Time zones work on hosts without a zoneinfo database
+
+	"github.com/robfig/cron/v3"
+)
+
+// Catch-up policies of scheduled tasks.
+const (
+	CatchUpNone = "none"
+	CatchUpLast = "last"
+	CatchUpAll  = "all"
+)
+
+// maxCatchUpRuns caps the runs caught up for a task with catch_up all.
+const maxCatchUpRuns = 100
+
+// scheduleParser parses schedules: standard cron with an optional leading
+// seconds field, or descriptors such as @daily and @every 1h.
+var scheduleParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// location returns the time zone of a task.
+func (t ScheduledTask) location() (*time.Location, error) {
+	if t.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(t.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q for task %s: %w", t.Timezone, t.Name, err)
+	}
+	return loc, nil
+}
+
+// parseSchedule parses the schedule of a task in its time zone.
+func parseSchedule(task ScheduledTask) (cron.Schedule, error) {
+	spec := task.Schedule
+	if task.Timezone != "" {
+		if strings.HasPrefix(spec, "TZ=") || strings.HasPrefix(spec, "CRON_TZ=") {
+			return nil, fmt.Errorf("task %s sets both timezone and a time zone in its schedule", task.Name)
+		}
+		if _, err := task.location(); err != nil {
+			return nil, err
+		}
+		spec = "CRON_TZ=" + task.Timezone + " " + spec
+	}
+	schedule, err := scheduleParser.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q for task %s: %w", task.Schedule, task.Name, err)
+	}
+	return schedule, nil
+}
+
+// BlackoutWindow is a period in which runs of a task are skipped. From and
+// To are both either a time of day ("22:00"), a weekday and a time
+// ("Fri 16:00"), or a date and a time ("2025-12-24 00:00"), in the time
+// zone of the task. Daily and weekly windows may wrap around, as in
+// "Fri 16:00" to "Mon 08:00".
+type BlackoutWindow struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// String returns the window as "from - to".
+func (w BlackoutWindow) String() string {
+	return w.From + " - " + w.To
+}
+
+// Kinds of blackout windows.
+const (
+	blackoutDaily = iota
+	blackoutWeekly
+	blackoutDated
+)
+
+// blackout is a parsed blackout window. from and to are minutes of the
+// day or of the week, or Unix times for dated windows.
+type blackout struct {
+	window   BlackoutWindow
+	kind     int
+	from, to int64
+	loc      *time.Location
+}
+
+// parseBlackouts parses the blackout windows of a task.
+func parseBlackouts(task ScheduledTask) ([]blackout, error) {
+	loc, err := task.location()
+	if err != nil {
+		return nil, err
+	}
+	var windows []blackout
+	for _, w := range task.Blackout {
+		fromKind, from, err := parseBlackoutTime(w.From, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout %q for task %s: %w", w, task.Name, err)
+		}
+		toKind, to, err := parseBlackoutTime(w.To, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout %q for task %s: %w", w, task.Name, err)
+		}
+		if fromKind != toKind {
+			return nil, fmt.Errorf("invalid blackout %q for task %s: from and to must have the same format", w, task.Name)
+		}
+		if from == to || (fromKind == blackoutDated && from > to) {
+			return nil, fmt.Errorf("invalid blackout %q for task %s: the window is empty", w, task.Name)
+		}
+		windows = append(windows, blackout{window: w, kind: fromKind, from: from, to: to, loc: loc})
+	}
+	return windows, nil
+}
+
+// parseBlackoutTime parses one end of a blackout window.
+func parseBlackoutTime(s string, loc *time.Location) (kind int, value int64, err error) {
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+		minute, err := parseTimeOfDay(fields[0])
+		return blackoutDaily, minute, err
+	case 2:
+		if day, ok := parseWeekday(fields[0]); ok {
+			minute, err := parseTimeOfDay(fields[1])
+			return blackoutWeekly, int64(day)*24*60 + minute, err
+		}
+		t, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%q is not a weekday or a date", fields[0])
+		}
+		return blackoutDated, t.Unix(), nil
+	}
+	return 0, 0, fmt.Errorf("%q is not \"15:04\", \"Mon 15:04\" or \"2006-01-02 15:04\"", s)
+}
+
+// parseTimeOfDay parses "15:04" into minutes since midnight.
+func parseTimeOfDay(s string) (int64, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) == 2 {
+		hour, errHour := strconv.Atoi(parts[0])
+		minute, errMinute := strconv.Atoi(parts[1])
+		if errHour == nil && errMinute == nil && hour >= 0 && hour < 24 && minute >= 0 && minute < 60 {
+			return int64(hour*60 + minute), nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not a time of day like 15:04", s)
+}
+
+// parseWeekday parses a weekday name such as "Fri" or "friday".
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.ToLower(s)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if s == name || s == name[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// contains tells whether t falls in the window.
+func (b blackout) contains(t time.Time) bool {
+	t = t.In(b.loc)
+	var value int64
+	switch b.kind {
+	case blackoutDated:
+		return t.Unix() >= b.from && t.Unix() < b.to
+	case blackoutWeekly:
+		value = int64(t.Weekday())*24*60 + int64(t.Hour()*60+t.Minute())
+	default:
+		value = int64(t.Hour()*60 + t.Minute())
+	}
+	if b.from < b.to {
+		return value >= b.from && value < b.to
+	}
+	return value >= b.from || value < b.to
+}
+
+// inBlackout returns the window t falls in, if any.
+func inBlackout(windows []blackout, t time.Time) (BlackoutWindow, bool) {
+	for _, b := range windows {
+		if b.contains(t) {
+			return b.window, true
+		}
+	}
+	return BlackoutWindow{}, false
+}
+
+// missedRuns returns when a task was due, outside its blackout windows,
+// after last and up to now.
+func missedRuns(schedule cron.Schedule, windows []blackout, last, now time.Time) []time.Time {
+	var missed []time.Time
+	for t := schedule.Next(last); !t.IsZero() && !t.After(now) && len(missed) < maxCatchUpRuns; t = schedule.Next(t) {
+		if _, blocked := inBlackout(windows, t); !blocked {
+			missed = append(missed, t)
+		}
+	}
+	return missed
+}
+
+// DefaultStateFile returns where the scheduler persists when tasks were
+// last due by default.
+func DefaultStateFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "sloth-runner-scheduler-state.json")
+	}
+	return filepath.Join(home, ".sloth-runner", "scheduler", "state.json")
+}
+
+// lastRuns persists when each task with a catch-up policy was last due, so
+// runs missed while the scheduler was down are found when it starts.
+type lastRuns struct {
+	mu    sync.Mutex
+	path  string
+	times map[string]time.Time
+}
+
+// loadLastRuns reads the state file at path, which may not exist yet.
+func loadLastRuns(path string) (*lastRuns, error) {
+	l := &lastRuns{path: path, times: make(map[string]time.Time)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scheduler state: %w", err)
+	}
+	if err := json.Unmarshal(data, &l.times); err != nil {
+		return nil, fmt.Errorf("failed to parse scheduler state %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// get returns when a task was last due.
+func (l *lastRuns) get(taskName string) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t, ok := l.times[taskName]
+	return t, ok
+}
+
+// set records when a task was last due and saves the state.
+func (l *lastRuns) set(taskName string, t time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.times[taskName] = t
+	data, err := json.MarshalIndent(l.times, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create scheduler state directory: %w", err)
+	}
+	tmp := l.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write scheduler state: %w", err)
+	}
+	return os.Rename(tmp, l.path)
+}
@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScheduleTimezoneAndSeconds(t *testing.T) {
+	schedule, err := parseSchedule(ScheduledTask{Name: "job", Schedule: "0 9 * * *", Timezone: "America/Sao_Paulo"})
+	require.NoError(t, err)
+	next := schedule.Next(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), next.UTC())
+
+	schedule, err = parseSchedule(ScheduledTask{Name: "job", Schedule: "30 0 9 * * *"})
+	require.NoError(t, err)
+	assert.Equal(t, 30, schedule.Next(time.Date(2025, 6, 1, 0, 0, 0, 0, time.Local)).Second())
+
+	_, err = parseSchedule(ScheduledTask{Name: "job", Schedule: "0 9 * * *", Timezone: "Mars/Olympus"})
+	assert.Error(t, err)
+	_, err = parseSchedule(ScheduledTask{Name: "job", Schedule: "CRON_TZ=UTC 0 9 * * *", Timezone: "UTC"})
+	assert.Error(t, err)
+}
+
+func TestBlackoutWindows(t *testing.T) {
+	windows, err := parseBlackouts(ScheduledTask{Name: "job", Timezone: "UTC", Blackout: []BlackoutWindow{
+		{From: "Fri 16:00", To: "Mon 08:00"},
+		{From: "23:00", To: "01:00"},
+		{From: "2025-12-24 00:00", To: "2025-12-26 00:00"},
+	}})
+	require.NoError(t, err)
+	at := func(s string) time.Time {
+		ts, err := time.Parse("2006-01-02 15:04", s)
+		require.NoError(t, err)
+		return ts
+	}
+	for when, blocked := range map[string]bool{
+		"2025-06-06 15:59": false, // Friday
+		"2025-06-06 16:00": true,
+		"2025-06-08 12:00": true, // Sunday
+		"2025-06-09 07:59": true, // Monday
+		"2025-06-09 08:00": false,
+		"2025-06-10 23:30": true, // Daily window
+		"2025-06-11 00:30": true,
+		"2025-06-11 01:00": false,
+		"2025-12-25 12:00": true, // Thursday, dated window
+		"2025-12-26 12:00": false,
+	} {
+		_, ok := inBlackout(windows, at(when))
+		assert.Equal(t, blocked, ok, when)
+	}
+
+	for _, w := range []BlackoutWindow{
+		{From: "Fri 16:00", To: "08:00"},
+		{From: "Someday 16:00", To: "Mon 08:00"},
+		{From: "25:00", To: "08:00"},
+		{From: "08:00", To: "08:00"},
+		{From: "2025-12-26 00:00", To: "2025-12-24 00:00"},
+	} {
+		_, err := parseBlackouts(ScheduledTask{Name: "job", Blackout: []BlackoutWindow{w}})
+		assert.Error(t, err, w.String())
+	}
+}
+
+func TestSkipInBlackout(t *testing.T) {
+	s := NewScheduler("dummy.yaml")
+	s.History = NewHistory(HistoryConfig{Dir: t.TempDir()})
+	s.Runner = func(ctx context.Context, task ScheduledTask) *RunResult {
+		return &RunResult{Success: true}
+	}
+	now := time.Now()
+	task := ScheduledTask{Name: "job", Blackout: []BlackoutWindow{{
+		From: now.Add(-time.Hour).Format("2006-01-02 15:04"),
+		To:   now.Add(time.Hour).Format("2006-01-02 15:04"),
+	}}}
+	wrappedJob(t, s, task).Run()
+
+	runs, err := s.History.List("job")
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, StatusSkipped, runs[0].Status)
+	assert.Contains(t, runs[0].Error, "in blackout window")
+}
+
+func TestCatchUp(t *testing.T) {
+	for policy, want := range map[string]int32{CatchUpAll: 3, CatchUpLast: 1, CatchUpNone: 0} {
+		t.Run(policy, func(t *testing.T) {
+			dir := t.TempDir()
+			stateFile := filepath.Join(dir, "state.json")
+			last := time.Now().Add(-3*time.Hour - time.Minute)
+			require.NoError(t, ioutil.WriteFile(stateFile, []byte(fmt.Sprintf(`{"job": %q}`, last.Format(time.RFC3339Nano))), 0644))
+
+			s := NewScheduler("dummy.yaml")
+			var runs int32
+			s.Runner = func(ctx context.Context, task ScheduledTask) *RunResult {
+				atomic.AddInt32(&runs, 1)
+				return &RunResult{Success: true}
+			}
+			s.SetConfig(&SchedulerConfig{
+				StateFile:      stateFile,
+				ScheduledTasks: []ScheduledTask{{Name: "job", Schedule: "@every 1h", TaskFile: "job.lua", CatchUp: policy}},
+			})
+			require.NoError(t, s.Start())
+			assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) == want }, time.Second, 10*time.Millisecond)
+			s.Stop()
+			assert.Equal(t, want, atomic.LoadInt32(&runs))
+
+			if policy != CatchUpNone {
+				state, err := loadLastRuns(stateFile)
+				require.NoError(t, err)
+				due, ok := state.get("job")
+				require.True(t, ok)
+				assert.True(t, due.After(last.Add(3*time.Hour)))
+			}
+		})
+	}
+
+	s := NewScheduler("dummy.yaml")
+	s.SetConfig(&SchedulerConfig{ScheduledTasks: []ScheduledTask{{Name: "job", Schedule: "@every 1h", TaskFile: "job.lua", CatchUp: "sometimes"}}})
+	assert.Error(t, s.Start())
+}
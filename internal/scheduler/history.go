@@ -0,0 +1,189 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultHistoryMaxRuns is how many runs of each job the history keeps.
+	DefaultHistoryMaxRuns = 50
+	// DefaultHistoryMaxAge is how long the history keeps a run.
+	DefaultHistoryMaxAge = 30 * 24 * time.Hour
+)
+
+// HistoryConfig configures where scheduled runs are recorded and for how long.
+type HistoryConfig struct {
+	Dir     string        `yaml:"dir,omitempty"`
+	MaxRuns int           `yaml:"max_runs,omitempty"` // Per job
+	MaxAge  time.Duration `yaml:"max_age,omitempty"`
+}
+
+// DefaultHistoryDir returns where scheduled runs are recorded by default.
+func DefaultHistoryDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "sloth-runner-scheduler-history")
+	}
+	return filepath.Join(home, ".sloth-runner", "scheduler", "history")
+}
+
+// History records scheduled runs in a directory, as <id>.json with the
+// outcome of the run and <id>.log with the logs of its tasks. Runs beyond
+// maxRuns per job, or older than maxAge, are deleted as new runs are
+// recorded.
+type History struct {
+	dir     string
+	maxRuns int
+	maxAge  time.Duration
+	now     func() time.Time
+}
+
+// NewHistory returns the history described by config, filling in defaults.
+func NewHistory(config HistoryConfig) *History {
+	h := &History{dir: config.Dir, maxRuns: config.MaxRuns, maxAge: config.MaxAge, now: time.Now}
+	if h.dir == "" {
+		h.dir = DefaultHistoryDir()
+	}
+	if h.maxRuns <= 0 {
+		h.maxRuns = DefaultHistoryMaxRuns
+	}
+	if h.maxAge <= 0 {
+		h.maxAge = DefaultHistoryMaxAge
+	}
+	return h
+}
+
+// Dir returns the directory of the history.
+func (h *History) Dir() string {
+	return h.dir
+}
+
+// Record assigns an ID to a finished run, writes it and its task logs to
+// the history and applies the retention.
+func (h *History) Record(result *RunResult) error {
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create scheduler history directory: %w", err)
+	}
+	result.ID = result.StartedAt.Format("20060102-150405") + "-" + uuid.New().String()[:8]
+	result.LogFile = filepath.Join(h.dir, result.ID+".log")
+
+	var logs strings.Builder
+	for _, task := range result.Tasks {
+		fmt.Fprintf(&logs, "==> %s (%s, %s)\n", task.Name, task.Status, task.Duration.Round(time.Millisecond))
+		logs.WriteString(task.Logs)
+		if task.Logs != "" && !strings.HasSuffix(task.Logs, "\n") {
+			logs.WriteString("\n")
+		}
+		if task.Error != "" {
+			fmt.Fprintf(&logs, "error: %s\n", task.Error)
+		}
+	}
+	if result.Error != "" {
+		status := result.Status
+		if status == "" {
+			status = StatusFailed
+		}
+		fmt.Fprintf(&logs, "==> %s: %s\n", status, result.Error)
+	}
+	if err := ioutil.WriteFile(result.LogFile, []byte(logs.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write run log: %w", err)
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run: %w", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(h.dir, result.ID+".json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	return h.prune()
+}
+
+// List returns the recorded runs of job, or of every job when job is
+// empty, newest first.
+func (h *History) List(job string) ([]*RunResult, error) {
+	files, err := filepath.Glob(filepath.Join(h.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var runs []*RunResult
+	for _, file := range files {
+		run, err := readRun(file)
+		if err != nil {
+			continue // Skip runs being written or deleted
+		}
+		if job == "" || run.Task == job {
+			runs = append(runs, run)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].StartedAt.After(runs[j].StartedAt) })
+	return runs, nil
+}
+
+// Get returns the run with the given ID, or with the only ID starting with it.
+func (h *History) Get(id string) (*RunResult, error) {
+	if id == "" || filepath.Base(id) != id {
+		return nil, fmt.Errorf("invalid run ID %q", id)
+	}
+	files, err := filepath.Glob(filepath.Join(h.dir, id+"*.json"))
+	if err != nil {
+		return nil, err
+	}
+	switch len(files) {
+	case 0:
+		return nil, fmt.Errorf("scheduled run '%s' not found", id)
+	case 1:
+		return readRun(files[0])
+	}
+	for _, file := range files {
+		if filepath.Base(file) == id+".json" {
+			return readRun(file)
+		}
+	}
+	return nil, fmt.Errorf("run ID '%s' is ambiguous, it matches %d runs", id, len(files))
+}
+
+// prune deletes the runs beyond the retention, including those of jobs
+// no longer scheduled once they are too old.
+func (h *History) prune() error {
+	runs, err := h.List("")
+	if err != nil {
+		return err
+	}
+	cutoff := h.now().Add(-h.maxAge)
+	kept := make(map[string]int)
+	for _, run := range runs {
+		kept[run.Task]++
+		if kept[run.Task] > h.maxRuns || run.StartedAt.Before(cutoff) {
+			os.Remove(filepath.Join(h.dir, run.ID+".json"))
+			os.Remove(filepath.Join(h.dir, run.ID+".log"))
+		}
+	}
+	return nil
+}
+
+func readRun(path string) (*RunResult, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var run RunResult
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to parse run %s: %w", path, err)
+	}
+	if run.Status == "" {
+		run.Status = StatusFailed
+		if run.Success {
+			run.Status = StatusSuccess
+		}
+	}
+	return &run, nil
+}
@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryRecordAndGet(t *testing.T) {
+	h := NewHistory(HistoryConfig{Dir: t.TempDir()})
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	h.now = func() time.Time { return start }
+	result := &RunResult{
+		Task:       "nightly",
+		StartedAt:  start,
+		FinishedAt: start.Add(time.Second),
+		Status:     StatusFailed,
+		Error:      "task 'backup' failed: disk full",
+		Tasks: []TaskResult{
+			{Name: "backup", Status: "Failed", Error: "task 'backup' failed: disk full", Logs: "$ df -h\n100%"},
+		},
+	}
+	require.NoError(t, h.Record(result))
+	assert.Contains(t, result.ID, "20260102-030405-")
+
+	logs, err := ioutil.ReadFile(result.LogFile)
+	require.NoError(t, err)
+	assert.Equal(t, "==> backup (Failed, 0s)\n$ df -h\n100%\nerror: task 'backup' failed: disk full\n==> failed: task 'backup' failed: disk full\n", string(logs))
+
+	run, err := h.Get(result.ID[:18])
+	require.NoError(t, err)
+	assert.Equal(t, "nightly", run.Task)
+	assert.Equal(t, StatusFailed, run.Status)
+	assert.Equal(t, result.LogFile, run.LogFile)
+	assert.Empty(t, run.Tasks[0].Logs)
+
+	_, err = h.Get("20250101")
+	assert.Error(t, err)
+	_, err = h.Get("../etc")
+	assert.Error(t, err)
+}
+
+func TestHistoryRetention(t *testing.T) {
+	h := NewHistory(HistoryConfig{Dir: t.TempDir(), MaxRuns: 2, MaxAge: time.Hour})
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	record := func(job string, age time.Duration) {
+		require.NoError(t, h.Record(&RunResult{Task: job, StartedAt: now.Add(-age), FinishedAt: now.Add(-age), Success: true}))
+	}
+	record("old-job", 2*time.Hour)
+	record("a", 30*time.Minute)
+	record("a", 20*time.Minute)
+	record("b", 15*time.Minute)
+	record("a", 10*time.Minute)
+
+	runs, err := h.List("")
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	assert.Equal(t, "a", runs[0].Task)
+	assert.Equal(t, now.Add(-10*time.Minute), runs[0].StartedAt.UTC())
+	assert.Equal(t, "b", runs[1].Task)
+	assert.Equal(t, "a", runs[2].Task)
+	assert.Equal(t, now.Add(-20*time.Minute), runs[2].StartedAt.UTC())
+
+	runs, err = h.List("b")
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+}
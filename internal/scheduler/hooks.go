@@ -0,0 +1,163 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+)
+
+// Triggers of runs chained by the hooks of another task, passed to them in
+// the "trigger" param.
+const (
+	TriggerOnSuccess = "on_success"
+	TriggerOnFailure = "on_failure"
+)
+
+// Hooks say what happens after a run of a task.
+type Hooks struct {
+	// Jobs are scheduled tasks to run next. They get the trigger,
+	// upstream_job, upstream_run, upstream_status and upstream_error params.
+	Jobs []string `yaml:"jobs,omitempty"`
+	// Notify names the notifiers to tell about the run.
+	Notify []string `yaml:"notify,omitempty"`
+}
+
+// hooks returns the hooks a run of a task calls, and the trigger they are
+// called for. A run fails when it failed or timed out; skipped, replaced
+// and cancelled runs call no hooks.
+func (t ScheduledTask) hooks(status string) (Hooks, string) {
+	switch status {
+	case StatusSuccess:
+		return t.OnSuccess, TriggerOnSuccess
+	case StatusFailed, StatusTimedOut:
+		return t.OnFailure, TriggerOnFailure
+	}
+	return Hooks{}, ""
+}
+
+// validateHooks checks that the hooks of every task refer to known tasks
+// and notifiers, that tasks do not chain back to themselves, and that every
+// task has a schedule or a trigger, or is chained by another.
+func (c *SchedulerConfig) validateHooks() error {
+	tasks := make(map[string]ScheduledTask)
+	for _, task := range c.ScheduledTasks {
+		tasks[task.Name] = task
+	}
+	notifiers := make(map[string]bool)
+	for _, n := range c.Notifiers {
+		notifiers[n.Name] = true
+	}
+	chained := make(map[string]bool)
+	for _, task := range c.ScheduledTasks {
+		for _, hooks := range []Hooks{task.OnSuccess, task.OnFailure} {
+			for _, name := range hooks.Jobs {
+				if _, ok := tasks[name]; !ok {
+					return fmt.Errorf("task %s chains unknown task %s", task.Name, name)
+				}
+				chained[name] = true
+			}
+			for _, name := range hooks.Notify {
+				if !notifiers[name] {
+					return fmt.Errorf("task %s notifies unknown notifier %s", task.Name, name)
+				}
+			}
+		}
+	}
+	for _, task := range c.ScheduledTasks {
+		if task.Schedule == "" && len(task.Triggers()) == 0 && !chained[task.Name] {
+			return fmt.Errorf("task %s has no schedule or trigger and no task chains it", task.Name)
+		}
+	}
+
+	// Depth-first search for a cycle.
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[string]int)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("tasks chain each other in a loop: %v", append(path, name))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		task := tasks[name]
+		for _, next := range append(append([]string{}, task.OnSuccess.Jobs...), task.OnFailure.Jobs...) {
+			if err := visit(next, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, task := range c.ScheduledTasks {
+		if err := visit(task.Name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterRun sends the notifications and starts the jobs that the hooks of a
+// task call for the outcome of a run. Notifications are sent before it
+// returns. Chained jobs run in the background, through their concurrency
+// policy, once the scheduler has started, and right away otherwise, as
+// with run-now.
+func (s *Scheduler) afterRun(task ScheduledTask, result *RunResult) {
+	hooks, trigger := task.hooks(result.Status)
+	if len(hooks.Jobs) == 0 && len(hooks.Notify) == 0 {
+		return
+	}
+	config := s.Config()
+	if config == nil {
+		return
+	}
+
+	notification := newNotification(result)
+	for _, name := range hooks.Notify {
+		notifier, ok := config.Notifier(name)
+		if !ok {
+			fmt.Printf("Not notifying %s about scheduled task '%s': no such notifier\n", name, task.Name)
+			continue
+		}
+		// Notifications go out even while the scheduler stops.
+		if err := notifier.Notify(context.Background(), notification); err != nil {
+			fmt.Printf("Failed to notify %s about scheduled task '%s': %v\n", name, task.Name, err)
+		} else {
+			fmt.Printf("Notified %s about scheduled task '%s'\n", name, task.Name)
+		}
+	}
+
+	params := map[string]string{
+		"trigger":         trigger,
+		"upstream_job":    task.Name,
+		"upstream_run":    result.ID,
+		"upstream_status": result.Status,
+		"upstream_error":  result.Error,
+	}
+	reason := fmt.Sprintf("%s of '%s'", trigger, task.Name)
+	for _, name := range hooks.Jobs {
+		next, ok := config.Task(name)
+		if !ok {
+			fmt.Printf("Not starting scheduled task '%s' %s: no such task\n", name, reason)
+			continue
+		}
+		if next.Paused {
+			fmt.Printf("Not starting scheduled task '%s' %s: it is paused\n", name, reason)
+			continue
+		}
+		s.mu.Lock()
+		entry, scheduled := s.entries[name]
+		s.mu.Unlock()
+		if scheduled {
+			s.fire(entry.task, entry.chain, reason, params)
+			continue
+		}
+		if s.ctx.Err() == nil {
+			fmt.Printf("Scheduled task '%s' triggered by %s\n", name, reason)
+			s.RunTask(next.withParams(params))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateHooks(t *testing.T) {
+	notifiers := []Notifier{{Name: "ops", Type: NotifierSlack, URL: "http://localhost/hook"}}
+	valid := &SchedulerConfig{Notifiers: notifiers, ScheduledTasks: []ScheduledTask{
+		{Name: "build", TaskFile: "build.lua", Schedule: "@daily", OnSuccess: Hooks{Jobs: []string{"deploy"}}, OnFailure: Hooks{Notify: []string{"ops"}}},
+		{Name: "deploy", TaskFile: "deploy.lua", OnFailure: Hooks{Jobs: []string{"rollback"}, Notify: []string{"ops"}}},
+		{Name: "rollback", TaskFile: "rollback.lua"},
+	}}
+	assert.NoError(t, valid.Validate())
+
+	for _, config := range []*SchedulerConfig{
+		{ScheduledTasks: []ScheduledTask{
+			{Name: "build", TaskFile: "build.lua", Schedule: "@daily", OnSuccess: Hooks{Jobs: []string{"deploy"}}},
+		}},
+		{ScheduledTasks: []ScheduledTask{
+			{Name: "build", TaskFile: "build.lua", Schedule: "@daily", OnFailure: Hooks{Notify: []string{"ops"}}},
+		}},
+		{ScheduledTasks: []ScheduledTask{
+			{Name: "build", TaskFile: "build.lua", Schedule: "@daily", OnSuccess: Hooks{Jobs: []string{"test"}}},
+			{Name: "test", TaskFile: "test.lua", OnFailure: Hooks{Jobs: []string{"build"}}},
+		}},
+		{Notifiers: append(notifiers, notifiers...), ScheduledTasks: []ScheduledTask{
+			{Name: "build", TaskFile: "build.lua", Schedule: "@daily"},
+		}},
+	} {
+		assert.Error(t, config.Validate(), "%+v", config)
+	}
+}
+
+func TestNotifierValidate(t *testing.T) {
+	assert.NoError(t, Notifier{Name: "ops", Type: NotifierNtfy, URL: "https://ntfy.sh/ops"}.Validate())
+	assert.NoError(t, Notifier{Name: "log", Type: NotifierCommand, Command: "cat", Message: "{{.Job}}"}.Validate())
+	for _, n := range []Notifier{
+		{Type: NotifierWebhook, URL: "http://localhost"},
+		{Name: "ops", Type: "email", URL: "http://localhost"},
+		{Name: "ops", Type: NotifierSlack},
+		{Name: "ops", Type: NotifierCommand},
+		{Name: "ops", Type: NotifierWebhook, URL: "http://localhost", Message: "{{.Job"},
+	} {
+		assert.Error(t, n.Validate(), "%+v", n)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	requests := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- body
+	}))
+	defer server.Close()
+	out := filepath.Join(t.TempDir(), "notified.txt")
+
+	runs := make(chan map[string]string, 10)
+	s := NewScheduler("dummy.yaml")
+	s.Runner = func(ctx context.Context, task ScheduledTask) *RunResult {
+		if task.Name == "build" {
+			return &RunResult{Error: "compilation failed"}
+		}
+		runs <- task.Params
+		return &RunResult{Success: true}
+	}
+	s.SetConfig(&SchedulerConfig{
+		Notifiers: []Notifier{
+			{Name: "hook", Type: NotifierWebhook, URL: server.URL},
+			{Name: "slack", Type: NotifierSlack, URL: server.URL, Message: "{{.Job}} is {{.Status}}"},
+			{Name: "cmd", Type: NotifierCommand, Command: `cat > ` + out + `; echo " $SLOTH_JOB $SLOTH_STATUS" >> ` + out},
+		},
+		ScheduledTasks: []ScheduledTask{
+			{Name: "build", TaskFile: "build.lua", Schedule: "@daily",
+				OnSuccess: Hooks{Jobs: []string{"deploy"}},
+				OnFailure: Hooks{Jobs: []string{"cleanup"}, Notify: []string{"hook", "slack", "cmd"}}},
+			{Name: "cleanup", TaskFile: "cleanup.lua", Params: map[string]string{"env": "ci"}},
+			{Name: "deploy", TaskFile: "deploy.lua"},
+		},
+	})
+
+	// Outside the running scheduler, as with run-now, chained jobs run
+	// before RunTask returns.
+	build, _ := s.Config().Task("build")
+	result := s.RunTask(build)
+	assert.Equal(t, StatusFailed, result.Status)
+	require.Len(t, runs, 1)
+	params := <-runs
+	assert.Equal(t, TriggerOnFailure, params["trigger"])
+	assert.Equal(t, "build", params["upstream_job"])
+	assert.Equal(t, StatusFailed, params["upstream_status"])
+	assert.Equal(t, "compilation failed", params["upstream_error"])
+	assert.Equal(t, "ci", params["env"])
+
+	require.Len(t, requests, 2)
+	var notification Notification
+	require.NoError(t, json.Unmarshal(<-requests, &notification))
+	assert.Equal(t, "build", notification.Job)
+	assert.Equal(t, StatusFailed, notification.Status)
+	assert.Equal(t, "compilation failed", notification.Error)
+	assert.Equal(t, "[sloth-runner] Job build failed after "+notification.Duration+": compilation failed", notification.Message)
+	assert.JSONEq(t, `{"text":"build is failed"}`, string(<-requests))
+	notified, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(notified), ": compilation failed build failed\n"), string(notified))
+
+	// Within it, they go through the scheduler like triggered runs.
+	require.NoError(t, s.Start())
+	defer s.Stop()
+	cleanup, _ := s.Config().Task("cleanup")
+	s.RunTask(cleanup)
+	assert.Len(t, runs, 1)
+	<-runs
+	s.RunTask(build)
+	params = receiveRun(t, runs)
+	assert.Equal(t, "build", params["upstream_job"])
+}
@@ -0,0 +1,194 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Kinds of notifiers.
+const (
+	NotifierWebhook = "webhook"
+	NotifierSlack   = "slack"
+	NotifierNtfy    = "ntfy"
+	NotifierCommand = "command"
+)
+
+const (
+	// DefaultNotificationMessage is the message of notifiers without one.
+	DefaultNotificationMessage = `[sloth-runner] Job {{.Job}} {{.Status}} after {{.Duration}}{{if .Error}}: {{.Error}}{{end}}`
+	// notifyTimeout caps how long sending a notification may take.
+	notifyTimeout = 30 * time.Second
+	// maxErrorExcerpt caps the error of a run in notifications.
+	maxErrorExcerpt = 500
+)
+
+// Notifier is a sink for notifications about runs, named so the on_success
+// and on_failure hooks of tasks can refer to it.
+type Notifier struct {
+	Name string `yaml:"name"`
+	// Type is webhook (the notification as JSON), slack (a Slack-compatible
+	// incoming webhook), ntfy (an ntfy topic URL) or command (a shell
+	// command reading the message on its standard input).
+	Type    string `yaml:"type"`
+	URL     string `yaml:"url,omitempty"`
+	Command string `yaml:"command,omitempty"`
+	// Headers are added to the requests of webhook, slack and ntfy notifiers.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Message is a text/template over Notification. Defaults to
+	// DefaultNotificationMessage.
+	Message string `yaml:"message,omitempty"`
+}
+
+// Notification describes a finished run to notifiers.
+type Notification struct {
+	Job        string    `json:"job"`
+	Run        string    `json:"run"`
+	Status     string    `json:"status"`
+	Duration   string    `json:"duration"`
+	Attempts   int       `json:"attempts"`
+	Error      string    `json:"error,omitempty"` // The start of the error
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Host       string    `json:"host"`
+	Message    string    `json:"message"` // The rendered message
+}
+
+// newNotification describes a finished run.
+func newNotification(result *RunResult) Notification {
+	host, _ := os.Hostname()
+	excerpt := result.Error
+	if len(excerpt) > maxErrorExcerpt {
+		excerpt = excerpt[:maxErrorExcerpt-3] + "..."
+	}
+	return Notification{
+		Job:        result.Task,
+		Run:        result.ID,
+		Status:     result.Status,
+		Duration:   result.FinishedAt.Sub(result.StartedAt).Round(time.Millisecond).String(),
+		Attempts:   result.Attempts,
+		Error:      excerpt,
+		StartedAt:  result.StartedAt,
+		FinishedAt: result.FinishedAt,
+		Host:       host,
+	}
+}
+
+// Validate checks a notifier and its message template.
+func (n Notifier) Validate() error {
+	if n.Name == "" {
+		return fmt.Errorf("notifier has no name")
+	}
+	switch n.Type {
+	case NotifierWebhook, NotifierSlack, NotifierNtfy:
+		if n.URL == "" {
+			return fmt.Errorf("notifier %s has no url", n.Name)
+		}
+	case NotifierCommand:
+		if n.Command == "" {
+			return fmt.Errorf("notifier %s has no command", n.Name)
+		}
+	default:
+		return fmt.Errorf("invalid type %q for notifier %s, want %s, %s, %s or %s",
+			n.Type, n.Name, NotifierWebhook, NotifierSlack, NotifierNtfy, NotifierCommand)
+	}
+	if _, err := n.template(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// template parses the message template of a notifier.
+func (n Notifier) template() (*template.Template, error) {
+	message := n.Message
+	if message == "" {
+		message = DefaultNotificationMessage
+	}
+	tmpl, err := template.New(n.Name).Option("missingkey=error").Parse(message)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message for notifier %s: %w", n.Name, err)
+	}
+	return tmpl, nil
+}
+
+// Notify renders the message of a notification and sends it.
+func (n Notifier) Notify(ctx context.Context, notification Notification) error {
+	tmpl, err := n.template()
+	if err != nil {
+		return err
+	}
+	var message bytes.Buffer
+	if err := tmpl.Execute(&message, notification); err != nil {
+		return fmt.Errorf("failed to render message for notifier %s: %w", n.Name, err)
+	}
+	notification.Message = message.String()
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	switch n.Type {
+	case NotifierWebhook:
+		body, err := json.Marshal(notification)
+		if err != nil {
+			return err
+		}
+		return n.post(ctx, "application/json", body, nil)
+	case NotifierSlack:
+		body, err := json.Marshal(map[string]string{"text": notification.Message})
+		if err != nil {
+			return err
+		}
+		return n.post(ctx, "application/json", body, nil)
+	case NotifierNtfy:
+		headers := map[string]string{"Title": fmt.Sprintf("sloth-runner: %s %s", notification.Job, notification.Status)}
+		if notification.Status != StatusSuccess {
+			headers["Priority"] = "high"
+			headers["Tags"] = "warning"
+		}
+		return n.post(ctx, "text/plain", []byte(notification.Message), headers)
+	default:
+		cmd := exec.CommandContext(ctx, "sh", "-c", n.Command)
+		cmd.Stdin = strings.NewReader(notification.Message)
+		cmd.Env = append(os.Environ(),
+			"SLOTH_JOB="+notification.Job,
+			"SLOTH_RUN="+notification.Run,
+			"SLOTH_STATUS="+notification.Status,
+			"SLOTH_DURATION="+notification.Duration,
+			"SLOTH_ERROR="+notification.Error,
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("notifier %s: %w: %s", n.Name, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+}
+
+// post sends a notification over HTTP.
+func (n Notifier) post(ctx context.Context, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("notifier %s: %w", n.Name, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	for key, value := range n.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("notifier %s: %w", n.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notifier %s: %s replied %s", n.Name, n.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/labels"
+)
+
+// Validate checks a scheduled task, including its cron expression, time
+// zone and blackout windows, so it can be saved and scheduled.
+func (t ScheduledTask) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("scheduled task has no name")
+	}
+	if t.TaskFile == "" {
+		return fmt.Errorf("task %s has no task_file", t.Name)
+	}
+	if t.Schedule != "" {
+		if _, err := parseSchedule(t); err != nil {
+			return err
+		}
+	}
+	if err := t.validateTriggers(); err != nil {
+		return err
+	}
+	if _, err := parseBlackouts(t); err != nil {
+		return err
+	}
+	switch t.ConcurrencyPolicy {
+	case "", ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace:
+	default:
+		return fmt.Errorf("invalid concurrency_policy %q for task %s, want %s, %s or %s",
+			t.ConcurrencyPolicy, t.Name, ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace)
+	}
+	switch t.CatchUp {
+	case "", CatchUpNone, CatchUpLast, CatchUpAll:
+	default:
+		return fmt.Errorf("invalid catch_up %q for task %s, want %s, %s or %s", t.CatchUp, t.Name, CatchUpNone, CatchUpLast, CatchUpAll)
+	}
+	if t.Schedule == "" && t.CatchUp != "" && t.CatchUp != CatchUpNone {
+		return fmt.Errorf("task %s has a catch_up but no schedule", t.Name)
+	}
+	if err := t.validateTargets(); err != nil {
+		return err
+	}
+	if t.Jitter < 0 || t.Timeout < 0 || t.MaxRetries < 0 || t.RetryBackoff < 0 {
+		return fmt.Errorf("task %s has a negative jitter, timeout, max_retries or retry_backoff", t.Name)
+	}
+	return nil
+}
+
+// validateTargets checks the agents a task targets, if any.
+func (t ScheduledTask) validateTargets() error {
+	set := 0
+	for _, ok := range []bool{t.Agent != "", t.Selector != "", t.AllAgents} {
+		if ok {
+			set++
+		}
+	}
+	if set == 0 {
+		return nil
+	}
+	if set > 1 {
+		return fmt.Errorf("task %s sets more than one of agent, selector and all_agents", t.Name)
+	}
+	if t.Selector != "" {
+		if _, err := labels.ParseSelector(t.Selector); err != nil {
+			return fmt.Errorf("invalid selector %q for task %s: %w", t.Selector, t.Name, err)
+		}
+	}
+	if t.TaskGroup == "" || len(t.Targets()) == 0 {
+		return fmt.Errorf("task %s runs on agents and needs a task_group and task_name or tasks", t.Name)
+	}
+	return nil
+}
+
+// Validate checks every task and notifier of the configuration, that their
+// names are unique, that webhooks listen on different addresses and that
+// the hooks of the tasks are sound.
+func (c *SchedulerConfig) Validate() error {
+	notifiers := make(map[string]bool)
+	for _, n := range c.Notifiers {
+		if err := n.Validate(); err != nil {
+			return err
+		}
+		if notifiers[n.Name] {
+			return fmt.Errorf("notifier %s is defined more than once", n.Name)
+		}
+		notifiers[n.Name] = true
+	}
+	names := make(map[string]bool)
+	listeners := make(map[string]string)
+	for _, task := range c.ScheduledTasks {
+		if err := task.Validate(); err != nil {
+			return err
+		}
+		if names[task.Name] {
+			return fmt.Errorf("scheduled task %s is defined more than once", task.Name)
+		}
+		names[task.Name] = true
+		if task.Webhook != nil {
+			if other, ok := listeners[task.Webhook.Listen]; ok {
+				return fmt.Errorf("the http_webhooks of tasks %s and %s both listen on %s", other, task.Name, task.Webhook.Listen)
+			}
+			listeners[task.Webhook.Listen] = task.Name
+		}
+	}
+	return c.validateHooks()
+}
+
+// Reload reads the configuration file again and applies the differences
+// to the running scheduler: new tasks are scheduled, removed ones are
+// unscheduled and changed ones rescheduled. Running runs go on. An invalid
+// configuration is rejected and the current one kept. Changes to history
+// and state_file take effect when the scheduler restarts.
+func (s *Scheduler) Reload() error {
+	config, hash, err := readConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid scheduler config, keeping the current one: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return fmt.Errorf("the scheduler is stopped")
+	}
+	wanted := make(map[string]ScheduledTask)
+	for _, task := range config.ScheduledTasks {
+		wanted[task.Name] = task
+	}
+	var added, changed, removed int
+	for name, entry := range s.entries {
+		if task, ok := wanted[name]; !ok {
+			s.removeJob(name)
+			removed++
+			fmt.Printf("Unscheduled task '%s'\n", name)
+		} else if !reflect.DeepEqual(task, entry.task) {
+			s.removeJob(name)
+			changed++
+		}
+	}
+	added = len(config.ScheduledTasks) - len(s.entries) - changed
+	s.config, s.configHash = config, hash
+	now := time.Now()
+	var errs []string
+	for _, task := range config.ScheduledTasks {
+		if _, ok := s.entries[task.Name]; ok {
+			continue
+		}
+		if err := s.addJob(task, now); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	fmt.Printf("Reloaded scheduler config: %d task(s) added, %d changed, %d removed\n", added, changed, removed)
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to schedule tasks: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// WatchConfig reloads the configuration whenever its file changes, checking
+// every interval, until ctx is done.
+func (s *Scheduler) WatchConfig(ctx context.Context, interval time.Duration) {
+	modTime, size := configStat(s.configPath)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		newModTime, newSize := configStat(s.configPath)
+		if newModTime.Equal(modTime) && newSize == size {
+			continue
+		}
+		modTime, size = newModTime, newSize
+		fmt.Printf("Scheduler config %s changed, reloading...\n", s.configPath)
+		if err := s.Reload(); err != nil {
+			fmt.Printf("Failed to reload scheduler config: %v\n", err)
+		}
+	}
+}
+
+// configStat returns the modification time and size of a file.
+func configStat(path string) (time.Time, int64) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, -1
+	}
+	return fi.ModTime(), fi.Size()
+}
@@ -0,0 +1,149 @@
+package scheduler
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scheduledNames returns the scheduled tasks, and the number of cron entries.
+func scheduledNames(s *Scheduler) ([]string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, len(s.cron.Entries())
+}
+
+func TestValidate(t *testing.T) {
+	valid := ScheduledTask{Name: "job", Schedule: "@daily", TaskFile: "job.lua"}
+	assert.NoError(t, valid.Validate())
+	remote := ScheduledTask{Name: "job", Schedule: "@daily", TaskFile: "job.lua", TaskGroup: "g", Tasks: []string{"t"}, Selector: "role=web,env=prod"}
+	assert.NoError(t, remote.Validate())
+	for _, task := range []ScheduledTask{
+		{Schedule: "@daily", TaskFile: "job.lua"},
+		{Name: "job", Schedule: "@daily"},
+		{Name: "job", Schedule: "61 * * * *", TaskFile: "job.lua"},
+		{Name: "job", Schedule: "@daily", TaskFile: "job.lua", ConcurrencyPolicy: "never"},
+		{Name: "job", Schedule: "@daily", TaskFile: "job.lua", Timeout: -time.Second},
+		{Name: "job", Schedule: "@daily", TaskFile: "job.lua", TaskGroup: "g", TaskName: "t", Agent: "web1", AllAgents: true},
+		{Name: "job", Schedule: "@daily", TaskFile: "job.lua", TaskGroup: "g", TaskName: "t", Selector: "role"},
+		{Name: "job", Schedule: "@daily", TaskFile: "job.lua", TaskGroup: "g", AllAgents: true},
+	} {
+		assert.Error(t, task.Validate(), "%+v", task)
+	}
+	assert.Error(t, (&SchedulerConfig{ScheduledTasks: []ScheduledTask{valid, valid}}).Validate())
+}
+
+func TestReload(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "scheduler.yaml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`
+scheduled_tasks:
+  - {name: keep, schedule: "@every 1h", task_file: keep.lua}
+  - {name: change, schedule: "@every 1h", task_file: change.lua}
+  - {name: remove, schedule: "@every 1h", task_file: remove.lua}
+  - {name: paused, schedule: "@every 1h", task_file: paused.lua, paused: true}
+`), 0644))
+	s := NewScheduler(configPath)
+	require.NoError(t, s.LoadConfig())
+	require.NoError(t, s.Start())
+	defer s.Stop()
+	names, entries := scheduledNames(s)
+	assert.Equal(t, []string{"change", "keep", "paused", "remove"}, names)
+	assert.Equal(t, 3, entries)
+
+	s.mu.Lock()
+	keepID := s.entries["keep"].id
+	s.mu.Unlock()
+
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`
+scheduled_tasks:
+  - {name: keep, schedule: "@every 1h", task_file: keep.lua}
+  - {name: change, schedule: "@every 2h", task_file: change.lua}
+  - {name: paused, schedule: "@every 1h", task_file: paused.lua}
+  - {name: new, schedule: "@every 1h", task_file: new.lua}
+`), 0644))
+	require.NoError(t, s.Reload())
+	names, entries = scheduledNames(s)
+	assert.Equal(t, []string{"change", "keep", "new", "paused"}, names)
+	assert.Equal(t, 4, entries)
+	s.mu.Lock()
+	assert.Equal(t, keepID, s.entries["keep"].id, "unchanged tasks keep their job")
+	s.mu.Unlock()
+	task, ok := s.Config().Task("change")
+	require.True(t, ok)
+	assert.Equal(t, "@every 2h", task.Schedule)
+
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`
+scheduled_tasks:
+  - {name: keep, schedule: "not a schedule", task_file: keep.lua}
+`), 0644))
+	assert.Error(t, s.Reload())
+	names, _ = scheduledNames(s)
+	assert.Len(t, names, 4)
+}
+
+func TestWatchConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "scheduler.yaml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte("scheduled_tasks: []\n"), 0644))
+	s := NewScheduler(configPath)
+	require.NoError(t, s.LoadConfig())
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.WatchConfig(ctx, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`
+scheduled_tasks:
+  - {name: added, schedule: "@every 1h", task_file: added.lua}
+`), 0644))
+	assert.Eventually(t, func() bool {
+		names, _ := scheduledNames(s)
+		return len(names) == 1 && names[0] == "added"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestReloadKeepsRunningState(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "scheduler.yaml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`
+scheduled_tasks:
+  - {name: job, schedule: "@every 1h", task_file: job.lua, concurrency_policy: forbid}
+`), 0644))
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	s := NewScheduler(configPath)
+	s.Runner = blockingRunner(started, release)
+	require.NoError(t, s.LoadConfig())
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	done := make(chan *RunResult, 1)
+	go func() {
+		result, _ := s.RunNow("job")
+		done <- result
+	}()
+	<-started
+
+	// The rescheduled task still sees the run started before the reload.
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`
+scheduled_tasks:
+  - {name: job, schedule: "@every 2h", task_file: job.lua, concurrency_policy: forbid}
+`), 0644))
+	require.NoError(t, s.Reload())
+	result, err := s.RunNow("job")
+	require.NoError(t, err)
+	assert.Equal(t, StatusSkipped, result.Status)
+
+	close(release)
+	assert.Equal(t, StatusSuccess, (<-done).Status)
+}
@@ -1,11 +1,15 @@
 package scheduler
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"os"
-	"os/exec"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/robfig/cron/v3"
 	"gopkg.in/yaml.v2"
@@ -16,28 +20,221 @@ type ScheduledTask struct {
 	Name      string `yaml:"name"`
 	Schedule  string `yaml:"schedule"`
 	TaskFile  string `yaml:"task_file"`
-	TaskGroup string `yaml:"task_group"`
-	TaskName  string `yaml:"task_name"`
+	TaskGroup string `yaml:"task_group,omitempty"`
+	TaskName  string `yaml:"task_name,omitempty"`
+	// Tasks selects more tasks to run, in addition to TaskName. When no task
+	// is selected, every task of TaskGroup (or of the file) runs.
+	Tasks []string `yaml:"tasks,omitempty"`
+	// Values is a YAML file with values passed to the Lua tasks.
+	Values string `yaml:"values,omitempty"`
+	// Env, Production and Shards are passed to the Lua template, like the
+	// --env, --prod and --shards flags of the run command.
+	Env        string `yaml:"env,omitempty"`
+	Production bool   `yaml:"production,omitempty"`
+	Shards     string `yaml:"shards,omitempty"`
+	// Params are added to the params of every selected task.
+	Params map[string]string `yaml:"params,omitempty"`
+	// ConcurrencyPolicy says what happens when the task is due while its
+	// previous run is still running: allow (the default), forbid or replace.
+	ConcurrencyPolicy string `yaml:"concurrency_policy,omitempty"`
+	// Jitter delays every run by a random duration up to Jitter.
+	Jitter time.Duration `yaml:"jitter,omitempty"`
+	// Timeout kills a run, retries included, that takes longer.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// MaxRetries reruns a failed run up to MaxRetries times, waiting
+	// RetryBackoff before the first retry and twice as long before each
+	// following one.
+	MaxRetries   int           `yaml:"max_retries,omitempty"`
+	RetryBackoff time.Duration `yaml:"retry_backoff,omitempty"`
+	// Timezone is the IANA time zone of Schedule and Blackout, such as
+	// "America/Sao_Paulo". Defaults to the local time zone.
+	Timezone string `yaml:"timezone,omitempty"`
+	// Blackout lists windows in which runs are skipped.
+	Blackout []BlackoutWindow `yaml:"blackout,omitempty"`
+	// CatchUp says which runs missed while the scheduler was down are run
+	// when it starts: none (the default), last or all.
+	CatchUp string `yaml:"catch_up,omitempty"`
+	// Paused keeps the task configured without scheduling it.
+	Paused bool `yaml:"paused,omitempty"`
+	// FileWatch, Webhook and GitPoll run the task on events, besides or
+	// instead of Schedule. Triggered runs share its concurrency policy.
+	FileWatch *FileWatchTrigger `yaml:"file_watch,omitempty"`
+	Webhook   *WebhookTrigger   `yaml:"http_webhook,omitempty"`
+	GitPoll   *GitPollTrigger   `yaml:"git_poll,omitempty"`
+	// Agent, Selector and AllAgents run the task on remote agents instead of
+	// the scheduler host: the agent of that name, the active agents whose
+	// labels match a selector such as "role=web,env=prod", or every active
+	// agent. The jobs go through the master.
+	Agent     string `yaml:"agent,omitempty"`
+	Selector  string `yaml:"selector,omitempty"`
+	AllAgents bool   `yaml:"all_agents,omitempty"`
+	// OnSuccess and OnFailure chain other tasks and send notifications after
+	// a run that succeeded, or that failed or timed out.
+	OnSuccess Hooks `yaml:"on_success,omitempty"`
+	OnFailure Hooks `yaml:"on_failure,omitempty"`
+	// Source is the workflow file that declares the task, for tasks imported
+	// by scheduler sync. Syncing the file again updates or removes them.
+	Source string `yaml:"source,omitempty"`
 }
 
+// Concurrency policies of scheduled tasks.
+const (
+	ConcurrencyAllow   = "allow"
+	ConcurrencyForbid  = "forbid"
+	ConcurrencyReplace = "replace"
+)
+
+const (
+	// DefaultRetryBackoff is the wait before the first retry of a failed run.
+	DefaultRetryBackoff = 10 * time.Second
+	// maxRetryBackoff caps the wait between retries.
+	maxRetryBackoff = 10 * time.Minute
+)
+
+// Statuses of scheduled runs.
+const (
+	StatusSuccess   = "success"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"   // Not run, the previous run was still running
+	StatusReplaced  = "replaced"  // Killed to start a newer run
+	StatusTimedOut  = "timed_out" // Killed after its timeout
+	StatusCancelled = "cancelled" // Killed when the scheduler stopped
+)
+
+var (
+	errReplaced = errors.New("killed to start a newer run")
+	errTimedOut = errors.New("killed after its timeout")
+)
+
+// Targets returns the tasks selected by TaskName and Tasks.
+func (t ScheduledTask) Targets() []string {
+	var targets []string
+	if t.TaskName != "" {
+		targets = append(targets, t.TaskName)
+	}
+	for _, name := range t.Tasks {
+		if name != "" && name != t.TaskName {
+			targets = append(targets, name)
+		}
+	}
+	return targets
+}
+
+// Remote tells whether the task runs on remote agents.
+func (t ScheduledTask) Remote() bool {
+	return t.Agent != "" || t.Selector != "" || t.AllAgents
+}
+
+// TaskResult is the outcome of one task of a scheduled run.
+type TaskResult struct {
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	Logs     string        `json:"-"` // Kept in the log file of the run
+}
+
+// RunResult is the outcome of a scheduled run.
+type RunResult struct {
+	ID         string                 `json:"id,omitempty"` // Set when recorded in the history
+	Task       string                 `json:"task"`
+	StartedAt  time.Time              `json:"started_at"`
+	FinishedAt time.Time              `json:"finished_at"`
+	Status     string                 `json:"status"`
+	Success    bool                   `json:"success"`
+	Attempts   int                    `json:"attempts,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Tasks      []TaskResult           `json:"tasks,omitempty"`
+	Outputs    map[string]interface{} `json:"outputs,omitempty"`
+	LogFile    string                 `json:"log_file,omitempty"`
+}
+
+// RunFunc runs a scheduled task once and reports its outcome. It fills in
+// Success, Error, Tasks and Outputs; the scheduler sets the rest. It must
+// return soon after ctx is cancelled.
+type RunFunc func(ctx context.Context, task ScheduledTask) *RunResult
+
 // SchedulerConfig holds the configuration for the scheduler
 type SchedulerConfig struct {
 	ScheduledTasks []ScheduledTask `yaml:"scheduled_tasks"`
+	History        HistoryConfig   `yaml:"history,omitempty"`
+	// StateFile is where the scheduler persists when tasks with a catch-up
+	// policy were last due. Defaults to DefaultStateFile().
+	StateFile string `yaml:"state_file,omitempty"`
+	// Notifiers are the sinks the hooks of tasks send notifications to.
+	Notifiers []Notifier `yaml:"notifiers,omitempty"`
+}
+
+// Task returns the configured task with the given name.
+func (c *SchedulerConfig) Task(name string) (ScheduledTask, bool) {
+	for _, task := range c.ScheduledTasks {
+		if task.Name == name {
+			return task, true
+		}
+	}
+	return ScheduledTask{}, false
+}
+
+// Notifier returns the notifier with the given name.
+func (c *SchedulerConfig) Notifier(name string) (Notifier, bool) {
+	for _, n := range c.Notifiers {
+		if n.Name == name {
+			return n, true
+		}
+	}
+	return Notifier{}, false
 }
 
 // Scheduler manages the cron jobs
 type Scheduler struct {
-	cron *cron.Cron
+	cron       *cron.Cron
 	configPath string
 	config     *SchedulerConfig
 	mu         sync.Mutex
+	// Runner runs the scheduled tasks. The CLI runs them in its own process.
+	Runner RunFunc
+	// History, if set, records every run.
+	History *History
+
+	ctx         context.Context
+	cancel      context.CancelFunc
+	runningMu   sync.Mutex                     // Guards running, guards and lastResults
+	running     map[string]map[*execution]bool // Running executions by task name
+	guards      map[string]*runGuard           // Concurrency state by task name, kept across reloads
+	lastResults map[string]*RunResult          // The latest run of every task, by name
+	background  sync.WaitGroup                 // Catch-ups, triggers and triggered runs
+	entries     map[string]scheduledEntry      // Jobs by task name, paused ones included
+	lastRuns    *lastRuns
+	configHash  string    // SHA-256 of the configuration file last applied
+	startedAt   time.Time // When Start was called
+}
+
+// scheduledEntry is a task scheduled with cron, or waiting for triggers.
+type scheduledEntry struct {
+	id    cron.EntryID // 0 for paused tasks and tasks without a schedule
+	task  ScheduledTask
+	chain cron.Chain         // Wraps every run, scheduled, triggered or chained
+	stop  context.CancelFunc // Stops the triggers, if any
+}
+
+// execution is a running execution of a scheduled task.
+type execution struct {
+	cancel    context.CancelCauseFunc
+	startedAt time.Time
 }
 
 // NewScheduler creates a new Scheduler instance
 func NewScheduler(configPath string) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Scheduler{
-		cron: cron.New(),
-		configPath: configPath,
+		cron:        cron.New(),
+		configPath:  configPath,
+		ctx:         ctx,
+		cancel:      cancel,
+		running:     make(map[string]map[*execution]bool),
+		guards:      make(map[string]*runGuard),
+		entries:     make(map[string]scheduledEntry),
+		lastResults: make(map[string]*RunResult),
 	}
 }
 
@@ -46,17 +243,29 @@ func (s *Scheduler) LoadConfig() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := ioutil.ReadFile(s.configPath)
+	config, hash, err := readConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+	s.config = config
+	s.configHash = hash
+	return nil
+}
+
+// readConfig reads a scheduler configuration file, and returns it with the
+// SHA-256 of its content.
+func readConfig(path string) (*SchedulerConfig, string, error) {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("failed to read scheduler config file: %w", err)
+		return nil, "", fmt.Errorf("failed to read scheduler config file: %w", err)
 	}
 
 	var config SchedulerConfig
 	if err := yaml.Unmarshal(data, &config); err != nil {
-		return fmt.Errorf("failed to unmarshal scheduler config: %w", err)
+		return nil, "", fmt.Errorf("failed to unmarshal scheduler config: %w", err)
 	}
-	s.config = &config
-	return nil
+	sum := sha256.Sum256(data)
+	return &config, hex.EncodeToString(sum[:]), nil
 }
 
 // Start initializes and starts the cron scheduler
@@ -68,15 +277,16 @@ func (s *Scheduler) Start() error {
 		return fmt.Errorf("scheduler configuration not loaded")
 	}
 
+	if err := s.config.Validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	s.startedAt = now
+	s.loadLastResults()
 	for _, task := range s.config.ScheduledTasks {
-		task := task // capture loop variable
-		_, err := s.cron.AddFunc(task.Schedule, func() {
-			s.RunTask(task)
-		})
-		if err != nil {
-			return fmt.Errorf("failed to add cron job for task %s: %w", task.Name, err)
+		if err := s.addJob(task, now); err != nil {
+			return err
 		}
-		fmt.Printf("Scheduled task '%s' with schedule '%s'\n", task.Name, task.Schedule)
 	}
 
 	s.cron.Start()
@@ -84,31 +294,284 @@ func (s *Scheduler) Start() error {
 	return nil
 }
 
-// Stop stops the cron scheduler
+// Stop stops the cron scheduler, cancels the running tasks and waits for
+// them to finish. Runs finishing meanwhile still read the configuration,
+// so s.mu is not held while waiting.
 func (s *Scheduler) Stop() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.cron.Stop()
+	done := s.cron.Stop()
+	s.cancel()
+	s.mu.Unlock()
+	<-done.Done()
+	s.background.Wait()
 	fmt.Println("Scheduler stopped.")
 }
 
-// Mockable exec.Command for testing
-var execCommand = exec.Command
+// addJob schedules a task and starts its triggers, unless it is paused,
+// and catches up the runs it missed. The caller holds s.mu.
+func (s *Scheduler) addJob(task ScheduledTask, now time.Time) error {
+	if task.Paused {
+		s.entries[task.Name] = scheduledEntry{task: task}
+		fmt.Printf("Scheduled task '%s' is paused\n", task.Name)
+		return nil
+	}
+	wrappers, err := s.jobWrappers(task)
+	if err != nil {
+		return err
+	}
+	chain := cron.NewChain(wrappers...)
+	job := chain.Then(cron.FuncJob(func() {
+		s.RunTask(task)
+	}))
+	entry := scheduledEntry{task: task, chain: chain}
+	if triggers := task.Triggers(); len(triggers) > 0 {
+		if entry.stop, err = s.startTriggers(task, chain); err != nil {
+			return err
+		}
+		fmt.Printf("Scheduled task '%s' is triggered by %s\n", task.Name, strings.Join(triggers, ", "))
+	}
+	if task.Schedule != "" {
+		if entry.id, err = s.schedule(task, job, now); err != nil {
+			if entry.stop != nil {
+				entry.stop()
+			}
+			return err
+		}
+		fmt.Printf("Scheduled task '%s' with schedule '%s'\n", task.Name, task.Schedule)
+	}
+	s.entries[task.Name] = entry
+	return nil
+}
 
-// RunTask executes a sloth-runner task
-func (s *Scheduler) RunTask(task ScheduledTask) {
-	fmt.Printf("Executing scheduled task '%s' (file: %s, group: %s, task: %s)...\n", task.Name, task.TaskFile, task.TaskGroup, task.TaskName)
+// schedule adds the cron entry of a task and catches up the runs it missed.
+// The caller holds s.mu.
+func (s *Scheduler) schedule(task ScheduledTask, job cron.Job, now time.Time) (cron.EntryID, error) {
+	schedule, err := parseSchedule(task)
+	if err != nil {
+		return 0, err
+	}
+	switch task.CatchUp {
+	case CatchUpLast, CatchUpAll:
+		if s.lastRuns == nil {
+			stateFile := s.config.StateFile
+			if stateFile == "" {
+				stateFile = DefaultStateFile()
+			}
+			if s.lastRuns, err = loadLastRuns(stateFile); err != nil {
+				return 0, err
+			}
+		}
+		id := s.cron.Schedule(schedule, cron.NewChain(recordDue(task, s.lastRuns)).Then(job))
+		if err := s.catchUp(task, schedule, s.lastRuns, job, now); err != nil {
+			s.cron.Remove(id)
+			return 0, err
+		}
+		return id, nil
+	default:
+		return s.cron.Schedule(schedule, job), nil
+	}
+}
+
+// removeJob unschedules a task and stops its triggers. Its running runs go
+// on. The caller holds s.mu.
+func (s *Scheduler) removeJob(name string) {
+	if entry, ok := s.entries[name]; ok {
+		if entry.id != 0 {
+			s.cron.Remove(entry.id)
+		}
+		if entry.stop != nil {
+			entry.stop()
+		}
+	}
+	delete(s.entries, name)
+}
 
-	// Assuming sloth-runner executable is in the same directory or in PATH
-	cmd := execCommand("sloth-runner", "run", "-f", task.TaskFile, "-g", task.TaskGroup, "-t", task.TaskName)
+// RunTask executes a scheduled task with the scheduler's Runner, retrying
+// it and killing it after its timeout as configured, and returns its outcome.
+func (s *Scheduler) RunTask(task ScheduledTask) *RunResult {
+	fmt.Printf("Executing scheduled task '%s' (file: %s, group: %s, tasks: %v)...\n", task.Name, task.TaskFile, task.TaskGroup, task.Targets())
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	startedAt := time.Now()
+	ctx, cancel := context.WithCancelCause(s.ctx)
+	defer cancel(nil)
+	defer s.track(task.Name, &execution{cancel: cancel, startedAt: startedAt})()
+	if task.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeoutCause(ctx, task.Timeout, errTimedOut)
+		defer cancelTimeout()
+	}
+
+	var result *RunResult
+	backoff := task.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		result = &RunResult{Error: "no runner configured"}
+		if s.Runner != nil {
+			result = s.Runner(ctx, task)
+		}
+		result.Attempts = attempt
+		if result.Success || ctx.Err() != nil || attempt > task.MaxRetries {
+			break
+		}
+		fmt.Printf("Scheduled task '%s' failed (attempt %d of %d): %s. Retrying in %s...\n", task.Name, attempt, task.MaxRetries+1, result.Error, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+
+	switch cause := context.Cause(ctx); {
+	case result.Success:
+		result.Status = StatusSuccess
+	case errors.Is(cause, errReplaced):
+		result.Status, result.Error = StatusReplaced, cause.Error()
+	case errors.Is(cause, errTimedOut):
+		result.Status, result.Error = StatusTimedOut, fmt.Sprintf("%s of %s", cause, task.Timeout)
+	case cause != nil:
+		result.Status, result.Error = StatusCancelled, "killed when the scheduler stopped"
+	default:
+		result.Status = StatusFailed
+	}
+	return s.finish(task, startedAt, result)
+}
+
+// RunNow runs a task at once, even a paused one, under its concurrency
+// policy like the runs the scheduler starts, and returns its outcome. The
+// blackout windows and jitter of the task do not apply.
+func (s *Scheduler) RunNow(name string) (*RunResult, error) {
+	s.mu.Lock()
+	if s.ctx.Err() != nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("the scheduler is stopped")
+	}
+	entry, ok := s.entries[name]
+	if !ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("scheduled task '%s' not found", name)
+	}
+	wrappers, err := s.concurrencyWrappers(entry.task)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.background.Add(1)
+	s.mu.Unlock()
+	defer s.background.Done()
+
+	var result *RunResult
+	task := entry.task
+	cron.NewChain(wrappers...).Then(cron.FuncJob(func() {
+		result = s.RunTask(task)
+	})).Run()
+	if result == nil {
+		// The run was skipped, which is the task's latest result.
+		s.runningMu.Lock()
+		result = s.lastResults[name]
+		s.runningMu.Unlock()
+	}
+	return result, nil
+}
+
+// catchUp runs, in the background, the runs of task missed since it was
+// last due, as its catch-up policy says, and records it as due now.
+func (s *Scheduler) catchUp(task ScheduledTask, schedule cron.Schedule, state *lastRuns, job cron.Job, now time.Time) error {
+	windows, err := parseBlackouts(task)
+	if err != nil {
+		return err
+	}
+	last, ok := state.get(task.Name)
+	if err := state.set(task.Name, now); err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	missed := missedRuns(schedule, windows, last, now)
+	if len(missed) == 0 {
+		return nil
+	}
+	if task.CatchUp == CatchUpLast {
+		missed = missed[len(missed)-1:]
+	}
+	fmt.Printf("Catching up %d missed run(s) of scheduled task '%s', last due at %s\n", len(missed), task.Name, last.Format(time.RFC3339))
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		for range missed {
+			if s.ctx.Err() != nil {
+				return
+			}
+			job.Run()
+		}
+	}()
+	return nil
+}
+
+// skip records that a run of task did not start.
+func (s *Scheduler) skip(task ScheduledTask, reason string) {
+	now := time.Now()
+	s.finish(task, now, &RunResult{Status: StatusSkipped, Error: reason})
+}
+
+// finish completes the result of a run, reports it and records it in the
+// history.
+func (s *Scheduler) finish(task ScheduledTask, startedAt time.Time, result *RunResult) *RunResult {
+	result.Task = task.Name
+	result.StartedAt = startedAt
+	result.FinishedAt = time.Now()
+
+	switch result.Status {
+	case StatusSuccess:
+		fmt.Printf("Scheduled task '%s' completed successfully in %s.\n", task.Name, result.FinishedAt.Sub(startedAt).Round(time.Millisecond))
+	case StatusSkipped:
+		fmt.Printf("Skipped scheduled task '%s': %s\n", task.Name, result.Error)
+	default:
+		fmt.Printf("Error executing scheduled task '%s': %s\n", task.Name, result.Error)
+	}
+	if s.History != nil {
+		if err := s.History.Record(result); err != nil {
+			fmt.Printf("Failed to record run of scheduled task '%s': %v\n", task.Name, err)
+		} else {
+			fmt.Printf("Recorded run %s of scheduled task '%s', logs in %s\n", result.ID, task.Name, result.LogFile)
+		}
+	}
+	s.runningMu.Lock()
+	s.lastResults[task.Name] = result
+	s.runningMu.Unlock()
+	s.afterRun(task, result)
+	return result
+}
+
+// track registers a running execution of a task and returns the function
+// unregistering it.
+func (s *Scheduler) track(taskName string, e *execution) func() {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	if s.running[taskName] == nil {
+		s.running[taskName] = make(map[*execution]bool)
+	}
+	s.running[taskName][e] = true
+	return func() {
+		s.runningMu.Lock()
+		defer s.runningMu.Unlock()
+		delete(s.running[taskName], e)
+	}
+}
 
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("Error executing scheduled task '%s': %v\n", task.Name, err)
-	} else {
-		fmt.Printf("Scheduled task '%s' completed successfully.\n", task.Name)
+// cancelRunning kills the running executions of a task.
+func (s *Scheduler) cancelRunning(taskName string, cause error) {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	for e := range s.running[taskName] {
+		e.cancel(cause)
 	}
 }
 
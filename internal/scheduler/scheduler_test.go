@@ -1,10 +1,9 @@
 package scheduler
 
 import (
-	"fmt"
+	"context"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"testing"
 	"time"
 
@@ -76,68 +75,58 @@ func TestConfigGetSet(t *testing.T) {
 	assert.Equal(t, cfg, sched.Config())
 }
 
-// Mock exec.Command for testing RunTask
-// var runCommandFunc func(name string, arg ...string) *os.ProcessState // This line was causing issues
-
 func TestRunTask(t *testing.T) {
-	// Override exec.Command for testing
-	oldExecCommand := execCommand
-	defer func() { execCommand = oldExecCommand }()
-
-	execCommand = func(name string, arg ...string) *exec.Cmd {
-		cs := []string{"-test.run=TestHelperProcess", "--"}
-		cs = append(cs, arg...)
-		cmd := exec.Command(os.Args[0], cs...)
-		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
-		return cmd
-	}
-
 	sched := NewScheduler("dummy.yaml")
+	var got ScheduledTask
+	sched.Runner = func(ctx context.Context, task ScheduledTask) *RunResult {
+		got = task
+		return &RunResult{
+			Success: true,
+			Tasks:   []TaskResult{{Name: "mock_name", Status: "Success"}},
+			Outputs: map[string]interface{}{"mock_name": "done"},
+		}
+	}
 	task := ScheduledTask{
 		Name:      "mock_task",
 		TaskFile:  "mock.lua",
 		TaskGroup: "mock_group",
 		TaskName:  "mock_name",
+		Values:    "values.yaml",
+		Params:    map[string]string{"region": "eu"},
 	}
 
-	sched.RunTask(task)
-	// In a real test, you'd check logs or mock stdout/stderr to verify output
-}
+	result := sched.RunTask(task)
+	assert.Equal(t, task, got)
+	assert.True(t, result.Success)
+	assert.Equal(t, "mock_task", result.Task)
+	assert.False(t, result.FinishedAt.Before(result.StartedAt))
+	assert.Len(t, result.Tasks, 1)
+	assert.Equal(t, "done", result.Outputs["mock_name"])
 
-// TestHelperProcess is a helper for TestRunTask to mock exec.Command
-func TestHelperProcess(t *testing.T) {
-	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
-		return
+	sched.Runner = func(ctx context.Context, task ScheduledTask) *RunResult {
+		return &RunResult{Error: "task mock_name failed"}
 	}
-	defer os.Exit(0)
+	result = sched.RunTask(task)
+	assert.False(t, result.Success)
+	assert.Equal(t, "task mock_name failed", result.Error)
 
-	args := os.Args
-	for len(args) > 0 {
-		if args[0] == "--" {
-			args = args[1:]
-			break
-		}
-		args = args[1:]
-	}
-	if len(args) == 0 {
-		fmt.Fprintf(os.Stderr, "No command\n")
-		os.Exit(1)
-	}
+	sched.Runner = nil
+	assert.False(t, sched.RunTask(task).Success)
 
-	cmd := args[0]
-	switch cmd {
-	case "sloth-runner":
-		// Simulate successful execution
-		fmt.Println("Mock sloth-runner run successful")
-		os.Exit(0)
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", cmd)
-		os.Exit(1)
-	}
+	sched.History = NewHistory(HistoryConfig{Dir: t.TempDir()})
+	result = sched.RunTask(task)
+	assert.NotEmpty(t, result.ID)
+	runs, err := sched.History.List("mock_task")
+	assert.NoError(t, err)
+	assert.Len(t, runs, 1)
+	assert.Equal(t, result.ID, runs[0].ID)
 }
 
-// Mock exec.Command for testing
-// var execCommand = exec.Command // This is already defined in scheduler.go
+func TestScheduledTaskTargets(t *testing.T) {
+	assert.Nil(t, ScheduledTask{TaskGroup: "g"}.Targets())
+	assert.Equal(t, []string{"a"}, ScheduledTask{TaskName: "a"}.Targets())
+	assert.Equal(t, []string{"a", "b", "c"}, ScheduledTask{TaskName: "a", Tasks: []string{"b", "a", "c"}}.Targets())
+}
 
 func TestStartStop(t *testing.T) {
 	// Create a temporary config file
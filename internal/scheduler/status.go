@@ -0,0 +1,274 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DaemonStatus describes a running scheduler and its jobs.
+type DaemonStatus struct {
+	PID        int       `json:"pid"`
+	StartedAt  time.Time `json:"started_at"`
+	Uptime     string    `json:"uptime"`
+	ConfigFile string    `json:"config_file"`
+	// ConfigHash is the SHA-256 of the configuration file last applied, so
+	// monitoring can tell whether an edit was picked up or rejected.
+	ConfigHash string      `json:"config_hash"`
+	Jobs       []JobStatus `json:"jobs"`
+}
+
+// JobStatus describes a scheduled task of a running scheduler.
+type JobStatus struct {
+	Name     string   `json:"name"`
+	Schedule string   `json:"schedule,omitempty"`
+	Triggers []string `json:"triggers,omitempty"`
+	Paused   bool     `json:"paused"`
+	// Next and Previous are when cron fires the task next and fired it
+	// last. They are unset for tasks without a schedule.
+	Next     *time.Time `json:"next,omitempty"`
+	Previous *time.Time `json:"previous,omitempty"`
+	// Running counts the runs of the task in progress. RunningSince and
+	// RunningFor are for the oldest of them.
+	Running      int        `json:"running"`
+	RunningSince *time.Time `json:"running_since,omitempty"`
+	RunningFor   string     `json:"running_for,omitempty"`
+	// LastRun is the latest finished run, without its tasks and outputs.
+	LastRun *RunResult `json:"last_run,omitempty"`
+}
+
+// Status describes the scheduler and every configured task.
+func (s *Scheduler) Status() DaemonStatus {
+	now := time.Now()
+	configFile, err := filepath.Abs(s.configPath)
+	if err != nil {
+		configFile = s.configPath
+	}
+
+	s.mu.Lock()
+	status := DaemonStatus{
+		PID:        os.Getpid(),
+		StartedAt:  s.startedAt,
+		Uptime:     now.Sub(s.startedAt).Round(time.Second).String(),
+		ConfigFile: configFile,
+		ConfigHash: s.configHash,
+		Jobs:       []JobStatus{},
+	}
+	if s.config != nil {
+		for _, task := range s.config.ScheduledTasks {
+			job := JobStatus{Name: task.Name, Schedule: task.Schedule, Triggers: task.Triggers(), Paused: task.Paused}
+			if entry, ok := s.entries[task.Name]; ok && entry.id != 0 {
+				e := s.cron.Entry(entry.id)
+				if !e.Next.IsZero() {
+					job.Next = &e.Next
+				}
+				if !e.Prev.IsZero() {
+					job.Previous = &e.Prev
+				}
+			}
+			status.Jobs = append(status.Jobs, job)
+		}
+	}
+	s.mu.Unlock()
+
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	for i := range status.Jobs {
+		job := &status.Jobs[i]
+		for e := range s.running[job.Name] {
+			job.Running++
+			if job.RunningSince == nil || e.startedAt.Before(*job.RunningSince) {
+				startedAt := e.startedAt
+				job.RunningSince = &startedAt
+			}
+		}
+		if job.RunningSince != nil {
+			job.RunningFor = now.Sub(*job.RunningSince).Round(time.Second).String()
+		}
+		if last, ok := s.lastResults[job.Name]; ok {
+			run := *last
+			run.Tasks, run.Outputs = nil, nil
+			job.LastRun = &run
+		}
+	}
+	return status
+}
+
+// loadLastResults takes the latest run of every task from the history, so
+// a restarted scheduler reports them.
+func (s *Scheduler) loadLastResults() {
+	if s.History == nil {
+		return
+	}
+	runs, err := s.History.List("")
+	if err != nil {
+		return
+	}
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	for _, run := range runs {
+		if _, ok := s.lastResults[run.Task]; !ok {
+			s.lastResults[run.Task] = run
+		}
+	}
+}
+
+// ServeStatus serves the status of the scheduler as JSON, at GET /status,
+// and runs tasks at once, at POST /run?task=<name>, replying with the
+// outcome, on a unix socket at path until ctx is done or the scheduler
+// stops, which removes the socket. Only the user running the scheduler can
+// connect to it. A socket left behind by a scheduler that died is replaced;
+// one another scheduler serves, or a file that is not a socket, is not.
+func (s *Scheduler) ServeStatus(ctx context.Context, path string) error {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("another scheduler serves its status on %s", path)
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and is not a socket", path)
+		}
+		os.Remove(path)
+	}
+	ln, socket, err := listenPrivate(path)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Status())
+	})
+	mux.HandleFunc("/run", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		result, err := s.RunNow(r.URL.Query().Get("task"))
+		if err != nil {
+			code := http.StatusNotFound
+			if s.ctx.Err() != nil {
+				code = http.StatusServiceUnavailable
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+	server := &http.Server{Handler: mux}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		select {
+		case <-ctx.Done():
+		case <-s.ctx.Done():
+		}
+		server.Close()
+		if info, err := os.Lstat(path); err == nil && os.SameFile(info, socket) {
+			os.Remove(path)
+		}
+	}()
+	go server.Serve(ln)
+	return nil
+}
+
+// listenPrivate listens on a unix socket at path that only the current user
+// can connect to. The socket is bound in a directory only the user can
+// enter and restricted before it is moved to path, so there is no moment
+// when others can connect.
+func listenPrivate(path string) (net.Listener, os.FileInfo, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".sock-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	defer os.RemoveAll(dir)
+	bound := filepath.Join(dir, "s")
+	ln, err := net.Listen("unix", bound)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	// The socket is removed from path when serving stops, not from where
+	// it was bound.
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(bound, 0600); err != nil {
+		ln.Close()
+		return nil, nil, fmt.Errorf("failed to restrict access to %s: %w", path, err)
+	}
+	if err := os.Rename(bound, path); err != nil {
+		ln.Close()
+		return nil, nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		ln.Close()
+		return nil, nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	return ln, info, nil
+}
+
+// FetchStatus asks the scheduler serving its status on the unix socket at
+// path for it.
+func FetchStatus(ctx context.Context, path string) (*DaemonStatus, error) {
+	var status DaemonStatus
+	if err := callScheduler(ctx, path, http.MethodGet, "/status", &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// RequestRun asks the scheduler serving its status on the unix socket at
+// path to run a task now, and waits for the outcome.
+func RequestRun(ctx context.Context, path, name string) (*RunResult, error) {
+	var result RunResult
+	if err := callScheduler(ctx, path, http.MethodPost, "/run?task="+url.QueryEscape(name), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ErrSchedulerUnreachable is returned when no scheduler serves the socket.
+var ErrSchedulerUnreachable = errors.New("the scheduler is not running or not reachable")
+
+// callScheduler sends a request to the scheduler on the unix socket at path
+// and decodes its JSON reply into out.
+func callScheduler(ctx context.Context, path, method, target string, out interface{}) error {
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	req, err := http.NewRequestWithContext(ctx, method, "http://scheduler"+target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: failed to reach it on %s: %v", ErrSchedulerUnreachable, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("the scheduler replied %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode the scheduler's reply: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatus(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "scheduler.yaml")
+	config := []byte(`
+scheduled_tasks:
+  - name: "every_second"
+    schedule: "@every 1s"
+    task_file: "job.lua"
+  - name: "watched"
+    task_file: "job.lua"
+    file_watch:
+      paths: ["` + dir + `"]
+  - name: "paused"
+    schedule: "@daily"
+    task_file: "job.lua"
+    paused: true
+`)
+	require.NoError(t, ioutil.WriteFile(configPath, config, 0644))
+
+	history := NewHistory(HistoryConfig{Dir: filepath.Join(dir, "history")})
+	require.NoError(t, history.Record(&RunResult{Task: "paused", Status: StatusFailed, Error: "boom", StartedAt: time.Now().Add(-time.Hour)}))
+
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	s := NewScheduler(configPath)
+	s.Runner = blockingRunner(started, release)
+	s.History = history
+	require.NoError(t, s.LoadConfig())
+	require.NoError(t, s.Start())
+	defer s.Stop()
+	defer close(release)
+
+	socket := filepath.Join(dir, "scheduler.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, s.ServeStatus(ctx, socket))
+	assert.Error(t, s.ServeStatus(ctx, socket), "the socket is in use")
+	info, err := os.Lstat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// A file that is not a socket is left alone.
+	notSocket := filepath.Join(dir, "scheduler.yaml")
+	assert.Error(t, s.ServeStatus(ctx, notSocket))
+	_, err = os.Stat(notSocket)
+	assert.NoError(t, err)
+
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the scheduled task did not start")
+	}
+	status, err := FetchStatus(context.Background(), socket)
+	require.NoError(t, err)
+	sum := sha256.Sum256(config)
+	assert.Equal(t, os.Getpid(), status.PID)
+	assert.Equal(t, configPath, status.ConfigFile)
+	assert.Equal(t, hex.EncodeToString(sum[:]), status.ConfigHash)
+	require.Len(t, status.Jobs, 3)
+
+	running := status.Jobs[0]
+	assert.Equal(t, "every_second", running.Name)
+	require.NotNil(t, running.Next)
+	require.NotNil(t, running.Previous)
+	assert.True(t, running.Next.After(*running.Previous))
+	assert.Equal(t, 1, running.Running)
+	assert.NotNil(t, running.RunningSince)
+	assert.Nil(t, running.LastRun)
+
+	watched := status.Jobs[1]
+	assert.Equal(t, []string{TriggerFileWatch}, watched.Triggers)
+	assert.Nil(t, watched.Next)
+	assert.Zero(t, watched.Running)
+
+	paused := status.Jobs[2]
+	assert.True(t, paused.Paused)
+	assert.Nil(t, paused.Next)
+	require.NotNil(t, paused.LastRun, "the last run comes from the history")
+	assert.Equal(t, StatusFailed, paused.LastRun.Status)
+
+	// The socket goes away with the scheduler.
+	cancel()
+	assert.Eventually(t, func() bool {
+		_, err := os.Lstat(socket)
+		return os.IsNotExist(err)
+	}, 3*time.Second, 20*time.Millisecond)
+	_, err = FetchStatus(context.Background(), socket)
+	assert.Error(t, err)
+}
+
+func TestRequestRun(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "scheduler.yaml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`
+scheduled_tasks:
+  - {name: job, schedule: "@daily", task_file: job.lua, concurrency_policy: forbid, paused: true}
+`), 0644))
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	s := NewScheduler(configPath)
+	s.Runner = blockingRunner(started, release)
+	require.NoError(t, s.LoadConfig())
+	require.NoError(t, s.Start())
+	defer s.Stop()
+	socket := filepath.Join(dir, "scheduler.sock")
+	require.NoError(t, s.ServeStatus(context.Background(), socket))
+
+	done := make(chan *RunResult, 1)
+	go func() {
+		result, err := RequestRun(context.Background(), socket, "job")
+		assert.NoError(t, err)
+		done <- result
+	}()
+	<-started
+	status, err := FetchStatus(context.Background(), socket)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status.Jobs[0].Running, "the scheduler tracks the run")
+
+	// A second run is skipped under the task's concurrency policy.
+	result, err := RequestRun(context.Background(), socket, "job")
+	require.NoError(t, err)
+	assert.Equal(t, StatusSkipped, result.Status)
+	close(release)
+	assert.Equal(t, StatusSuccess, (<-done).Status)
+
+	_, err = RequestRun(context.Background(), socket, "missing")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrSchedulerUnreachable)
+	_, err = RequestRun(context.Background(), filepath.Join(dir, "none.sock"), "job")
+	assert.ErrorIs(t, err, ErrSchedulerUnreachable)
+}
@@ -0,0 +1,442 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Kinds of triggers, passed to triggered runs in the "trigger" param.
+const (
+	TriggerFileWatch = "file_watch"
+	TriggerWebhook   = "http_webhook"
+	TriggerGitPoll   = "git_poll"
+)
+
+const (
+	// DefaultFileWatchInterval is how often watched files are checked.
+	DefaultFileWatchInterval = time.Second
+	// DefaultFileWatchDebounce is how long watched files must stay unchanged
+	// before a run starts.
+	DefaultFileWatchDebounce = 2 * time.Second
+	// DefaultGitPollInterval is how often a git branch is checked.
+	DefaultGitPollInterval = time.Minute
+	// maxWebhookPayload caps the size of a webhook request body.
+	maxWebhookPayload = 10 << 20
+	// gitTimeout caps how long a git poll may take.
+	gitTimeout = time.Minute
+)
+
+// FileWatchTrigger runs a task when files change. Paths are files,
+// directories, watched recursively, or patterns as in filepath.Glob. The
+// run gets the changed files, comma separated, in the changed_files param.
+type FileWatchTrigger struct {
+	Paths []string `yaml:"paths"`
+	// Debounce waits until the files stayed unchanged that long, so a burst
+	// of changes starts a single run. Defaults to 2s.
+	Debounce time.Duration `yaml:"debounce,omitempty"`
+	// Interval is how often the files are checked. Defaults to 1s.
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// WebhookTrigger runs a task when an HTTP POST request signed with a shared
+// secret arrives. The request carries an HMAC-SHA256 of its body in the
+// X-Hub-Signature-256 header, as "sha256=<hex>", like GitHub and Gitea
+// send. The run gets the body in the payload param and, when it is a JSON
+// object, its top-level scalar fields in payload_<field> params.
+type WebhookTrigger struct {
+	// Listen is the address to listen on, such as "127.0.0.1:9000".
+	Listen string `yaml:"listen"`
+	// Path is the URL path of the webhook. Defaults to "/".
+	Path string `yaml:"path,omitempty"`
+	// Secret is the shared secret. SecretEnv names an environment variable
+	// holding it instead, to keep it out of the config file.
+	Secret    string `yaml:"secret,omitempty"`
+	SecretEnv string `yaml:"secret_env,omitempty"`
+}
+
+// GitPollTrigger runs a task when a branch of a git repository advances.
+// The run gets the git_repo, git_branch, git_sha and git_previous_sha
+// params. The first poll only records where the branch is.
+type GitPollTrigger struct {
+	// Repo is a local path or a remote URL, as accepted by git ls-remote.
+	Repo string `yaml:"repo"`
+	// Branch defaults to the default branch of the repository (HEAD).
+	Branch string `yaml:"branch,omitempty"`
+	// Interval is how often the branch is checked. Defaults to 1m.
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// Triggers returns the kinds of the triggers of a task.
+func (t ScheduledTask) Triggers() []string {
+	var triggers []string
+	if t.FileWatch != nil {
+		triggers = append(triggers, TriggerFileWatch)
+	}
+	if t.Webhook != nil {
+		triggers = append(triggers, TriggerWebhook)
+	}
+	if t.GitPoll != nil {
+		triggers = append(triggers, TriggerGitPoll)
+	}
+	return triggers
+}
+
+// validateTriggers checks the triggers of a task.
+func (t ScheduledTask) validateTriggers() error {
+	if w := t.FileWatch; w != nil {
+		if len(w.Paths) == 0 {
+			return fmt.Errorf("file_watch of task %s has no paths", t.Name)
+		}
+		for _, path := range w.Paths {
+			if _, err := filepath.Match(path, ""); err != nil {
+				return fmt.Errorf("invalid file_watch path %q for task %s: %w", path, t.Name, err)
+			}
+		}
+		if w.Debounce < 0 || w.Interval < 0 {
+			return fmt.Errorf("file_watch of task %s has a negative debounce or interval", t.Name)
+		}
+	}
+	if w := t.Webhook; w != nil {
+		if w.Listen == "" {
+			return fmt.Errorf("http_webhook of task %s has no listen address", t.Name)
+		}
+		if _, _, err := net.SplitHostPort(w.Listen); err != nil {
+			return fmt.Errorf("invalid http_webhook listen address %q for task %s: %w", w.Listen, t.Name, err)
+		}
+		if w.Path != "" && !strings.HasPrefix(w.Path, "/") {
+			return fmt.Errorf("http_webhook path %q of task %s must start with /", w.Path, t.Name)
+		}
+		if w.Secret == "" && w.SecretEnv == "" {
+			return fmt.Errorf("http_webhook of task %s needs a secret or secret_env", t.Name)
+		}
+	}
+	if g := t.GitPoll; g != nil {
+		if g.Repo == "" {
+			return fmt.Errorf("git_poll of task %s has no repo", t.Name)
+		}
+		if g.Interval < 0 {
+			return fmt.Errorf("git_poll of task %s has a negative interval", t.Name)
+		}
+	}
+	return nil
+}
+
+// startTriggers starts watching for the events of the triggers of task,
+// which start runs through chain, and returns the function stopping them.
+func (s *Scheduler) startTriggers(task ScheduledTask, chain cron.Chain) (context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	stop := cancel
+	fire := func(params map[string]string) {
+		s.fire(task, chain, params["trigger"], params)
+	}
+	if task.Webhook != nil {
+		ln, err := s.serveWebhook(ctx, task, fire)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		// Free the address at once, for a reload listening on it again.
+		stop = func() {
+			cancel()
+			ln.Close()
+		}
+	}
+	if w := task.FileWatch; w != nil {
+		files := snapshotFiles(w.Paths)
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			watchFiles(ctx, *w, files, fire)
+		}()
+	}
+	if g := task.GitPoll; g != nil {
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			pollGit(ctx, task.Name, *g, fire)
+		}()
+	}
+	return stop, nil
+}
+
+// fire starts a run of task, with params added to its own, in the
+// background. It is called while a goroutine tracked by s.background, or
+// a cron job, runs.
+func (s *Scheduler) fire(task ScheduledTask, chain cron.Chain, reason string, params map[string]string) {
+	if s.ctx.Err() != nil {
+		return
+	}
+	task = task.withParams(params)
+	fmt.Printf("Scheduled task '%s' triggered by %s\n", task.Name, reason)
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		chain.Then(cron.FuncJob(func() { s.RunTask(task) })).Run()
+	}()
+}
+
+// withParams returns the task with params added to its own.
+func (t ScheduledTask) withParams(params map[string]string) ScheduledTask {
+	merged := make(map[string]string, len(t.Params)+len(params))
+	for k, v := range t.Params {
+		merged[k] = v
+	}
+	for k, v := range params {
+		merged[k] = v
+	}
+	t.Params = merged
+	return t
+}
+
+// fileState is what is compared to tell whether a watched file changed.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchFiles fires once the watched files changed, from their state in
+// files, and then stayed unchanged for the debounce, until ctx is done.
+func watchFiles(ctx context.Context, w FileWatchTrigger, files map[string]fileState, fire func(map[string]string)) {
+	interval, debounce := w.Interval, w.Debounce
+	if interval <= 0 {
+		interval = DefaultFileWatchInterval
+	}
+	if debounce <= 0 {
+		debounce = DefaultFileWatchDebounce
+	}
+	changed := make(map[string]bool)
+	var lastChange time.Time
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := snapshotFiles(w.Paths)
+		for path, state := range current {
+			if old, ok := files[path]; !ok || old != state {
+				changed[path] = true
+				lastChange = time.Now()
+			}
+		}
+		for path := range files {
+			if _, ok := current[path]; !ok {
+				changed[path] = true
+				lastChange = time.Now()
+			}
+		}
+		files = current
+		if len(changed) == 0 || time.Since(lastChange) < debounce {
+			continue
+		}
+		var paths []string
+		for path := range changed {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		fire(map[string]string{"trigger": TriggerFileWatch, "changed_files": strings.Join(paths, ",")})
+		changed = make(map[string]bool)
+		lastChange = time.Time{}
+	}
+}
+
+// snapshotFiles returns the state of the files matching paths. Directories
+// are walked, skipping .git directories.
+func snapshotFiles(paths []string) map[string]fileState {
+	files := make(map[string]fileState)
+	for _, pattern := range paths {
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return nil
+				}
+				if info.IsDir() {
+					if info.Name() == ".git" && path != match {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				files[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+				return nil
+			})
+		}
+	}
+	return files
+}
+
+// serveWebhook listens for the webhook of task until ctx is done, and
+// returns the listener.
+func (s *Scheduler) serveWebhook(ctx context.Context, task ScheduledTask, fire func(map[string]string)) (net.Listener, error) {
+	w := task.Webhook
+	secret := w.Secret
+	if w.SecretEnv != "" {
+		if secret = os.Getenv(w.SecretEnv); secret == "" {
+			return nil, fmt.Errorf("http_webhook of task %s: environment variable %s is not set", task.Name, w.SecretEnv)
+		}
+	}
+	path := w.Path
+	if path == "" {
+		path = "/"
+	}
+	ln, err := net.Listen("tcp", w.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the http_webhook of task %s: %w", task.Name, err)
+	}
+	server := &http.Server{
+		Handler:           webhookHandler(ctx, path, []byte(secret), fire),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// Webhooks come seldom; closing every connection lets Shutdown return
+	// as soon as the requests are handled.
+	server.SetKeepAlivesEnabled(false)
+	go server.Serve(ln)
+	// Shutdown waits for the requests being handled, so runs they fire are
+	// tracked before Stop stops waiting.
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	fmt.Printf("Listening for the http_webhook of scheduled task '%s' on %s%s\n", task.Name, ln.Addr(), path)
+	return ln, nil
+}
+
+// webhookHandler fires for POST requests to path signed with secret.
+func webhookHandler(ctx context.Context, path string, secret []byte, fire func(map[string]string)) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(rw, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			rw.Header().Set("Allow", http.MethodPost)
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, maxWebhookPayload))
+		if err != nil {
+			http.Error(rw, "failed to read the request body", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !validSignature(secret, body, r.Header.Get("X-Hub-Signature-256")) {
+			http.Error(rw, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if ctx.Err() != nil {
+			http.Error(rw, "the scheduler is stopping", http.StatusServiceUnavailable)
+			return
+		}
+		fire(webhookParams(body))
+		rw.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// validSignature tells whether signature, "sha256=<hex>", is the HMAC-SHA256
+// of body with secret.
+func validSignature(secret, body []byte, signature string) bool {
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// webhookParams returns the params of a run triggered by a webhook.
+func webhookParams(body []byte) map[string]string {
+	params := map[string]string{"trigger": TriggerWebhook, "payload": string(body)}
+	var fields map[string]interface{}
+	if json.Unmarshal(body, &fields) != nil {
+		return params
+	}
+	for key, value := range fields {
+		switch value.(type) {
+		case string, float64, bool:
+			params["payload_"+key] = fmt.Sprint(value)
+		}
+	}
+	return params
+}
+
+// pollGit fires whenever the branch advances, until ctx is done.
+func pollGit(ctx context.Context, taskName string, g GitPollTrigger, fire func(map[string]string)) {
+	interval := g.Interval
+	if interval <= 0 {
+		interval = DefaultGitPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last string
+	for {
+		sha, err := branchHead(ctx, g)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			fmt.Printf("Failed to poll git for scheduled task '%s': %v\n", taskName, err)
+		case last != "" && sha != last:
+			fire(map[string]string{
+				"trigger":          TriggerGitPoll,
+				"git_repo":         g.Repo,
+				"git_branch":       g.Branch,
+				"git_sha":          sha,
+				"git_previous_sha": last,
+			})
+			last = sha
+		default:
+			last = sha
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// branchHead returns the commit the polled branch points to.
+func branchHead(ctx context.Context, g GitPollTrigger) (string, error) {
+	ref := "HEAD"
+	if g.Branch != "" {
+		ref = "refs/heads/" + g.Branch
+	}
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", "--", g.Repo, ref)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git ls-remote %s %s: %w: %s", g.Repo, ref, err, strings.TrimSpace(stderr.String()))
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[1] == ref {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("branch %s not found in %s", ref, g.Repo)
+}
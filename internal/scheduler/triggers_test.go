@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// paramsRunner sends the params of every run to runs.
+func paramsRunner(runs chan<- map[string]string) RunFunc {
+	return func(ctx context.Context, task ScheduledTask) *RunResult {
+		runs <- task.Params
+		return &RunResult{Success: true}
+	}
+}
+
+// triggeredScheduler starts a scheduler with a single task.
+func triggeredScheduler(t *testing.T, task ScheduledTask) (*Scheduler, chan map[string]string) {
+	runs := make(chan map[string]string, 10)
+	s := NewScheduler("dummy.yaml")
+	s.Runner = paramsRunner(runs)
+	s.SetConfig(&SchedulerConfig{ScheduledTasks: []ScheduledTask{task}})
+	require.NoError(t, s.Start())
+	t.Cleanup(s.Stop)
+	return s, runs
+}
+
+func receiveRun(t *testing.T, runs <-chan map[string]string) map[string]string {
+	select {
+	case params := <-runs:
+		return params
+	case <-time.After(5 * time.Second):
+		t.Fatal("the trigger did not start a run")
+		return nil
+	}
+}
+
+func TestValidateTriggers(t *testing.T) {
+	for _, task := range []ScheduledTask{
+		{Name: "job", TaskFile: "job.lua", FileWatch: &FileWatchTrigger{Paths: []string{"src"}}},
+		{Name: "job", TaskFile: "job.lua", Webhook: &WebhookTrigger{Listen: ":9000", SecretEnv: "HOOK_SECRET"}},
+		{Name: "job", TaskFile: "job.lua", Schedule: "@daily", GitPoll: &GitPollTrigger{Repo: "."}},
+	} {
+		assert.NoError(t, task.Validate(), "%+v", task)
+	}
+	for _, task := range []ScheduledTask{
+		{Name: "job", TaskFile: "job.lua", FileWatch: &FileWatchTrigger{}},
+		{Name: "job", TaskFile: "job.lua", FileWatch: &FileWatchTrigger{Paths: []string{"src/["}}},
+		{Name: "job", TaskFile: "job.lua", Webhook: &WebhookTrigger{Listen: ":9000"}},
+		{Name: "job", TaskFile: "job.lua", Webhook: &WebhookTrigger{Listen: "9000", Secret: "s"}},
+		{Name: "job", TaskFile: "job.lua", GitPoll: &GitPollTrigger{}},
+		{Name: "job", TaskFile: "job.lua", GitPoll: &GitPollTrigger{Repo: "."}, CatchUp: CatchUpAll},
+	} {
+		assert.Error(t, task.Validate(), "%+v", task)
+	}
+	never := &SchedulerConfig{ScheduledTasks: []ScheduledTask{{Name: "job", TaskFile: "job.lua"}}}
+	assert.Error(t, never.Validate())
+	hook := &WebhookTrigger{Listen: ":9000", Secret: "s"}
+	config := &SchedulerConfig{ScheduledTasks: []ScheduledTask{
+		{Name: "a", TaskFile: "a.lua", Webhook: hook},
+		{Name: "b", TaskFile: "b.lua", Webhook: hook},
+	}}
+	assert.Error(t, config.Validate())
+}
+
+func TestFileWatchTrigger(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "old.txt"), []byte("old"), 0644))
+	_, runs := triggeredScheduler(t, ScheduledTask{
+		Name:      "watch",
+		TaskFile:  "job.lua",
+		Params:    map[string]string{"env": "ci"},
+		FileWatch: &FileWatchTrigger{Paths: []string{dir}, Interval: 20 * time.Millisecond, Debounce: 200 * time.Millisecond},
+	})
+
+	// A burst of changes starts a single run.
+	for _, name := range []string{"a.txt", "b.txt"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+		time.Sleep(50 * time.Millisecond)
+	}
+	params := receiveRun(t, runs)
+	assert.Equal(t, TriggerFileWatch, params["trigger"])
+	assert.Equal(t, filepath.Join(dir, "a.txt")+","+filepath.Join(dir, "b.txt"), params["changed_files"])
+	assert.Equal(t, "ci", params["env"])
+	select {
+	case params := <-runs:
+		t.Fatalf("unexpected run with %v", params)
+	case <-time.After(400 * time.Millisecond):
+	}
+}
+
+func TestWebhookTrigger(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	_, runs := triggeredScheduler(t, ScheduledTask{
+		Name:     "hook",
+		TaskFile: "job.lua",
+		Webhook:  &WebhookTrigger{Listen: addr, Path: "/deploy", Secret: "s3cret"},
+	})
+
+	body := []byte(`{"ref":"refs/heads/main","after":"abc123","commits":[]}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	post := func(path, signature string) int {
+		req, err := http.NewRequest(http.MethodPost, "http://"+addr+path, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("X-Hub-Signature-256", signature)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusUnauthorized, post("/deploy", "sha256=00"))
+	assert.Equal(t, http.StatusNotFound, post("/other", "sha256="+hex.EncodeToString(mac.Sum(nil))))
+	assert.Equal(t, http.StatusAccepted, post("/deploy", "sha256="+hex.EncodeToString(mac.Sum(nil))))
+
+	params := receiveRun(t, runs)
+	assert.Equal(t, TriggerWebhook, params["trigger"])
+	assert.Equal(t, string(body), params["payload"])
+	assert.Equal(t, "refs/heads/main", params["payload_ref"])
+	assert.Equal(t, "abc123", params["payload_after"])
+	assert.NotContains(t, params, "payload_commits")
+	assert.Len(t, runs, 0)
+}
+
+func TestGitPollTrigger(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(bytes.TrimSpace(out))
+	}
+	git("init", "-q", "-b", "main")
+	git("commit", "-q", "--allow-empty", "-m", "first")
+	first := git("rev-parse", "HEAD")
+
+	_, runs := triggeredScheduler(t, ScheduledTask{
+		Name:     "poll",
+		TaskFile: "job.lua",
+		GitPoll:  &GitPollTrigger{Repo: repo, Branch: "main", Interval: 50 * time.Millisecond},
+	})
+	time.Sleep(200 * time.Millisecond) // The first poll only records the branch
+	assert.Len(t, runs, 0)
+	git("commit", "-q", "--allow-empty", "-m", "second")
+
+	params := receiveRun(t, runs)
+	assert.Equal(t, TriggerGitPoll, params["trigger"])
+	assert.Equal(t, git("rev-parse", "HEAD"), params["git_sha"])
+	assert.Equal(t, first, params["git_previous_sha"])
+	assert.Equal(t, "main", params["git_branch"])
+}
@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// jobWrappers returns the cron job wrappers applying the blackout windows,
+// the jitter and the concurrency policy of task, in that order.
+func (s *Scheduler) jobWrappers(task ScheduledTask) ([]cron.JobWrapper, error) {
+	var wrappers []cron.JobWrapper
+	windows, err := parseBlackouts(task)
+	if err != nil {
+		return nil, err
+	}
+	if len(windows) > 0 {
+		wrappers = append(wrappers, s.skipInBlackout(task, windows))
+	}
+	if task.Jitter > 0 {
+		wrappers = append(wrappers, s.delayByJitter(task.Jitter))
+	}
+	concurrency, err := s.concurrencyWrappers(task)
+	if err != nil {
+		return nil, err
+	}
+	return append(wrappers, concurrency...), nil
+}
+
+// concurrencyWrappers returns the cron job wrappers applying the
+// concurrency policy of task.
+func (s *Scheduler) concurrencyWrappers(task ScheduledTask) ([]cron.JobWrapper, error) {
+	switch task.ConcurrencyPolicy {
+	case "", ConcurrencyAllow:
+		return nil, nil
+	case ConcurrencyForbid:
+		return []cron.JobWrapper{s.skipIfStillRunning(task)}, nil
+	case ConcurrencyReplace:
+		return []cron.JobWrapper{s.replaceIfStillRunning(task)}, nil
+	default:
+		return nil, fmt.Errorf("invalid concurrency_policy %q for task %s, want %s, %s or %s",
+			task.ConcurrencyPolicy, task.Name, ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace)
+	}
+}
+
+// runGuard is the concurrency state of a task. Every job running the task
+// shares it, and it outlives reloads, so a rescheduled task still sees the
+// run started before the reload.
+type runGuard struct {
+	slot     chan struct{} // Full while a run under forbid or replace runs
+	latestMu sync.Mutex
+	latest   int // Counts the runs that tried to replace the running one
+}
+
+// guard returns the concurrency state of a task.
+func (s *Scheduler) guard(name string) *runGuard {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	g, ok := s.guards[name]
+	if !ok {
+		g = &runGuard{slot: make(chan struct{}, 1)}
+		s.guards[name] = g
+	}
+	return g
+}
+
+// recordDue records when task is due, so runs missed while the scheduler
+// is down can be caught up.
+func recordDue(task ScheduledTask, state *lastRuns) cron.JobWrapper {
+	return func(j cron.Job) cron.Job {
+		return cron.FuncJob(func() {
+			if err := state.set(task.Name, time.Now()); err != nil {
+				fmt.Printf("Failed to record when scheduled task '%s' was due: %v\n", task.Name, err)
+			}
+			j.Run()
+		})
+	}
+}
+
+// skipInBlackout skips a run, and records it as skipped, during the
+// blackout windows of the task.
+func (s *Scheduler) skipInBlackout(task ScheduledTask, windows []blackout) cron.JobWrapper {
+	return func(j cron.Job) cron.Job {
+		return cron.FuncJob(func() {
+			if window, ok := inBlackout(windows, time.Now()); ok {
+				s.skip(task, fmt.Sprintf("in blackout window %s", window))
+				return
+			}
+			j.Run()
+		})
+	}
+}
+
+// delayByJitter delays every run by a random duration up to jitter. Runs
+// waiting when the scheduler stops are dropped.
+func (s *Scheduler) delayByJitter(jitter time.Duration) cron.JobWrapper {
+	return func(j cron.Job) cron.Job {
+		return cron.FuncJob(func() {
+			timer := time.NewTimer(time.Duration(rand.Int63n(int64(jitter))))
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				j.Run()
+			case <-s.ctx.Done():
+			}
+		})
+	}
+}
+
+// skipIfStillRunning skips a run, and records it as skipped, while the
+// previous one is still running. Every job of the task shares that state,
+// so scheduled, triggered and manual runs do not overlap.
+func (s *Scheduler) skipIfStillRunning(task ScheduledTask) cron.JobWrapper {
+	g := s.guard(task.Name)
+	return func(j cron.Job) cron.Job {
+		return cron.FuncJob(func() {
+			select {
+			case g.slot <- struct{}{}:
+				defer func() { <-g.slot }()
+				j.Run()
+			default:
+				s.skip(task, "the previous run is still running")
+			}
+		})
+	}
+}
+
+// replaceIfStillRunning kills the running run, which is recorded as
+// replaced, and starts the new one once it has stopped. A run superseded
+// by a newer one before it could start is recorded as skipped. Like
+// skipIfStillRunning, every job of the task shares that state.
+func (s *Scheduler) replaceIfStillRunning(task ScheduledTask) cron.JobWrapper {
+	g := s.guard(task.Name)
+	return func(j cron.Job) cron.Job {
+		return cron.FuncJob(func() {
+			g.latestMu.Lock()
+			g.latest++
+			run := g.latest
+			g.latestMu.Unlock()
+
+			s.cancelRunning(task.Name, errReplaced)
+			g.slot <- struct{}{}
+			defer func() { <-g.slot }()
+
+			g.latestMu.Lock()
+			superseded := run != g.latest
+			g.latestMu.Unlock()
+			if superseded {
+				s.skip(task, "replaced by a newer run before it started")
+				return
+			}
+			j.Run()
+		})
+	}
+}
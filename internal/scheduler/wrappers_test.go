@@ -0,0 +1,124 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingRunner runs until its context is cancelled or release is closed.
+func blockingRunner(started chan<- struct{}, release <-chan struct{}) RunFunc {
+	return func(ctx context.Context, task ScheduledTask) *RunResult {
+		started <- struct{}{}
+		select {
+		case <-ctx.Done():
+			return &RunResult{Error: ctx.Err().Error()}
+		case <-release:
+			return &RunResult{Success: true}
+		}
+	}
+}
+
+func wrappedJob(t *testing.T, s *Scheduler, task ScheduledTask) cron.Job {
+	wrappers, err := s.jobWrappers(task)
+	require.NoError(t, err)
+	return cron.NewChain(wrappers...).Then(cron.FuncJob(func() { s.RunTask(task) }))
+}
+
+func TestConcurrencyPolicyForbid(t *testing.T) {
+	s := NewScheduler("dummy.yaml")
+	s.History = NewHistory(HistoryConfig{Dir: t.TempDir()})
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	s.Runner = blockingRunner(started, release)
+	job := wrappedJob(t, s, ScheduledTask{Name: "job", ConcurrencyPolicy: ConcurrencyForbid})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() { defer wg.Done(); job.Run() }()
+	<-started
+	job.Run() // Skipped while the first run is running
+	close(release)
+	wg.Wait()
+
+	runs, err := s.History.List("job")
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	statuses := []string{runs[0].Status, runs[1].Status}
+	assert.ElementsMatch(t, []string{StatusSkipped, StatusSuccess}, statuses)
+}
+
+func TestConcurrencyPolicyReplace(t *testing.T) {
+	s := NewScheduler("dummy.yaml")
+	s.History = NewHistory(HistoryConfig{Dir: t.TempDir()})
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	s.Runner = blockingRunner(started, release)
+	job := wrappedJob(t, s, ScheduledTask{Name: "job", ConcurrencyPolicy: ConcurrencyReplace})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); job.Run() }()
+	<-started
+	go func() { defer wg.Done(); job.Run() }() // Kills the first run
+	<-started
+	close(release)
+	wg.Wait()
+
+	runs, err := s.History.List("job")
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	statuses := []string{runs[0].Status, runs[1].Status}
+	assert.ElementsMatch(t, []string{StatusReplaced, StatusSuccess}, statuses)
+}
+
+func TestTimeoutAndRetries(t *testing.T) {
+	s := NewScheduler("dummy.yaml")
+	attempts := 0
+	s.Runner = func(ctx context.Context, task ScheduledTask) *RunResult {
+		attempts++
+		if attempts < 3 {
+			return &RunResult{Error: "flaky"}
+		}
+		return &RunResult{Success: true}
+	}
+	result := s.RunTask(ScheduledTask{Name: "job", MaxRetries: 2, RetryBackoff: time.Millisecond})
+	assert.Equal(t, StatusSuccess, result.Status)
+	assert.Equal(t, 3, result.Attempts)
+
+	attempts = 0
+	result = s.RunTask(ScheduledTask{Name: "job", MaxRetries: 1, RetryBackoff: time.Millisecond})
+	assert.Equal(t, StatusFailed, result.Status)
+	assert.Equal(t, 2, result.Attempts)
+	assert.Equal(t, "flaky", result.Error)
+
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	defer close(release)
+	s.Runner = blockingRunner(started, release)
+	result = s.RunTask(ScheduledTask{Name: "job", Timeout: 10 * time.Millisecond, MaxRetries: 3})
+	assert.Equal(t, StatusTimedOut, result.Status)
+	assert.Equal(t, 1, result.Attempts)
+	assert.Contains(t, result.Error, "timeout of 10ms")
+}
+
+func TestJobWrappersJitterAndInvalidPolicy(t *testing.T) {
+	s := NewScheduler("dummy.yaml")
+	_, err := s.jobWrappers(ScheduledTask{Name: "job", ConcurrencyPolicy: "sometimes"})
+	assert.Error(t, err)
+
+	ran := make(chan struct{}, 1)
+	s.Runner = func(ctx context.Context, task ScheduledTask) *RunResult {
+		ran <- struct{}{}
+		return &RunResult{Success: true}
+	}
+	wrappedJob(t, s, ScheduledTask{Name: "job", Jitter: 5 * time.Millisecond}).Run()
+	assert.Len(t, ran, 1)
+
+	// Runs waiting for their jitter are dropped when the scheduler stops.
+	s.cancel()
+	wrappedJob(t, s, ScheduledTask{Name: "job", Jitter: time.Hour}).Run()
+	assert.Len(t, ran, 1)
+}
@@ -0,0 +1,208 @@
+package taskrunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/chalkan3/sloth-runner/internal/audit"
+	"github.com/chalkan3/sloth-runner/internal/luainterface"
+	"github.com/chalkan3/sloth-runner/internal/types"
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"github.com/google/uuid"
+	lua "github.com/yuin/gopher-lua"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// agentAddress returns the address of the agent a task is delegated to, from
+// the task's delegate_to or else its group's. It is empty for local tasks.
+func (tr *TaskRunner) agentAddress(t *types.Task, groupName string) (string, error) {
+	delegateTo, scope := t.DelegateTo, "task"
+	if delegateTo == nil {
+		delegateTo, scope = tr.TaskGroups[groupName].DelegateTo, "group"
+	}
+	switch v := delegateTo.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil // Direct address
+	case map[string]interface{}:
+		if addr, ok := v["address"].(string); ok {
+			return addr, nil
+		}
+		return "", fmt.Errorf("invalid agent definition in %s delegate_to: missing address", scope)
+	default:
+		return "", fmt.Errorf("invalid type for %s delegate_to: %T", scope, v)
+	}
+}
+
+// runDelegatedTask runs a task on an agent, syncing the session workdir there
+// and back. The agent's response is returned even when the task failed, so
+// its results can be recorded.
+func (tr *TaskRunner) runDelegatedTask(ctx context.Context, t *types.Task, agentAddress string, session *types.SharedSession, groupName string) (*pb.ExecuteTaskResponse, error) {
+	if session == nil {
+		return nil, &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("delegated tasks must run inside a task group")}
+	}
+
+	// Connect to the agent
+	options := append(audit.DialOptions(), tr.DialOptions...)
+	conn, err := grpc.Dial(agentAddress, append(options, grpc.WithInsecure())...)
+	if err != nil {
+		return nil, &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("failed to connect to agent %s: %w", agentAddress, err)}
+	}
+	defer conn.Close()
+	c := pb.NewAgentClient(conn)
+
+	if session.WorkspaceID == "" {
+		session.WorkspaceID = uuid.New().String()
+	}
+	filter := workspaceFilter(t, tr.TaskGroups[groupName])
+
+	// Upload only what changed since the last sync. Agents that predate
+	// incremental sync get the whole workspace as a tarball instead.
+	req := &pb.ExecuteTaskRequest{
+		TaskName:      t.Name,
+		TaskGroup:     groupName,
+		LuaScript:     tr.LuaScript,
+		ExecutionId:   uuid.New().String(),
+		RunnerVersion: tr.Version,
+	}
+	if tr.Bundle != nil {
+		req.Bundle = proto.Clone(tr.Bundle).(*pb.ExecutionBundle)
+		req.Bundle.Params = t.Params
+	}
+	known, err := pushWorkspace(ctx, c, session.WorkspaceID, session.Workdir, filter)
+	legacy := errors.Is(err, errLegacyAgent)
+	switch {
+	case legacy:
+		var buf bytes.Buffer
+		if err := createTar(session.Workdir, &buf); err != nil {
+			return nil, &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("failed to create workspace tarball: %w", err)}
+		}
+		req.Workspace = buf.Bytes()
+	case err != nil:
+		return nil, &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("failed to sync workspace to agent %s: %w", agentAddress, err)}
+	default:
+		req.WorkspaceId = session.WorkspaceID
+	}
+
+	// Send the task to the agent
+	r, err := c.ExecuteTask(ctx, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			// The call was aborted, but the agent may still be running the task.
+			cancelRemoteTask(c, req.ExecutionId, t.Name, agentAddress)
+			return nil, &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("task on agent %s aborted: %w", agentAddress, ctx.Err())}
+		}
+		return nil, &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("failed to execute task on agent %s: %w", agentAddress, err)}
+	}
+
+	tr.checkAgentVersion(agentAddress, r.GetAgentVersion())
+
+	if !r.GetSuccess() {
+		reason := r.GetOutput()
+		if results := r.GetResults(); len(results) > 0 && results[len(results)-1].GetError() != "" {
+			reason = results[len(results)-1].GetError()
+		}
+		return r, &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("task failed on agent %s: %s", agentAddress, reason)}
+	}
+
+	// Bring back the files the task changed or deleted
+	if legacy {
+		if err := extractTar(bytes.NewReader(r.GetWorkspace()), session.Workdir); err != nil {
+			return r, &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("failed to extract updated workspace from agent %s: %w", agentAddress, err)}
+		}
+	} else if err := pullWorkspace(ctx, c, session.WorkspaceID, session.Workdir, filter, known); err != nil {
+		return r, &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("failed to sync workspace from agent %s: %w", agentAddress, err)}
+	}
+	return r, nil
+}
+
+// checkAgentVersion warns, once per agent, when an agent runs another
+// version than this runner: their Lua APIs may differ.
+func (tr *TaskRunner) checkAgentVersion(agentAddress, agentVersion string) {
+	if tr.Version == "" || agentVersion == "" || agentVersion == tr.Version {
+		return
+	}
+	if _, warned := tr.skewWarned.LoadOrStore(agentAddress, true); !warned {
+		slog.Warn("agent runs another sloth-runner version; upgrade it with 'sloth-runner agent upgrade'", "agent", agentAddress, "agent_version", agentVersion, "runner_version", tr.Version)
+	}
+}
+
+// cancelRemoteTask asks an agent to cancel a delegated task, which kills the
+// processes it started.
+func cancelRemoteTask(c pb.AgentClient, executionID, taskName, agentAddress string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := c.CancelTask(ctx, &pb.CancelTaskRequest{ExecutionId: executionID})
+	switch {
+	case err != nil:
+		slog.Error("failed to cancel task on agent", "task", taskName, "agent", agentAddress, "err", err)
+	case resp.GetCancelled():
+		slog.Warn("cancelled task on agent", "task", taskName, "agent", agentAddress)
+	}
+}
+
+// mergeRemoteOutputs makes the output table and exports of a delegated task
+// available as if the task had run locally.
+func (tr *TaskRunner) mergeRemoteOutputs(L *lua.LState, t *types.Task, resp *pb.ExecuteTaskResponse) error {
+	if resp.GetOutputJson() != "" {
+		var output interface{}
+		if err := json.Unmarshal([]byte(resp.GetOutputJson()), &output); err != nil {
+			return fmt.Errorf("failed to decode task output from agent: %w", err)
+		}
+		if table, ok := luainterface.GoValueToLua(L, output).(*lua.LTable); ok {
+			t.Output = table
+		}
+	}
+	if resp.GetExportsJson() != "" {
+		var exports map[string]interface{}
+		if err := json.Unmarshal([]byte(resp.GetExportsJson()), &exports); err != nil {
+			return fmt.Errorf("failed to decode exports from agent: %w", err)
+		}
+		tr.Export(exports)
+	}
+	return nil
+}
+
+func taskResultsFromProto(results []*pb.TaskResult) []types.TaskResult {
+	converted := make([]types.TaskResult, 0, len(results))
+	for _, r := range results {
+		result := types.TaskResult{
+			Name:     r.GetName(),
+			Status:   r.GetStatus(),
+			Duration: time.Duration(r.GetDurationMs()) * time.Millisecond,
+			Attempt:  int(r.GetAttempt()),
+			Logs:     r.GetLogs(),
+		}
+		if r.GetError() != "" {
+			result.Error = errors.New(r.GetError())
+		}
+		converted = append(converted, result)
+	}
+	return converted
+}
+
+// TaskResultsToProto converts the results of a task for an ExecuteTaskResponse.
+func TaskResultsToProto(results []types.TaskResult) []*pb.TaskResult {
+	converted := make([]*pb.TaskResult, 0, len(results))
+	for _, r := range results {
+		result := &pb.TaskResult{
+			Name:       r.Name,
+			Status:     r.Status,
+			DurationMs: r.Duration.Milliseconds(),
+			Attempt:    int32(r.Attempt),
+			Logs:       r.Logs,
+		}
+		if r.Error != nil {
+			result.Error = r.Error.Error()
+		}
+		converted = append(converted, result)
+	}
+	return converted
+}
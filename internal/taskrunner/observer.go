@@ -0,0 +1,62 @@
+package taskrunner
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/chalkan3/sloth-runner/internal/types"
+)
+
+// maxTaskLogSize bounds the logs kept for each task attempt.
+const maxTaskLogSize = 1 << 20
+
+// RunObserver follows the progress of a run, for example to report it to
+// the master's dashboard. Its methods are called from the goroutine running
+// the task and must not block for long.
+type RunObserver interface {
+	// GroupStarted is called with the tasks of a group, in execution order.
+	GroupStarted(group string, tasks []*types.Task)
+	// TaskStarted is called before every attempt of a task.
+	TaskStarted(group, task string, attempt int)
+	// TaskFinished is called with the result of every attempt, and once for
+	// tasks that are skipped without running.
+	TaskFinished(group string, result types.TaskResult)
+	// ArtifactProduced is called with the path of every artifact stored.
+	ArtifactProduced(group, task, path string)
+}
+
+func (tr *TaskRunner) taskFinished(group string, result types.TaskResult) {
+	if tr.Observer != nil {
+		tr.Observer.TaskFinished(group, result)
+	}
+}
+
+// taskLogBuffer collects the logs of a task attempt, keeping the first
+// maxTaskLogSize bytes.
+type taskLogBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *taskLogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := maxTaskLogSize - b.buf.Len(); len(p) > room {
+		// room is never negative: the buffer stops growing at maxTaskLogSize.
+		b.buf.Write(p[:room])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (b *taskLogBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.truncated {
+		return b.buf.String() + "\n[log truncated]\n"
+	}
+	return b.buf.String()
+}
@@ -2,8 +2,8 @@ package taskrunner
 
 import (
 	"archive/tar"
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -22,8 +22,8 @@ import (
 	"github.com/chalkan3/sloth-runner/internal/types"
 	pb "github.com/chalkan3/sloth-runner/proto"
 	"github.com/pterm/pterm"
-	"google.golang.org/grpc"
 	lua "github.com/yuin/gopher-lua"
+	"google.golang.org/grpc"
 )
 
 type SurveyAsker interface {
@@ -76,6 +76,37 @@ type TaskRunner struct {
 	Interactive bool
 	surveyAsker SurveyAsker
 	LuaScript   string // New field
+	// WorkdirOverride makes every group run in this directory and keeps it
+	// after the run. Agents use it to run delegated tasks in a synced workspace.
+	WorkdirOverride string
+	// Bundle is sent with delegated tasks so agents rebuild this Lua environment.
+	Bundle *pb.ExecutionBundle
+	// Local ignores delegate_to, so a task received by an agent is not delegated again.
+	Local bool
+	// Context aborts the run when cancelled. Running tasks are cancelled,
+	// including delegated ones, and the remaining tasks are skipped.
+	Context context.Context
+	// PrepareState is called with the Lua state of every task once the
+	// built-in modules are loaded. Agents use it to apply their policy.
+	PrepareState func(L *lua.LState)
+	// Observer, if set, is told about the progress of the run.
+	Observer RunObserver
+	// Version is the sloth-runner version, sent with delegated tasks so
+	// agents running another version are reported.
+	Version string
+	// DialOptions are added to those used to connect to agents, e.g. to
+	// present the token they require.
+	DialOptions []grpc.DialOption
+
+	skewWarned sync.Map // Agent addresses already reported as skewed
+}
+
+// context returns the context of the run.
+func (tr *TaskRunner) context() context.Context {
+	if tr.Context == nil {
+		return context.Background()
+	}
+	return tr.Context
 }
 
 func NewTaskRunner(L *lua.LState, groups map[string]types.TaskGroup, targetGroup string, targetTasks []string, dryRun bool, interactive bool, asker SurveyAsker, luaScript string) *TaskRunner {
@@ -135,6 +166,7 @@ func (tr *TaskRunner) executeTaskWithRetries(t *types.Task, inputFromDependencie
 			completedTasks[t.Name] = true
 			delete(runningTasks, t.Name)
 			mu.Unlock()
+			tr.taskFinished(groupName, types.TaskResult{Name: t.Name, Status: "Skipped"})
 			return nil
 		}
 	} else if t.RunIf != "" {
@@ -152,13 +184,23 @@ func (tr *TaskRunner) executeTaskWithRetries(t *types.Task, inputFromDependencie
 			completedTasks[t.Name] = true
 			delete(runningTasks, t.Name)
 			mu.Unlock()
+			tr.taskFinished(groupName, types.TaskResult{Name: t.Name, Status: "Skipped"})
 			return nil
 		}
 	}
 
 	var taskErr error
 
-	for i := 0; i <= t.Retries; i++ {
+	// Delegated tasks are retried by the agent, which reports every attempt.
+	retries := t.Retries
+	if addr, _ := tr.agentAddress(t, groupName); addr != "" && !tr.Local {
+		retries = 0
+	}
+
+	for i := 0; i <= retries; i++ {
+		if i > 0 && tr.context().Err() != nil {
+			break // Cancelled: do not retry
+		}
 		if i > 0 {
 			pterm.Warning.Printf("Task '%s' failed. Retrying in 1s (%d/%d)...\n", t.Name, i, t.Retries)
 			time.Sleep(1 * time.Second)
@@ -174,13 +216,13 @@ func (tr *TaskRunner) executeTaskWithRetries(t *types.Task, inputFromDependencie
 			if err != nil {
 				return &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("invalid timeout duration: %w", err)}
 			}
-			ctx, cancel = context.WithTimeout(context.Background(), timeout)
+			ctx, cancel = context.WithTimeout(tr.context(), timeout)
 		} else {
-			ctx, cancel = context.WithCancel(context.Background())
+			ctx, cancel = context.WithCancel(tr.context())
 		}
 		defer cancel()
 
-		taskErr = tr.runTask(ctx, t, inputFromDependencies, mu, completedTasks, taskOutputs, runningTasks, session, groupName)
+		taskErr = tr.runTask(ctx, t, inputFromDependencies, mu, completedTasks, taskOutputs, runningTasks, session, groupName, i+1)
 
 		if taskErr == nil {
 			slog.Info("task finished", "task", t.Name, "status", "success")
@@ -192,86 +234,34 @@ func (tr *TaskRunner) executeTaskWithRetries(t *types.Task, inputFromDependencie
 	return taskErr // Final failure
 }
 
-func (tr *TaskRunner) runTask(ctx context.Context, t *types.Task, inputFromDependencies *lua.LTable, mu *sync.Mutex, completedTasks map[string]bool, taskOutputs map[string]*lua.LTable, runningTasks map[string]bool, session *types.SharedSession, groupName string) (taskErr error) {
+func (tr *TaskRunner) runTask(ctx context.Context, t *types.Task, inputFromDependencies *lua.LTable, mu *sync.Mutex, completedTasks map[string]bool, taskOutputs map[string]*lua.LTable, runningTasks map[string]bool, session *types.SharedSession, groupName string, attempt int) (taskErr error) {
 	startTime := time.Now()
 
-	var agentAddress string
-
-	// Determine agent address from task's DelegateTo or group's DelegateTo
-	if t.DelegateTo != nil {
-		switch v := t.DelegateTo.(type) {
-		case string:
-			agentAddress = v // Direct address
-		case map[string]interface{}:
-			if addr, ok := v["address"].(string); ok {
-				agentAddress = addr
-			} else {
-				return &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("invalid agent definition in task delegate_to: missing address")}
-			}
-		default:
-			return &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("invalid type for task delegate_to: %T", v)}
-		}
-	} else if tr.TaskGroups[groupName].DelegateTo != nil {
-		switch v := tr.TaskGroups[groupName].DelegateTo.(type) {
-		case string:
-			agentAddress = v // Direct address
-		case map[string]interface{}:
-			if addr, ok := v["address"].(string); ok {
-				agentAddress = addr
-			} else {
-				return &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("invalid agent definition in group delegate_to: missing address")}
-			}
-		default:
-			return &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("invalid type for group delegate_to: %T", v)}
-		}
-	}
-
-	if agentAddress != "" {
-		// Connect to the agent
-		conn, err := grpc.Dial(agentAddress, grpc.WithInsecure())
-		if err != nil {
-			return &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("failed to connect to agent %s: %w", agentAddress, err)}
-		}
-		defer conn.Close()
-		c := pb.NewAgentClient(conn)
-
-		// Create a tarball of the workspace
-		var buf bytes.Buffer
-		if err := createTar(session.Workdir, &buf); err != nil {
-			return &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("failed to create workspace tarball: %w", err)}
-		}
-
-		// Send the task and workspace to the agent
-		r, err := c.ExecuteTask(ctx, &pb.ExecuteTaskRequest{
-			TaskName:    t.Name,
-			TaskGroup:   groupName,
-			LuaScript:   tr.LuaScript,
-			Workspace:   buf.Bytes(),
-		})
-		if err != nil {
-			return &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("failed to execute task on agent %s: %w", agentAddress, err)}
-		}
-
-		if !r.GetSuccess() {
-			return &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("task failed on agent %s: %s", agentAddress, r.GetOutput())}
-		}
-
-		// Extract the updated workspace
-		if err := extractTar(bytes.NewReader(r.GetWorkspace()), session.Workdir); err != nil {
-			return &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("failed to extract updated workspace from agent %s: %w", agentAddress, err)}
-		}
-
-		return nil
+	agentAddress, err := tr.agentAddress(t, groupName)
+	if err != nil {
+		return &TaskExecutionError{TaskName: t.Name, Err: err}
 	}
 
 	L := lua.NewState()
 	defer L.Close()
 	luainterface.OpenAll(L)
+	if tr.PrepareState != nil {
+		tr.PrepareState(L)
+	}
 	
 	localInputFromDependencies := luainterface.CopyTable(inputFromDependencies, L)
+
+	logs := &taskLogBuffer{}
+	ctx = luainterface.WithTaskLog(ctx, logs)
+	if tr.Observer != nil {
+		tr.Observer.TaskStarted(groupName, t.Name, attempt)
+	}
 	
 t.Output = L.NewTable()
 
+	// Attempts made by an agent before the one it reported as final.
+	var remoteResults []types.TaskResult
+
 	defer func() {
 		if r := recover(); r != nil {
 			taskErr = &TaskExecutionError{TaskName: t.Name, Err: fmt.Errorf("panic: %v", r)}
@@ -281,21 +271,52 @@ t.Output = L.NewTable()
 		status := "Success"
 		if taskErr != nil {
 			status = "Failed"
+			if errors.Is(ctx.Err(), context.Canceled) {
+				status = "Cancelled"
+			}
 		}
 
-		mu.Lock()
-		tr.Results = append(tr.Results, types.TaskResult{
+		result := types.TaskResult{
 			Name:     t.Name,
 			Status:   status,
 			Duration: duration,
 			Error:    taskErr,
-		})
+			Attempt:  attempt,
+			Logs:     logs.String(),
+		}
+		var earlier []types.TaskResult
+		if len(remoteResults) > 0 {
+			earlier = remoteResults[:len(remoteResults)-1]
+			result.Attempt = remoteResults[len(remoteResults)-1].Attempt
+			result.Logs = remoteResults[len(remoteResults)-1].Logs
+		}
+
+		mu.Lock()
+		tr.Results = append(tr.Results, earlier...)
+		tr.Results = append(tr.Results, result)
 		taskOutputs[t.Name] = luainterface.CopyTable(t.Output, tr.L)
 		completedTasks[t.Name] = true
 		delete(runningTasks, t.Name)
 		mu.Unlock()
+
+		for _, r := range earlier {
+			tr.taskFinished(groupName, r)
+		}
+		tr.taskFinished(groupName, result)
 	}()
 
+	if agentAddress != "" && !tr.Local {
+		var resp *pb.ExecuteTaskResponse
+		resp, taskErr = tr.runDelegatedTask(ctx, t, agentAddress, session, groupName)
+		if resp != nil {
+			remoteResults = taskResultsFromProto(resp.GetResults())
+			if err := tr.mergeRemoteOutputs(L, t, resp); err != nil && taskErr == nil {
+				taskErr = &TaskExecutionError{TaskName: t.Name, Err: err}
+			}
+		}
+		return taskErr
+	}
+
 	if t.PreExec != nil {
 		success, msg, _, err := luainterface.ExecuteLuaFunction(L, t.PreExec, t.Params, localInputFromDependencies, 2, ctx)
 		if err != nil {
@@ -379,7 +400,9 @@ func (tr *TaskRunner) Run() error {
 
 		var workdir string
 		var err error
-		if group.Workdir != "" {
+		if tr.WorkdirOverride != "" {
+			workdir = tr.WorkdirOverride
+		} else if group.Workdir != "" {
 			workdir = group.Workdir
 		} else if group.CreateWorkdirBeforeRun {
 			uuid, err := uuid.NewRandom()
@@ -429,6 +452,14 @@ func (tr *TaskRunner) Run() error {
 			return err
 		}
 
+		if tr.Observer != nil {
+			ordered := make([]*types.Task, 0, len(executionOrder))
+			for _, name := range executionOrder {
+				ordered = append(ordered, taskMap[name])
+			}
+			tr.Observer.GroupStarted(groupName, ordered)
+		}
+
 		p, _ := pterm.DefaultProgressbar.WithTotal(len(executionOrder)).WithTitle("Executing tasks").Start()
 		defer p.Stop()
 
@@ -444,6 +475,14 @@ func (tr *TaskRunner) Run() error {
 			task := taskMap[taskName]
 			runningTasks[task.Name] = true
 
+			if err := tr.context().Err(); err != nil {
+				slog.Warn("Skipping task because the run was cancelled", "task", task.Name)
+				taskStatus[task.Name] = "Skipped"
+				tr.taskFinished(groupName, types.TaskResult{Name: task.Name, Status: "Skipped"})
+				p.Increment()
+				continue
+			}
+
 			// Dependency checks
 			skip := false
 			for _, depName := range task.DependsOn {
@@ -455,6 +494,7 @@ func (tr *TaskRunner) Run() error {
 			}
 			if skip {
 				taskStatus[task.Name] = "Skipped"
+				tr.taskFinished(groupName, types.TaskResult{Name: task.Name, Status: "Skipped"})
 				p.Increment()
 				continue
 			}
@@ -467,6 +507,7 @@ func (tr *TaskRunner) Run() error {
 					slog.Error("Failed to consume artifact", "task", task.Name, "artifact", artifactName, "error", err)
 					groupErrors = append(groupErrors, err)
 					taskStatus[task.Name] = "Failed"
+					tr.taskFinished(groupName, types.TaskResult{Name: task.Name, Status: "Failed", Error: fmt.Errorf("failed to consume artifact %s: %w", artifactName, err)})
 					skip = true
 					break
 				}
@@ -497,6 +538,7 @@ func (tr *TaskRunner) Run() error {
 				case "skip":
 					pterm.Info.Printf("Skipping task '%s' by user choice.\n", task.Name)
 					taskStatus[task.Name] = "Skipped"
+					tr.taskFinished(groupName, types.TaskResult{Name: task.Name, Status: "Skipped"})
 					p.Increment()
 					continue
 				case "abort":
@@ -527,6 +569,9 @@ func (tr *TaskRunner) Run() error {
 							slog.Error("Failed to produce artifact", "task", task.Name, "artifact", match, "error", err)
 						} else {
 							slog.Info("Produced artifact", "task", task.Name, "artifact", destPath)
+							if tr.Observer != nil {
+								tr.Observer.ArtifactProduced(groupName, task.Name, destPath)
+							}
 						}
 					}
 				}
@@ -541,12 +586,12 @@ func (tr *TaskRunner) Run() error {
 
 		mu.Lock()
 		for name, outputTable := range taskOutputs {
-			tr.Outputs[name] = luainterface.LuaTableToGoMap(tr.L, outputTable)
+			tr.Outputs[name] = luainterface.LuaValueToGo(outputTable)
 		}
 		mu.Unlock()
 
-		shouldClean := true
-		if group.CleanWorkdirAfterRunFunc != nil {
+		shouldClean := tr.WorkdirOverride == ""
+		if shouldClean && group.CleanWorkdirAfterRunFunc != nil {
 			L := lua.NewState()
 			defer L.Close()
 			luainterface.OpenAll(L)
@@ -588,7 +633,8 @@ func (tr *TaskRunner) Run() error {
 		if result.Error != nil {
 			status = pterm.Red(result.Status)
 			errStr = result.Error.Error()
-		} else if result.Status == "Skipped" {
+		}
+		if result.Status == "Skipped" || result.Status == "Cancelled" {
 			status = pterm.Yellow(result.Status)
 		} else if result.Status == "DryRun" {
 			status = pterm.Cyan(result.Status)
@@ -1,9 +1,13 @@
 package taskrunner
 
 import (
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/chalkan3/sloth-runner/internal/luainterface"
 	"github.com/chalkan3/sloth-runner/internal/types"
+	pb "github.com/chalkan3/sloth-runner/proto"
 	"github.com/stretchr/testify/assert"
 	lua "github.com/yuin/gopher-lua"
 )
@@ -39,3 +43,82 @@ func TestRun_Failure_CircularDependency(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "circular dependency")
 }
+
+// TestMergeRemoteOutputs validates that outputs and exports returned by an agent behave like local ones.
+func TestMergeRemoteOutputs(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	task := &types.Task{Name: "remote"}
+	tr := NewTaskRunner(L, nil, "", nil, false, false, &DefaultSurveyAsker{}, "")
+	resp := &pb.ExecuteTaskResponse{
+		OutputJson:  `{"answer":42,"list":["x","y"]}`,
+		ExportsJson: `{"version":"1.2.3"}`,
+	}
+	assert.NoError(t, tr.mergeRemoteOutputs(L, task, resp))
+
+	assert.Equal(t, lua.LNumber(42), task.Output.RawGetString("answer"))
+	list, ok := task.Output.RawGetString("list").(*lua.LTable)
+	assert.True(t, ok)
+	assert.Equal(t, lua.LString("y"), list.RawGetInt(2))
+	assert.Equal(t, "1.2.3", tr.Exports["version"])
+
+	results := taskResultsFromProto(TaskResultsToProto([]types.TaskResult{
+		{Name: "remote", Status: "Failed", Duration: 1500 * time.Millisecond, Error: errors.New("boom"), Attempt: 1},
+	}))
+	assert.Equal(t, "boom", results[0].Error.Error())
+	assert.Equal(t, 1500*time.Millisecond, results[0].Duration)
+	assert.Equal(t, 1, results[0].Attempt)
+}
+
+// recordingObserver records the events of a run.
+type recordingObserver struct {
+	events  []string
+	results []types.TaskResult
+}
+
+func (o *recordingObserver) GroupStarted(group string, tasks []*types.Task) {
+	o.events = append(o.events, "group "+group)
+}
+
+func (o *recordingObserver) TaskStarted(group, task string, attempt int) {
+	o.events = append(o.events, "start "+task)
+}
+
+func (o *recordingObserver) TaskFinished(group string, result types.TaskResult) {
+	o.events = append(o.events, "finish "+result.Name)
+	o.results = append(o.results, result)
+}
+
+func (o *recordingObserver) ArtifactProduced(group, task, path string) {
+	o.events = append(o.events, "artifact "+task)
+}
+
+// TestRun_Observer validates that observers follow the run and receive the logs of each task.
+func TestRun_Observer(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	luainterface.OpenAll(L)
+
+	script := `
+TaskDefinitions = {
+  test_group = {
+    tasks = {
+      { name = "first", command = function() log.info("hello from first"); exec.run("echo out") return true, "ok" end },
+      { name = "second", depends_on = "first", command = function() return true, "ok" end },
+    },
+  },
+}`
+	groups, err := luainterface.LoadTaskDefinitions(L, script, "")
+	assert.NoError(t, err)
+
+	observer := &recordingObserver{}
+	tr := NewTaskRunner(L, groups, "test_group", nil, false, false, &DefaultSurveyAsker{}, "")
+	tr.Observer = observer
+	assert.NoError(t, tr.Run())
+
+	assert.Equal(t, []string{"group test_group", "start first", "finish first", "start second", "finish second"}, observer.events)
+	assert.Contains(t, observer.results[0].Logs, "hello from first")
+	assert.Contains(t, observer.results[0].Logs, "$ echo out\nout\n")
+	assert.Empty(t, observer.results[1].Logs)
+}
@@ -0,0 +1,121 @@
+package taskrunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/chalkan3/sloth-runner/internal/types"
+	"github.com/chalkan3/sloth-runner/internal/workspace"
+	pb "github.com/chalkan3/sloth-runner/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errLegacyAgent is returned when the agent does not implement incremental
+// workspace sync, so the caller has to fall back to a whole tarball.
+var errLegacyAgent = errors.New("agent does not support incremental workspace sync")
+
+// workspaceFilter picks the sync filter of a task, falling back to its group.
+func workspaceFilter(t *types.Task, group types.TaskGroup) workspace.Filter {
+	sync := group.WorkspaceSync
+	if t.WorkspaceSync != nil {
+		sync = t.WorkspaceSync
+	}
+	if sync == nil {
+		return workspace.Filter{}
+	}
+	return workspace.Filter{Include: sync.Include, Exclude: sync.Exclude}
+}
+
+// pushWorkspace uploads the files of root that changed since the last sync
+// to the agent workspace id, and deletes remote files that no longer exist
+// locally. It returns the local manifest that was synced.
+func pushWorkspace(ctx context.Context, c pb.AgentClient, id, root string, filter workspace.Filter) (workspace.Manifest, error) {
+	remote, err := c.GetWorkspaceManifest(ctx, &pb.WorkspaceManifestRequest{WorkspaceId: id})
+	if err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			return nil, errLegacyAgent
+		}
+		return nil, fmt.Errorf("failed to get workspace manifest: %w", err)
+	}
+
+	local, err := workspace.Scan(root, filter)
+	if err != nil {
+		return nil, err
+	}
+	// Files outside the filter are left alone on the agent.
+	remoteManifest := workspace.ManifestFromProto(remote.GetFiles())
+	for path := range remoteManifest {
+		if !filter.Match(path) {
+			delete(remoteManifest, path)
+		}
+	}
+	changed, deleted := workspace.Diff(local, remoteManifest)
+
+	stream, err := c.SyncWorkspace(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workspace upload: %w", err)
+	}
+	if err := stream.Send(&pb.WorkspaceChunk{WorkspaceId: id, Deleted: deleted}); err != nil {
+		return nil, fmt.Errorf("failed to send workspace header: %w", err)
+	}
+	cw := workspace.NewChunkWriter(workspace.ChunkSize, func(data []byte) error {
+		return stream.Send(&pb.WorkspaceChunk{Data: data})
+	})
+	if err := workspace.Pack(root, changed, cw); err != nil {
+		return nil, fmt.Errorf("failed to pack workspace: %w", err)
+	}
+	if err := cw.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to send workspace: %w", err)
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload workspace: %w", err)
+	}
+	slog.Debug("workspace uploaded", "workspace", id, "changed", len(changed), "deleted", resp.GetFilesDeleted(), "bytes", cw.BytesWritten)
+	return local, nil
+}
+
+// pullWorkspace downloads the files the agent changed in workspace id and
+// removes the local files the agent deleted. known is the manifest that was
+// pushed before the task ran.
+func pullWorkspace(ctx context.Context, c pb.AgentClient, id, root string, filter workspace.Filter, known workspace.Manifest) error {
+	stream, err := c.FetchWorkspace(ctx, &pb.FetchWorkspaceRequest{
+		WorkspaceId: id,
+		Known:       known.Proto(),
+		Include:     filter.Include,
+		Exclude:     filter.Exclude,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch workspace: %w", err)
+	}
+
+	header, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("failed to receive workspace header: %w", err)
+	}
+	if err := workspace.Remove(root, header.GetDeleted()); err != nil {
+		return fmt.Errorf("failed to apply remote deletions: %w", err)
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	cr := workspace.NewChunkReader(func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.GetData(), nil
+	})
+	written, err := workspace.Unpack(cr, root)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to unpack workspace: %w", err)
+	}
+	slog.Debug("workspace downloaded", "workspace", id, "written", written, "deleted", len(header.GetDeleted()), "bytes", cr.BytesRead)
+	return nil
+}
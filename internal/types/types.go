@@ -30,6 +30,20 @@ type Task struct {
 	AbortIfFunc *lua.LFunction
 	Output      *lua.LTable
 	DelegateTo  interface{} // Can be string (agent name) or map (inline agent definition)
+	// WorkspaceSync overrides the group's sync filter when the task is delegated.
+	WorkspaceSync *WorkspaceSync
+	// ForwardEnv names the variables of the caller's environment shipped to
+	// agents with delegated tasks.
+	ForwardEnv []string
+	// Schedule is the scheduled task declared by the schedule and triggers
+	// fields, as scheduler.yaml fields, for scheduler sync. Nil when none.
+	Schedule map[string]interface{}
+}
+
+// WorkspaceSync selects which workdir files are synced to and from agents.
+type WorkspaceSync struct {
+	Include []string
+	Exclude []string
 }
 
 // TaskGroup represents a collection of related tasks.
@@ -40,6 +54,9 @@ type TaskGroup struct {
 	CreateWorkdirBeforeRun   bool
 	CleanWorkdirAfterRunFunc *lua.LFunction
 	DelegateTo               interface{} `yaml:"delegate_to"` // Can be map[string]Agent or string (default agent)
+	WorkspaceSync            *WorkspaceSync
+	ForwardEnv               []string               // Like Task.ForwardEnv, for every task of the group
+	Schedule                 map[string]interface{} // Like Task.Schedule, running the whole group
 }
 
 // TaskResult holds the outcome of a single task execution.
@@ -48,15 +65,19 @@ type TaskResult struct {
 	Status   string
 	Duration time.Duration
 	Error    error
+	Attempt  int    // 1-based attempt that produced this result
+	Logs     string // log.* messages and exec.run output of the attempt
 }
 
 // SharedSession holds data that can be shared between tasks in a group.
 type SharedSession struct {
 	Workdir string
-	Cmd     *exec.Cmd
-	Stdin   io.WriteCloser
-	Stdout  io.ReadCloser
-	Stderr  io.ReadCloser
+	// WorkspaceID names the copy of Workdir kept on agents by delegated tasks.
+	WorkspaceID string
+	Cmd         *exec.Cmd
+	Stdin       io.WriteCloser
+	Stdout      io.ReadCloser
+	Stderr      io.ReadCloser
 }
 
 // TaskRunner is the interface for the main task execution engine.
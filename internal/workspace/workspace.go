@@ -0,0 +1,357 @@
+package workspace
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pb "github.com/chalkan3/sloth-runner/proto"
+)
+
+// ChunkSize is the size of the data chunks workspaces are streamed in. It
+// keeps every gRPC message well below the default 4MB limit.
+const ChunkSize = 1 << 20
+
+// File describes a single file in a workspace.
+type File struct {
+	Path string // Slash-separated path relative to the workspace root
+	Hash string // Hex-encoded SHA-256 of the content
+	Mode os.FileMode
+	Size int64
+}
+
+// Manifest maps relative paths to the files of a workspace.
+type Manifest map[string]File
+
+// ManifestFromProto builds a manifest from its wire representation.
+func ManifestFromProto(files []*pb.WorkspaceFile) Manifest {
+	manifest := make(Manifest, len(files))
+	for _, f := range files {
+		manifest[f.GetPath()] = File{Path: f.GetPath(), Hash: f.GetHash(), Mode: os.FileMode(f.GetMode()), Size: f.GetSize()}
+	}
+	return manifest
+}
+
+// Proto returns the wire representation of the manifest, sorted by path.
+func (m Manifest) Proto() []*pb.WorkspaceFile {
+	files := make([]*pb.WorkspaceFile, 0, len(m))
+	for _, f := range m {
+		files = append(files, &pb.WorkspaceFile{Path: f.Path, Hash: f.Hash, Mode: uint32(f.Mode), Size: f.Size})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// Filter selects which workspace files are synced. An empty Include list
+// selects everything; Exclude always wins over Include.
+type Filter struct {
+	Include []string
+	Exclude []string
+}
+
+// Match reports whether the relative path passes the filter.
+func (f Filter) Match(rel string) bool {
+	for _, pattern := range f.Exclude {
+		if matchPattern(pattern, rel) {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, pattern := range f.Include {
+		if matchPattern(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern matches a glob against a relative path. Patterns without a
+// slash match the base name at any depth (like .gitignore), and patterns
+// ending in "/" or "/**" match everything below that directory.
+func matchPattern(pattern, rel string) bool {
+	pattern = filepath.ToSlash(pattern)
+	if strings.HasSuffix(pattern, "/**") || strings.HasSuffix(pattern, "/") {
+		dir := strings.TrimSuffix(strings.TrimSuffix(pattern, "**"), "/")
+		if ok, _ := filepath.Match(dir, rel); ok {
+			return true
+		}
+		for parent := filepath.ToSlash(filepath.Dir(rel)); parent != "." && parent != "/"; parent = filepath.ToSlash(filepath.Dir(parent)) {
+			if ok, _ := filepath.Match(dir, parent); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if ok, _ := filepath.Match(pattern, rel); ok {
+		return true
+	}
+	if !strings.Contains(pattern, "/") {
+		if ok, _ := filepath.Match(pattern, filepath.Base(rel)); ok {
+			return true
+		}
+		for _, part := range strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/") {
+			if ok, _ := filepath.Match(pattern, part); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Scan walks root and builds a manifest of the regular files that pass the filter.
+func Scan(root string, filter Filter) (Manifest, error) {
+	manifest := make(Manifest)
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return manifest, nil
+	}
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !filter.Match(rel) {
+			return nil
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		manifest[rel] = File{Path: rel, Hash: hash, Mode: fi.Mode().Perm(), Size: fi.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan workspace %s: %w", root, err)
+	}
+	return manifest, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Diff compares the source manifest against what the destination already
+// has. It returns the paths that must be sent (new or modified) and the
+// paths the destination must delete, both sorted.
+func Diff(source, destination Manifest) (changed, deleted []string) {
+	for path, file := range source {
+		if existing, ok := destination[path]; !ok || existing.Hash != file.Hash || existing.Mode != file.Mode {
+			changed = append(changed, path)
+		}
+	}
+	for path := range destination {
+		if _, ok := source[path]; !ok {
+			deleted = append(deleted, path)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(deleted)
+	return changed, deleted
+}
+
+// Pack writes the given files from root as a gzip-compressed tarball.
+func Pack(root string, paths []string, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, rel := range paths {
+		if err := addFile(tw, root, rel); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addFile(tw *tar.Writer, root, rel string) error {
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Unpack extracts a tarball produced by Pack into dest and returns the
+// number of files written. Entries that would escape dest are rejected.
+func Unpack(r io.Reader, dest string) (int, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		if err == io.EOF {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	written := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+		target, err := safeJoin(dest, header.Name)
+		if err != nil {
+			return written, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return written, err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+		if err != nil {
+			return written, err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return written, err
+		}
+		if err := f.Close(); err != nil {
+			return written, err
+		}
+		// OpenFile only applies the mode to new files.
+		if err := os.Chmod(target, os.FileMode(header.Mode).Perm()); err != nil {
+			return written, err
+		}
+		written++
+	}
+}
+
+// Remove deletes the given relative paths from root, ignoring files that are already gone.
+func Remove(root string, paths []string) error {
+	for _, rel := range paths {
+		target, err := safeJoin(root, rel)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func safeJoin(root, rel string) (string, error) {
+	target := filepath.Join(root, filepath.FromSlash(rel))
+	if target != filepath.Clean(root) && !strings.HasPrefix(target, filepath.Clean(root)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("path %q escapes the workspace", rel)
+	}
+	return target, nil
+}
+
+// ChunkWriter buffers writes and hands them to send in chunks of at most size bytes.
+type ChunkWriter struct {
+	send func([]byte) error
+	buf  []byte
+	size int
+	// BytesWritten counts the bytes passed to send.
+	BytesWritten int64
+}
+
+// NewChunkWriter creates a ChunkWriter that flushes every size bytes.
+func NewChunkWriter(size int, send func([]byte) error) *ChunkWriter {
+	return &ChunkWriter{send: send, size: size, buf: make([]byte, 0, size)}
+}
+
+func (w *ChunkWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		room := w.size - len(w.buf)
+		if room > len(p) {
+			room = len(p)
+		}
+		w.buf = append(w.buf, p[:room]...)
+		p = p[room:]
+		if len(w.buf) == w.size {
+			if err := w.Flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Flush sends any buffered data.
+func (w *ChunkWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	chunk := make([]byte, len(w.buf))
+	copy(chunk, w.buf)
+	w.buf = w.buf[:0]
+	w.BytesWritten += int64(len(chunk))
+	return w.send(chunk)
+}
+
+// ChunkReader turns a sequence of received chunks back into a stream. recv
+// returns io.EOF once the sender is done.
+type ChunkReader struct {
+	recv func() ([]byte, error)
+	buf  []byte
+	// BytesRead counts the bytes received.
+	BytesRead int64
+}
+
+// NewChunkReader creates a ChunkReader on top of recv.
+func NewChunkReader(recv func() ([]byte, error)) *ChunkReader {
+	return &ChunkReader{recv: recv}
+}
+
+func (r *ChunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.BytesRead += int64(len(chunk))
+		r.buf = chunk
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
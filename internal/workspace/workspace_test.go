@@ -0,0 +1,108 @@
+package workspace
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, root, rel, content string) {
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestFilterMatch(t *testing.T) {
+	filter := Filter{Include: []string{"src/", "go.mod"}, Exclude: []string{"*.log", "vendor/**"}}
+
+	assert.True(t, filter.Match("go.mod"))
+	assert.True(t, filter.Match("src/main.go"))
+	assert.True(t, filter.Match("src/pkg/util.go"))
+	assert.False(t, filter.Match("src/debug.log"))
+	assert.False(t, filter.Match("README.md"))
+	assert.False(t, Filter{Exclude: []string{"vendor/**"}}.Match("vendor/lib/a.go"))
+	assert.False(t, Filter{Exclude: []string{"node_modules"}}.Match("web/node_modules/x.js"))
+	assert.True(t, Filter{}.Match("anything/at/all"))
+}
+
+func TestDiff(t *testing.T) {
+	source := Manifest{
+		"same.txt":    {Path: "same.txt", Hash: "a", Mode: 0644},
+		"changed.txt": {Path: "changed.txt", Hash: "b", Mode: 0644},
+		"new.txt":     {Path: "new.txt", Hash: "c", Mode: 0644},
+		"chmod.sh":    {Path: "chmod.sh", Hash: "d", Mode: 0755},
+	}
+	destination := Manifest{
+		"same.txt":    {Path: "same.txt", Hash: "a", Mode: 0644},
+		"changed.txt": {Path: "changed.txt", Hash: "old", Mode: 0644},
+		"chmod.sh":    {Path: "chmod.sh", Hash: "d", Mode: 0644},
+		"gone.txt":    {Path: "gone.txt", Hash: "e", Mode: 0644},
+	}
+
+	changed, deleted := Diff(source, destination)
+	assert.Equal(t, []string{"changed.txt", "chmod.sh", "new.txt"}, changed)
+	assert.Equal(t, []string{"gone.txt"}, deleted)
+}
+
+func TestIncrementalSyncRoundTrip(t *testing.T) {
+	src, _ := ioutil.TempDir("", "workspace-src-")
+	defer os.RemoveAll(src)
+	dst, _ := ioutil.TempDir("", "workspace-dst-")
+	defer os.RemoveAll(dst)
+
+	writeFile(t, src, "a.txt", "hello")
+	writeFile(t, src, "dir/b.txt", "world")
+	writeFile(t, dst, "a.txt", "hello")
+	writeFile(t, dst, "stale.txt", "remove me")
+
+	local, err := Scan(src, Filter{})
+	assert.NoError(t, err)
+	remote, err := Scan(dst, Filter{})
+	assert.NoError(t, err)
+	changed, deleted := Diff(local, remote)
+	assert.Equal(t, []string{"dir/b.txt"}, changed)
+	assert.Equal(t, []string{"stale.txt"}, deleted)
+
+	// Stream through tiny chunks to exercise chunk boundaries.
+	var chunks [][]byte
+	cw := NewChunkWriter(16, func(chunk []byte) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	assert.NoError(t, Pack(src, changed, cw))
+	assert.NoError(t, cw.Flush())
+	assert.True(t, len(chunks) > 1)
+	for _, chunk := range chunks {
+		assert.True(t, len(chunk) <= 16)
+	}
+
+	cr := NewChunkReader(func() ([]byte, error) {
+		if len(chunks) == 0 {
+			return nil, io.EOF
+		}
+		chunk := chunks[0]
+		chunks = chunks[1:]
+		return chunk, nil
+	})
+	written, err := Unpack(cr, dst)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, written)
+	assert.Equal(t, cw.BytesWritten, cr.BytesRead)
+	assert.NoError(t, Remove(dst, deleted))
+
+	synced, err := Scan(dst, Filter{})
+	assert.NoError(t, err)
+	assert.Equal(t, local, synced)
+}
+
+func TestRemoveRejectsEscapingPaths(t *testing.T) {
+	dst, _ := ioutil.TempDir("", "workspace-dst-")
+	defer os.RemoveAll(dst)
+
+	assert.Error(t, Remove(dst, []string{"../outside.txt"}))
+	assert.NoError(t, Remove(dst, []string{"missing.txt"}))
+}
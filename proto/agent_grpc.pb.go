@@ -19,9 +19,17 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Agent_ExecuteTask_FullMethodName = "/agent.Agent/ExecuteTask"
-	Agent_RunCommand_FullMethodName  = "/agent.Agent/RunCommand"
-	Agent_Shutdown_FullMethodName    = "/agent.Agent/Shutdown"
+	Agent_ExecuteTask_FullMethodName          = "/agent.Agent/ExecuteTask"
+	Agent_RunCommand_FullMethodName           = "/agent.Agent/RunCommand"
+	Agent_Shutdown_FullMethodName             = "/agent.Agent/Shutdown"
+	Agent_GetWorkspaceManifest_FullMethodName = "/agent.Agent/GetWorkspaceManifest"
+	Agent_SyncWorkspace_FullMethodName        = "/agent.Agent/SyncWorkspace"
+	Agent_FetchWorkspace_FullMethodName       = "/agent.Agent/FetchWorkspace"
+	Agent_CancelTask_FullMethodName           = "/agent.Agent/CancelTask"
+	Agent_Shell_FullMethodName                = "/agent.Agent/Shell"
+	Agent_PutFile_FullMethodName              = "/agent.Agent/PutFile"
+	Agent_GetFile_FullMethodName              = "/agent.Agent/GetFile"
+	Agent_Upgrade_FullMethodName              = "/agent.Agent/Upgrade"
 )
 
 // AgentClient is the client API for Agent service.
@@ -31,6 +39,14 @@ type AgentClient interface {
 	ExecuteTask(ctx context.Context, in *ExecuteTaskRequest, opts ...grpc.CallOption) (*ExecuteTaskResponse, error)
 	RunCommand(ctx context.Context, in *RunCommandRequest, opts ...grpc.CallOption) (*RunCommandResponse, error)
 	Shutdown(ctx context.Context, in *ShutdownRequest, opts ...grpc.CallOption) (*ShutdownResponse, error)
+	GetWorkspaceManifest(ctx context.Context, in *WorkspaceManifestRequest, opts ...grpc.CallOption) (*WorkspaceManifest, error)
+	SyncWorkspace(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[WorkspaceChunk, SyncWorkspaceResponse], error)
+	FetchWorkspace(ctx context.Context, in *FetchWorkspaceRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WorkspaceChunk], error)
+	CancelTask(ctx context.Context, in *CancelTaskRequest, opts ...grpc.CallOption) (*CancelTaskResponse, error)
+	Shell(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ShellInput, ShellOutput], error)
+	PutFile(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[FileChunk, PutFileResponse], error)
+	GetFile(ctx context.Context, in *GetFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileChunk], error)
+	Upgrade(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[FileChunk, UpgradeResponse], error)
 }
 
 type agentClient struct {
@@ -71,6 +87,116 @@ func (c *agentClient) Shutdown(ctx context.Context, in *ShutdownRequest, opts ..
 	return out, nil
 }
 
+func (c *agentClient) GetWorkspaceManifest(ctx context.Context, in *WorkspaceManifestRequest, opts ...grpc.CallOption) (*WorkspaceManifest, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WorkspaceManifest)
+	err := c.cc.Invoke(ctx, Agent_GetWorkspaceManifest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) SyncWorkspace(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[WorkspaceChunk, SyncWorkspaceResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Agent_ServiceDesc.Streams[0], Agent_SyncWorkspace_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WorkspaceChunk, SyncWorkspaceResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_SyncWorkspaceClient = grpc.ClientStreamingClient[WorkspaceChunk, SyncWorkspaceResponse]
+
+func (c *agentClient) FetchWorkspace(ctx context.Context, in *FetchWorkspaceRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WorkspaceChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Agent_ServiceDesc.Streams[1], Agent_FetchWorkspace_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[FetchWorkspaceRequest, WorkspaceChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_FetchWorkspaceClient = grpc.ServerStreamingClient[WorkspaceChunk]
+
+func (c *agentClient) CancelTask(ctx context.Context, in *CancelTaskRequest, opts ...grpc.CallOption) (*CancelTaskResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CancelTaskResponse)
+	err := c.cc.Invoke(ctx, Agent_CancelTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentClient) Shell(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ShellInput, ShellOutput], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Agent_ServiceDesc.Streams[2], Agent_Shell_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ShellInput, ShellOutput]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_ShellClient = grpc.BidiStreamingClient[ShellInput, ShellOutput]
+
+func (c *agentClient) PutFile(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[FileChunk, PutFileResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Agent_ServiceDesc.Streams[3], Agent_PutFile_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[FileChunk, PutFileResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_PutFileClient = grpc.ClientStreamingClient[FileChunk, PutFileResponse]
+
+func (c *agentClient) GetFile(ctx context.Context, in *GetFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Agent_ServiceDesc.Streams[4], Agent_GetFile_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetFileRequest, FileChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_GetFileClient = grpc.ServerStreamingClient[FileChunk]
+
+func (c *agentClient) Upgrade(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[FileChunk, UpgradeResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Agent_ServiceDesc.Streams[5], Agent_Upgrade_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[FileChunk, UpgradeResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_UpgradeClient = grpc.ClientStreamingClient[FileChunk, UpgradeResponse]
+
 // AgentServer is the server API for Agent service.
 // All implementations must embed UnimplementedAgentServer
 // for forward compatibility.
@@ -78,6 +204,14 @@ type AgentServer interface {
 	ExecuteTask(context.Context, *ExecuteTaskRequest) (*ExecuteTaskResponse, error)
 	RunCommand(context.Context, *RunCommandRequest) (*RunCommandResponse, error)
 	Shutdown(context.Context, *ShutdownRequest) (*ShutdownResponse, error)
+	GetWorkspaceManifest(context.Context, *WorkspaceManifestRequest) (*WorkspaceManifest, error)
+	SyncWorkspace(grpc.ClientStreamingServer[WorkspaceChunk, SyncWorkspaceResponse]) error
+	FetchWorkspace(*FetchWorkspaceRequest, grpc.ServerStreamingServer[WorkspaceChunk]) error
+	CancelTask(context.Context, *CancelTaskRequest) (*CancelTaskResponse, error)
+	Shell(grpc.BidiStreamingServer[ShellInput, ShellOutput]) error
+	PutFile(grpc.ClientStreamingServer[FileChunk, PutFileResponse]) error
+	GetFile(*GetFileRequest, grpc.ServerStreamingServer[FileChunk]) error
+	Upgrade(grpc.ClientStreamingServer[FileChunk, UpgradeResponse]) error
 	mustEmbedUnimplementedAgentServer()
 }
 
@@ -97,6 +231,30 @@ func (UnimplementedAgentServer) RunCommand(context.Context, *RunCommandRequest)
 func (UnimplementedAgentServer) Shutdown(context.Context, *ShutdownRequest) (*ShutdownResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Shutdown not implemented")
 }
+func (UnimplementedAgentServer) GetWorkspaceManifest(context.Context, *WorkspaceManifestRequest) (*WorkspaceManifest, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetWorkspaceManifest not implemented")
+}
+func (UnimplementedAgentServer) SyncWorkspace(grpc.ClientStreamingServer[WorkspaceChunk, SyncWorkspaceResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method SyncWorkspace not implemented")
+}
+func (UnimplementedAgentServer) FetchWorkspace(*FetchWorkspaceRequest, grpc.ServerStreamingServer[WorkspaceChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method FetchWorkspace not implemented")
+}
+func (UnimplementedAgentServer) CancelTask(context.Context, *CancelTaskRequest) (*CancelTaskResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelTask not implemented")
+}
+func (UnimplementedAgentServer) Shell(grpc.BidiStreamingServer[ShellInput, ShellOutput]) error {
+	return status.Errorf(codes.Unimplemented, "method Shell not implemented")
+}
+func (UnimplementedAgentServer) PutFile(grpc.ClientStreamingServer[FileChunk, PutFileResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method PutFile not implemented")
+}
+func (UnimplementedAgentServer) GetFile(*GetFileRequest, grpc.ServerStreamingServer[FileChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method GetFile not implemented")
+}
+func (UnimplementedAgentServer) Upgrade(grpc.ClientStreamingServer[FileChunk, UpgradeResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Upgrade not implemented")
+}
 func (UnimplementedAgentServer) mustEmbedUnimplementedAgentServer() {}
 func (UnimplementedAgentServer) testEmbeddedByValue()               {}
 
@@ -172,6 +330,92 @@ func _Agent_Shutdown_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Agent_GetWorkspaceManifest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WorkspaceManifestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).GetWorkspaceManifest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_GetWorkspaceManifest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).GetWorkspaceManifest(ctx, req.(*WorkspaceManifestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_SyncWorkspace_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServer).SyncWorkspace(&grpc.GenericServerStream[WorkspaceChunk, SyncWorkspaceResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_SyncWorkspaceServer = grpc.ClientStreamingServer[WorkspaceChunk, SyncWorkspaceResponse]
+
+func _Agent_FetchWorkspace_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FetchWorkspaceRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AgentServer).FetchWorkspace(m, &grpc.GenericServerStream[FetchWorkspaceRequest, WorkspaceChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_FetchWorkspaceServer = grpc.ServerStreamingServer[WorkspaceChunk]
+
+func _Agent_CancelTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).CancelTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_CancelTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).CancelTask(ctx, req.(*CancelTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agent_Shell_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServer).Shell(&grpc.GenericServerStream[ShellInput, ShellOutput]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_ShellServer = grpc.BidiStreamingServer[ShellInput, ShellOutput]
+
+func _Agent_PutFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServer).PutFile(&grpc.GenericServerStream[FileChunk, PutFileResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_PutFileServer = grpc.ClientStreamingServer[FileChunk, PutFileResponse]
+
+func _Agent_GetFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetFileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AgentServer).GetFile(m, &grpc.GenericServerStream[GetFileRequest, FileChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_GetFileServer = grpc.ServerStreamingServer[FileChunk]
+
+func _Agent_Upgrade_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServer).Upgrade(&grpc.GenericServerStream[FileChunk, UpgradeResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Agent_UpgradeServer = grpc.ClientStreamingServer[FileChunk, UpgradeResponse]
+
 // Agent_ServiceDesc is the grpc.ServiceDesc for Agent service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -191,17 +435,72 @@ var Agent_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Shutdown",
 			Handler:    _Agent_Shutdown_Handler,
 		},
+		{
+			MethodName: "GetWorkspaceManifest",
+			Handler:    _Agent_GetWorkspaceManifest_Handler,
+		},
+		{
+			MethodName: "CancelTask",
+			Handler:    _Agent_CancelTask_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SyncWorkspace",
+			Handler:       _Agent_SyncWorkspace_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "FetchWorkspace",
+			Handler:       _Agent_FetchWorkspace_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Shell",
+			Handler:       _Agent_Shell_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "PutFile",
+			Handler:       _Agent_PutFile_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "GetFile",
+			Handler:       _Agent_GetFile_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Upgrade",
+			Handler:       _Agent_Upgrade_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/agent.proto",
 }
 
 const (
-	AgentRegistry_RegisterAgent_FullMethodName  = "/agent.AgentRegistry/RegisterAgent"
-	AgentRegistry_ListAgents_FullMethodName     = "/agent.AgentRegistry/ListAgents"
-	AgentRegistry_StopAgent_FullMethodName      = "/agent.AgentRegistry/StopAgent"
-	AgentRegistry_ExecuteCommand_FullMethodName = "/agent.AgentRegistry/ExecuteCommand"
-	AgentRegistry_Heartbeat_FullMethodName      = "/agent.AgentRegistry/Heartbeat"
+	AgentRegistry_RegisterAgent_FullMethodName     = "/agent.AgentRegistry/RegisterAgent"
+	AgentRegistry_ListAgents_FullMethodName        = "/agent.AgentRegistry/ListAgents"
+	AgentRegistry_StopAgent_FullMethodName         = "/agent.AgentRegistry/StopAgent"
+	AgentRegistry_ExecuteCommand_FullMethodName    = "/agent.AgentRegistry/ExecuteCommand"
+	AgentRegistry_Heartbeat_FullMethodName         = "/agent.AgentRegistry/Heartbeat"
+	AgentRegistry_SubmitJob_FullMethodName         = "/agent.AgentRegistry/SubmitJob"
+	AgentRegistry_PullJobs_FullMethodName          = "/agent.AgentRegistry/PullJobs"
+	AgentRegistry_CompleteJob_FullMethodName       = "/agent.AgentRegistry/CompleteJob"
+	AgentRegistry_ListJobs_FullMethodName          = "/agent.AgentRegistry/ListJobs"
+	AgentRegistry_GetJob_FullMethodName            = "/agent.AgentRegistry/GetJob"
+	AgentRegistry_ReportWorkflowRun_FullMethodName = "/agent.AgentRegistry/ReportWorkflowRun"
+	AgentRegistry_UploadArtifact_FullMethodName    = "/agent.AgentRegistry/UploadArtifact"
+	AgentRegistry_ListWorkflowRuns_FullMethodName  = "/agent.AgentRegistry/ListWorkflowRuns"
+	AgentRegistry_GetWorkflowRun_FullMethodName    = "/agent.AgentRegistry/GetWorkflowRun"
+	AgentRegistry_GetArtifact_FullMethodName       = "/agent.AgentRegistry/GetArtifact"
+	AgentRegistry_CancelJob_FullMethodName         = "/agent.AgentRegistry/CancelJob"
+	AgentRegistry_AgentShell_FullMethodName        = "/agent.AgentRegistry/AgentShell"
+	AgentRegistry_PutAgentFile_FullMethodName      = "/agent.AgentRegistry/PutAgentFile"
+	AgentRegistry_GetAgentFile_FullMethodName      = "/agent.AgentRegistry/GetAgentFile"
+	AgentRegistry_UpgradeAgent_FullMethodName      = "/agent.AgentRegistry/UpgradeAgent"
 )
 
 // AgentRegistryClient is the client API for AgentRegistry service.
@@ -213,6 +512,21 @@ type AgentRegistryClient interface {
 	StopAgent(ctx context.Context, in *StopAgentRequest, opts ...grpc.CallOption) (*StopAgentResponse, error)
 	ExecuteCommand(ctx context.Context, in *ExecuteCommandRequest, opts ...grpc.CallOption) (*ExecuteCommandResponse, error)
 	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
+	SubmitJob(ctx context.Context, in *SubmitJobRequest, opts ...grpc.CallOption) (*SubmitJobResponse, error)
+	PullJobs(ctx context.Context, in *PullJobsRequest, opts ...grpc.CallOption) (*PullJobsResponse, error)
+	CompleteJob(ctx context.Context, in *CompleteJobRequest, opts ...grpc.CallOption) (*CompleteJobResponse, error)
+	ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error)
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	ReportWorkflowRun(ctx context.Context, in *WorkflowRun, opts ...grpc.CallOption) (*ReportWorkflowRunResponse, error)
+	UploadArtifact(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ArtifactChunk, UploadArtifactResponse], error)
+	ListWorkflowRuns(ctx context.Context, in *ListWorkflowRunsRequest, opts ...grpc.CallOption) (*ListWorkflowRunsResponse, error)
+	GetWorkflowRun(ctx context.Context, in *GetWorkflowRunRequest, opts ...grpc.CallOption) (*WorkflowRun, error)
+	GetArtifact(ctx context.Context, in *GetArtifactRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ArtifactChunk], error)
+	CancelJob(ctx context.Context, in *CancelJobRequest, opts ...grpc.CallOption) (*CancelJobResponse, error)
+	AgentShell(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ShellInput, ShellOutput], error)
+	PutAgentFile(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[FileChunk, PutFileResponse], error)
+	GetAgentFile(ctx context.Context, in *GetFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileChunk], error)
+	UpgradeAgent(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[UpgradeAgentChunk, UpgradeAgentResult], error)
 }
 
 type agentRegistryClient struct {
@@ -273,6 +587,186 @@ func (c *agentRegistryClient) Heartbeat(ctx context.Context, in *HeartbeatReques
 	return out, nil
 }
 
+func (c *agentRegistryClient) SubmitJob(ctx context.Context, in *SubmitJobRequest, opts ...grpc.CallOption) (*SubmitJobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SubmitJobResponse)
+	err := c.cc.Invoke(ctx, AgentRegistry_SubmitJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentRegistryClient) PullJobs(ctx context.Context, in *PullJobsRequest, opts ...grpc.CallOption) (*PullJobsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PullJobsResponse)
+	err := c.cc.Invoke(ctx, AgentRegistry_PullJobs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentRegistryClient) CompleteJob(ctx context.Context, in *CompleteJobRequest, opts ...grpc.CallOption) (*CompleteJobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CompleteJobResponse)
+	err := c.cc.Invoke(ctx, AgentRegistry_CompleteJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentRegistryClient) ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListJobsResponse)
+	err := c.cc.Invoke(ctx, AgentRegistry_ListJobs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentRegistryClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, AgentRegistry_GetJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentRegistryClient) ReportWorkflowRun(ctx context.Context, in *WorkflowRun, opts ...grpc.CallOption) (*ReportWorkflowRunResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReportWorkflowRunResponse)
+	err := c.cc.Invoke(ctx, AgentRegistry_ReportWorkflowRun_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentRegistryClient) UploadArtifact(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ArtifactChunk, UploadArtifactResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AgentRegistry_ServiceDesc.Streams[0], AgentRegistry_UploadArtifact_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ArtifactChunk, UploadArtifactResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentRegistry_UploadArtifactClient = grpc.ClientStreamingClient[ArtifactChunk, UploadArtifactResponse]
+
+func (c *agentRegistryClient) ListWorkflowRuns(ctx context.Context, in *ListWorkflowRunsRequest, opts ...grpc.CallOption) (*ListWorkflowRunsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListWorkflowRunsResponse)
+	err := c.cc.Invoke(ctx, AgentRegistry_ListWorkflowRuns_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentRegistryClient) GetWorkflowRun(ctx context.Context, in *GetWorkflowRunRequest, opts ...grpc.CallOption) (*WorkflowRun, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WorkflowRun)
+	err := c.cc.Invoke(ctx, AgentRegistry_GetWorkflowRun_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentRegistryClient) GetArtifact(ctx context.Context, in *GetArtifactRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ArtifactChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AgentRegistry_ServiceDesc.Streams[1], AgentRegistry_GetArtifact_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetArtifactRequest, ArtifactChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentRegistry_GetArtifactClient = grpc.ServerStreamingClient[ArtifactChunk]
+
+func (c *agentRegistryClient) CancelJob(ctx context.Context, in *CancelJobRequest, opts ...grpc.CallOption) (*CancelJobResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CancelJobResponse)
+	err := c.cc.Invoke(ctx, AgentRegistry_CancelJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentRegistryClient) AgentShell(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ShellInput, ShellOutput], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AgentRegistry_ServiceDesc.Streams[2], AgentRegistry_AgentShell_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ShellInput, ShellOutput]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentRegistry_AgentShellClient = grpc.BidiStreamingClient[ShellInput, ShellOutput]
+
+func (c *agentRegistryClient) PutAgentFile(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[FileChunk, PutFileResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AgentRegistry_ServiceDesc.Streams[3], AgentRegistry_PutAgentFile_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[FileChunk, PutFileResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentRegistry_PutAgentFileClient = grpc.ClientStreamingClient[FileChunk, PutFileResponse]
+
+func (c *agentRegistryClient) GetAgentFile(ctx context.Context, in *GetFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AgentRegistry_ServiceDesc.Streams[4], AgentRegistry_GetAgentFile_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetFileRequest, FileChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentRegistry_GetAgentFileClient = grpc.ServerStreamingClient[FileChunk]
+
+func (c *agentRegistryClient) UpgradeAgent(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[UpgradeAgentChunk, UpgradeAgentResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &AgentRegistry_ServiceDesc.Streams[5], AgentRegistry_UpgradeAgent_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UpgradeAgentChunk, UpgradeAgentResult]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentRegistry_UpgradeAgentClient = grpc.BidiStreamingClient[UpgradeAgentChunk, UpgradeAgentResult]
+
 // AgentRegistryServer is the server API for AgentRegistry service.
 // All implementations must embed UnimplementedAgentRegistryServer
 // for forward compatibility.
@@ -282,6 +776,21 @@ type AgentRegistryServer interface {
 	StopAgent(context.Context, *StopAgentRequest) (*StopAgentResponse, error)
 	ExecuteCommand(context.Context, *ExecuteCommandRequest) (*ExecuteCommandResponse, error)
 	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
+	SubmitJob(context.Context, *SubmitJobRequest) (*SubmitJobResponse, error)
+	PullJobs(context.Context, *PullJobsRequest) (*PullJobsResponse, error)
+	CompleteJob(context.Context, *CompleteJobRequest) (*CompleteJobResponse, error)
+	ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error)
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	ReportWorkflowRun(context.Context, *WorkflowRun) (*ReportWorkflowRunResponse, error)
+	UploadArtifact(grpc.ClientStreamingServer[ArtifactChunk, UploadArtifactResponse]) error
+	ListWorkflowRuns(context.Context, *ListWorkflowRunsRequest) (*ListWorkflowRunsResponse, error)
+	GetWorkflowRun(context.Context, *GetWorkflowRunRequest) (*WorkflowRun, error)
+	GetArtifact(*GetArtifactRequest, grpc.ServerStreamingServer[ArtifactChunk]) error
+	CancelJob(context.Context, *CancelJobRequest) (*CancelJobResponse, error)
+	AgentShell(grpc.BidiStreamingServer[ShellInput, ShellOutput]) error
+	PutAgentFile(grpc.ClientStreamingServer[FileChunk, PutFileResponse]) error
+	GetAgentFile(*GetFileRequest, grpc.ServerStreamingServer[FileChunk]) error
+	UpgradeAgent(grpc.BidiStreamingServer[UpgradeAgentChunk, UpgradeAgentResult]) error
 	mustEmbedUnimplementedAgentRegistryServer()
 }
 
@@ -307,6 +816,51 @@ func (UnimplementedAgentRegistryServer) ExecuteCommand(context.Context, *Execute
 func (UnimplementedAgentRegistryServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
 }
+func (UnimplementedAgentRegistryServer) SubmitJob(context.Context, *SubmitJobRequest) (*SubmitJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitJob not implemented")
+}
+func (UnimplementedAgentRegistryServer) PullJobs(context.Context, *PullJobsRequest) (*PullJobsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PullJobs not implemented")
+}
+func (UnimplementedAgentRegistryServer) CompleteJob(context.Context, *CompleteJobRequest) (*CompleteJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompleteJob not implemented")
+}
+func (UnimplementedAgentRegistryServer) ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListJobs not implemented")
+}
+func (UnimplementedAgentRegistryServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedAgentRegistryServer) ReportWorkflowRun(context.Context, *WorkflowRun) (*ReportWorkflowRunResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportWorkflowRun not implemented")
+}
+func (UnimplementedAgentRegistryServer) UploadArtifact(grpc.ClientStreamingServer[ArtifactChunk, UploadArtifactResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method UploadArtifact not implemented")
+}
+func (UnimplementedAgentRegistryServer) ListWorkflowRuns(context.Context, *ListWorkflowRunsRequest) (*ListWorkflowRunsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWorkflowRuns not implemented")
+}
+func (UnimplementedAgentRegistryServer) GetWorkflowRun(context.Context, *GetWorkflowRunRequest) (*WorkflowRun, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetWorkflowRun not implemented")
+}
+func (UnimplementedAgentRegistryServer) GetArtifact(*GetArtifactRequest, grpc.ServerStreamingServer[ArtifactChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method GetArtifact not implemented")
+}
+func (UnimplementedAgentRegistryServer) CancelJob(context.Context, *CancelJobRequest) (*CancelJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelJob not implemented")
+}
+func (UnimplementedAgentRegistryServer) AgentShell(grpc.BidiStreamingServer[ShellInput, ShellOutput]) error {
+	return status.Errorf(codes.Unimplemented, "method AgentShell not implemented")
+}
+func (UnimplementedAgentRegistryServer) PutAgentFile(grpc.ClientStreamingServer[FileChunk, PutFileResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method PutAgentFile not implemented")
+}
+func (UnimplementedAgentRegistryServer) GetAgentFile(*GetFileRequest, grpc.ServerStreamingServer[FileChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method GetAgentFile not implemented")
+}
+func (UnimplementedAgentRegistryServer) UpgradeAgent(grpc.BidiStreamingServer[UpgradeAgentChunk, UpgradeAgentResult]) error {
+	return status.Errorf(codes.Unimplemented, "method UpgradeAgent not implemented")
+}
 func (UnimplementedAgentRegistryServer) mustEmbedUnimplementedAgentRegistryServer() {}
 func (UnimplementedAgentRegistryServer) testEmbeddedByValue()                       {}
 
@@ -418,6 +972,218 @@ func _AgentRegistry_Heartbeat_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AgentRegistry_SubmitJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentRegistryServer).SubmitJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentRegistry_SubmitJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentRegistryServer).SubmitJob(ctx, req.(*SubmitJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentRegistry_PullJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PullJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentRegistryServer).PullJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentRegistry_PullJobs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentRegistryServer).PullJobs(ctx, req.(*PullJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentRegistry_CompleteJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompleteJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentRegistryServer).CompleteJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentRegistry_CompleteJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentRegistryServer).CompleteJob(ctx, req.(*CompleteJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentRegistry_ListJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentRegistryServer).ListJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentRegistry_ListJobs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentRegistryServer).ListJobs(ctx, req.(*ListJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentRegistry_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentRegistryServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentRegistry_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentRegistryServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentRegistry_ReportWorkflowRun_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WorkflowRun)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentRegistryServer).ReportWorkflowRun(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentRegistry_ReportWorkflowRun_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentRegistryServer).ReportWorkflowRun(ctx, req.(*WorkflowRun))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentRegistry_UploadArtifact_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentRegistryServer).UploadArtifact(&grpc.GenericServerStream[ArtifactChunk, UploadArtifactResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentRegistry_UploadArtifactServer = grpc.ClientStreamingServer[ArtifactChunk, UploadArtifactResponse]
+
+func _AgentRegistry_ListWorkflowRuns_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWorkflowRunsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentRegistryServer).ListWorkflowRuns(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentRegistry_ListWorkflowRuns_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentRegistryServer).ListWorkflowRuns(ctx, req.(*ListWorkflowRunsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentRegistry_GetWorkflowRun_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetWorkflowRunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentRegistryServer).GetWorkflowRun(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentRegistry_GetWorkflowRun_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentRegistryServer).GetWorkflowRun(ctx, req.(*GetWorkflowRunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentRegistry_GetArtifact_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetArtifactRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AgentRegistryServer).GetArtifact(m, &grpc.GenericServerStream[GetArtifactRequest, ArtifactChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentRegistry_GetArtifactServer = grpc.ServerStreamingServer[ArtifactChunk]
+
+func _AgentRegistry_CancelJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentRegistryServer).CancelJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentRegistry_CancelJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentRegistryServer).CancelJob(ctx, req.(*CancelJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentRegistry_AgentShell_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentRegistryServer).AgentShell(&grpc.GenericServerStream[ShellInput, ShellOutput]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentRegistry_AgentShellServer = grpc.BidiStreamingServer[ShellInput, ShellOutput]
+
+func _AgentRegistry_PutAgentFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentRegistryServer).PutAgentFile(&grpc.GenericServerStream[FileChunk, PutFileResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentRegistry_PutAgentFileServer = grpc.ClientStreamingServer[FileChunk, PutFileResponse]
+
+func _AgentRegistry_GetAgentFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetFileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AgentRegistryServer).GetAgentFile(m, &grpc.GenericServerStream[GetFileRequest, FileChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentRegistry_GetAgentFileServer = grpc.ServerStreamingServer[FileChunk]
+
+func _AgentRegistry_UpgradeAgent_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentRegistryServer).UpgradeAgent(&grpc.GenericServerStream[UpgradeAgentChunk, UpgradeAgentResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type AgentRegistry_UpgradeAgentServer = grpc.BidiStreamingServer[UpgradeAgentChunk, UpgradeAgentResult]
+
 // AgentRegistry_ServiceDesc is the grpc.ServiceDesc for AgentRegistry service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -445,7 +1211,76 @@ var AgentRegistry_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Heartbeat",
 			Handler:    _AgentRegistry_Heartbeat_Handler,
 		},
+		{
+			MethodName: "SubmitJob",
+			Handler:    _AgentRegistry_SubmitJob_Handler,
+		},
+		{
+			MethodName: "PullJobs",
+			Handler:    _AgentRegistry_PullJobs_Handler,
+		},
+		{
+			MethodName: "CompleteJob",
+			Handler:    _AgentRegistry_CompleteJob_Handler,
+		},
+		{
+			MethodName: "ListJobs",
+			Handler:    _AgentRegistry_ListJobs_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _AgentRegistry_GetJob_Handler,
+		},
+		{
+			MethodName: "ReportWorkflowRun",
+			Handler:    _AgentRegistry_ReportWorkflowRun_Handler,
+		},
+		{
+			MethodName: "ListWorkflowRuns",
+			Handler:    _AgentRegistry_ListWorkflowRuns_Handler,
+		},
+		{
+			MethodName: "GetWorkflowRun",
+			Handler:    _AgentRegistry_GetWorkflowRun_Handler,
+		},
+		{
+			MethodName: "CancelJob",
+			Handler:    _AgentRegistry_CancelJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "UploadArtifact",
+			Handler:       _AgentRegistry_UploadArtifact_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "GetArtifact",
+			Handler:       _AgentRegistry_GetArtifact_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "AgentShell",
+			Handler:       _AgentRegistry_AgentShell_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "PutAgentFile",
+			Handler:       _AgentRegistry_PutAgentFile_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "GetAgentFile",
+			Handler:       _AgentRegistry_GetAgentFile_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "UpgradeAgent",
+			Handler:       _AgentRegistry_UpgradeAgent_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/agent.proto",
 }